@@ -0,0 +1,303 @@
+// Package ast declares the types used to represent the syntax of configuration-style Ruby:
+// literals, hashes and arrays, method calls and their blocks, assignments, constants and
+// conditionals.
+package ast
+
+// A Node is any element of the syntax tree.  Positions are byte offsets into the source.
+type Node interface {
+	Pos() int
+	End() int
+}
+
+// An Expr is a node that produces a value; in Ruby, every statement does.
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// Span records where in the source a node begins and ends, and is embedded in every node.
+type Span struct {
+	Start int
+	Stop  int
+}
+
+// Pos returns the offset of the first byte of the node.
+func (self Span) Pos() int {
+	return self.Start
+}
+
+// End returns the offset just past the last byte of the node.
+func (self Span) End() int {
+	return self.Stop
+}
+
+func (Span) exprNode() {}
+
+// A File is an entire source file: a sequence of statements.
+type File struct {
+	Span
+	Body []Expr
+}
+
+// Nil is the literal nil.
+type Nil struct {
+	Span
+}
+
+// Bool is the literal true or false.
+type Bool struct {
+	Span
+	Value bool
+}
+
+// Self is the keyword self.
+type Self struct {
+	Span
+}
+
+// An Integer literal; Value is written without underscores in a form that
+// big.Int.SetString accepts with base 0, e.g.: -1000, 0x1F, 0o17, 0b101.
+type Integer struct {
+	Span
+	Value string
+}
+
+// A Float literal; Value is written without underscores, e.g.: 1.5e-3.
+type Float struct {
+	Span
+	Value string
+}
+
+// A Rational literal such as 3r or 1.5r; Value is the number without the suffix.
+type Rational struct {
+	Span
+	Value string
+}
+
+// An Imaginary literal such as 2i; Value is the number without the suffix.
+type Imaginary struct {
+	Span
+	Value string
+}
+
+// A String literal, in any of its forms.  Parts holds *StringText and *Interpolation
+// nodes in order.
+type String struct {
+	Span
+	Parts []Expr
+}
+
+// Literal returns the string's contents, provided it contains no interpolations.
+func (self *String) Literal() (string, bool) {
+	return literalParts(self.Parts)
+}
+
+// StringText is the literal text within a string, symbol or regexp.
+type StringText struct {
+	Span
+	Value string
+}
+
+// An Interpolation is the code within #{...}.
+type Interpolation struct {
+	Span
+	Body []Expr
+}
+
+// An XString is a command to be run by the shell, `like this`.
+type XString struct {
+	Span
+	Parts []Expr
+}
+
+// A Symbol literal, such as :name or :"name".
+type Symbol struct {
+	Span
+	Parts []Expr
+}
+
+// Literal returns the symbol's name, provided it contains no interpolations.
+func (self *Symbol) Literal() (string, bool) {
+	return literalParts(self.Parts)
+}
+
+// A Regexp literal; Flags holds the options that follow it, e.g.: "mi".
+type Regexp struct {
+	Span
+	Parts []Expr
+	Flags string
+}
+
+// Literal returns the regexp's source, provided it contains no interpolations.
+func (self *Regexp) Literal() (string, bool) {
+	return literalParts(self.Parts)
+}
+
+// An Array literal; elements may include *Splat nodes.
+type Array struct {
+	Span
+	Elements []Expr
+}
+
+// A Hash literal, or the keyword arguments at the end of a method call (where Braces is
+// false).  Pairs holds *Pair and *DoubleSplat nodes.
+type Hash struct {
+	Span
+	Pairs  []Expr
+	Braces bool
+}
+
+// A Pair is a single entry of a hash.  For entries written as labels (name: value), Key is
+// a *Symbol and Label is true.
+type Pair struct {
+	Span
+	Key   Expr
+	Value Expr
+	Label bool
+}
+
+// A Range such as 1..10 or 'a'...'z'; either end may be nil.
+type Range struct {
+	Span
+	Low       Expr
+	High      Expr
+	Exclusive bool
+}
+
+// An Ident is a bare name, which Ruby resolves to either a local variable or a call to a
+// method taking no arguments.
+type Ident struct {
+	Span
+	Name string
+}
+
+// A Const is a constant, optionally qualified by the expression it is looked up in
+// (Scope::Name) or qualified as top-level (::Name).
+type Const struct {
+	Span
+	Scope    Expr
+	Name     string
+	TopLevel bool
+}
+
+// A Variable is an instance, class or global variable; Name includes its sigil.
+type Variable struct {
+	Span
+	Name string
+}
+
+// A Call is a method call.  Receiver is nil for calls on self; Operator is how the method
+// was called on its receiver (".", "&." or "::").  Keyword arguments appear as a final
+// *Hash argument.
+type Call struct {
+	Span
+	Receiver Expr
+	Operator string
+	Name     string
+	Args     []Expr
+	Parens   bool
+	Block    *Block
+}
+
+// A Block is the do...end or {...} passed to a method call or lambda.
+type Block struct {
+	Span
+	Params []*Param
+	Body   []Expr
+	Braces bool
+}
+
+// A Param is a block or lambda parameter.  Prefix is one of "", "*", "**" or "&".
+type Param struct {
+	Span
+	Name    string
+	Prefix  string
+	Default Expr
+}
+
+// A Lambda is written ->(params) { body }.
+type Lambda struct {
+	Span
+	Block *Block
+}
+
+// A BlockPass is an argument passed as a block, such as &:to_s.
+type BlockPass struct {
+	Span
+	Value Expr
+}
+
+// A Splat expands an array into arguments or elements: *values.
+type Splat struct {
+	Span
+	Value Expr
+}
+
+// A DoubleSplat expands a hash into keyword arguments or entries: **options.
+type DoubleSplat struct {
+	Span
+	Value Expr
+}
+
+// An Index is an element reference: receiver[args].
+type Index struct {
+	Span
+	Receiver Expr
+	Args     []Expr
+}
+
+// An Assign sets a variable, constant, attribute or element.  Operator is "=" or an
+// operator-assignment such as "+=" or "||=".
+type Assign struct {
+	Span
+	Target   Expr
+	Operator string
+	Value    Expr
+}
+
+// A Binary expression, including the logical operators (&&, ||, and, or).
+type Binary struct {
+	Span
+	Operator string
+	Left     Expr
+	Right    Expr
+}
+
+// A Unary expression: -x, +x, !x, ~x, not x or defined?(x).
+type Unary struct {
+	Span
+	Operator string
+	Operand  Expr
+}
+
+// An If is a conditional in any of its forms: if/unless statements (with elsif branches
+// appearing as a nested *If in Else), trailing modifiers and the ternary operator.
+type If struct {
+	Span
+	Cond     Expr
+	Then     []Expr
+	Else     []Expr
+	Unless   bool
+	Modifier bool
+	Ternary  bool
+}
+
+// A Paren is a parenthesized sequence of statements, or a begin...end block.
+type Paren struct {
+	Span
+	Body []Expr
+}
+
+func literalParts(parts []Expr) (string, bool) {
+	value := ``
+
+	for _, part := range parts {
+		if text, ok := part.(*StringText); ok {
+			value += text.Value
+		} else {
+			return ``, false
+		}
+	}
+
+	return value, true
+}
@@ -0,0 +1,104 @@
+package ast
+
+// Inspect traverses the tree rooted at node in depth-first order, calling f for each
+// node.  If f returns false, the children of that node are skipped.
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+
+	for _, child := range Children(node) {
+		Inspect(child, f)
+	}
+}
+
+// Children returns the nodes directly beneath the given one, in source order.
+func Children(node Node) []Node {
+	children := make([]Node, 0)
+
+	add := func(nodes ...Node) {
+		for _, n := range nodes {
+			if n != nil {
+				children = append(children, n)
+			}
+		}
+	}
+
+	addExprs := func(exprs []Expr) {
+		for _, expr := range exprs {
+			add(expr)
+		}
+	}
+
+	switch n := node.(type) {
+	case *File:
+		addExprs(n.Body)
+	case *String:
+		addExprs(n.Parts)
+	case *Interpolation:
+		addExprs(n.Body)
+	case *XString:
+		addExprs(n.Parts)
+	case *Symbol:
+		addExprs(n.Parts)
+	case *Regexp:
+		addExprs(n.Parts)
+	case *Array:
+		addExprs(n.Elements)
+	case *Hash:
+		addExprs(n.Pairs)
+	case *Pair:
+		add(n.Key, n.Value)
+	case *Range:
+		add(n.Low, n.High)
+	case *Const:
+		add(n.Scope)
+	case *Call:
+		add(n.Receiver)
+		addExprs(n.Args)
+
+		if n.Block != nil {
+			add(n.Block)
+		}
+	case *Block:
+		for _, param := range n.Params {
+			add(param)
+		}
+
+		addExprs(n.Body)
+	case *Param:
+		add(n.Default)
+	case *Lambda:
+		if n.Block != nil {
+			add(n.Block)
+		}
+	case *BlockPass:
+		add(n.Value)
+	case *Splat:
+		add(n.Value)
+	case *DoubleSplat:
+		add(n.Value)
+	case *Index:
+		add(n.Receiver)
+		addExprs(n.Args)
+	case *Assign:
+		add(n.Target, n.Value)
+	case *Binary:
+		add(n.Left, n.Right)
+	case *Unary:
+		add(n.Operand)
+	case *If:
+		add(n.Cond)
+		addExprs(n.Then)
+		addExprs(n.Else)
+	case *Paren:
+		addExprs(n.Body)
+	}
+
+	// modifiers are written after what they govern
+	if n, ok := node.(*If); ok && n.Modifier && len(children) > 1 {
+		children = append(children[1:], children[0])
+	}
+
+	return children
+}
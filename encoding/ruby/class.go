@@ -0,0 +1,218 @@
+package ruby
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+)
+
+// Class is a marker that, when embedded in a struct, causes the struct to be written as
+// a Ruby object constructed with keyword arguments rather than as a hash.  The class
+// name is given in the embedded field's tag; adding the "positional" option passes the
+// field values as positional arguments in field order instead:
+//
+//	type Endpoint struct {
+//		ruby.Class `ruby:"MyApp::Endpoint"`
+//		Host       string `ruby:"host"`
+//		Port       int    `ruby:"port"`
+//	}
+//
+// is written as:
+//
+//	MyApp::Endpoint.new(host: 'x', port: 1)
+//
+// which Unmarshal reads back into an Endpoint.  Fields that omit options (such as
+// omitempty) would leave out are written as nil, as constructor arguments cannot be.
+type Class struct{}
+
+var classType = reflect.TypeOf(Class{})
+
+// ClassNamer is implemented by types that are written as Ruby objects constructed from
+// their fields, e.g.: MyApp::Endpoint.new(host: 'x', port: 1).  The name returned takes
+// precedence over one given to an embedded Class marker.
+type ClassNamer interface {
+	RubyClass() string
+}
+
+var classNamerType = reflect.TypeOf((*ClassNamer)(nil)).Elem()
+
+// describes how instances of a struct type are constructed in Ruby
+type classSpec struct {
+	Name       string
+	Positional bool
+}
+
+// a (possibly namespaced) Ruby constant, e.g.: MyApp::Endpoint
+var rxConstantPath = regexp.MustCompile(`^(::)?[A-Z][A-Za-z0-9_]*(::[A-Z][A-Za-z0-9_]*)*$`)
+
+// label-style keyword arguments that can be written without quoting
+var rxBareLabel = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reads the class name and options from an embedded Class marker, if there is one
+func collectClass(t reflect.Type) (classSpec, error) {
+	var spec classSpec
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		if !sf.Anonymous || sf.Type != classType {
+			continue
+		}
+
+		tag := sf.Tag.Get(`ruby`)
+		name, options := parseTag(tag)
+
+		tagErr := &TagError{
+			Struct: t,
+			Field:  sf.Name,
+			Tag:    tag,
+		}
+
+		if name != `` && !rxConstantPath.MatchString(name) {
+			tagErr.Reason = fmt.Sprintf("'%s' is not a valid Ruby class name", name)
+			return spec, tagErr
+		}
+
+		for _, opt := range options {
+			if opt != `positional` {
+				tagErr.Reason = fmt.Sprintf("unknown option '%s'", opt)
+				return spec, tagErr
+			}
+		}
+
+		spec.Name = name
+		spec.Positional = options.Contains(`positional`)
+	}
+
+	return spec, nil
+}
+
+// returns how the given struct value is to be constructed in Ruby; the Name is empty
+// if it should be written as a hash
+func (self *encodeState) classOf(v reflect.Value) (classSpec, error) {
+	spec := typeClass(v.Type(), self.tagKeys)
+	named := false
+
+	if v.Type().Implements(classNamerType) {
+		spec.Name, named = v.Interface().(ClassNamer).RubyClass(), true
+	} else if v.CanAddr() && v.Addr().Type().Implements(classNamerType) {
+		spec.Name, named = v.Addr().Interface().(ClassNamer).RubyClass(), true
+	}
+
+	// names from tags were checked along with the tag
+	if named && spec.Name != `` && !rxConstantPath.MatchString(spec.Name) {
+		return spec, &UnsupportedValueError{
+			Value: v,
+			Str:   fmt.Sprintf("class name '%s' (from RubyClass)", spec.Name),
+			Path:  self.path.String(),
+		}
+	}
+
+	return spec, nil
+}
+
+// returns the keyword argument label for the given field name, e.g.: "host: "
+func keywordLabel(name string) []byte {
+	if rxBareLabel.MatchString(name) {
+		return []byte(name + `: `)
+	}
+
+	return []byte(singleQuote(name) + `: `)
+}
+
+// A ClassKind selects the Ruby construct used to define a class from a struct type.
+type ClassKind int
+
+const (
+	// define the class with Data.define (Ruby 3.2 and later), whose instances are immutable
+	DataClass ClassKind = iota
+
+	// define the class with Struct.new
+	StructClass
+)
+
+// MarshalClass returns a Ruby definition of the class that instances of v's struct type
+// are constructed as, with one member for each field that would be written, e.g.:
+//
+//	MyApp::Endpoint = Data.define(:host, :port)
+//
+// Namespaces in the class name must already be defined when the output is evaluated.
+func MarshalClass(v interface{}, kind ClassKind) ([]byte, error) {
+	e := &encodeState{}
+
+	if err := e.marshalClass(reflect.ValueOf(v), kind); err != nil {
+		return nil, err
+	}
+
+	return e.Bytes(), nil
+}
+
+// EncodeClass writes a Ruby definition of the class that instances of v's struct type are
+// constructed as, followed by a newline.  Fields are named as they would be by Encode.
+func (self *Encoder) EncodeClass(v interface{}, kind ClassKind) error {
+	e := &encodeState{
+		encodeOptions: self.options,
+	}
+
+	if err := e.marshalClass(reflect.ValueOf(v), kind); err != nil {
+		return err
+	}
+
+	e.writeStringsUnindented("\n")
+
+	_, err := self.w.Write(e.Bytes())
+	return err
+}
+
+func (self *encodeState) marshalClass(v reflect.Value, kind ClassKind) error {
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("Cannot define a Ruby class for non-struct type '%v'", v.Type())
+	}
+
+	spec, err := self.classOf(v)
+
+	if err != nil {
+		return err
+	} else if spec.Name == `` {
+		return fmt.Errorf("Type '%v' does not declare a Ruby class name", v.Type())
+	}
+
+	fields, err := typeFields(v.Type(), self.tagKeys, self.fieldNaming)
+
+	if err != nil {
+		return err
+	}
+
+	var members bytes.Buffer
+
+	for i, field := range fields {
+		if i > 0 {
+			members.WriteString(`, `)
+		}
+
+		members.WriteString(symbolLiteral(field.Name))
+	}
+
+	switch kind {
+	case StructClass:
+		// Struct.new only accepts keyword arguments if asked to
+		if !spec.Positional {
+			if members.Len() > 0 {
+				members.WriteString(`, `)
+			}
+
+			members.WriteString(`keyword_init: true`)
+		}
+
+		self.writeStrings(spec.Name, ` = Struct.new(`, members.String(), `)`)
+	default:
+		self.writeStrings(spec.Name, ` = Data.define(`, members.String(), `)`)
+	}
+
+	return nil
+}
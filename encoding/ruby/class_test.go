@@ -0,0 +1,239 @@
+package ruby
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type TestEndpoint struct {
+	Class `ruby:"MyApp::Endpoint"`
+	Host  string `ruby:"host"`
+	Port  int    `ruby:"port,omitempty"`
+	TLS   bool
+}
+
+type TestPoint struct {
+	Class `ruby:"Point,positional"`
+	X     int
+	Y     int
+}
+
+type TestNamedRecord struct {
+	Name string `ruby:"name"`
+}
+
+func (self TestNamedRecord) RubyClass() string {
+	return `Record`
+}
+
+type TestEmptyObject struct {
+	Class `ruby:"Empty"`
+}
+
+func TestEncodeClassKeywords(t *testing.T) {
+	e := &encodeState{}
+
+	in := []interface{}{
+		TestEndpoint{
+			Host: `x`,
+			Port: 1,
+		},
+		TestPoint{X: 1, Y: -2},
+		TestNamedRecord{Name: `n`},
+		TestEmptyObject{},
+		map[string]interface{}{
+			`p`: &TestPoint{},
+		},
+	}
+
+	shouldBe := `[MyApp::Endpoint.new(host: 'x', port: 1, TLS: false), Point.new(1, -2), Record.new(name: 'n'), Empty.new, {'p'=>Point.new(0, 0)}]`
+
+	if err := e.marshal(in); err != nil {
+		t.Fatal(err)
+	} else if s := e.String(); s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	} else {
+		t.Log(s)
+	}
+}
+
+func TestEncodeClassIndented(t *testing.T) {
+	e := &encodeState{
+		indentEnabled: true,
+		indent:        []byte{' ', ' '},
+	}
+
+	in := map[string]interface{}{
+		`endpoint`: TestEndpoint{
+			Host: `x`,
+		},
+	}
+
+	shouldBe := "{\n  'endpoint' => MyApp::Endpoint.new(\n    host: 'x',\n    port: nil,\n    TLS: false\n  )\n}"
+
+	if err := e.marshal(in); err != nil {
+		t.Fatal(err)
+	} else if s := e.String(); s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	} else {
+		t.Log(s)
+	}
+}
+
+type TestInvalidClassName struct{}
+
+func (self TestInvalidClassName) RubyClass() string {
+	return `not a class`
+}
+
+func TestEncodeClassOmitted(t *testing.T) {
+	type positional struct {
+		Class `ruby:"Pt,positional"`
+		X     int `ruby:"x,omitempty"`
+		Y     int `ruby:"y"`
+	}
+
+	type keywords struct {
+		Class `ruby:"Kw"`
+		X     *int `ruby:"x,omitnil"`
+		Y     int  `ruby:"y"`
+	}
+
+	// constructor arguments are written as nil rather than left out, which would shift
+	// later positional arguments or drop a required keyword
+	for _, tc := range []struct {
+		In       interface{}
+		ShouldBe string
+	}{
+		{positional{Y: 5}, `Pt.new(nil, 5)`},
+		{keywords{Y: 5}, `Kw.new(x: nil, y: 5)`},
+	} {
+		data, err := Marshal(tc.In)
+
+		if err != nil {
+			t.Fatal(err)
+		} else if s := string(data); s != tc.ShouldBe {
+			t.Fatalf("Expected \"%s\", got \"%s\"", tc.ShouldBe, s)
+		}
+
+		out := reflect.New(reflect.TypeOf(tc.In))
+
+		if err := Unmarshal(data, out.Interface()); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(out.Elem().Interface(), tc.In) {
+			t.Fatalf("Expected %+v, got %+v", tc.In, out.Elem().Interface())
+		}
+	}
+
+	var valueErr *UnsupportedValueError
+
+	if _, err := Marshal(TestInvalidClassName{}); !errors.As(err, &valueErr) {
+		t.Fatalf("Expected an UnsupportedValueError, got %v", err)
+	} else if _, err := MarshalClass(TestInvalidClassName{}, DataClass); !errors.As(err, &valueErr) {
+		t.Fatalf("Expected an UnsupportedValueError, got %v", err)
+	}
+}
+
+func TestUnmarshalClass(t *testing.T) {
+	type objects struct {
+		Endpoint TestEndpoint    `ruby:"endpoint"`
+		Points   []*TestPoint    `ruby:"points"`
+		Record   TestNamedRecord `ruby:"record"`
+		Empty    TestEmptyObject `ruby:"empty"`
+	}
+
+	in := objects{
+		Endpoint: TestEndpoint{Host: `x`, Port: 1, TLS: true},
+		Points:   []*TestPoint{{X: 1, Y: -2}, {}},
+		Record:   TestNamedRecord{Name: `n`},
+	}
+
+	for _, indent := range []string{``, `  `} {
+		data, err := MarshalIndent(in, ``, indent)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out objects
+
+		if err := Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(in, out) {
+			t.Fatalf("Expected %+v, got %+v (from %s)", in, out, data)
+		}
+	}
+
+	var point TestPoint
+
+	// positional and keyword arguments may be mixed, and the constant may be qualified
+	if err := Unmarshal([]byte(`::Point.new(3, Y: 4)`), &point); err != nil {
+		t.Fatal(err)
+	} else if point.X != 3 || point.Y != 4 {
+		t.Fatalf("Expected 3, 4, got %d, %d", point.X, point.Y)
+	}
+
+	for _, src := range []string{`Other.new(1, 2)`, `Point.new(1, 2, 3)`, `Point.new(1) { }`} {
+		var typeErr *UnmarshalTypeError
+		var syntaxErr *SyntaxError
+
+		if err := Unmarshal([]byte(src), &point); !errors.As(err, &typeErr) && !errors.As(err, &syntaxErr) {
+			t.Fatalf("Expected an error decoding %q, got %v", src, err)
+		}
+	}
+}
+
+func TestMarshalClass(t *testing.T) {
+	for _, tc := range []struct {
+		In       interface{}
+		Kind     ClassKind
+		ShouldBe string
+	}{
+		{TestEndpoint{}, DataClass, `MyApp::Endpoint = Data.define(:host, :port, :TLS)`},
+		{TestEndpoint{}, StructClass, `MyApp::Endpoint = Struct.new(:host, :port, :TLS, keyword_init: true)`},
+		{&TestPoint{}, StructClass, `Point = Struct.new(:X, :Y)`},
+		{TestNamedRecord{}, DataClass, `Record = Data.define(:name)`},
+	} {
+		if data, err := MarshalClass(tc.In, tc.Kind); err != nil {
+			t.Fatal(err)
+		} else if s := string(data); s != tc.ShouldBe {
+			t.Fatalf("Expected \"%s\", got \"%s\"", tc.ShouldBe, s)
+		}
+	}
+
+	if _, err := MarshalClass(TestStruct{}, DataClass); err == nil {
+		t.Fatal("Expected an error for a struct without a class name")
+	}
+
+	var buf bytes.Buffer
+
+	encoder := NewEncoder(&buf)
+	encoder.SetFieldNaming(SnakeCase)
+
+	if err := encoder.EncodeClass(TestPoint{}, DataClass); err != nil {
+		t.Fatal(err)
+	} else if err := encoder.Encode(TestPoint{X: 3, Y: 4}); err != nil {
+		t.Fatal(err)
+	} else if s, shouldBe := buf.String(), "Point = Data.define(:x, :y)\nPoint.new(3, 4)\n"; s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	}
+}
+
+func TestValidateTypeClass(t *testing.T) {
+	for _, invalid := range []interface{}{
+		struct {
+			Class `ruby:"lowercase"`
+		}{},
+		struct {
+			Class `ruby:"Valid,keywords"`
+		}{},
+	} {
+		if err := ValidateType(reflect.TypeOf(invalid)); err == nil {
+			t.Fatalf("Expected %T to be invalid", invalid)
+		} else {
+			t.Log(err)
+		}
+	}
+}
@@ -0,0 +1,505 @@
+package ruby
+
+import (
+	"fmt"
+	"github.com/ghetzel/rubyutils/encoding/ruby/ast"
+	"github.com/ghetzel/rubyutils/encoding/ruby/lexer"
+	"github.com/ghetzel/rubyutils/encoding/ruby/parser"
+	"io"
+)
+
+// how much of the line before a value is kept so that errors can quote it; on longer
+// lines (such as the output of Marshal) only the value itself is kept
+const excerptLimit = 1024
+
+// how much of the input is read at a time, at first and at most; see readerTokens.Next
+const readSize = 32 * 1024
+const maxReadSize = 8 * 1024 * 1024
+
+// how many reads in a row may return nothing before the reader is taken to be broken
+const maxEmptyReads = 100
+
+// A Token holds a value of one of these types:
+//
+//	Delim, for the four Ruby delimiters [ ] { }
+//	hash keys, and values not written with brackets, as Decode would store them in
+//	an interface{} (see Unmarshal)
+type Token interface{}
+
+// A Delim is a Ruby array or hash delimiter: one of [ ] { }
+type Delim rune
+
+func (self Delim) String() string {
+	return string(self)
+}
+
+// where the decoder is within the arrays and hashes it has read with Token
+type tokenState int
+
+const (
+	tokenTopValue tokenState = iota
+	tokenArrayStart
+	tokenArrayValue
+	tokenArrayComma
+	tokenHashStart
+	tokenHashKey
+	tokenHashArrow
+	tokenHashValue
+	tokenHashComma
+)
+
+// A Decoder reads Ruby values from an input stream.  The stream holds a sequence of
+// values, one per line (or separated by semicolons), as written by an Encoder.
+type Decoder struct {
+	tokens  *readerTokens
+	parser  *parser.Parser
+	state   tokenState
+	stack   []tokenState
+	start   lexer.Token
+	kept    int
+	err     error
+	options decodeOptions
+}
+
+// supplies the parser with tokens, reading more of the input whenever the lexer reaches
+// the end of what it has been given
+type readerTokens struct {
+	r     io.Reader
+	lexer *lexer.Lexer
+	buf   []byte
+	read  int
+}
+
+// returns the next token, reading as much of the input as it needs.  A token that continues
+// past what has been read is lexed again from its start once more is read, so each read
+// asks for as much as is already pending (up to maxReadSize); with a reader that fills
+// what it is asked for, a long token (such as a string of several megabytes) is lexed a
+// number of times logarithmic in its length.  A reader that returns less (such as a pipe)
+// has the token lexed again after every read.
+func (self *readerTokens) Next() (lexer.Token, error) {
+	empty := 0
+
+	for {
+		tok, err := self.lexer.Next()
+
+		if err != lexer.ErrNeedMore {
+			return tok, err
+		}
+
+		size := self.lexer.Pending()
+
+		if size < readSize {
+			size = readSize
+		} else if size > maxReadSize {
+			size = maxReadSize
+		}
+
+		if size > len(self.buf) {
+			self.buf = make([]byte, size)
+		}
+
+		n, err := self.r.Read(self.buf[:size])
+		self.lexer.Append(self.buf[:n])
+		self.read += n
+
+		if err == io.EOF {
+			self.lexer.Close()
+		} else if err != nil {
+			return lexer.Token{}, err
+		} else if n > 0 {
+			empty = 0
+		} else if empty++; empty == maxEmptyReads {
+			return lexer.Token{}, io.ErrNoProgress
+		}
+	}
+}
+
+// NewDecoder returns a new Decoder that reads from r.  Input is read as it is needed, and
+// released once the values in it have been decoded.
+func NewDecoder(r io.Reader) *Decoder {
+	tokens := &readerTokens{
+		r:     r,
+		lexer: lexer.NewIncremental(),
+		buf:   make([]byte, readSize),
+	}
+
+	return &Decoder{
+		tokens: tokens,
+		parser: parser.New(tokens),
+	}
+}
+
+// Decode reads the next value from the input and stores it in the value pointed to by v,
+// as Unmarshal does.  At the end of the input, it returns io.EOF.
+func (self *Decoder) Decode(v interface{}) error {
+	if self.err != nil {
+		return self.err
+	}
+
+	if err := self.tokenPrepareForDecode(); err != nil {
+		return err
+	}
+
+	tok, err := self.peek()
+
+	if err != nil {
+		return err
+	} else if !self.tokenValueAllowed() {
+		return self.unexpected(tok)
+	} else if tok.Kind == lexer.EOF && self.state == tokenTopValue {
+		return io.EOF
+	}
+
+	node, err := self.parseValue()
+
+	if err != nil {
+		return err
+	}
+
+	self.tokenValueEnd()
+
+	return self.decodeState().unmarshal(node, v)
+}
+
+// DisallowUnknownFields causes the Decoder to return an error when a hash being decoded
+// into a struct has a key that does not match any of its fields.
+func (self *Decoder) DisallowUnknownFields() {
+	self.options.disallowUnknownFields = true
+}
+
+// DisallowDuplicateKeys causes the Decoder to return an error when a hash has the same
+// key more than once, rather than keeping the last value given for it.  Keys are compared
+// as the Go values they decode into, so "{'a' => 1, :a => 2}" has a duplicate key when
+// decoded into a map[string]int or a struct.
+func (self *Decoder) DisallowDuplicateKeys() {
+	self.options.disallowDuplicateKeys = true
+}
+
+// UseNumber causes the Decoder to store numbers in an interface{} as a Number rather than
+// as an int64, *big.Int or float64, keeping their precision and whether they were
+// written as integers or floats.
+func (self *Decoder) UseNumber() {
+	self.options.useNumber = true
+}
+
+// UseCaseInsensitiveFields causes the Decoder to match hash keys to struct fields whose
+// names differ only in case, when no field matches exactly.
+func (self *Decoder) UseCaseInsensitiveFields() {
+	self.options.caseInsensitive = true
+}
+
+// SetTagKeys sets the struct tag keys consulted, in order, for a field's name and
+// options, as Encoder.SetTagKeys does.  Values written by an Encoder should be decoded
+// with the same keys.
+func (self *Decoder) SetTagKeys(keys ...string) {
+	self.options.tagKeys = keys
+}
+
+// SetFieldNaming sets the strategy (such as SnakeCase) for deriving the keys of struct
+// fields that are not explicitly named by a tag, as Encoder.SetFieldNaming does.
+func (self *Decoder) SetFieldNaming(naming NamingStrategy) {
+	self.options.fieldNaming = naming
+}
+
+// SetVariables gives the values that names within string interpolations (e.g.:
+// "#{ENV['HOME']}/.config") refer to.  Names beginning with an uppercase letter are
+// defined as constants and others as local variables; interpolations referring to any
+// other name fail to decode with an *EvalError.
+func (self *Decoder) SetVariables(variables map[string]interface{}) {
+	self.options.variables = variables
+}
+
+// More reports whether there is another element in the array or hash being read, or
+// another value in the input.
+func (self *Decoder) More() bool {
+	if self.err != nil {
+		return false
+	}
+
+	tok, err := self.peek()
+
+	// a comma may be followed by the closing delimiter
+	if err == nil && tok.Is(lexer.Operator, `,`) && (self.state == tokenArrayComma || self.state == tokenHashComma) {
+		self.parser.Next()
+
+		if self.state == tokenArrayComma {
+			self.state = tokenArrayValue
+		} else {
+			self.state = tokenHashKey
+		}
+
+		tok, err = self.peek()
+	}
+
+	return err == nil && tok.Kind != lexer.EOF && !tok.Is(lexer.Operator, `]`) && !tok.Is(lexer.Operator, `}`)
+}
+
+// Token returns the next token in the input: the delimiters of arrays and hashes, hash
+// keys and the values within them.  The commas and arrows separating them are checked
+// but not returned.  At the end of the input, it returns nil and io.EOF.
+func (self *Decoder) Token() (Token, error) {
+	if self.err != nil {
+		return nil, self.err
+	}
+
+	for {
+		tok, err := self.peek()
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case tok.Is(lexer.Operator, `[`):
+			if !self.tokenValueAllowed() {
+				return nil, self.unexpected(tok)
+			}
+
+			self.parser.Next()
+			self.stack = append(self.stack, self.state)
+			self.state = tokenArrayStart
+			return Delim('['), nil
+
+		case tok.Is(lexer.Operator, `]`):
+			if self.state != tokenArrayStart && self.state != tokenArrayValue && self.state != tokenArrayComma {
+				return nil, self.unexpected(tok)
+			}
+
+			self.parser.Next()
+			self.tokenPop()
+			return Delim(']'), nil
+
+		case tok.Is(lexer.Operator, `{`):
+			if !self.tokenValueAllowed() {
+				return nil, self.unexpected(tok)
+			}
+
+			self.parser.Next()
+			self.stack = append(self.stack, self.state)
+			self.state = tokenHashStart
+			return Delim('{'), nil
+
+		case tok.Is(lexer.Operator, `}`):
+			if self.state != tokenHashStart && self.state != tokenHashKey && self.state != tokenHashComma {
+				return nil, self.unexpected(tok)
+			}
+
+			self.parser.Next()
+			self.tokenPop()
+			return Delim('}'), nil
+
+		case tok.Is(lexer.Operator, `,`):
+			switch self.state {
+			case tokenArrayComma:
+				self.state = tokenArrayValue
+			case tokenHashComma:
+				self.state = tokenHashKey
+			default:
+				return nil, self.unexpected(tok)
+			}
+
+			self.parser.Next()
+
+		case tok.Is(lexer.Operator, `=>`):
+			if self.state != tokenHashArrow {
+				return nil, self.unexpected(tok)
+			}
+
+			self.parser.Next()
+			self.state = tokenHashValue
+
+		case tok.Kind == lexer.EOF && self.state == tokenTopValue:
+			return nil, io.EOF
+
+		case self.state == tokenHashStart || self.state == tokenHashKey:
+			return self.tokenKey(tok)
+
+		default:
+			if !self.tokenValueAllowed() {
+				return nil, self.unexpected(tok)
+			}
+
+			var value interface{}
+
+			if err := self.Decode(&value); err != nil {
+				return nil, err
+			}
+
+			return value, nil
+		}
+	}
+}
+
+// reads a hash key, which may be a label (name:) that needs no arrow after it
+func (self *Decoder) tokenKey(tok lexer.Token) (Token, error) {
+	var key ast.Expr
+
+	if tok.Kind == lexer.Label {
+		self.parser.Next()
+
+		if tok.Interpolated() {
+			return nil, self.unexpected(tok)
+		}
+
+		key = &ast.Symbol{
+			Span:  ast.Span{Start: tok.Offset, Stop: tok.End()},
+			Parts: []ast.Expr{&ast.StringText{Value: tok.Value}},
+		}
+
+		self.state = tokenHashValue
+	} else {
+		node, err := self.parseValue()
+
+		if err != nil {
+			return nil, err
+		}
+
+		key = node
+		self.state = tokenHashArrow
+	}
+
+	d := self.decodeState()
+
+	if err := d.interpolate(key); err != nil {
+		return nil, err
+	}
+
+	// keys are strings whether they were written as strings or symbols, as in the hashes
+	// decoded into an interface{}
+	if name, ok := stringLiteral(key); ok {
+		return name, nil
+	}
+
+	return d.interfaceValue(key, nil)
+}
+
+// parses the value that begins with the last token peeked at; values at the top level are
+// whole statements
+func (self *Decoder) parseValue() (node ast.Expr, err error) {
+	if self.state == tokenTopValue {
+		node, err = self.parser.Statement()
+	} else {
+		node, err = self.parser.Value()
+	}
+
+	if err != nil {
+		self.err = self.decodeState().syntaxError(err)
+		return nil, self.err
+	}
+
+	return node, nil
+}
+
+// returns the next token, skipping line breaks (and, between values at the top level,
+// semicolons) and releasing the input before it
+func (self *Decoder) peek() (lexer.Token, error) {
+	for {
+		tok, err := self.parser.Peek()
+
+		if err != nil {
+			self.err = self.decodeState().syntaxError(err)
+			return tok, self.err
+		}
+
+		if tok.Kind == lexer.Newline || (tok.Is(lexer.Operator, `;`) && self.state == tokenTopValue) {
+			self.parser.Next()
+			continue
+		}
+
+		self.release(tok)
+		return tok, nil
+	}
+}
+
+// discards the input before the given token, keeping the start of its line for excerpts
+func (self *Decoder) release(tok lexer.Token) {
+	self.start = tok
+	self.kept = tok.Offset - (tok.Column - 1)
+
+	if tok.Offset-self.kept > excerptLimit {
+		self.kept = tok.Offset
+	}
+
+	self.tokens.lexer.Discard(self.kept)
+}
+
+// returns a decodeState over the input retained since the last token peeked at
+func (self *Decoder) decodeState() *decodeState {
+	column := 1
+
+	if self.kept == self.start.Offset {
+		column = self.start.Column
+	}
+
+	d := newDecodeState(self.tokens.lexer.Source(self.kept, self.tokens.read), self.kept, self.start.Line, column)
+	d.decodeOptions = self.options
+
+	return d
+}
+
+func (self *Decoder) unexpected(tok lexer.Token) error {
+	d := self.decodeState()
+	line, column := d.position(tok.Offset)
+
+	self.err = &SyntaxError{
+		Msg:     fmt.Sprintf("Unexpected %v", tok),
+		Offset:  tok.Offset,
+		Line:    line,
+		Column:  column,
+		Excerpt: d.sourceLine(tok.Offset, column),
+	}
+
+	return self.err
+}
+
+func (self *Decoder) tokenValueAllowed() bool {
+	switch self.state {
+	case tokenTopValue, tokenArrayStart, tokenArrayValue, tokenHashValue:
+		return true
+	}
+
+	return false
+}
+
+// reads the comma or arrow that must come before a value being decoded
+func (self *Decoder) tokenPrepareForDecode() error {
+	var expected string
+	var next tokenState
+
+	switch self.state {
+	case tokenArrayComma:
+		expected, next = `,`, tokenArrayValue
+	case tokenHashArrow:
+		expected, next = `=>`, tokenHashValue
+	default:
+		return nil
+	}
+
+	tok, err := self.peek()
+
+	if err != nil {
+		return err
+	} else if !tok.Is(lexer.Operator, expected) {
+		return self.unexpected(tok)
+	}
+
+	self.parser.Next()
+	self.state = next
+	return nil
+}
+
+func (self *Decoder) tokenValueEnd() {
+	switch self.state {
+	case tokenArrayStart, tokenArrayValue:
+		self.state = tokenArrayComma
+	case tokenHashValue:
+		self.state = tokenHashComma
+	}
+}
+
+// returns to the state enclosing the array or hash just closed
+func (self *Decoder) tokenPop() {
+	self.state = self.stack[len(self.stack)-1]
+	self.stack = self.stack[:len(self.stack)-1]
+	self.tokenValueEnd()
+}
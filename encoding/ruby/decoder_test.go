@@ -0,0 +1,462 @@
+package ruby
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecoderStream(t *testing.T) {
+	var buf bytes.Buffer
+
+	encoder := NewEncoder(&buf)
+	in := []TestDecodeInner{{Host: `a`, Port: 1}, {Host: `b`, Port: 2}}
+
+	for _, server := range in {
+		if err := encoder.Encode(server); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf.WriteString("# a comment\n\n{'host'=>'c'}; {'port'=>3}\n")
+
+	decoder := NewDecoder(&buf)
+	out := make([]TestDecodeInner, 0)
+
+	for {
+		var server TestDecodeInner
+
+		if err := decoder.Decode(&server); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		out = append(out, server)
+	}
+
+	shouldBe := append(in, TestDecodeInner{Host: `c`}, TestDecodeInner{Port: 3})
+
+	if !reflect.DeepEqual(out, shouldBe) {
+		t.Fatalf("Expected %+v, got %+v", shouldBe, out)
+	}
+}
+
+func TestDecoderToken(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader(`{
+  'servers' => [{host: 'a', :port => 80}, :b,],
+  1 => nil,
+}
+-2.5`))
+
+	tokens := make([]string, 0)
+
+	for {
+		tok, err := decoder.Token()
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		tokens = append(tokens, fmt.Sprintf("%T:%v", tok, tok))
+	}
+
+	shouldBe := `ruby.Delim:{ string:servers ruby.Delim:[ ruby.Delim:{ string:host string:a string:port int64:80 ruby.Delim:} ruby.Symbol:b ruby.Delim:] int64:1 <nil>:<nil> ruby.Delim:} float64:-2.5`
+
+	if actual := strings.Join(tokens, ` `); actual != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, actual)
+	}
+}
+
+func TestDecoderTokenAndDecode(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader("{'items' => [\n  {'host' => 'a'},\n  {'host' => 'b'},\n]}"))
+
+	for _, shouldBe := range []Token{Delim('{'), `items`, Delim('[')} {
+		if tok, err := decoder.Token(); err != nil || tok != shouldBe {
+			t.Fatalf("Expected %v, got %v (%v)", shouldBe, tok, err)
+		}
+	}
+
+	hosts := make([]string, 0)
+
+	for decoder.More() {
+		var server TestDecodeInner
+
+		if err := decoder.Decode(&server); err != nil {
+			t.Fatal(err)
+		}
+
+		hosts = append(hosts, server.Host)
+	}
+
+	if strings.Join(hosts, `,`) != `a,b` {
+		t.Fatalf("Expected \"a,b\", got \"%s\"", strings.Join(hosts, `,`))
+	}
+
+	for _, shouldBe := range []Token{Delim(']'), Delim('}')} {
+		if tok, err := decoder.Token(); err != nil || tok != shouldBe {
+			t.Fatalf("Expected %v, got %v (%v)", shouldBe, tok, err)
+		}
+	}
+
+	if decoder.More() {
+		t.Fatalf("Expected no more values")
+	}
+}
+
+// generates a single-line array of many hashes without holding it in memory
+type testLargeArray struct {
+	count int
+	next  int
+	buf   bytes.Buffer
+}
+
+func (self *testLargeArray) Read(p []byte) (int, error) {
+	for self.buf.Len() < len(p) && self.next <= self.count {
+		switch {
+		case self.next == 0:
+			self.buf.WriteString(`[`)
+		case self.next == self.count:
+			self.buf.WriteString(`]`)
+		default:
+			fmt.Fprintf(&self.buf, "{'id'=>%d, 'name'=>'item-%d'}, ", self.next, self.next)
+		}
+
+		self.next += 1
+	}
+
+	if self.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+
+	return self.buf.Read(p)
+}
+
+func TestDecoderLargeInput(t *testing.T) {
+	input := &testLargeArray{count: 100000}
+	decoder := NewDecoder(input)
+
+	if tok, err := decoder.Token(); err != nil || tok != Delim('[') {
+		t.Fatalf("Expected [, got %v (%v)", tok, err)
+	}
+
+	total := 0
+
+	for decoder.More() {
+		var item struct {
+			ID int `ruby:"id"`
+		}
+
+		if err := decoder.Decode(&item); err != nil {
+			t.Fatal(err)
+		}
+
+		total += item.ID
+	}
+
+	if shouldBe := 99999 * 100000 / 2; total != shouldBe {
+		t.Fatalf("Expected %d, got %d", shouldBe, total)
+	}
+
+	// the input read has been released as it was decoded
+	if retained := decoder.tokens.read - decoder.kept; retained > 2*readSize {
+		t.Fatalf("Expected no more than %d bytes retained, got %d", 2*readSize, retained)
+	}
+}
+
+func TestDecoderLargeToken(t *testing.T) {
+	input := `'` + strings.Repeat(`x`, 4*1024*1024) + `'`
+	reader := &testCountingReader{r: strings.NewReader(input)}
+
+	var out string
+
+	if err := NewDecoder(reader).Decode(&out); err != nil {
+		t.Fatal(err)
+	} else if len(out) != len(input)-2 {
+		t.Fatalf("Expected %d bytes, got %d", len(input)-2, len(out))
+	}
+
+	// reads grow with the token, rather than the token being lexed anew every readSize bytes
+	if reader.reads > 16 {
+		t.Fatalf("Expected no more than 16 reads, got %d", reader.reads)
+	}
+}
+
+func TestDecoderShortReads(t *testing.T) {
+	input := "{name: 'short', tags: [:a, :b], n: 42}\n[1.5, nil]\n"
+
+	for name, reader := range map[string]func(io.Reader) io.Reader{
+		`OneByteReader`: iotest.OneByteReader,
+		`HalfReader`:    iotest.HalfReader,
+	} {
+		decoder := NewDecoder(reader(strings.NewReader(input)))
+
+		var first map[string]interface{}
+		var second []interface{}
+
+		if err := decoder.Decode(&first); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		} else if err := decoder.Decode(&second); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		} else if err := decoder.Decode(&second); err != io.EOF {
+			t.Fatalf("%s: Expected io.EOF, got %v", name, err)
+		}
+
+		if first[`name`] != `short` || fmt.Sprint(first[`tags`]) != `[a b]` || fmt.Sprint(second) != `[1.5 <nil>]` {
+			t.Fatalf("%s: Decoded %v and %v", name, first, second)
+		}
+	}
+}
+
+type testCountingReader struct {
+	r     io.Reader
+	reads int
+}
+
+func (self *testCountingReader) Read(p []byte) (int, error) {
+	self.reads += 1
+	return self.r.Read(p)
+}
+
+func BenchmarkDecoderLargeToken(b *testing.B) {
+	input := `'` + strings.Repeat(`x`, 8*1024*1024) + `'`
+	b.SetBytes(int64(len(input)))
+
+	for i := 0; i < b.N; i++ {
+		var out string
+
+		if err := NewDecoder(strings.NewReader(input)).Decode(&out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader("1\n'two'\n[3, 4 5]\n"))
+
+	var value int
+
+	if err := decoder.Decode(&value); err != nil || value != 1 {
+		t.Fatalf("Expected 1, got %v (%v)", value, err)
+	}
+
+	err := decoder.Decode(&value)
+
+	var typeErr *UnmarshalTypeError
+
+	if !errors.As(err, &typeErr) || typeErr.Line != 2 || typeErr.Column != 1 {
+		t.Fatalf("Expected an *UnmarshalTypeError at line 2, column 1, got %v", err)
+	}
+
+	var values []int
+
+	err = decoder.Decode(&values)
+
+	if shouldBe := "Expected ']', found integer '5' at line 3, column 7\n    [3, 4 5]\n          ^"; err == nil || err.Error() != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%v\"", shouldBe, err)
+	}
+
+	// syntax errors end decoding
+	if again := decoder.Decode(&values); again != err {
+		t.Fatalf("Expected the same error again, got %v", again)
+	}
+}
+
+func TestDecoderDisallowUnknownFields(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader("{'host' => 'a'}\n{'host' => 'b', 'hots' => 'c'}"))
+	decoder.DisallowUnknownFields()
+
+	var server TestDecodeInner
+
+	if err := decoder.Decode(&server); err != nil {
+		t.Fatal(err)
+	}
+
+	err := decoder.Decode(&server)
+
+	if shouldBe := "Unknown key 'hots' for type 'ruby.TestDecodeInner' at line 2, column 17\n    {'host' => 'b', 'hots' => 'c'}\n                    ^"; err == nil || err.Error() != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%v\"", shouldBe, err)
+	}
+}
+
+func TestDecoderDisallowDuplicateKeys(t *testing.T) {
+	for src, target := range map[string]interface{}{
+		`{'host' => 'a', :host => 'b'}`: &TestDecodeInner{},
+		`{'a' => 1, :a => 2}`:           &map[string]int{},
+		`{1 => 'a', 1 => 'b'}`:          new(interface{}),
+		`[{}, {:x => 1, :x => 2}]`:      new(interface{}),
+	} {
+		decoder := NewDecoder(strings.NewReader(src))
+		decoder.DisallowDuplicateKeys()
+
+		var dupErr *DuplicateKeyError
+
+		if err := decoder.Decode(target); !errors.As(err, &dupErr) {
+			t.Fatalf("Expected *DuplicateKeyError decoding %q, got %v", src, err)
+		}
+	}
+
+	// unhashable keys are type errors rather than panics when looking for duplicates
+	for _, src := range []string{`{[1] => 'a', [1] => 'b'}`, `{{} => 'a'}`} {
+		for _, target := range []interface{}{&map[interface{}]string{}, new(interface{})} {
+			decoder := NewDecoder(strings.NewReader(src))
+			decoder.DisallowDuplicateKeys()
+
+			var typeErr *UnmarshalTypeError
+
+			if err := decoder.Decode(target); !errors.As(err, &typeErr) {
+				t.Fatalf("Expected *UnmarshalTypeError decoding %q, got %v", src, err)
+			}
+		}
+	}
+
+	var hosts map[string]string
+
+	decoder := NewDecoder(strings.NewReader(`{'a' => 'x', 'b' => 'y'}`))
+	decoder.DisallowDuplicateKeys()
+
+	if err := decoder.Decode(&hosts); err != nil || len(hosts) != 2 {
+		t.Fatalf("Expected two hosts, got %v (%v)", hosts, err)
+	}
+
+	// without the option, the last value wins
+	if err := Unmarshal([]byte(`{'a' => 'x', 'a' => 'y'}`), &hosts); err != nil || hosts[`a`] != `y` {
+		t.Fatalf("Expected \"y\", got %v (%v)", hosts, err)
+	}
+
+	decoder = NewDecoder(strings.NewReader("[\n  {'x' => 1, 'x' => 2}]"))
+	decoder.DisallowDuplicateKeys()
+
+	var values []map[string]int
+
+	err := decoder.Decode(&values)
+
+	if shouldBe := "Duplicate key 'x' in map[string]int at [0], line 2, column 14\n      {'x' => 1, 'x' => 2}]\n                 ^"; err == nil || err.Error() != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%v\"", shouldBe, err)
+	}
+}
+
+func TestDecoderUseNumber(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader(`[0x10, -123456789012345678901234567890, 1.50, 2e-3]`))
+	decoder.UseNumber()
+
+	var out interface{}
+
+	if err := decoder.Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	shouldBe := []interface{}{Number(`16`), Number(`-123456789012345678901234567890`), Number(`1.50`), Number(`2e-3`)}
+
+	if !reflect.DeepEqual(out, shouldBe) {
+		t.Fatalf("Expected %#v, got %#v", shouldBe, out)
+	}
+
+	if n := shouldBe[0].(Number); !n.IsInteger() {
+		t.Fatalf("Expected %v to be an integer", n)
+	} else if i, err := n.Int64(); err != nil || i != 16 {
+		t.Fatalf("Expected 16, got %v (%v)", i, err)
+	}
+
+	if n := shouldBe[2].(Number); n.IsInteger() {
+		t.Fatalf("Expected %v to be a float", n)
+	} else if f, err := n.Float64(); err != nil || f != 1.5 {
+		t.Fatalf("Expected 1.5, got %v (%v)", f, err)
+	}
+
+	if data, err := Marshal(shouldBe); err != nil {
+		t.Fatal(err)
+	} else if string(data) != `[16, -123456789012345678901234567890, 1.50, 2e-3]` {
+		t.Fatalf("Expected \"[16, -123456789012345678901234567890, 1.50, 2e-3]\", got \"%s\"", data)
+	}
+
+	var fields struct {
+		Size Number `ruby:"size"`
+	}
+
+	if err := Unmarshal([]byte(`{'size' => 1_000}`), &fields); err != nil || fields.Size != `1000` {
+		t.Fatalf("Expected 1000, got %v (%v)", fields.Size, err)
+	}
+
+	if _, err := Marshal(Number(`12 + 1`)); err == nil {
+		t.Fatalf("Expected an error encoding an invalid Number")
+	}
+}
+
+func TestDecoderUseCaseInsensitiveFields(t *testing.T) {
+	var fields struct {
+		Host  string `ruby:"host"`
+		Other string `ruby:"HOST"`
+		Port  int
+	}
+
+	decoder := NewDecoder(strings.NewReader(`{'Host' => 'a', 'HOST' => 'b', :port => 80}`))
+	decoder.UseCaseInsensitiveFields()
+
+	if err := decoder.Decode(&fields); err != nil {
+		t.Fatal(err)
+	}
+
+	if fields.Host != `a` || fields.Other != `b` || fields.Port != 80 {
+		t.Fatalf("Unexpected values: %+v", fields)
+	}
+}
+
+func TestDecoderTagKeysAndFieldNaming(t *testing.T) {
+	type server struct {
+		HostName   string `json:"host"`
+		ListenPort int
+		MaxConns   int  `ruby:"max_connections" json:"maxConns"`
+		Internal   bool `json:"-"`
+	}
+
+	var buf bytes.Buffer
+
+	encoder := NewEncoder(&buf)
+	encoder.SetTagKeys(`ruby`, `json`)
+	encoder.SetFieldNaming(SnakeCase)
+
+	in := server{HostName: `db`, ListenPort: 5432, MaxConns: 10, Internal: true}
+
+	if err := encoder.Encode(in); err != nil {
+		t.Fatal(err)
+	} else if shouldBe := "{'host'=>'db', 'listen_port'=>5432, 'max_connections'=>10}\n"; buf.String() != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, buf.String())
+	}
+
+	var out server
+
+	decoder := NewDecoder(&buf)
+	decoder.SetTagKeys(`ruby`, `json`)
+	decoder.SetFieldNaming(SnakeCase)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&out); err != nil {
+		t.Fatal(err)
+	} else if in.Internal = false; out != in {
+		t.Fatalf("Expected %+v, got %+v", in, out)
+	}
+}
+
+func TestDecoderVariables(t *testing.T) {
+	var out []string
+
+	decoder := NewDecoder(strings.NewReader("[\"#{ENV['HOME']}/.config\", \"#{user}\", \"#{ENV['MISSING']}\"]\n"))
+	decoder.SetVariables(map[string]interface{}{
+		`ENV`:  map[string]string{`HOME`: `/home/app`},
+		`user`: `app`,
+	})
+
+	if err := decoder.Decode(&out); err != nil {
+		t.Fatal(err)
+	} else if shouldBe := []string{`/home/app/.config`, `app`, ``}; !reflect.DeepEqual(out, shouldBe) {
+		t.Fatalf("Expected %v, got %v", shouldBe, out)
+	}
+}
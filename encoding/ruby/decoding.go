@@ -0,0 +1,1034 @@
+package ruby
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"github.com/ghetzel/rubyutils/encoding/ruby/ast"
+	"github.com/ghetzel/rubyutils/encoding/ruby/lexer"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// converts parsed Ruby literals into Go values, using the source they were parsed from to
+// report where any problems lie
+type decodeState struct {
+	decodeOptions
+	src          []byte
+	offset       int
+	line         int
+	column       int
+	interpolator *evalState
+}
+
+// the strictness and number handling a Decoder has been asked for
+type decodeOptions struct {
+	disallowUnknownFields bool
+	disallowDuplicateKeys bool
+	useNumber             bool
+	caseInsensitive       bool
+	variables             map[string]interface{}
+	tagKeys               []string
+	fieldNaming           NamingStrategy
+}
+
+// returns a decodeState for source found at the given offset, line and column of the input
+func newDecodeState(src []byte, offset int, line int, column int) *decodeState {
+	return &decodeState{
+		src:    src,
+		offset: offset,
+		line:   line,
+		column: column,
+	}
+}
+
+func (self *decodeState) unmarshal(node ast.Expr, v interface{}) error {
+	rv := reflect.ValueOf(v)
+
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &InvalidUnmarshalError{
+			Type: reflect.TypeOf(v),
+		}
+	}
+
+	return self.value(node, rv.Elem(), nil, nil)
+}
+
+// returns the line and column of the given offset
+func (self *decodeState) position(offset int) (int, int) {
+	line, column := self.line, self.column
+
+	for _, c := range self.source(self.offset, offset) {
+		if c == '\n' {
+			line += 1
+			column = 1
+		} else {
+			column += 1
+		}
+	}
+
+	return line, column
+}
+
+// returns the source between the given offsets, as much of it as is available
+func (self *decodeState) source(start int, end int) []byte {
+	start, end = start-self.offset, end-self.offset
+
+	if start < 0 {
+		start = 0
+	}
+
+	if end > len(self.src) {
+		end = len(self.src)
+	}
+
+	if start >= end {
+		return nil
+	}
+
+	return self.src[start:end]
+}
+
+// returns the line of source containing the given offset, which is at the given column,
+// or nothing if the start of that line is no longer available
+func (self *decodeState) sourceLine(offset int, column int) string {
+	start := offset - (column - 1)
+
+	if start < self.offset {
+		return ``
+	}
+
+	line := self.source(start, self.offset+len(self.src))
+
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	return string(bytes.TrimSuffix(line, []byte("\r")))
+}
+
+// converts an error from the parser into a *SyntaxError
+func (self *decodeState) syntaxError(err error) error {
+	var parseErr *lexer.Error
+
+	if errors.As(err, &parseErr) {
+		return &SyntaxError{
+			Msg:     parseErr.Msg,
+			Offset:  parseErr.Offset,
+			Line:    parseErr.Line,
+			Column:  parseErr.Column,
+			Excerpt: self.sourceLine(parseErr.Offset, parseErr.Column),
+		}
+	}
+
+	return err
+}
+
+// returns a *SyntaxError for valid Ruby that cannot be decoded
+func (self *decodeState) unsupported(node ast.Node) error {
+	line, column := self.position(node.Pos())
+	code := self.source(node.Pos(), node.End())
+
+	if i := bytes.IndexByte(code, '\n'); i >= 0 {
+		code = append(code[:i:i], `...`...)
+	}
+
+	return &SyntaxError{
+		Msg:     fmt.Sprintf("Cannot decode '%s', only literal values are supported", code),
+		Offset:  node.Pos(),
+		Line:    line,
+		Column:  column,
+		Excerpt: self.sourceLine(node.Pos(), column),
+	}
+}
+
+// returns an *UnmarshalTypeError for a Ruby value that cannot be stored in the given type
+func (self *decodeState) typeError(node ast.Node, t reflect.Type, path *valuePath) error {
+	line, column := self.position(node.Pos())
+
+	return &UnmarshalTypeError{
+		Path:    path.String(),
+		Value:   describeValue(node),
+		Type:    t,
+		Offset:  node.Pos(),
+		Line:    line,
+		Column:  column,
+		Excerpt: self.sourceLine(node.Pos(), column),
+	}
+}
+
+func (self *decodeState) unmarshalerError(node ast.Node, t reflect.Type, path *valuePath, err error) error {
+	line, column := self.position(node.Pos())
+
+	return &UnmarshalerError{
+		Type:    t,
+		Path:    path.String(),
+		Err:     err,
+		Offset:  node.Pos(),
+		Line:    line,
+		Column:  column,
+		Excerpt: self.sourceLine(node.Pos(), column),
+	}
+}
+
+// returns an *UnknownFieldError for a hash key that names no field of the given struct type
+func (self *decodeState) unknownField(key ast.Node, t reflect.Type, path *valuePath) error {
+	line, column := self.position(key.Pos())
+
+	return &UnknownFieldError{
+		Type:    t,
+		Key:     string(self.source(key.Pos(), key.End())),
+		Path:    path.String(),
+		Offset:  key.Pos(),
+		Line:    line,
+		Column:  column,
+		Excerpt: self.sourceLine(key.Pos(), column),
+	}
+}
+
+// returns a *DuplicateKeyError for a hash key that was already seen in the same hash
+func (self *decodeState) duplicateKey(key ast.Node, t reflect.Type, path *valuePath) error {
+	line, column := self.position(key.Pos())
+
+	return &DuplicateKeyError{
+		Type:    t,
+		Key:     string(self.source(key.Pos(), key.End())),
+		Path:    path.String(),
+		Offset:  key.Pos(),
+		Line:    line,
+		Column:  column,
+		Excerpt: self.sourceLine(key.Pos(), column),
+	}
+}
+
+// describes a Ruby literal for use in error messages
+func describeValue(node ast.Node) string {
+	if kind, literal, ok := numericLiteral(node); ok {
+		return kind + ` ` + literal
+	}
+
+	switch node.(type) {
+	case *ast.Nil:
+		return `nil`
+	case *ast.Bool:
+		return `boolean`
+	case *ast.String:
+		return `string`
+	case *ast.Symbol:
+		return `symbol`
+	case *ast.Array:
+		return `array`
+	case *ast.Hash:
+		return `hash`
+	}
+
+	return `expression`
+}
+
+// returns the kind ("integer" or "float") and value of a (possibly signed) numeric literal
+func numericLiteral(node ast.Node) (string, string, bool) {
+	sign := ``
+
+	if unary, ok := node.(*ast.Unary); ok && (unary.Operator == `-` || unary.Operator == `+`) {
+		node = unary.Operand
+
+		if unary.Operator == `-` {
+			sign = `-`
+		}
+	}
+
+	switch n := node.(type) {
+	case *ast.Integer:
+		return `integer`, negate(sign, n.Value), true
+	case *ast.Float:
+		return `float`, negate(sign, n.Value), true
+	}
+
+	return ``, ``, false
+}
+
+// returns a numeric literal as a Number, with integers written in decimal
+func numberValue(kind string, literal string) Number {
+	if kind == `integer` {
+		if n, ok := new(big.Int).SetString(literal, 0); ok {
+			return Number(n.String())
+		}
+	}
+
+	return Number(literal)
+}
+
+func negate(sign string, literal string) string {
+	if sign == `-` {
+		if literal[0] == '-' {
+			return literal[1:]
+		}
+
+		return `-` + literal
+	}
+
+	return literal
+}
+
+// decodes a node into the given value; options from the struct field being decoded into
+// apply to it and (as when encoding) to the elements of any collection it holds
+func (self *decodeState) value(node ast.Expr, v reflect.Value, options tagOptions, path *valuePath) error {
+	// a parenthesized literal is that literal
+	for {
+		if paren, ok := node.(*ast.Paren); ok && len(paren.Body) == 1 {
+			node = paren.Body[0]
+		} else {
+			break
+		}
+	}
+
+	_, isNil := node.(*ast.Nil)
+
+	if isNil {
+		switch v.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+	}
+
+	unmarshaler, textUnmarshaler, v := indirect(v)
+
+	if unmarshaler != nil {
+		code := append([]byte(nil), self.source(node.Pos(), node.End())...)
+
+		if err := unmarshaler.UnmarshalRuby(code); err != nil {
+			return self.unmarshalerError(node, v.Type(), path, err)
+		}
+
+		return nil
+	} else if isSQLNullType(v.Type()) {
+		// database/sql's Null wrappers are written as the value they hold, or as nil
+		v.Set(reflect.Zero(v.Type()))
+
+		if isNil {
+			return nil
+		}
+
+		v.FieldByName(`Valid`).SetBool(true)
+		return self.value(node, sqlNullValue(v), options, path)
+	} else if isNil {
+		// values that cannot be nil are left as they are
+		return nil
+	}
+
+	raw := options.Contains(`raw`) && isRawType(v.Type())
+
+	if !raw {
+		if err := self.interpolate(node); err != nil {
+			return err
+		}
+	}
+
+	if textUnmarshaler != nil {
+		if str, ok := stringLiteral(node); ok {
+			if err := textUnmarshaler.UnmarshalText([]byte(str)); err != nil {
+				return self.unmarshalerError(node, v.Type(), path, err)
+			}
+
+			return nil
+		}
+	}
+
+	// fields holding verbatim Ruby receive the source of the value
+	if raw {
+		code := self.source(node.Pos(), node.End())
+
+		if v.Kind() == reflect.String {
+			v.SetString(string(code))
+		} else {
+			v.SetBytes(append([]byte(nil), code...))
+		}
+
+		return nil
+	}
+
+	if v.Kind() == reflect.Interface {
+		if v.NumMethod() > 0 {
+			return self.typeError(node, v.Type(), path)
+		}
+
+		value, err := self.interfaceValue(node, path)
+
+		if err != nil {
+			return err
+		}
+
+		if value == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(value))
+		}
+
+		return nil
+	}
+
+	if handled, err := self.typeValue(node, v, path); handled {
+		return err
+	}
+
+	if v.Type() == numberType {
+		if kind, literal, ok := numericLiteral(node); ok {
+			v.SetString(string(numberValue(kind, literal)))
+			return nil
+		}
+
+		return self.typeError(node, v.Type(), path)
+	}
+
+	if kind, literal, ok := numericLiteral(node); ok {
+		if kind == `integer` && setInteger(v, literal) || kind == `float` && setFloat(v, literal) {
+			return nil
+		}
+
+		return self.typeError(node, v.Type(), path)
+	}
+
+	switch n := node.(type) {
+	case *ast.Bool:
+		if v.Kind() != reflect.Bool {
+			return self.typeError(node, v.Type(), path)
+		}
+
+		v.SetBool(n.Value)
+
+	case *ast.String:
+		str, ok := n.Literal()
+
+		if !ok {
+			return self.unsupported(node)
+		}
+
+		// fields tagged `string` were written with their numbers and booleans quoted
+		if options.Contains(`string`) && v.Kind() != reflect.String {
+			if setQuoted(v, str) {
+				return nil
+			}
+
+			return self.typeError(node, v.Type(), path)
+		}
+
+		return self.setString(node, str, v, path)
+
+	case *ast.Symbol:
+		name, ok := n.Literal()
+
+		if !ok {
+			return self.unsupported(node)
+		}
+
+		return self.setString(node, name, v, path)
+
+	case *ast.Array:
+		return self.array(n, v, options, path)
+
+	case *ast.Hash:
+		switch v.Kind() {
+		case reflect.Map:
+			return self.hashToMap(n, v, options, path)
+		case reflect.Struct:
+			return self.hashToStruct(n, v, path)
+		default:
+			return self.typeError(node, v.Type(), path)
+		}
+
+	case *ast.Call:
+		if v.Kind() != reflect.Struct {
+			return self.unsupported(node)
+		}
+
+		return self.callToStruct(n, v, path)
+
+	default:
+		return self.unsupported(node)
+	}
+
+	return nil
+}
+
+// dereferences pointers (allocating those that are nil) until reaching a value that is not
+// one, stopping early at a value whose type implements Unmarshaler or TextUnmarshaler
+func indirect(v reflect.Value) (Unmarshaler, encoding.TextUnmarshaler, reflect.Value) {
+	for {
+		// methods with pointer receivers are found through the value's address
+		if v.Kind() != reflect.Ptr {
+			if v.CanAddr() {
+				if unmarshaler, textUnmarshaler := unmarshalers(v.Addr()); unmarshaler != nil || textUnmarshaler != nil {
+					return unmarshaler, textUnmarshaler, v
+				}
+			}
+
+			return nil, nil, v
+		}
+
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+
+		if unmarshaler, textUnmarshaler := unmarshalers(v); unmarshaler != nil || textUnmarshaler != nil {
+			return unmarshaler, textUnmarshaler, v
+		}
+
+		v = v.Elem()
+	}
+}
+
+// returns whichever of the decoding interfaces the given pointer implements, preferring
+// Unmarshaler
+func unmarshalers(ptr reflect.Value) (Unmarshaler, encoding.TextUnmarshaler) {
+	if ptr.Type().NumMethod() == 0 || !ptr.CanInterface() {
+		return nil, nil
+	}
+
+	if unmarshaler, ok := ptr.Interface().(Unmarshaler); ok {
+		return unmarshaler, nil
+	}
+
+	textUnmarshaler, _ := ptr.Interface().(encoding.TextUnmarshaler)
+	return nil, textUnmarshaler
+}
+
+func (self *decodeState) setString(node ast.Node, str string, v reflect.Value, path *valuePath) error {
+	switch {
+	case v.Kind() == reflect.String:
+		v.SetString(str)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		v.SetBytes([]byte(str))
+	default:
+		return self.typeError(node, v.Type(), path)
+	}
+
+	return nil
+}
+
+// stores an integer written in Go syntax, reporting false if the value cannot hold it
+func setInteger(v reflect.Value, literal string) bool {
+	n, ok := new(big.Int).SetString(literal, 0)
+
+	if !ok {
+		return false
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !n.IsInt64() || v.OverflowInt(n.Int64()) {
+			return false
+		}
+
+		v.SetInt(n.Int64())
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if !n.IsUint64() || v.OverflowUint(n.Uint64()) {
+			return false
+		}
+
+		v.SetUint(n.Uint64())
+
+	case reflect.Float32, reflect.Float64:
+		f, _ := new(big.Float).SetInt(n).Float64()
+
+		if v.OverflowFloat(f) {
+			return false
+		}
+
+		v.SetFloat(f)
+
+	default:
+		return false
+	}
+
+	return true
+}
+
+// stores a floating-point number, reporting false if the value cannot hold it
+func setFloat(v reflect.Value, literal string) bool {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(literal, v.Type().Bits())
+
+		if err != nil {
+			return false
+		}
+
+		v.SetFloat(f)
+		return true
+	}
+
+	return false
+}
+
+// stores a boolean or number that was written as a string, reporting false if it is not one
+func setQuoted(v reflect.Value, str string) bool {
+	switch v.Kind() {
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(str); err == nil {
+			v.SetBool(b)
+			return true
+		}
+
+		return false
+
+	case reflect.Float32, reflect.Float64:
+		return setFloat(v, str) || setInteger(v, str)
+	}
+
+	return setInteger(v, str)
+}
+
+func (self *decodeState) array(node *ast.Array, v reflect.Value, options tagOptions, path *valuePath) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		slice := reflect.MakeSlice(v.Type(), len(node.Elements), len(node.Elements))
+
+		for i, element := range node.Elements {
+			if err := self.value(element, slice.Index(i), options, path.Index(i)); err != nil {
+				return err
+			}
+		}
+
+		v.Set(slice)
+
+	case reflect.Array:
+		// as with encoding/json, extra elements are dropped and missing ones zeroed
+		for i := 0; i < v.Len(); i++ {
+			if i < len(node.Elements) {
+				if err := self.value(node.Elements[i], v.Index(i), options, path.Index(i)); err != nil {
+					return err
+				}
+			} else {
+				v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+			}
+		}
+
+	default:
+		return self.typeError(node, v.Type(), path)
+	}
+
+	return nil
+}
+
+// reports whether a value can be used as a Go map key, which (unlike its type being
+// comparable) also requires that any interfaces within it hold comparable values
+func isHashable(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Interface:
+		return v.IsNil() || isHashable(v.Elem())
+
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !isHashable(v.Field(i)) {
+				return false
+			}
+		}
+
+		return true
+
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if !isHashable(v.Index(i)) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return v.Type().Comparable()
+}
+
+// returns the pairs of a hash, failing on anything else (such as a double splat)
+func (self *decodeState) pairs(node *ast.Hash) ([]*ast.Pair, error) {
+	pairs := make([]*ast.Pair, len(node.Pairs))
+
+	for i, entry := range node.Pairs {
+		if pair, ok := entry.(*ast.Pair); ok {
+			pairs[i] = pair
+		} else {
+			return nil, self.unsupported(entry)
+		}
+	}
+
+	return pairs, nil
+}
+
+func (self *decodeState) hashToMap(node *ast.Hash, v reflect.Value, options tagOptions, path *valuePath) error {
+	pairs, err := self.pairs(node)
+
+	if err != nil {
+		return err
+	}
+
+	t := v.Type()
+
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(t))
+	}
+
+	seen := make(map[interface{}]bool, len(pairs))
+
+	for _, pair := range pairs {
+		key := reflect.New(t.Key()).Elem()
+
+		if err := self.value(pair.Key, key, nil, path); err != nil {
+			return err
+		} else if !isHashable(key) {
+			// such as an array or hash decoded into an interface{} key
+			return self.typeError(pair.Key, t, path)
+		}
+
+		// keys are compared once decoded (and known to be hashable), so 'a' and :a are the
+		// same key of a map[string]T
+		if self.disallowDuplicateKeys {
+			if seen[key.Interface()] {
+				return self.duplicateKey(pair.Key, t, path)
+			}
+
+			seen[key.Interface()] = true
+		}
+
+		elem := reflect.New(t.Elem()).Elem()
+
+		if err := self.value(pair.Value, elem, options, path.Key(key.Interface())); err != nil {
+			return err
+		}
+
+		v.SetMapIndex(key, elem)
+	}
+
+	return nil
+}
+
+func (self *decodeState) hashToStruct(node *ast.Hash, v reflect.Value, path *valuePath) error {
+	pairs, err := self.pairs(node)
+
+	if err != nil {
+		return err
+	}
+
+	fields, err := typeFields(v.Type(), self.tagKeys, self.fieldNaming)
+
+	if err != nil {
+		return err
+	}
+
+	byName := make(map[string]structField, len(fields))
+	byFoldedName := make(map[string]structField, len(fields))
+
+	for _, field := range fields {
+		byName[field.Name] = field
+
+		// where names differ only in case, the first field is the one matched
+		if _, ok := byFoldedName[strings.ToLower(field.Name)]; !ok {
+			byFoldedName[strings.ToLower(field.Name)] = field
+		}
+	}
+
+	seen := make(map[string]bool, len(pairs))
+
+	for _, pair := range pairs {
+		// keys that are not strings or symbols cannot name a field
+		name, ok := stringLiteral(pair.Key)
+		field, found := byName[name]
+
+		// an exact match is preferred to one that ignores case
+		if ok && !found && self.caseInsensitive {
+			field, found = byFoldedName[strings.ToLower(name)]
+		}
+
+		if !ok || !found {
+			if self.disallowUnknownFields {
+				return self.unknownField(pair.Key, v.Type(), path)
+			}
+
+			continue
+		}
+
+		if self.disallowDuplicateKeys {
+			if seen[field.Name] {
+				return self.duplicateKey(pair.Key, v.Type(), path)
+			}
+
+			seen[field.Name] = true
+		}
+
+		if err := self.value(pair.Value, fieldForDecode(v, field.Index), field.Options, path.Field(field.GoName)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodes a call to the constructor of the Ruby class a struct names (as the encoder
+// writes them, e.g.: MyApp::Endpoint.new(host: 'x', port: 1)) into the struct; positional
+// arguments set its fields in order, and keyword arguments the fields they name
+func (self *decodeState) callToStruct(node *ast.Call, v reflect.Value, path *valuePath) error {
+	name := constName(node.Receiver)
+
+	if name == `` || node.Name != `new` || node.Block != nil {
+		return self.unsupported(node)
+	}
+
+	class := typeClass(v.Type(), self.tagKeys)
+
+	if v.Type().Implements(classNamerType) {
+		class.Name = v.Interface().(ClassNamer).RubyClass()
+	} else if v.CanAddr() && v.Addr().Type().Implements(classNamerType) {
+		class.Name = v.Addr().Interface().(ClassNamer).RubyClass()
+	}
+
+	if class.Name == `` || strings.TrimPrefix(class.Name, `::`) != name {
+		return self.typeError(node, v.Type(), path)
+	}
+
+	args := node.Args
+	var keywords *ast.Hash
+
+	if n := len(args); n > 0 {
+		if hash, ok := args[n-1].(*ast.Hash); ok && !hash.Braces {
+			args, keywords = args[:n-1], hash
+		}
+	}
+
+	fields, err := typeFields(v.Type(), self.tagKeys, self.fieldNaming)
+
+	if err != nil {
+		return err
+	} else if len(args) > len(fields) {
+		return self.typeError(args[len(fields)], v.Type(), path)
+	}
+
+	for i, arg := range args {
+		field := fields[i]
+
+		if err := self.value(arg, fieldForDecode(v, field.Index), field.Options, path.Field(field.GoName)); err != nil {
+			return err
+		}
+	}
+
+	if keywords != nil {
+		return self.hashToStruct(keywords, v, path)
+	}
+
+	return nil
+}
+
+// returns the contents of a string or symbol literal
+func stringLiteral(key ast.Expr) (string, bool) {
+	switch k := key.(type) {
+	case *ast.String:
+		return k.Literal()
+	case *ast.Symbol:
+		return k.Literal()
+	}
+
+	return ``, false
+}
+
+// retrieves a (possibly inlined) field, allocating any nil pointers along the way
+func fieldForDecode(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 {
+			for v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					v.Set(reflect.New(v.Type().Elem()))
+				}
+
+				v = v.Elem()
+			}
+		}
+
+		v = v.Field(x)
+	}
+
+	return v
+}
+
+// returns the Go value used to represent a Ruby literal when decoding into an interface{},
+// as tabulated in the documentation of Unmarshal
+func (self *decodeState) interfaceValue(node ast.Expr, path *valuePath) (interface{}, error) {
+	for {
+		if paren, ok := node.(*ast.Paren); ok && len(paren.Body) == 1 {
+			node = paren.Body[0]
+		} else {
+			break
+		}
+	}
+
+	if err := self.interpolate(node); err != nil {
+		return nil, err
+	}
+
+	if value, ok, err := self.interfaceTypeValue(node, path); ok {
+		return value, err
+	}
+
+	if kind, literal, ok := numericLiteral(node); ok {
+		if self.useNumber {
+			return numberValue(kind, literal), nil
+		}
+
+		if kind == `float` {
+			if f, err := strconv.ParseFloat(literal, 64); err == nil {
+				return f, nil
+			}
+
+			return nil, self.typeError(node, reflect.TypeOf(float64(0)), path)
+		}
+
+		n, _ := new(big.Int).SetString(literal, 0)
+
+		if n.IsInt64() {
+			return n.Int64(), nil
+		}
+
+		return n, nil
+	}
+
+	switch n := node.(type) {
+	case *ast.Nil:
+		return nil, nil
+
+	case *ast.Bool:
+		return n.Value, nil
+
+	case *ast.String:
+		if str, ok := n.Literal(); ok {
+			return str, nil
+		}
+
+		return nil, self.unsupported(node)
+
+	case *ast.Symbol:
+		if name, ok := n.Literal(); ok {
+			return Symbol(name), nil
+		}
+
+		return nil, self.unsupported(node)
+
+	case *ast.Array:
+		values := make([]interface{}, len(n.Elements))
+
+		for i, element := range n.Elements {
+			value, err := self.interfaceValue(element, path.Index(i))
+
+			if err != nil {
+				return nil, err
+			}
+
+			values[i] = value
+		}
+
+		return values, nil
+
+	case *ast.Hash:
+		return self.interfaceHash(n, path)
+	}
+
+	return nil, self.unsupported(node)
+}
+
+func (self *decodeState) interfaceHash(node *ast.Hash, path *valuePath) (interface{}, error) {
+	pairs, err := self.pairs(node)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]interface{}, len(pairs))
+	named := true
+	symbols := make(map[string]bool, len(pairs))
+
+	for i, pair := range pairs {
+		if name, ok := stringLiteral(pair.Key); ok {
+			_, symbol := pair.Key.(*ast.Symbol)
+
+			// a symbol and a string of the same name are different keys, which
+			// map[string]interface{} would merge
+			if isSymbol, seen := symbols[name]; seen && isSymbol != symbol {
+				named = false
+			}
+
+			symbols[name] = symbol
+			keys[i] = name
+			continue
+		}
+
+		key, err := self.interfaceValue(pair.Key, path)
+
+		if err != nil {
+			return nil, err
+		} else if !isHashable(reflect.ValueOf(&key).Elem()) {
+			return nil, self.typeError(pair.Key, reflect.TypeOf(map[interface{}]interface{}(nil)), path)
+		}
+
+		keys[i] = key
+		named = false
+	}
+
+	// without a map[string]interface{}, symbol keys are kept as Symbols
+	if !named {
+		for i, pair := range pairs {
+			if _, ok := pair.Key.(*ast.Symbol); ok {
+				keys[i] = Symbol(keys[i].(string))
+			}
+		}
+	}
+
+	if self.disallowDuplicateKeys {
+		t := reflect.TypeOf(map[interface{}]interface{}(nil))
+
+		if named {
+			t = reflect.TypeOf(map[string]interface{}(nil))
+		}
+
+		seen := make(map[interface{}]bool, len(keys))
+
+		for i, key := range keys {
+			if seen[key] {
+				return nil, self.duplicateKey(pairs[i].Key, t, path)
+			}
+
+			seen[key] = true
+		}
+	}
+
+	if named {
+		hash := make(map[string]interface{}, len(pairs))
+
+		for i, pair := range pairs {
+			name := keys[i].(string)
+			value, err := self.interfaceValue(pair.Value, path.Key(name))
+
+			if err != nil {
+				return nil, err
+			}
+
+			hash[name] = value
+		}
+
+		return hash, nil
+	}
+
+	hash := make(map[interface{}]interface{}, len(pairs))
+
+	for i, pair := range pairs {
+		value, err := self.interfaceValue(pair.Value, path.Key(keys[i]))
+
+		if err != nil {
+			return nil, err
+		}
+
+		hash[keys[i]] = value
+	}
+
+	return hash, nil
+}
@@ -0,0 +1,267 @@
+package ruby
+
+import (
+	"database/sql"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+type TestDecodeInner struct {
+	Host string `ruby:"host"`
+	Port uint16 `ruby:"port"`
+}
+
+type TestDecodeStruct struct {
+	Name    string                 `ruby:"name"`
+	Enabled bool                   `ruby:"enabled"`
+	Ratio   float64                `ruby:"ratio"`
+	Mode    int                    `ruby:"mode,octal"`
+	Limit   int                    `ruby:"limit,string"`
+	Kind    string                 `ruby:"kind,symbol"`
+	Code    string                 `ruby:"code,raw"`
+	Tags    []string               `ruby:"tags"`
+	Servers []*TestDecodeInner     `ruby:"servers"`
+	Extra   map[string]interface{} `ruby:"extra"`
+	Pair    [2]int                 `ruby:"pair"`
+	Missing *TestDecodeInner       `ruby:"missing"`
+}
+
+func TestUnmarshalRoundTrip(t *testing.T) {
+	in := TestDecodeStruct{
+		Name:    `test`,
+		Enabled: true,
+		Ratio:   0.25,
+		Mode:    0755,
+		Limit:   42,
+		Kind:    `primary`,
+		Code:    `Time.now`,
+		Tags:    []string{`a`, `b's`},
+		Servers: []*TestDecodeInner{{Host: `localhost`, Port: 8080}},
+		Extra:   map[string]interface{}{`nested`: []interface{}{int64(1), `two`, nil}},
+		Pair:    [2]int{-1, 2},
+	}
+
+	data, err := MarshalIndent(in, ``, `  `)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out TestDecodeStruct
+
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("Expected %+v, got %+v (from %s)", in, out, data)
+	}
+}
+
+func TestUnmarshalRoundTripTypes(t *testing.T) {
+	n := 7
+
+	for _, in := range []interface{}{
+		true,
+		int8(-128),
+		int16(32767),
+		int32(-5),
+		int64(-9223372036854775808),
+		uint8(255),
+		uint64(18446744073709551615),
+		float32(3.14159265),
+		1e300,
+		-0.5,
+		`it's a \ test`,
+		Symbol(`with space`),
+		Number(`12345678901234567890.5`),
+		[3]string{`a`, ``, `c`},
+		map[Symbol]int{`a`: 1},
+		map[int]string{1: `one`, -2: `two`},
+		map[interface{}]interface{}{int64(1): `x`, `y`: nil},
+		&n,
+		Range{Begin: `a`, End: nil},
+		Set{int64(1), `b`},
+		sql.NullString{String: `x`, Valid: true},
+		sql.NullInt64{},
+		[]sql.NullBool{{Bool: false, Valid: true}, {}},
+	} {
+		data, err := Marshal(in)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out := reflect.New(reflect.TypeOf(in))
+
+		if err := Unmarshal(data, out.Interface()); err != nil {
+			t.Fatalf("%s: %v", data, err)
+		} else if !reflect.DeepEqual(in, out.Elem().Interface()) {
+			t.Fatalf("Expected %#v, got %#v (from %s)", in, out.Elem().Interface(), data)
+		}
+	}
+}
+
+func TestUnmarshalScalars(t *testing.T) {
+	var i int8
+	var u uint
+	var f float32
+	var s string
+	var b []byte
+	var p *int
+
+	for src, target := range map[string]interface{}{
+		`-0x10`:               &i,
+		`1_000`:               &u,
+		`1.5e3`:               &f,
+		`:"a b"`:              &s,
+		"<<~EOS\n  text\nEOS": &b,
+		`(12)`:                &p,
+	} {
+		if err := Unmarshal([]byte(src), target); err != nil {
+			t.Fatalf("Unexpected error decoding %q: %v", src, err)
+		}
+	}
+
+	if i != -16 || u != 1000 || f != 1500 || s != `a b` || string(b) != "text\n" || *p != 12 {
+		t.Fatalf("Unexpected values: %v %v %v %q %q %v", i, u, f, s, b, *p)
+	}
+
+	if err := Unmarshal([]byte(`nil`), &p); err != nil || p != nil {
+		t.Fatalf("Expected nil to clear the pointer, got %v (%v)", p, err)
+	}
+}
+
+func TestUnmarshalInterface(t *testing.T) {
+	var out interface{}
+
+	src := `{'name'=>'x', :list=>[1, 2.5, true, nil], big: 123456789012345678901234567890, 'h'=>{1=>'one', 'two'=>2}}`
+
+	if err := Unmarshal([]byte(src), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	huge, _ := new(big.Int).SetString(`123456789012345678901234567890`, 10)
+
+	shouldBe := map[string]interface{}{
+		`name`: `x`,
+		`list`: []interface{}{int64(1), 2.5, true, nil},
+		`big`:  huge,
+		`h`: map[interface{}]interface{}{
+			int64(1): `one`,
+			`two`:    int64(2),
+		},
+	}
+
+	if !reflect.DeepEqual(out, shouldBe) {
+		t.Fatalf("Expected %#v, got %#v", shouldBe, out)
+	}
+}
+
+func TestUnmarshalInterfaceSymbolAndStringKeys(t *testing.T) {
+	var out interface{}
+
+	// a symbol and a string of the same name are different keys, and both are kept
+	if err := Unmarshal([]byte(`{a: 1, 'a' => 2, 'b' => 3}`), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	shouldBe := map[interface{}]interface{}{
+		Symbol(`a`): int64(1),
+		`a`:         int64(2),
+		`b`:         int64(3),
+	}
+
+	if !reflect.DeepEqual(out, shouldBe) {
+		t.Fatalf("Expected %#v, got %#v", shouldBe, out)
+	}
+
+	data, err := Marshal(out)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var again interface{}
+
+	if err := Unmarshal(data, &again); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(again, shouldBe) {
+		t.Fatalf("Expected %#v, got %#v (from %s)", shouldBe, again, data)
+	}
+}
+
+func TestUnmarshalSyntaxError(t *testing.T) {
+	var out interface{}
+
+	err := Unmarshal([]byte("{\n  'a' => [1, 2\n  'b' => 3\n}"), &out)
+
+	var syntaxErr *SyntaxError
+
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("Expected *SyntaxError, got %T (%v)", err, err)
+	}
+
+	if syntaxErr.Line != 3 || syntaxErr.Column != 3 || syntaxErr.Offset != 19 {
+		t.Fatalf("Expected line 3, column 3 (offset 19), got line %d, column %d (offset %d)", syntaxErr.Line, syntaxErr.Column, syntaxErr.Offset)
+	}
+
+	if shouldBe := "Expected ']', found string ''b'' at line 3, column 3\n      'b' => 3\n      ^"; err.Error() != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, err.Error())
+	}
+
+	err = Unmarshal([]byte("[1,\n\t:a, File.read(1)]"), &out)
+
+	if shouldBe := "Cannot decode 'File.read(1)', only literal values are supported at line 2, column 6\n    \t:a, File.read(1)]\n    \t    ^"; err == nil || err.Error() != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%v\"", shouldBe, err)
+	}
+}
+
+func TestUnmarshalTypeError(t *testing.T) {
+	var out TestDecodeStruct
+
+	err := Unmarshal([]byte("{\n  'name' => 'x',\n  'servers' => [{'host' => 'a', 'port' => 70000}],\n}"), &out)
+
+	var typeErr *UnmarshalTypeError
+
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("Expected *UnmarshalTypeError, got %T (%v)", err, err)
+	}
+
+	if typeErr.Path != `Servers[0].Port` || typeErr.Value != `integer 70000` || typeErr.Type != reflect.TypeOf(uint16(0)) {
+		t.Fatalf("Unexpected error fields: %+v", typeErr)
+	}
+
+	if shouldBe := "Cannot decode Ruby integer 70000 into Go value of type 'uint16' at Servers[0].Port, line 3, column 43\n      'servers' => [{'host' => 'a', 'port' => 70000}],\n                                              ^"; err.Error() != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, err.Error())
+	}
+}
+
+func TestUnmarshalInvalidTarget(t *testing.T) {
+	var out map[string]interface{}
+
+	for _, target := range []interface{}{nil, out, (*int)(nil)} {
+		var invalid *InvalidUnmarshalError
+
+		if err := Unmarshal([]byte(`{}`), target); !errors.As(err, &invalid) {
+			t.Fatalf("Expected *InvalidUnmarshalError for %T, got %v", target, err)
+		}
+	}
+}
+
+func TestUnmarshalUnhashableKey(t *testing.T) {
+	var out map[interface{}]interface{}
+	var iface interface{}
+
+	for _, target := range []interface{}{&out, &iface} {
+		var typeErr *UnmarshalTypeError
+
+		if err := Unmarshal([]byte(`{[1] => 2}`), target); !errors.As(err, &typeErr) {
+			t.Fatalf("Expected *UnmarshalTypeError, got %T (%v)", err, err)
+		} else if typeErr.Value != `array` || typeErr.Column != 2 {
+			t.Fatalf("Unexpected error fields: %+v", typeErr)
+		}
+	}
+}
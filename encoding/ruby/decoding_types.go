@@ -0,0 +1,688 @@
+package ruby
+
+import (
+	"fmt"
+	"github.com/ghetzel/rubyutils/encoding/ruby/ast"
+	"math"
+	"math/big"
+	"net"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UTC offsets given to Time.at, e.g.: in: '+09:00'
+var rxTimeOffset = regexp.MustCompile(`^([-+])([0-9]{2}):?([0-9]{2})$`)
+
+// the fractions of a second that may be given to Time.at, in nanoseconds
+var timeUnits = map[string]int64{
+	`millisecond`: 1e6,
+	`usec`:        1e3,
+	`microsecond`: 1e3,
+	`nsec`:        1,
+	`nanosecond`:  1,
+}
+
+// decodes the Ruby expressions that are written for types with a dedicated Ruby
+// representation (and the constants Float::INFINITY and Float::NAN), including those of
+// the standard library such as IPAddr.new('10.0.0.0/8'), reporting false if
+// the node is not one of them or the value is not of a type that can hold it
+func (self *decodeState) typeValue(node ast.Expr, v reflect.Value, path *valuePath) (bool, error) {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if f, ok := floatConstant(node); ok {
+			v.SetFloat(f)
+			return true, nil
+		}
+
+		return false, nil
+
+	case reflect.String:
+		if str, ok := pathnameLiteral(node); ok {
+			v.SetString(str)
+			return true, nil
+		}
+
+		return false, nil
+	}
+
+	// the remaining types are set through a pointer, as those in math/big must be
+	ptr := v
+
+	if v.Kind() != reflect.Ptr {
+		if !v.CanAddr() {
+			return false, nil
+		}
+
+		ptr = v.Addr()
+	}
+
+	if !ptr.CanInterface() {
+		return false, nil
+	}
+
+	switch target := ptr.Interface().(type) {
+	case *Range:
+		rng, ok := node.(*ast.Range)
+
+		if !ok {
+			return false, nil
+		}
+
+		value, err := self.rangeValue(rng, path)
+
+		if err != nil {
+			return true, err
+		}
+
+		*target = value
+
+	case *Set:
+		elements, ok := setElements(node)
+
+		if !ok {
+			return false, nil
+		}
+
+		value, err := self.setValue(elements, path)
+
+		if err != nil {
+			return true, err
+		}
+
+		*target = value
+
+	case *Regexp:
+		rx, ok := node.(*ast.Regexp)
+
+		if !ok {
+			return false, nil
+		}
+
+		value, err := self.regexpValue(rx)
+
+		if err != nil {
+			return true, err
+		}
+
+		*target = value
+
+	case *regexp.Regexp:
+		rx, ok := node.(*ast.Regexp)
+
+		if !ok {
+			return false, nil
+		}
+
+		value, err := self.regexpValue(rx)
+
+		if err != nil {
+			return true, err
+		}
+
+		compiled, err := goRegexp(value)
+
+		if err != nil {
+			return true, self.unmarshalerError(node, v.Type(), path, err)
+		}
+
+		*target = *compiled
+
+	case *time.Time:
+		call, ok := node.(*ast.Call)
+
+		if !ok || !isTimeAt(call) {
+			return false, nil
+		}
+
+		value, ok := timeValue(call)
+
+		if !ok {
+			return true, self.unsupported(node)
+		}
+
+		*target = value
+
+	case *net.IP:
+		address, ok := ipAddrLiteral(node)
+
+		if !ok {
+			return false, nil
+		} else if ip := net.ParseIP(address); ip != nil {
+			*target = ip
+		} else {
+			return true, self.unmarshalerError(node, v.Type(), path, &net.ParseError{Type: `IP address`, Text: address})
+		}
+
+	case *netip.Addr:
+		address, ok := ipAddrLiteral(node)
+
+		if !ok {
+			return false, nil
+		}
+
+		value, err := netip.ParseAddr(address)
+
+		if err != nil {
+			return true, self.unmarshalerError(node, v.Type(), path, err)
+		}
+
+		*target = value
+
+	case *net.IPNet:
+		address, ok := ipAddrLiteral(node)
+
+		if !ok {
+			return false, nil
+		}
+
+		prefix, err := ipPrefix(address)
+
+		if err != nil {
+			return true, self.unmarshalerError(node, v.Type(), path, err)
+		}
+
+		_, network, _ := net.ParseCIDR(prefix.String())
+		*target = *network
+
+	case *netip.Prefix:
+		address, ok := ipAddrLiteral(node)
+
+		if !ok {
+			return false, nil
+		}
+
+		value, err := ipPrefix(address)
+
+		if err != nil {
+			return true, self.unmarshalerError(node, v.Type(), path, err)
+		}
+
+		*target = value
+
+	case *url.URL:
+		str, ok := uriLiteral(node)
+
+		if !ok {
+			return false, nil
+		}
+
+		value, err := url.Parse(str)
+
+		if err != nil {
+			return true, self.unmarshalerError(node, v.Type(), path, err)
+		}
+
+		*target = *value
+
+	case *big.Rat:
+		if value, ok := rationalValue(node); ok {
+			target.Set(value)
+		} else if kind, literal, ok := numericLiteral(node); ok && kind == `integer` {
+			n, _ := new(big.Int).SetString(literal, 0)
+			target.SetInt(n)
+		} else {
+			return false, nil
+		}
+
+	case *big.Int:
+		kind, literal, ok := numericLiteral(node)
+
+		if !ok || kind != `integer` {
+			return false, nil
+		}
+
+		target.SetString(literal, 0)
+
+	case *big.Float:
+		kind, literal, ok := numericLiteral(node)
+
+		if !ok {
+			return false, nil
+		} else if kind == `integer` {
+			n, _ := new(big.Int).SetString(literal, 0)
+			target.SetInt(n)
+		} else if _, ok := target.SetString(literal); !ok {
+			return true, self.typeError(node, v.Type(), path)
+		}
+
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// returns the Go value for the Ruby expressions handled by typeValue, as it is stored in
+// an interface{}, reporting false if the node is not one of them
+func (self *decodeState) interfaceTypeValue(node ast.Expr, path *valuePath) (interface{}, bool, error) {
+	if f, ok := floatConstant(node); ok {
+		return f, true, nil
+	} else if str, ok := pathnameLiteral(node); ok {
+		return str, true, nil
+	} else if str, ok := ipAddrLiteral(node); ok {
+		return str, true, nil
+	} else if str, ok := uriLiteral(node); ok {
+		return str, true, nil
+	} else if rat, ok := rationalValue(node); ok {
+		return rat, true, nil
+	} else if elements, ok := setElements(node); ok {
+		value, err := self.setValue(elements, path)
+		return value, true, err
+	}
+
+	switch n := node.(type) {
+	case *ast.Range:
+		value, err := self.rangeValue(n, path)
+		return value, true, err
+
+	case *ast.Regexp:
+		value, err := self.regexpValue(n)
+		return value, true, err
+
+	case *ast.Call:
+		if isTimeAt(n) {
+			if value, ok := timeValue(n); ok {
+				return value, true, nil
+			}
+
+			return nil, true, self.unsupported(node)
+		}
+	}
+
+	return nil, false, nil
+}
+
+func (self *decodeState) rangeValue(node *ast.Range, path *valuePath) (Range, error) {
+	rng := Range{
+		Exclusive: node.Exclusive,
+	}
+
+	var err error
+
+	if node.Low != nil {
+		if rng.Begin, err = self.interfaceValue(node.Low, path.Field(`Begin`)); err != nil {
+			return Range{}, err
+		}
+	}
+
+	if node.High != nil {
+		if rng.End, err = self.interfaceValue(node.High, path.Field(`End`)); err != nil {
+			return Range{}, err
+		}
+	}
+
+	return rng, nil
+}
+
+func (self *decodeState) setValue(elements []ast.Expr, path *valuePath) (Set, error) {
+	set := make(Set, len(elements))
+
+	for i, element := range elements {
+		value, err := self.interfaceValue(element, path.Index(i))
+
+		if err != nil {
+			return nil, err
+		}
+
+		set[i] = value
+	}
+
+	return set, nil
+}
+
+func (self *decodeState) regexpValue(node *ast.Regexp) (Regexp, error) {
+	source, ok := node.Literal()
+
+	if !ok {
+		return Regexp{}, self.unsupported(node)
+	}
+
+	return Regexp{
+		Source: source,
+		Flags:  node.Flags,
+	}, nil
+}
+
+// compiles a Ruby regular expression as a Go one; only the flags that Go supports (i and
+// m, which in Ruby lets . match newlines) are allowed
+func goRegexp(rx Regexp) (*regexp.Regexp, error) {
+	var flags string
+
+	for _, flag := range rx.Flags {
+		switch flag {
+		case 'i':
+			flags += `i`
+		case 'm':
+			flags += `s`
+		case 'n', 'e', 's', 'u', 'o':
+			// encodings and interpolation have no bearing on the pattern
+		default:
+			return nil, fmt.Errorf("Ruby regular expression flag '%c' has no equivalent in Go", flag)
+		}
+	}
+
+	if flags != `` {
+		return regexp.Compile(`(?` + flags + `)` + rx.Source)
+	}
+
+	return regexp.Compile(rx.Source)
+}
+
+// returns the name of a constant, including the constants it is qualified by, e.g.:
+// "Float::INFINITY", or nothing if it is qualified by anything else
+func constName(node ast.Expr) string {
+	c, ok := node.(*ast.Const)
+
+	if !ok {
+		return ``
+	} else if c.Scope == nil {
+		return c.Name
+	} else if scope := constName(c.Scope); scope != `` {
+		return scope + `::` + c.Name
+	}
+
+	return ``
+}
+
+// returns the value of Float::INFINITY or Float::NAN, either of which may be signed
+func floatConstant(node ast.Expr) (float64, bool) {
+	sign := 1
+
+	if unary, ok := node.(*ast.Unary); ok && (unary.Operator == `-` || unary.Operator == `+`) {
+		node = unary.Operand
+
+		if unary.Operator == `-` {
+			sign = -1
+		}
+	}
+
+	switch constName(node) {
+	case `Float::INFINITY`:
+		return math.Inf(sign), true
+	case `Float::NAN`:
+		return math.NaN(), true
+	}
+
+	return 0, false
+}
+
+// returns the value of a rational literal (3r, -1.5r or 1/3r) or a call to Rational with
+// literal arguments, e.g.: Rational(1, 3) or Rational('0.75')
+func rationalValue(node ast.Expr) (*big.Rat, bool) {
+	switch n := node.(type) {
+	case *ast.Rational:
+		return new(big.Rat).SetString(n.Value)
+
+	case *ast.Unary:
+		if n.Operator == `-` || n.Operator == `+` {
+			if rat, ok := n.Operand.(*ast.Rational); ok {
+				if value, ok := new(big.Rat).SetString(rat.Value); ok {
+					if n.Operator == `-` {
+						value.Neg(value)
+					}
+
+					return value, true
+				}
+			}
+		}
+
+	case *ast.Binary:
+		if _, ok := n.Right.(*ast.Rational); ok && n.Operator == `/` {
+			return ratioValue(n.Left, n.Right)
+		}
+
+	case *ast.Call:
+		if n.Receiver == nil && n.Name == `Rational` && n.Block == nil {
+			switch len(n.Args) {
+			case 1:
+				return rationalArgument(n.Args[0])
+			case 2:
+				return ratioValue(n.Args[0], n.Args[1])
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// returns the first of two numbers divided by the second
+func ratioValue(numerator ast.Expr, denominator ast.Expr) (*big.Rat, bool) {
+	a, ok := rationalArgument(numerator)
+
+	if !ok {
+		return nil, false
+	}
+
+	b, ok := rationalArgument(denominator)
+
+	if !ok || b.Sign() == 0 {
+		return nil, false
+	}
+
+	return a.Quo(a, b), true
+}
+
+// returns a number given to Rational, which may be any numeric literal or a string
+func rationalArgument(node ast.Expr) (*big.Rat, bool) {
+	if kind, literal, ok := numericLiteral(node); ok {
+		if kind == `integer` {
+			n, ok := new(big.Int).SetString(literal, 0)
+
+			if !ok {
+				return nil, false
+			}
+
+			return new(big.Rat).SetInt(n), true
+		}
+
+		return new(big.Rat).SetString(literal)
+	} else if str, ok := node.(*ast.String); ok {
+		if literal, ok := str.Literal(); ok {
+			return new(big.Rat).SetString(strings.Replace(strings.TrimSpace(literal), `_`, ``, -1))
+		}
+	}
+
+	return rationalValue(node)
+}
+
+// returns the elements of a set, written as Set[...] or Set.new([...])
+func setElements(node ast.Expr) ([]ast.Expr, bool) {
+	switch n := node.(type) {
+	case *ast.Index:
+		if constName(n.Receiver) == `Set` {
+			return n.Args, true
+		}
+
+	case *ast.Call:
+		if constName(n.Receiver) != `Set` || n.Name != `new` || n.Block != nil {
+			break
+		} else if len(n.Args) == 0 {
+			return []ast.Expr{}, true
+		} else if array, ok := n.Args[0].(*ast.Array); ok && len(n.Args) == 1 {
+			return array.Elements, true
+		}
+	}
+
+	return nil, false
+}
+
+// returns the path given to Pathname.new, as written for fields tagged `pathname`
+func pathnameLiteral(node ast.Expr) (string, bool) {
+	return stringArgument(node, `Pathname`, `new`)
+}
+
+// returns the address given to IPAddr.new, as written for IP addresses and networks
+func ipAddrLiteral(node ast.Expr) (string, bool) {
+	return stringArgument(node, `IPAddr`, `new`)
+}
+
+// returns the URL given to URI (or URI.parse), as written for URLs
+func uriLiteral(node ast.Expr) (string, bool) {
+	if str, ok := stringArgument(node, ``, `URI`); ok {
+		return str, true
+	}
+
+	return stringArgument(node, `URI`, `parse`)
+}
+
+// returns the string literal given as the only argument of a call to the named method of
+// the named constant (or, if none is named, of self), e.g.: Pathname.new('/etc/hosts')
+func stringArgument(node ast.Expr, receiver string, method string) (string, bool) {
+	call, ok := node.(*ast.Call)
+
+	if !ok || call.Name != method || len(call.Args) != 1 || call.Block != nil {
+		return ``, false
+	} else if receiver == `` && call.Receiver != nil {
+		return ``, false
+	} else if receiver != `` && constName(call.Receiver) != receiver {
+		return ``, false
+	}
+
+	if str, ok := call.Args[0].(*ast.String); ok {
+		return str.Literal()
+	}
+
+	return ``, false
+}
+
+// returns the network given to IPAddr.new, which (as in Ruby) is masked to its prefix
+// length and covers only the address itself if no prefix length is given
+func ipPrefix(address string) (netip.Prefix, error) {
+	if strings.Contains(address, `/`) {
+		prefix, err := netip.ParsePrefix(address)
+
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(address)
+
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func isTimeAt(call *ast.Call) bool {
+	return constName(call.Receiver) == `Time` && call.Name == `at` && call.Block == nil
+}
+
+// returns the time given by a call to Time.at, as written by the encoder: the seconds
+// since the Unix epoch, optionally followed by a fraction of a second (in microseconds
+// unless a unit is given) and the offset (in:) of its time zone
+func timeValue(call *ast.Call) (time.Time, bool) {
+	args := call.Args
+	location := time.Local
+
+	if len(args) > 0 {
+		if hash, ok := args[len(args)-1].(*ast.Hash); ok && !hash.Braces {
+			args = args[:len(args)-1]
+
+			if len(hash.Pairs) != 1 {
+				return time.Time{}, false
+			}
+
+			pair, ok := hash.Pairs[0].(*ast.Pair)
+
+			if !ok {
+				return time.Time{}, false
+			} else if key, ok := stringLiteral(pair.Key); !ok || key != `in` {
+				return time.Time{}, false
+			} else if zone, ok := stringLiteral(pair.Value); !ok {
+				return time.Time{}, false
+			} else if location, ok = timeLocation(zone); !ok {
+				return time.Time{}, false
+			}
+		}
+	}
+
+	if len(args) < 1 || len(args) > 3 {
+		return time.Time{}, false
+	}
+
+	seconds, ok := rationalArgument(args[0])
+
+	if !ok {
+		return time.Time{}, false
+	}
+
+	// the time in nanoseconds, which may not fit in an int64
+	nanoseconds := new(big.Rat).Mul(seconds, big.NewRat(1e9, 1))
+
+	if len(args) > 1 {
+		fraction, ok := rationalArgument(args[1])
+
+		if !ok {
+			return time.Time{}, false
+		}
+
+		unit := timeUnits[`usec`]
+
+		if len(args) > 2 {
+			name, ok := args[2].(*ast.Symbol)
+
+			if !ok {
+				return time.Time{}, false
+			} else if literal, ok := name.Literal(); !ok {
+				return time.Time{}, false
+			} else if unit, ok = timeUnits[literal]; !ok {
+				return time.Time{}, false
+			}
+		}
+
+		nanoseconds.Add(nanoseconds, fraction.Mul(fraction, big.NewRat(unit, 1)))
+	}
+
+	return unixTime(nanoseconds, location)
+}
+
+// returns the time the given number of nanoseconds since the Unix epoch, reporting false
+// if it is out of range
+func unixTime(nanoseconds *big.Rat, location *time.Location) (time.Time, bool) {
+	// Ruby rounds toward negative infinity, as Euclidean division does
+	sec, nsec := new(big.Int).DivMod(nanoseconds.Num(), nanoseconds.Denom(), new(big.Int))
+	sec, nsec = sec.DivMod(sec, big.NewInt(1e9), nsec)
+
+	if !sec.IsInt64() {
+		return time.Time{}, false
+	}
+
+	return time.Unix(sec.Int64(), nsec.Int64()).In(location), true
+}
+
+// returns the time zone for an offset given to Time.at, e.g.: "+09:00" or "UTC"
+func timeLocation(zone string) (*time.Location, bool) {
+	if zone == `UTC` || zone == `Z` {
+		return time.UTC, true
+	}
+
+	match := rxTimeOffset.FindStringSubmatch(zone)
+
+	if match == nil {
+		return nil, false
+	}
+
+	hours, _ := strconv.Atoi(match[2])
+	minutes, _ := strconv.Atoi(match[3])
+	offset := hours*3600 + minutes*60
+
+	if match[1] == `-` {
+		offset = -offset
+	}
+
+	// the encoder writes UTC as +00:00
+	if offset == 0 {
+		return time.UTC, true
+	}
+
+	return time.FixedZone(``, offset), true
+}
@@ -0,0 +1,163 @@
+package ruby
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+type TestDecodeTypes struct {
+	Kind    Symbol    `ruby:"kind"`
+	Name    string    `ruby:"name,symbol"`
+	Ports   Range     `ruby:"ports"`
+	Tags    Set       `ruby:"tags"`
+	Match   Regexp    `ruby:"match"`
+	Created time.Time `ruby:"created"`
+	Path    string    `ruby:"path,pathname"`
+}
+
+func TestUnmarshalTypesRoundTrip(t *testing.T) {
+	in := TestDecodeTypes{
+		Kind:    Symbol(`web`),
+		Name:    `primary`,
+		Ports:   Range{Begin: int64(8000), End: int64(8080), Exclusive: true},
+		Tags:    Set{`a`, Symbol(`b`), int64(3)},
+		Match:   Regexp{Source: `^a/b`, Flags: `i`},
+		Created: time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC),
+		Path:    `/etc/hosts`,
+	}
+
+	data, err := Marshal(in)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out TestDecodeTypes
+
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("Expected %+v, got %+v (from %s)", in, out, data)
+	}
+}
+
+func TestUnmarshalRegexpRoundTrip(t *testing.T) {
+	for _, source := range []string{`a/b`, `^/srv/(\w+)/`, `a\\/b`, `\d+\.\d+`} {
+		in := Regexp{Source: source}
+		data, err := Marshal(in)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out Regexp
+
+		if err := Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		} else if out != in {
+			t.Fatalf("Expected \"%s\", got \"%s\" (from %s)", in.Source, out.Source, data)
+		}
+	}
+}
+
+func TestUnmarshalTypesInterface(t *testing.T) {
+	var out interface{}
+
+	src := `[:a, (..5), 'a'...'z', Set[1], /x/m, Float::INFINITY, -Float::INFINITY, Rational(1, 3), -3r, 1/4r, Time.at(0, 1500, :millisecond, in: '-05:00'), Pathname.new('x')]`
+
+	if err := Unmarshal([]byte(src), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	values := out.([]interface{})
+
+	shouldBe := []interface{}{
+		Symbol(`a`),
+		Range{End: int64(5)},
+		Range{Begin: `a`, End: `z`, Exclusive: true},
+		Set{int64(1)},
+		Regexp{Source: `x`, Flags: `m`},
+		math.Inf(1),
+		math.Inf(-1),
+		big.NewRat(1, 3),
+		big.NewRat(-3, 1),
+		big.NewRat(1, 4),
+	}
+
+	if !reflect.DeepEqual(values[:len(shouldBe)], shouldBe) {
+		t.Fatalf("Expected %#v, got %#v", shouldBe, values[:len(shouldBe)])
+	}
+
+	if tm, ok := values[10].(time.Time); !ok || tm.UnixNano() != 1500000000 {
+		t.Fatalf("Expected 1.5 seconds after the epoch, got %v", values[10])
+	} else if _, offset := tm.Zone(); offset != -5*3600 {
+		t.Fatalf("Expected an offset of -05:00, got %d", offset)
+	}
+
+	if values[11] != `x` {
+		t.Fatalf("Expected \"x\", got \"%v\"", values[11])
+	}
+}
+
+func TestUnmarshalTypesTargets(t *testing.T) {
+	var nan, inf float32
+	var rat *big.Rat
+	var n big.Int
+	var rx *regexp.Regexp
+	var at time.Time
+	var sym Symbol
+	var name string
+
+	for src, target := range map[string]interface{}{
+		`Float::NAN`:                     &nan,
+		`-::Float::INFINITY`:             &inf,
+		`Rational('0.75')`:               &rat,
+		`123456789012345678901234567890`: &n,
+		`/^a.b$/mi`:                      &rx,
+		`Time.at(-1.5)`:                  &at,
+		`:sym`:                           &sym,
+		`:"plain name"`:                  &name,
+	} {
+		if err := Unmarshal([]byte(src), target); err != nil {
+			t.Fatalf("Unexpected error decoding %q: %v", src, err)
+		}
+	}
+
+	if !math.IsNaN(float64(nan)) || !math.IsInf(float64(inf), -1) {
+		t.Fatalf("Expected NaN and -Inf, got %v and %v", nan, inf)
+	}
+
+	if rat.Cmp(big.NewRat(3, 4)) != 0 {
+		t.Fatalf("Expected 3/4, got %v", rat)
+	}
+
+	if n.String() != `123456789012345678901234567890` {
+		t.Fatalf("Expected \"123456789012345678901234567890\", got \"%s\"", n.String())
+	}
+
+	if !rx.MatchString("A\nB") {
+		t.Fatalf("Expected %v to match across lines, ignoring case", rx)
+	}
+
+	if at.Unix() != -2 || at.Nanosecond() != 5e8 {
+		t.Fatalf("Expected 1.5 seconds before the epoch, got %v", at)
+	}
+
+	if sym != `sym` || name != `plain name` {
+		t.Fatalf("Unexpected values: %q %q", sym, name)
+	}
+
+	if err := Unmarshal([]byte(`/a/x`), &rx); err == nil {
+		t.Fatalf("Expected an error decoding a regular expression with the x flag")
+	}
+
+	if err := Unmarshal([]byte(`Time.at(0, in: 'Mars')`), &at); err == nil {
+		t.Fatalf("Expected an error decoding an unknown time zone")
+	}
+}
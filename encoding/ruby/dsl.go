@@ -0,0 +1,775 @@
+package ruby
+
+import (
+	"github.com/ghetzel/rubyutils/encoding/ruby/ast"
+	"github.com/ghetzel/rubyutils/encoding/ruby/parser"
+	"reflect"
+	"strings"
+)
+
+// A DSLReader reads configuration files written as a sequence of Ruby method calls (such
+// as knife.rb, a Puma config or a Vagrantfile) into Go values, binding each setting the
+// file makes to the struct field whose `ruby` tag names it.  The arguments of each call
+// are evaluated as an Evaluator would, so the file may use local variables, constants and
+// the other constant expressions that it supports.
+type DSLReader struct {
+	budget                int
+	disallowUnknownFields bool
+	variables             map[string]interface{}
+	tagKeys               []string
+	fieldNaming           NamingStrategy
+	filename              string
+}
+
+// A DSLCall records a method call made by a DSL file, for values that are to hold the
+// calls themselves rather than the settings they make.
+type DSLCall struct {
+	// the attributes the method was called on, e.g.: ["vm"] for config.vm.box = 'base'
+	Path []string
+
+	// the method's name as Ruby sees it, e.g.: "box=" for config.vm.box = 'base'
+	Name string
+
+	// the evaluated arguments, decoded as Unmarshal decodes into an interface{}
+	Args []interface{}
+
+	// the calls made within the block given to the method, or nil if none was given
+	Block []DSLCall
+}
+
+var dslCallsType = reflect.TypeOf([]DSLCall(nil))
+
+// how a call sets the value it names
+type dslMode int
+
+const (
+	dslCallMode   dslMode = iota // name value, which adds to lists
+	dslAssignMode                // set :name, value or config.name = value
+	dslAppendMode                // config.name << value
+)
+
+// a method call made by a DSL file, both as written and as the setting it makes
+type dslCall struct {
+	node   ast.Expr
+	path   []string
+	method string
+	args   []ast.Expr
+	block  *ast.Block
+
+	// the names leading to the setting (beginning at depth), where the last of them is
+	// written, the arguments giving its value and how it is set
+	names  []string
+	depth  int
+	key    ast.Node
+	values []ast.Expr
+	mode   dslMode
+}
+
+// reads DSL files into Go values
+type dslState struct {
+	*evalState
+}
+
+// NewDSLReader returns a new DSLReader with the default evaluation budget.
+func NewDSLReader() *DSLReader {
+	return &DSLReader{
+		budget: DefaultEvalBudget,
+	}
+}
+
+// UnmarshalDSL reads the Ruby DSL in data into the value pointed to by v with a new
+// DSLReader.
+func UnmarshalDSL(data []byte, v interface{}) error {
+	return NewDSLReader().Unmarshal(data, v)
+}
+
+// SetBudget sets the number of steps that reading each file may take.
+func (self *DSLReader) SetBudget(steps int) {
+	self.budget = steps
+}
+
+// SetVariables defines the given values before reading each file, as
+// Evaluator.SetVariables does.
+func (self *DSLReader) SetVariables(variables map[string]interface{}) {
+	self.variables = variables
+}
+
+// SetFilename sets the name of the file being read, which __FILE__ and __dir__ return
+// as Evaluator.SetFilename describes.  Files such as knife.rb often begin by finding
+// their own directory with File.dirname(__FILE__).
+func (self *DSLReader) SetFilename(name string) {
+	self.filename = name
+}
+
+// SetTagKeys sets the struct tag keys consulted, in order, for a field's name and
+// options, as Encoder.SetTagKeys does.
+func (self *DSLReader) SetTagKeys(keys ...string) {
+	self.tagKeys = keys
+}
+
+// SetFieldNaming sets the strategy (such as SnakeCase) for deriving the settings that
+// struct fields not explicitly named by a tag hold, as Encoder.SetFieldNaming does.
+func (self *DSLReader) SetFieldNaming(naming NamingStrategy) {
+	self.fieldNaming = naming
+}
+
+// DisallowUnknownFields causes the reader to fail with an *UnknownFieldError when the file
+// makes a setting that names no field of the struct being read into.
+func (self *DSLReader) DisallowUnknownFields() {
+	self.disallowUnknownFields = true
+}
+
+// Unmarshal reads the Ruby DSL in data into the value pointed to by v.  Each statement of
+// the file that calls a method (on self, a block's parameter or the attributes of either)
+// makes a setting:
+//
+//	name value           sets the field tagged "name"; several arguments set it to an
+//	                     array of them, and none to true
+//	set :name, value     replaces the value of the field tagged "name"
+//	config.name = value  replaces the value of the field tagged "name" within the field
+//	                     tagged "config"'s attributes, e.g.: config.vm.box sets box within
+//	                     the field tagged "vm"
+//	config.name << value appends the value to the slice tagged "name"
+//	append :name, value  appends the values given to the slice tagged "name"
+//	name[:key] = value   replaces the value of the field tagged "key" within the field
+//	                     tagged "name"
+//
+// Calls of the first form add to slices rather than replacing them, so that repeated
+// calls (such as Puma's bind) collect every value given.  Calls given a block read the
+// block into the field as a file of its own, appending a new element to slices of structs
+// for each call.  The positional arguments of a call made on a struct field are stored in
+// the struct's fields tagged `arg`, in order, and its keyword arguments in the fields they
+// name.  Statements assigning local variables and constants are evaluated, conditionals
+// choose which statements are read, and settings naming no field are skipped (without
+// evaluating their arguments) unless DisallowUnknownFields is set.
+//
+// Reading into a map or an interface{} stores every setting, with blocks read into nested
+// maps, and reading into a []DSLCall stores the calls themselves.  Errors evaluating the
+// file are returned as an *EvalError, and values that do not fit the Go type given as an
+// *UnmarshalTypeError.
+func (self *DSLReader) Unmarshal(data []byte, v interface{}) (err error) {
+	rv := reflect.ValueOf(v)
+
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &InvalidUnmarshalError{
+			Type: reflect.TypeOf(v),
+		}
+	}
+
+	d := newDecodeState(data, 0, 1, 1)
+	d.disallowUnknownFields = self.disallowUnknownFields
+	d.tagKeys = self.tagKeys
+	d.fieldNaming = self.fieldNaming
+	file, err := parser.ParseFile(data)
+
+	if err != nil {
+		return d.syntaxError(err)
+	}
+
+	s := &dslState{
+		evalState: newEvalState(d, self.budget),
+	}
+
+	s.filename = self.filename
+
+	if err := s.define(self.variables); err != nil {
+		return err
+	}
+
+	defer s.recover(&err)
+
+	return s.body(file.Body, rv.Elem(), nil)
+}
+
+// reads a sequence of statements into the given value
+func (self *dslState) body(body []ast.Expr, v reflect.Value, path *valuePath) error {
+	for _, statement := range body {
+		self.step(statement, 1)
+
+		if n, ok := statement.(*ast.If); ok {
+			branch := n.Else
+
+			if truthy(self.eval(n.Cond)) != n.Unless {
+				branch = n.Then
+			}
+
+			if err := self.body(branch, v, path); err != nil {
+				return err
+			}
+		} else if call, ok := self.dslCallOf(statement); ok {
+			if err := self.bind(call, v, path); err != nil {
+				return err
+			}
+		} else {
+			self.eval(statement)
+		}
+	}
+
+	return nil
+}
+
+// reads the statements of a block into the given value, in a scope of their own
+func (self *dslState) readBlock(node *ast.Block, v reflect.Value, path *valuePath) error {
+	saved := self.scope
+	self.scope = newEvalScope(saved)
+
+	defer func() {
+		self.scope = saved
+	}()
+
+	return self.body(node.Body, v, path)
+}
+
+// returns the method call a statement makes on the object being configured, if it is one
+func (self *dslState) dslCallOf(node ast.Expr) (*dslCall, bool) {
+	call := &dslCall{
+		node: node,
+		mode: dslCallMode,
+	}
+
+	switch n := node.(type) {
+	case *ast.Ident:
+		if _, local := self.scope.lookup(n.Name); local {
+			return nil, false
+		}
+
+		call.method = n.Name
+		call.key = n
+
+	case *ast.Call:
+		path, ok := self.receiverPath(n.Receiver)
+
+		if !ok {
+			return nil, false
+		}
+
+		call.path, call.method, call.args, call.block = path, n.Name, n.Args, n.Block
+		call.key = methodName(n)
+
+	case *ast.Assign:
+		if index, ok := n.Target.(*ast.Index); ok {
+			return self.indexCall(call, n, index)
+		}
+
+		target, ok := n.Target.(*ast.Call)
+
+		if !ok || target.Receiver == nil || len(target.Args) > 0 || target.Block != nil {
+			return nil, false
+		}
+
+		path, ok := self.receiverPath(target.Receiver)
+
+		if !ok {
+			return nil, false
+		} else if n.Operator != `=` {
+			self.fail(node, "Cannot evaluate '%s', only '=' may assign settings", n.Operator)
+		}
+
+		call.path, call.method, call.args = path, target.Name+`=`, []ast.Expr{n.Value}
+		call.key = methodName(target)
+		call.mode = dslAssignMode
+
+	case *ast.Binary:
+		if n.Operator != `<<` {
+			return nil, false
+		}
+
+		path, ok := self.receiverPath(n.Left)
+
+		if !ok || len(path) == 0 {
+			return nil, false
+		}
+
+		call.path, call.method, call.args = path, `<<`, []ast.Expr{n.Right}
+		call.key = n.Left
+		call.mode = dslAppendMode
+
+		if target, ok := n.Left.(*ast.Call); ok {
+			call.key = methodName(target)
+		}
+
+	default:
+		return nil, false
+	}
+
+	call.names = append(append([]string(nil), call.path...), strings.TrimSuffix(call.method, `=`))
+	call.values = call.args
+
+	switch {
+	case call.mode == dslAppendMode:
+		call.names = call.path
+	case call.method == `set` && len(call.path) == 0 && len(call.args) > 0 && call.block == nil:
+		// set :name, value
+		if name, ok := stringLiteral(call.args[0]); ok {
+			call.names = []string{name}
+			call.key = call.args[0]
+			call.values = call.args[1:]
+			call.mode = dslAssignMode
+		}
+	case call.method == `append` && len(call.path) == 0 && len(call.args) > 0 && call.block == nil:
+		// append :name, value, ... (as Capistrano's append adds to a list setting)
+		if name, ok := stringLiteral(call.args[0]); ok {
+			call.names = []string{name}
+			call.key = call.args[0]
+			call.values = call.args[1:]
+			call.mode = dslAppendMode
+		}
+	}
+
+	return call, true
+}
+
+// returns the setting made by assigning to an element of an attribute, e.g.:
+// knife[:editor] = 'vim'
+func (self *dslState) indexCall(call *dslCall, node *ast.Assign, index *ast.Index) (*dslCall, bool) {
+	var path []string
+
+	switch n := index.Receiver.(type) {
+	case *ast.Ident:
+		if _, local := self.scope.lookup(n.Name); !local {
+			path = []string{n.Name}
+		}
+	case *ast.Call:
+		path, _ = self.receiverPath(n)
+	}
+
+	if len(path) == 0 || len(index.Args) != 1 {
+		return nil, false
+	}
+
+	name, ok := stringLiteral(index.Args[0])
+
+	if !ok {
+		return nil, false
+	} else if node.Operator != `=` {
+		self.fail(node, "Cannot evaluate '%s', only '=' may assign settings", node.Operator)
+	}
+
+	call.path, call.method, call.args = path, `[]=`, []ast.Expr{index.Args[0], node.Value}
+	call.names = append(append([]string(nil), path...), name)
+	call.key = index.Args[0]
+	call.values = []ast.Expr{node.Value}
+	call.mode = dslAssignMode
+
+	return call, true
+}
+
+// returns the attributes that a method is called on, provided it is called on the object
+// being configured: self, a block's parameter (or any other name that is not a local
+// variable) or a constant
+func (self *dslState) receiverPath(node ast.Expr) ([]string, bool) {
+	switch n := node.(type) {
+	case nil:
+		return []string{}, true
+	case *ast.Self:
+		return []string{}, true
+
+	case *ast.Ident:
+		_, local := self.scope.lookup(n.Name)
+		return []string{}, !local
+
+	case *ast.Const:
+		path := []string{}
+
+		if n.Scope != nil {
+			if scope, ok := self.receiverPath(n.Scope); ok {
+				path = scope
+			} else {
+				return nil, false
+			}
+		}
+
+		return append(path, n.Name), true
+
+	case *ast.Call:
+		if len(n.Args) == 0 && n.Block == nil && n.Operator == `.` {
+			if path, ok := self.receiverPath(n.Receiver); ok {
+				return append(path, n.Name), true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// returns where the name of a method call is written
+func methodName(node *ast.Call) ast.Node {
+	start := node.Pos()
+
+	if node.Receiver != nil {
+		start = node.Receiver.End() + len(node.Operator)
+	}
+
+	return ast.Span{Start: start, Stop: start + len(node.Name)}
+}
+
+// makes the setting of a call within the given value, which holds the attributes named
+// by the call's path
+func (self *dslState) bind(call *dslCall, v reflect.Value, path *valuePath) error {
+	_, _, v = indirect(v)
+
+	if v.Type() == dslCallsType {
+		return self.appendRecord(call, v, path)
+	}
+
+	name := call.names[call.depth]
+	last := call.depth == len(call.names)-1
+
+	next := *call
+	next.depth++
+
+	switch v.Kind() {
+	case reflect.Struct:
+		field, ok, err := self.field(v.Type(), name)
+
+		if err != nil {
+			return err
+		} else if !ok {
+			if self.disallowUnknownFields {
+				return self.unknownField(call.key, v.Type(), path)
+			}
+
+			return nil
+		}
+
+		value, fieldPath := fieldForDecode(v, field.Index), path.Field(field.GoName)
+
+		if last {
+			return self.apply(call, value, field.Options, fieldPath)
+		}
+
+		return self.bind(&next, value, fieldPath)
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return self.typeError(call.node, v.Type(), path)
+		} else if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+
+		key := reflect.New(v.Type().Key()).Elem()
+		key.SetString(name)
+		value := reflect.New(v.Type().Elem()).Elem()
+
+		// settings add to (or are made within) whatever earlier settings stored
+		if existing := v.MapIndex(key); existing.IsValid() {
+			value.Set(existing)
+		}
+
+		if last {
+			err := self.apply(call, value, nil, path.Key(name))
+
+			if err != nil {
+				return err
+			}
+		} else if err := self.bind(&next, value, path.Key(name)); err != nil {
+			return err
+		}
+
+		v.SetMapIndex(key, value)
+		return nil
+
+	case reflect.Interface:
+		if v.NumMethod() == 0 {
+			hash, ok := v.Interface().(map[string]interface{})
+
+			if !ok {
+				hash = make(map[string]interface{})
+				v.Set(reflect.ValueOf(hash))
+			}
+
+			return self.bind(call, reflect.ValueOf(hash), path)
+		}
+	}
+
+	return self.typeError(call.node, v.Type(), path)
+}
+
+// returns the field of a struct type with the given name
+func (self *dslState) field(t reflect.Type, name string) (structField, bool, error) {
+	fields, err := typeFields(t, self.tagKeys, self.fieldNaming)
+
+	if err != nil {
+		return structField{}, false, err
+	}
+
+	for _, field := range fields {
+		if field.Name == name {
+			return field, true, nil
+		}
+	}
+
+	return structField{}, false, nil
+}
+
+// stores the value a call sets in the field (or map value) it names
+func (self *dslState) apply(call *dslCall, v reflect.Value, options tagOptions, path *valuePath) error {
+	_, _, target := indirect(v)
+
+	if target.Type() == dslCallsType {
+		return self.appendRecord(call, target, path)
+	}
+
+	values := self.arguments(call, call.values)
+
+	switch {
+	case call.mode == dslAssignMode:
+		return self.value(self.argument(call, values), v, options, path)
+
+	case call.mode == dslAppendMode && target.Kind() == reflect.Interface && target.NumMethod() == 0:
+		list, _ := target.Interface().([]interface{})
+
+		for _, node := range values {
+			value, err := self.interfaceValue(node, path.Index(len(list)))
+
+			if err != nil {
+				return err
+			}
+
+			list = append(list, value)
+		}
+
+		target.Set(reflect.ValueOf(list))
+		return nil
+
+	case target.Kind() == reflect.Slice && !isRawType(target.Type()):
+		// calls add to lists rather than replacing them
+		elemType := target.Type().Elem()
+
+		if call.mode == dslCallMode && (call.block != nil || self.hasArgFields(elemType)) {
+			elem := reflect.New(elemType).Elem()
+
+			if err := self.fill(call, values, elem, options, path.Index(target.Len())); err != nil {
+				return err
+			}
+
+			target.Set(reflect.Append(target, elem))
+			return nil
+		}
+
+		// the elements of a single array are added, unless it is an element itself
+		if len(values) == 1 && call.mode == dslCallMode {
+			if array, ok := values[0].(*ast.Array); ok && !isListKind(indirectType(elemType).Kind()) {
+				values = array.Elements
+			}
+		}
+
+		for _, value := range values {
+			elem := reflect.New(elemType).Elem()
+
+			if err := self.value(value, elem, options, path.Index(target.Len())); err != nil {
+				return err
+			}
+
+			target.Set(reflect.Append(target, elem))
+		}
+
+		return nil
+
+	case call.mode == dslAppendMode:
+		return self.typeError(call.node, target.Type(), path)
+	}
+
+	return self.fill(call, values, v, options, path)
+}
+
+// stores the value of a call in a single value: a struct is given its positional and
+// keyword arguments and has its block read into it, maps and interfaces have the block
+// read into them, and anything else is set to the value of the arguments
+func (self *dslState) fill(call *dslCall, values []ast.Expr, v reflect.Value, options tagOptions, path *valuePath) error {
+	_, _, target := indirect(v)
+
+	if call.block == nil && !self.hasArgFields(target.Type()) {
+		return self.value(self.argument(call, values), v, options, path)
+	}
+
+	switch target.Kind() {
+	case reflect.Struct:
+		fields, err := typeFields(target.Type(), self.tagKeys, self.fieldNaming)
+
+		if err != nil {
+			return err
+		}
+
+		positional := make([]structField, 0)
+
+		for _, field := range fields {
+			if field.Options.Contains(`arg`) {
+				positional = append(positional, field)
+			}
+		}
+
+		var keywords *ast.Hash
+
+		if n := len(values); n > 0 {
+			if hash, ok := values[n-1].(*ast.Hash); ok && !hash.Braces {
+				keywords, values = hash, values[:n-1]
+			}
+		}
+
+		for i, value := range values {
+			if i >= len(positional) {
+				return self.typeError(value, target.Type(), path)
+			}
+
+			field := positional[i]
+
+			if err := self.value(value, fieldForDecode(target, field.Index), field.Options, path.Field(field.GoName)); err != nil {
+				return err
+			}
+		}
+
+		if keywords != nil {
+			if err := self.hashToStruct(keywords, target, path); err != nil {
+				return err
+			}
+		}
+
+		if call.block != nil {
+			return self.readBlock(call.block, target, path)
+		}
+
+		return nil
+
+	case reflect.Map:
+		if len(values) > 0 {
+			return self.typeError(values[0], target.Type(), path)
+		}
+
+		return self.readBlock(call.block, target, path)
+
+	case reflect.Interface:
+		if target.NumMethod() > 0 {
+			break
+		}
+
+		hash, ok := target.Interface().(map[string]interface{})
+
+		if !ok {
+			hash = make(map[string]interface{})
+		}
+
+		if err := self.readBlock(call.block, reflect.ValueOf(hash), path); err != nil {
+			return err
+		} else if len(values) == 0 {
+			target.Set(reflect.ValueOf(hash))
+			return nil
+		}
+
+		// a call given both arguments and a block stores them together
+		list := make([]interface{}, 0, len(values)+1)
+
+		for _, value := range values {
+			element, err := self.interfaceValue(value, path)
+
+			if err != nil {
+				return err
+			}
+
+			list = append(list, element)
+		}
+
+		target.Set(reflect.ValueOf(append(list, hash)))
+		return nil
+	}
+
+	return self.typeError(call.node, target.Type(), path)
+}
+
+// reports whether a (possibly pointer to a) struct type has fields tagged `arg`
+func (self *dslState) hasArgFields(t reflect.Type) bool {
+	if t = indirectType(t); t.Kind() != reflect.Struct {
+		return false
+	}
+
+	fields, _ := typeFields(t, self.tagKeys, self.fieldNaming)
+
+	for _, field := range fields {
+		if field.Options.Contains(`arg`) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isListKind(kind reflect.Kind) bool {
+	return kind == reflect.Slice || kind == reflect.Array
+}
+
+// evaluates the arguments of a call into literal nodes
+func (self *dslState) arguments(call *dslCall, nodes []ast.Expr) []ast.Expr {
+	splat := false
+
+	for _, node := range nodes {
+		switch node.(type) {
+		case *ast.Splat:
+			splat = true
+		case *ast.BlockPass:
+			self.fail(node, "Cannot pass a block argument to '%s'", call.method)
+		}
+	}
+
+	values := make([]ast.Expr, 0, len(nodes))
+
+	if splat {
+		for _, value := range self.elements(nodes) {
+			values = append(values, self.literal(value, call.node))
+		}
+	} else {
+		for _, node := range nodes {
+			values = append(values, self.fold(node))
+		}
+	}
+
+	return values
+}
+
+// returns the value a call's arguments give: true for none, the argument itself for one,
+// and an array of them for several
+func (self *dslState) argument(call *dslCall, values []ast.Expr) ast.Expr {
+	span := ast.Span{Start: call.node.Pos(), Stop: call.node.End()}
+
+	switch len(values) {
+	case 0:
+		return &ast.Bool{Span: span, Value: true}
+	case 1:
+		return values[0]
+	}
+
+	return &ast.Array{Span: span, Elements: values}
+}
+
+// appends the DSLCall recording a call to the given []DSLCall
+func (self *dslState) appendRecord(call *dslCall, v reflect.Value, path *valuePath) error {
+	record := DSLCall{
+		Path: make([]string, 0),
+		Name: call.method,
+		Args: make([]interface{}, 0, len(call.args)),
+	}
+
+	if call.depth < len(call.path) {
+		record.Path = append(record.Path, call.path[call.depth:]...)
+	}
+
+	for _, value := range self.arguments(call, call.args) {
+		arg, err := self.interfaceValue(value, path)
+
+		if err != nil {
+			return err
+		}
+
+		record.Args = append(record.Args, arg)
+	}
+
+	if call.block != nil {
+		record.Block = make([]DSLCall, 0)
+
+		if err := self.readBlock(call.block, reflect.ValueOf(&record.Block).Elem(), path.Index(v.Len())); err != nil {
+			return err
+		}
+	}
+
+	v.Set(reflect.Append(v, reflect.ValueOf(record)))
+	return nil
+}
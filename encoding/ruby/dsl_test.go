@@ -0,0 +1,275 @@
+package ruby
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+type TestDSLServer struct {
+	Workers int      `ruby:"workers"`
+	Threads []int    `ruby:"threads"`
+	Binds   []string `ruby:"bind"`
+	Preload bool     `ruby:"preload_app!"`
+	Env     string   `ruby:"environment"`
+	Port    int      `ruby:"port"`
+}
+
+type TestDSLNetwork struct {
+	Kind  string `ruby:"kind,arg"`
+	Guest int    `ruby:"guest"`
+	Host  int    `ruby:"host"`
+}
+
+type TestDSLMachine struct {
+	Box      string           `ruby:"box"`
+	Networks []TestDSLNetwork `ruby:"network"`
+	Folders  []string         `ruby:"folders"`
+	Settings struct {
+		Memory int `ruby:"memory"`
+	} `ruby:"settings"`
+}
+
+type TestDSLVagrant struct {
+	Vagrant struct {
+		Configure struct {
+			Version string          `ruby:"version,arg"`
+			VM      *TestDSLMachine `ruby:"vm"`
+		} `ruby:"configure"`
+	} `ruby:"Vagrant"`
+}
+
+func TestUnmarshalDSL(t *testing.T) {
+	var out TestDSLServer
+
+	err := UnmarshalDSL([]byte(`
+max_threads = 5
+
+workers 2 * 2
+threads 1, max_threads
+bind 'tcp://0.0.0.0:3000'
+bind "unix:///tmp/puma.#{max_threads}.sock"
+preload_app!
+set :environment, 'production' if max_threads > 3
+port 3000 unless max_threads > 3
+
+on_worker_boot do
+  ActiveRecord::Base.establish_connection
+end
+`), &out)
+
+	expected := TestDSLServer{
+		Workers: 4,
+		Threads: []int{1, 5},
+		Binds:   []string{`tcp://0.0.0.0:3000`, `unix:///tmp/puma.5.sock`},
+		Preload: true,
+		Env:     `production`,
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(out, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, out)
+	}
+}
+
+func TestUnmarshalDSLBlocks(t *testing.T) {
+	var out TestDSLVagrant
+
+	err := UnmarshalDSL([]byte(`
+Vagrant.configure('2') do |config|
+  config.vm.box = 'ubuntu/' + 'focal64'
+  config.vm.network 'forwarded_port', guest: 80, host: 8080
+  config.vm.network 'private_network'
+  config.vm.folders << '/srv'
+  config.vm.settings[:memory] = 1024 * 2
+end
+`), &out)
+
+	expected := &TestDSLMachine{
+		Box: `ubuntu/focal64`,
+		Networks: []TestDSLNetwork{
+			{Kind: `forwarded_port`, Guest: 80, Host: 8080},
+			{Kind: `private_network`},
+		},
+		Folders: []string{`/srv`},
+	}
+
+	expected.Settings.Memory = 2048
+
+	if err != nil {
+		t.Fatal(err)
+	} else if v := out.Vagrant.Configure.Version; v != `2` {
+		t.Fatalf("Expected \"2\", got \"%s\"", v)
+	} else if !reflect.DeepEqual(out.Vagrant.Configure.VM, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, out.Vagrant.Configure.VM)
+	}
+}
+
+func TestUnmarshalDSLInterface(t *testing.T) {
+	var out interface{}
+
+	err := UnmarshalDSL([]byte(`
+log_level :info
+cookbook_path ['a', 'b']
+knife[:editor] = 'vim'
+database do
+  adapter 'postgresql'
+end
+`), &out)
+
+	expected := map[string]interface{}{
+		`log_level`:     Symbol(`info`),
+		`cookbook_path`: []interface{}{`a`, `b`},
+		`knife`:         map[string]interface{}{`editor`: `vim`},
+		`database`:      map[string]interface{}{`adapter`: `postgresql`},
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(out, expected) {
+		t.Fatalf("Expected %#v, got %#v", expected, out)
+	}
+}
+
+func TestUnmarshalDSLCalls(t *testing.T) {
+	var out []DSLCall
+
+	err := UnmarshalDSL([]byte(`
+lock '~> 3.1'
+namespace :deploy do |config|
+  config.keep_releases = 5
+end
+`), &out)
+
+	expected := []DSLCall{
+		{Path: []string{}, Name: `lock`, Args: []interface{}{`~> 3.1`}},
+		{Path: []string{}, Name: `namespace`, Args: []interface{}{Symbol(`deploy`)}, Block: []DSLCall{
+			{Path: []string{}, Name: `keep_releases=`, Args: []interface{}{int64(5)}},
+		}},
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(out, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, out)
+	}
+}
+
+func TestUnmarshalDSLFieldNaming(t *testing.T) {
+	var out struct {
+		MaxThreads  int
+		Environment string `json:"env"`
+		Network     struct {
+			Kind     string `json:"kind,arg"`
+			HostPort int
+		}
+	}
+
+	reader := NewDSLReader()
+	reader.SetTagKeys(`ruby`, `json`)
+	reader.SetFieldNaming(SnakeCase)
+	reader.DisallowUnknownFields()
+
+	if err := reader.Unmarshal([]byte("max_threads 5\nenv 'production'\nnetwork 'forwarded_port', host_port: 8080\n"), &out); err != nil {
+		t.Fatal(err)
+	} else if out.MaxThreads != 5 || out.Environment != `production` || out.Network.Kind != `forwarded_port` || out.Network.HostPort != 8080 {
+		t.Fatalf("Unexpected values: %+v", out)
+	}
+}
+
+func TestUnmarshalDSLAppend(t *testing.T) {
+	var out struct {
+		Application string   `ruby:"application"`
+		LinkedFiles []string `ruby:"linked_files"`
+		LinkedDirs  []string `ruby:"linked_dirs"`
+	}
+
+	src := []byte(`
+set :application, 'shop'
+set :linked_files, ['config/master.key']
+append :linked_files, 'config/database.yml', 'config/storage.yml'
+append :linked_dirs, 'log', 'tmp/pids'
+`)
+
+	if err := UnmarshalDSL(src, &out); err != nil {
+		t.Fatal(err)
+	} else if shouldBe := []string{`config/master.key`, `config/database.yml`, `config/storage.yml`}; !reflect.DeepEqual(out.LinkedFiles, shouldBe) {
+		t.Fatalf("Expected %v, got %v", shouldBe, out.LinkedFiles)
+	} else if shouldBe := []string{`log`, `tmp/pids`}; !reflect.DeepEqual(out.LinkedDirs, shouldBe) {
+		t.Fatalf("Expected %v, got %v", shouldBe, out.LinkedDirs)
+	}
+
+	var settings map[string]interface{}
+
+	if err := UnmarshalDSL(src, &settings); err != nil {
+		t.Fatal(err)
+	} else if shouldBe := []interface{}{`log`, `tmp/pids`}; !reflect.DeepEqual(settings[`linked_dirs`], shouldBe) {
+		t.Fatalf("Expected %v, got %v", shouldBe, settings[`linked_dirs`])
+	}
+}
+
+func TestUnmarshalDSLFilename(t *testing.T) {
+	var out struct {
+		Node      string   `ruby:"node_name"`
+		Key       string   `ruby:"client_key"`
+		Cookbooks []string `ruby:"cookbook_path"`
+		Cache     string   `ruby:"syntax_check_cache_path"`
+	}
+
+	data, err := ioutil.ReadFile(`testdata/knife.rb`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := NewDSLReader()
+	reader.SetFilename(`/home/deployer/.chef/knife.rb`)
+
+	if err := reader.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Node != `deployer` || out.Key != `/home/deployer/.chef/deployer.pem` || out.Cache != `/home/deployer/.chef/syntaxcache` {
+		t.Fatalf("Unexpected settings: %+v", out)
+	} else if shouldBe := []string{`/home/deployer/.chef/../cookbooks`}; !reflect.DeepEqual(out.Cookbooks, shouldBe) {
+		t.Fatalf("Expected %v, got %v", shouldBe, out.Cookbooks)
+	}
+
+	if err := UnmarshalDSL(data, &out); err == nil {
+		t.Fatal("Expected an error, got nil")
+	} else if evalErr, ok := err.(*EvalError); !ok {
+		t.Fatalf("Expected *EvalError, got %T (%v)", err, err)
+	} else if evalErr.Line != 1 {
+		t.Fatalf("Expected line 1, got line %d", evalErr.Line)
+	}
+}
+
+func TestUnmarshalDSLErrors(t *testing.T) {
+	var out TestDSLServer
+
+	reader := NewDSLReader()
+	reader.DisallowUnknownFields()
+
+	if err := reader.Unmarshal([]byte("workers 2\nwokers 3\n"), &out); err == nil {
+		t.Fatal("Expected an error, got nil")
+	} else if unknownErr, ok := err.(*UnknownFieldError); !ok {
+		t.Fatalf("Expected *UnknownFieldError, got %T (%v)", err, err)
+	} else if unknownErr.Key != `wokers` || unknownErr.Line != 2 {
+		t.Fatalf("Expected key 'wokers' on line 2, got '%s' on line %d", unknownErr.Key, unknownErr.Line)
+	}
+
+	if err := UnmarshalDSL([]byte(`workers 'two'`), &out); err == nil {
+		t.Fatal("Expected an error, got nil")
+	} else if typeErr, ok := err.(*UnmarshalTypeError); !ok {
+		t.Fatalf("Expected *UnmarshalTypeError, got %T (%v)", err, err)
+	} else if typeErr.Path != `Workers` || typeErr.Column != 9 {
+		t.Fatalf("Expected Workers at column 9, got %s at column %d", typeErr.Path, typeErr.Column)
+	}
+
+	if err := UnmarshalDSL([]byte("workers ENV['WORKERS']"), &out); err == nil {
+		t.Fatal("Expected an error, got nil")
+	} else if _, ok := err.(*EvalError); !ok {
+		t.Fatalf("Expected *EvalError, got %T (%v)", err, err)
+	}
+}
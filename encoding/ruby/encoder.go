@@ -0,0 +1,112 @@
+package ruby
+
+import (
+	"io"
+)
+
+// An Encoder writes Ruby representations of Go values to an output stream.
+type Encoder struct {
+	w             io.Writer
+	options       encodeOptions
+	indentEnabled bool
+	indentPrefix  []byte
+	indent        []byte
+}
+
+// NewEncoder returns a new Encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		w: w,
+	}
+}
+
+// Encode writes the Ruby representation of v to the stream, followed by a newline.
+func (self *Encoder) Encode(v interface{}) error {
+	if self.options.requires == nil {
+		self.options.requires = make(requireSet)
+	}
+
+	e := &encodeState{
+		encodeOptions: self.options,
+		indentEnabled: self.indentEnabled,
+		indentPrefix:  self.indentPrefix,
+		indent:        self.indent,
+	}
+
+	// when streaming, output is written as each element of a sequence is encoded
+	if self.options.streamSequences {
+		e.stream = self.w
+	}
+
+	if err := e.marshal(v); err != nil {
+		return err
+	}
+
+	e.writeStringsUnindented("\n")
+
+	_, err := self.w.Write(e.Bytes())
+	return err
+}
+
+// SetIndent instructs the encoder to format each subsequent encoded value as if
+// indented by MarshalIndent.  Calling SetIndent with an empty indent disables indentation.
+func (self *Encoder) SetIndent(prefix string, indent string) {
+	self.indentEnabled = (prefix != `` || indent != ``)
+	self.indentPrefix = []byte(prefix[:])
+	self.indent = []byte(indent[:])
+}
+
+// SetDigitGrouping instructs the encoder to separate every three digits of
+// decimal integers whose magnitude is at least threshold with an underscore
+// (e.g.: 1_000_000).  A threshold of zero disables grouping.
+func (self *Encoder) SetDigitGrouping(threshold uint64) {
+	self.options.digitGroupThreshold = threshold
+}
+
+// SetTagKeys sets the struct tag keys consulted, in order, for a field's name and
+// options (e.g.: "ruby", "json", "yaml").  The first key present on a field is used.
+// Only the `ruby` tag is validated strictly; options from other tags that do not
+// apply to Ruby encoding are ignored.  The default is to consult only `ruby`.
+func (self *Encoder) SetTagKeys(keys ...string) {
+	self.options.tagKeys = keys
+}
+
+// SetFieldNaming sets a strategy (such as SnakeCase) for deriving the keys of struct
+// fields that are not explicitly named by a tag.  Passing nil uses the Go field name.
+func (self *Encoder) SetFieldNaming(naming NamingStrategy) {
+	self.options.fieldNaming = naming
+}
+
+// SetMapKeyNaming sets a strategy (such as SnakeCase) that is applied to the string
+// keys of maps.  Passing nil writes map keys as they are.
+func (self *Encoder) SetMapKeyNaming(naming NamingStrategy) {
+	self.options.mapKeyNaming = naming
+}
+
+// SetUnsupportedPolicy sets what the encoder does with values that have no Ruby
+// representation, such as channels, funcs and unsafe pointers.  Individual struct
+// fields can opt into skipping such values with the "skip-unsupported" tag option.
+func (self *Encoder) SetUnsupportedPolicy(policy UnsupportedPolicy) {
+	self.options.unsupportedPolicy = policy
+}
+
+// SetStreamSequences enables encoding iterators (iter.Seq values as arrays and iter.Seq2
+// values as hashes) and receive-only channels (as arrays, read until closed).  Each element
+// is written to the output stream as soon as it is encoded, so long sequences need not be
+// held in memory; should encoding fail partway through, what was written remains written.
+// For the same reason, the keys of iter.Seq2 values are not checked for duplicates as
+// those of maps are: a sequence yielding a key twice writes it twice, and Ruby keeps the
+// last value given for it.
+func (self *Encoder) SetStreamSequences(enabled bool) {
+	self.options.streamSequences = enabled
+}
+
+// SetSharedReferences enables detecting maps, slices and pointers that are reached from
+// more than one place in the value being encoded.  Each is written once, as an assignment
+// to a local variable (shared_1, shared_2, ...) ahead of the value itself, which then
+// refers to it by name; Ruby evaluating the output sees a single object wherever Go had
+// one.  Values that contain themselves cannot be written and produce a
+// *CyclicReferenceError.
+func (self *Encoder) SetSharedReferences(enabled bool) {
+	self.options.sharedReferences = enabled
+}
@@ -3,37 +3,111 @@ package ruby
 import (
 	"bytes"
 	"fmt"
-	"github.com/fatih/structs"
 	"github.com/ghetzel/go-stockutil/stringutil"
+	"io"
+	"math"
 	"reflect"
+	"regexp"
 	"sort"
 	"strconv"
-	"strings"
 )
 
 type encoderFunc func(e *encodeState, v reflect.Value) error // {}
 
+// settings that apply to an entire encoding operation
+type encodeOptions struct {
+	digitGroupThreshold uint64
+	tagKeys             []string
+	fieldNaming         NamingStrategy
+	mapKeyNaming        NamingStrategy
+	unsupportedPolicy   UnsupportedPolicy
+	encoders            map[reflect.Type]EncoderFunc
+	requires            requireSet
+	streamSequences     bool
+	sharedReferences    bool
+}
+
+// An UnsupportedPolicy determines what the encoder does with values that have no Ruby
+// representation, such as channels, funcs and unsafe pointers.
+type UnsupportedPolicy int
+
+const (
+	// fail with an *UnsupportedTypeError (the default)
+	UnsupportedError UnsupportedPolicy = iota
+
+	// omit struct fields, map entries and array elements holding such values
+	UnsupportedSkip
+
+	// write such values as nil
+	UnsupportedNil
+)
+
 type encodeState struct {
 	bytes.Buffer
+	encodeOptions
 	indentEnabled bool
 	indentLevel   int
 	indent        []byte
 	indentPrefix  []byte
+	fieldOptions  tagOptions
+	path          *valuePath
+	continueLine  bool
+	stream        io.Writer
+	shared        map[referenceKey]string
 }
 
 type encodeStructField struct {
-	Name  reflect.Value
-	Value reflect.Value
+	Name    reflect.Value
+	GoName  string
+	Value   reflect.Value
+	Options tagOptions
 }
 
 func (self *encodeState) marshal(v interface{}) error {
-	return self.reflectValue(reflect.ValueOf(v))
+	rv := reflect.ValueOf(v)
+
+	if self.sharedReferences {
+		if err := self.writeSharedReferences(rv); err != nil {
+			return err
+		}
+	}
+
+	return self.reflectValue(rv)
 }
 
 func (self *encodeState) reflectValue(v reflect.Value) error {
+	if v.IsValid() {
+		if name, ok := self.sharedName(v); ok {
+			self.writeStrings(name)
+			return nil
+		} else if fn, elem := self.customEncoder(v); fn != nil {
+			return customEncoder(fn)(self, elem)
+		} else if self.isStreamable(v) {
+			if isSequenceType(v.Type(), true) {
+				return sequence2Encoder(self, v)
+			}
+
+			return sequenceEncoder(self, v)
+		}
+	}
+
 	return valueEncoder(v)(self, v)
 }
 
+// returns a new, empty encodeState that shares this one's settings
+func (self *encodeState) child(indentLevel int, fieldOptions tagOptions, path *valuePath) *encodeState {
+	return &encodeState{
+		encodeOptions: self.encodeOptions,
+		indentEnabled: self.indentEnabled,
+		indentLevel:   indentLevel,
+		indent:        self.indent,
+		indentPrefix:  self.indentPrefix,
+		fieldOptions:  fieldOptions,
+		path:          path,
+		shared:        self.shared,
+	}
+}
+
 func (self *encodeState) getIndentBytes() []byte {
 	indentation := make([]byte, 0)
 
@@ -51,16 +125,34 @@ func (self *encodeState) getIndentBytes() []byte {
 }
 
 func (self *encodeState) writeBytesUnindented(values ...[]byte) {
+	self.continueLine = false
+
 	for _, value := range values {
 		self.Write(value)
 	}
 }
 
 func (self *encodeState) writeBytes(values ...[]byte) {
-	self.Write(self.getIndentBytes())
+	// values that follow a hash key on the same line are not indented
+	if !self.continueLine {
+		self.Write(self.getIndentBytes())
+	}
+
 	self.writeBytesUnindented(values...)
 }
 
+// writes whatever has been encoded so far to the output stream, if there is one
+func (self *encodeState) flush() error {
+	if self.stream == nil || self.Len() == 0 {
+		return nil
+	}
+
+	_, err := self.stream.Write(self.Bytes())
+	self.Reset()
+
+	return err
+}
+
 func (self *encodeState) writeStringsUnindented(values ...string) {
 	byteset := make([][]byte, len(values))
 
@@ -87,6 +179,18 @@ func valueEncoder(v reflect.Value) encoderFunc {
 		return invalidValueEncoder
 	}
 
+	if fn := typeEncoder(v.Type()); fn != nil {
+		return fn
+	}
+
+	if v.Type().Implements(marshalerType) {
+		return marshalerEncoder
+	} else if v.Kind() != reflect.Ptr && v.CanAddr() && reflect.PtrTo(v.Type()).Implements(marshalerType) {
+		return addrMarshalerEncoder
+	} else if v.Type().Implements(optionalType) || isSQLNullType(v.Type()) {
+		return optionalEncoder
+	}
+
 	switch v.Kind() {
 	case reflect.Bool:
 		return boolEncoder
@@ -111,6 +215,66 @@ func valueEncoder(v reflect.Value) encoderFunc {
 	}
 }
 
+// returns the encoder for types with a dedicated Ruby representation, or nil
+func typeEncoder(t reflect.Type) encoderFunc {
+	switch t {
+	case symbolType:
+		return symbolEncoder
+	case numberType:
+		return numberEncoder
+	case setType:
+		return setEncoder
+	case rangeType:
+		return rangeEncoder
+	case rubyRegexpType:
+		return regexpEncoder
+	case goRegexpType:
+		return goRegexpEncoder
+	case ipType, ipNetType, ipNetPtrType, netipAddrType, netipPrefixType:
+		return ipAddrEncoder
+	case urlType, urlPtrType:
+		return urlEncoder
+	case timeType:
+		return timeEncoder
+	}
+
+	return nil
+}
+
+// reports whether unsupported values in the current position should be omitted, either
+// because the encoder is configured to or the field holding them is tagged "skip-unsupported"
+func (self *encodeState) skipsUnsupported() bool {
+	return self.unsupportedPolicy == UnsupportedSkip || self.fieldOptions.Contains(`skip-unsupported`)
+}
+
+// reports whether the value (or the value pointed to) has no Ruby representation
+func (self *encodeState) isUnsupported(v reflect.Value) bool {
+	for v.IsValid() {
+		if v.Type().Implements(marshalerType) {
+			return false
+		} else if fn, _ := self.customEncoder(v); fn != nil {
+			return false
+		} else if self.isStreamable(v) {
+			return false
+		}
+
+		switch v.Kind() {
+		case reflect.Chan, reflect.Func, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+			return true
+		case reflect.Interface, reflect.Ptr:
+			if v.IsNil() {
+				return false
+			}
+
+			v = v.Elem()
+		default:
+			return false
+		}
+	}
+
+	return false
+}
+
 // encode invalid values
 func invalidValueEncoder(e *encodeState, v reflect.Value) error {
 	e.writeStrings(`nil`)
@@ -118,87 +282,230 @@ func invalidValueEncoder(e *encodeState, v reflect.Value) error {
 }
 
 func unsupportedTypeEncoder(e *encodeState, v reflect.Value) error {
-	return fmt.Errorf("Unsupported type '%T', cannot encode", v.Interface())
+	if e.unsupportedPolicy == UnsupportedNil {
+		e.writeStrings(`nil`)
+		return nil
+	}
+
+	return &UnsupportedTypeError{
+		Type: v.Type(),
+		Path: e.path.String(),
+	}
 }
 
-// encode boolean values
-func boolEncoder(e *encodeState, v reflect.Value) error {
-	if v.Bool() {
-		e.writeStrings(`true`)
+var marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+
+// encode values that implement Marshaler by writing their output verbatim
+func marshalerEncoder(e *encodeState, v reflect.Value) error {
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		e.writeStrings(`nil`)
+		return nil
+	}
+
+	data, err := v.Interface().(Marshaler).MarshalRuby()
+
+	if err != nil {
+		return &MarshalerError{
+			Type: v.Type(),
+			Path: e.path.String(),
+			Err:  err,
+		}
+	}
+
+	e.writeBytes(data)
+	return nil
+}
+
+// encode addressable values whose pointer implements Marshaler
+func addrMarshalerEncoder(e *encodeState, v reflect.Value) error {
+	return marshalerEncoder(e, v.Addr())
+}
+
+// write a scalar literal, quoting it as a string if the field asked for that
+func (self *encodeState) writeScalar(literal string) {
+	if self.fieldOptions.Contains(`string`) {
+		self.writeStrings(singleQuote(literal))
 	} else {
-		e.writeStrings(`false`)
+		self.writeStrings(literal)
 	}
+}
 
+// encode boolean values
+func boolEncoder(e *encodeState, v reflect.Value) error {
+	e.writeScalar(strconv.FormatBool(v.Bool()))
 	return nil
 }
 
 // encode integers
 func intEncoder(e *encodeState, v reflect.Value) error {
-	e.writeStrings(strconv.FormatInt(v.Int(), 10))
+	if i := v.Int(); i < 0 {
+		// negate in unsigned space so that math.MinInt64 survives
+		e.writeScalar(`-` + e.formatInteger(uint64(-(i+1))+1))
+	} else {
+		e.writeScalar(e.formatInteger(uint64(i)))
+	}
+
 	return nil
 }
 
 // encode unsigned integers
 func uintEncoder(e *encodeState, v reflect.Value) error {
-	e.writeStrings(strconv.FormatUint(v.Uint(), 10))
+	e.writeScalar(e.formatInteger(v.Uint()))
 	return nil
 }
 
-// encode floats
+// format the magnitude of an integer in the base requested by the field's tag options,
+// grouping decimal digits with underscores if the encoder is configured to
+func (self *encodeState) formatInteger(magnitude uint64) string {
+	switch {
+	case self.fieldOptions.Contains(`hex`):
+		return `0x` + strconv.FormatUint(magnitude, 16)
+	case self.fieldOptions.Contains(`octal`):
+		return `0o` + strconv.FormatUint(magnitude, 8)
+	case self.fieldOptions.Contains(`binary`):
+		return `0b` + strconv.FormatUint(magnitude, 2)
+	}
+
+	digits := strconv.FormatUint(magnitude, 10)
+
+	if self.digitGroupThreshold == 0 || magnitude < self.digitGroupThreshold {
+		return digits
+	}
+
+	// insert an underscore before every third digit, counting from the right
+	grouped := make([]byte, 0, len(digits)+(len(digits)-1)/3)
+
+	for i := 0; i < len(digits); i++ {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			grouped = append(grouped, '_')
+		}
+
+		grouped = append(grouped, digits[i])
+	}
+
+	return string(grouped)
+}
+
+// encode floats, writing infinities and NaN as the Float constants Ruby names them by (or,
+// for fields tagged `string`, as Ruby's Float#to_s writes them)
 func floatEncoder(e *encodeState, v reflect.Value) error {
-	e.writeStrings(strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()))
+	var literal, str string
+
+	switch f := v.Float(); {
+	case math.IsNaN(f):
+		literal, str = `Float::NAN`, `NaN`
+	case math.IsInf(f, 1):
+		literal, str = `Float::INFINITY`, `Infinity`
+	case math.IsInf(f, -1):
+		literal, str = `-Float::INFINITY`, `-Infinity`
+	default:
+		e.writeScalar(strconv.FormatFloat(f, 'f', -1, v.Type().Bits()))
+		return nil
+	}
+
+	if e.fieldOptions.Contains(`string`) {
+		e.writeStrings(singleQuote(str))
+	} else {
+		e.writeStrings(literal)
+	}
+
 	return nil
 }
 
-// encode strings (non-interpolated)
-func stringEncoder(e *encodeState, v reflect.Value) error {
-	str := v.String()
+// encode numbers verbatim, after checking that they are numbers
+func numberEncoder(e *encodeState, v reflect.Value) error {
+	literal := v.String()
+
+	if literal == `` {
+		literal = `0`
+	} else if !rxNumber.MatchString(literal) {
+		return &UnsupportedValueError{
+			Value: v,
+			Str:   fmt.Sprintf("number '%s'", literal),
+			Path:  e.path.String(),
+		}
+	}
 
-	// escape single-quotes
-	str = strings.Replace(str, `'`, `\'`, -1)
+	e.writeScalar(literal)
+	return nil
+}
 
-	e.writeStrings(`'`, str, `'`)
+// encode strings (non-interpolated), or as symbols or verbatim Ruby if the field asked for that
+func stringEncoder(e *encodeState, v reflect.Value) error {
+	switch {
+	case e.fieldOptions.Contains(`symbol`):
+		e.writeStrings(symbolLiteral(v.String()))
+	case e.fieldOptions.Contains(`pathname`):
+		e.require(`pathname`)
+		e.writeStrings(`Pathname.new(`, singleQuote(v.String()), `)`)
+	case e.fieldOptions.Contains(`raw`):
+		e.writeStrings(v.String())
+	default:
+		e.writeStrings(singleQuote(v.String()))
+	}
 
 	return nil
 }
 
-// encode a named key-value pair (in an output hash)
-func keyValueEncoder(e *encodeState, key reflect.Value, value reflect.Value) error {
-	keyEnc := &encodeState{
-		indentEnabled: e.indentEnabled,
-		indentLevel:   (e.indentLevel - 1),
-		indent:        e.indent,
-		indentPrefix:  e.indentPrefix,
-	}
+// encode symbols
+func symbolEncoder(e *encodeState, v reflect.Value) error {
+	e.writeStrings(symbolLiteral(v.String()))
+	return nil
+}
 
-	valEnc := &encodeState{
-		indentEnabled: e.indentEnabled,
-		indentLevel:   e.indentLevel,
-		indent:        e.indent,
-		indentPrefix:  e.indentPrefix,
-	}
+// encode a named key-value pair (in an output hash), applying the given tag options to the value
+func keyValueEncoder(e *encodeState, key reflect.Value, value reflect.Value, valueOptions tagOptions, valuePath *valuePath) error {
+	keyBytes, err := e.encodeKey(key, valuePath)
 
-	if err := valueEncoder(key)(keyEnc, key); err != nil {
+	if err != nil {
 		return err
 	}
 
-	if err := valueEncoder(value)(valEnc, value); err != nil {
-		return err
+	return e.writeKeyValue(keyBytes, value, valueOptions, valuePath)
+}
+
+// encode a hash key on its own, returning the (unindented) Ruby literal
+func (self *encodeState) encodeKey(key reflect.Value, valuePath *valuePath) ([]byte, error) {
+	keyEnc := self.child(self.indentLevel-1, nil, valuePath)
+
+	if err := keyEnc.reflectValue(key); err != nil {
+		return nil, err
 	}
 
-	keyBytes := bytes.TrimPrefix(keyEnc.Bytes(), keyEnc.getIndentBytes())
-	valBytes := bytes.TrimPrefix(valEnc.Bytes(), valEnc.getIndentBytes())
+	return bytes.TrimPrefix(keyEnc.Bytes(), keyEnc.getIndentBytes()), nil
+}
 
+// encode a value and write it alongside an already-encoded key
+func (self *encodeState) writeKeyValue(keyBytes []byte, value reflect.Value, valueOptions tagOptions, valuePath *valuePath) error {
 	var hashRocket []byte
 
-	if e.indentEnabled {
+	if self.indentEnabled {
 		hashRocket = []byte{' ', '=', '>', ' '}
 	} else {
 		hashRocket = []byte{'=', '>'}
 	}
 
-	e.writeBytes(keyBytes, hashRocket, valBytes)
-	return nil
+	prefix := make([]byte, 0, len(keyBytes)+len(hashRocket))
+	prefix = append(prefix, keyBytes...)
+	prefix = append(prefix, hashRocket...)
+
+	return self.writeEntry(prefix, value, valueOptions, valuePath)
+}
+
+// encode a value and write it on its own line (if indenting), preceded by the given prefix
+func (self *encodeState) writeEntry(prefix []byte, value reflect.Value, valueOptions tagOptions, valuePath *valuePath) error {
+	parentOptions, parentPath := self.fieldOptions, self.path
+
+	defer func() {
+		self.fieldOptions, self.path = parentOptions, parentPath
+		self.continueLine = false
+	}()
+
+	self.writeBytes(prefix)
+	self.fieldOptions, self.path = valueOptions, valuePath
+	self.continueLine = true
+
+	return self.reflectValue(value)
 }
 
 // encode generic interfaces and pointers
@@ -211,58 +518,29 @@ func elementEncoder(e *encodeState, v reflect.Value) error {
 	return e.reflectValue(v.Elem())
 }
 
-// encode structs
+// encode structs as hashes or, if they name a Ruby class, as calls to its constructor
 func structEncoder(e *encodeState, v reflect.Value) error {
-	e.writeStrings(`{`)
-
-	structValue := structs.New(v.Interface())
-	structFields := structValue.Fields()
-	fieldsToWrite := make([]*encodeStructField, 0)
+	fields, err := typeFields(v.Type(), e.tagKeys, e.fieldNaming)
 
-	for i := 0; i < len(structFields); i++ {
-		structField := structFields[i]
+	if err != nil {
+		return err
+	}
 
-		var fieldName string
-		var skip bool
+	class, err := e.classOf(v)
 
-		if structField.IsExported() {
-			tagParts := strings.Split(structField.Tag(`ruby`), `,`)
+	if err != nil {
+		return err
+	}
 
-			if len(tagParts) > 0 {
-				fieldName = tagParts[0]
-				tagParts = tagParts[1:]
-			}
+	opening, closing := `{`, `}`
 
-			for _, opt := range tagParts {
-				switch opt {
-				case `omitempty`:
-					if structField.IsZero() {
-						skip = true
-					}
-				}
-			}
-		} else {
-			skip = true
-		}
+	if class.Name != `` {
+		opening, closing = class.Name+`.new(`, `)`
+	}
 
-		// default struct field name to the field's name
-		if fieldName == `` {
-			fieldName = structField.Name()
-		}
+	e.writeStrings(opening)
 
-		// specifying a field name of "-" skips that field
-		if fieldName == `-` {
-			skip = true
-		}
-
-		// if we're not skipping this field, write it to the buffer
-		if !skip {
-			fieldsToWrite = append(fieldsToWrite, &encodeStructField{
-				Name:  reflect.ValueOf(fieldName),
-				Value: reflect.ValueOf(structField.Value()),
-			})
-		}
-	}
+	fieldsToWrite := e.structFieldsToWrite(v, fields, class.Name != ``)
 
 	// only break and increase indentation if we have anything to write
 	if len(fieldsToWrite) > 0 {
@@ -274,7 +552,20 @@ func structEncoder(e *encodeState, v reflect.Value) error {
 	}
 
 	for i, field := range fieldsToWrite {
-		keyValueEncoder(e, field.Name, field.Value)
+		fieldPath := e.path.Field(field.GoName)
+
+		switch {
+		case class.Positional:
+			err = e.writeEntry(nil, field.Value, field.Options, fieldPath)
+		case class.Name != ``:
+			err = e.writeEntry(keywordLabel(field.Name.String()), field.Value, field.Options, fieldPath)
+		default:
+			err = keyValueEncoder(e, field.Name, field.Value, field.Options, fieldPath)
+		}
+
+		if err != nil {
+			return err
+		}
 
 		// for all but the last element
 		if i < (len(fieldsToWrite) - 1) {
@@ -295,44 +586,196 @@ func structEncoder(e *encodeState, v reflect.Value) error {
 
 	if len(fieldsToWrite) > 0 {
 		e.indentLevel -= 1
-		e.writeStrings(`}`)
+		e.writeStrings(closing)
+	} else if class.Name != `` {
+		// constructors without arguments need no parentheses
+		e.Truncate(e.Len() - 1)
 	} else {
 		// if we didn't write anything, don't indent this (it's just an empty "{}")
-		e.writeStringsUnindented(`}`)
+		e.writeStringsUnindented(closing)
 	}
 
 	return nil
 }
 
+// returns the fields of the given struct value that are to be written, in order.  The
+// arguments of a constructor cannot be left out (positional ones would shift, and Ruby
+// requires every member of a Data class), so with omittedAsNil the fields that would be
+// omitted are written as nil instead.
+func (self *encodeState) structFieldsToWrite(v reflect.Value, fields []structField, omittedAsNil bool) []*encodeStructField {
+	fieldsToWrite := make([]*encodeStructField, 0)
+
+	for _, field := range fields {
+		fieldValue, ok := fieldByIndex(v, field.Index)
+
+		// fields inlined from a nil pointer are omitted, as are those their options say to
+		omitted := !ok ||
+			(field.Options.Contains(`omitempty`) && isEmptyValue(fieldValue)) ||
+			(field.Options.Contains(`omitnil`) && isNilValue(fieldValue)) ||
+			(field.Options.Contains(`omitzero`) && isZeroValue(fieldValue)) ||
+			((self.unsupportedPolicy == UnsupportedSkip || field.Options.Contains(`skip-unsupported`)) && self.isUnsupported(fieldValue))
+
+		if omitted && !omittedAsNil {
+			continue
+		} else if omitted {
+			// the zero Value is written as nil
+			fieldValue = reflect.Value{}
+		}
+
+		fieldsToWrite = append(fieldsToWrite, &encodeStructField{
+			Name:    reflect.ValueOf(field.Name),
+			GoName:  field.GoName,
+			Value:   fieldValue,
+			Options: field.Options,
+		})
+	}
+
+	return fieldsToWrite
+}
+
+// reports whether the value should be omitted by "omitempty"; this matches the
+// definition of empty used by encoding/json
+func isEmptyValue(v reflect.Value) bool {
+	if _, ok, isOptional := optionalValue(v); isOptional {
+		return !ok
+	}
+
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+// reports whether the value should be omitted by "omitnil"; optional values that hold
+// nothing are written as nil, so they are omitted too
+func isNilValue(v reflect.Value) bool {
+	if _, ok, isOptional := optionalValue(v); isOptional {
+		return !ok
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+type isZeroer interface {
+	IsZero() bool
+}
+
+var isZeroerType = reflect.TypeOf((*isZeroer)(nil)).Elem()
+
+// reports whether the value should be omitted by "omitzero", preferring the
+// value's own IsZero() method over a comparison with its type's zero value
+func isZeroValue(v reflect.Value) bool {
+	// a nil pointer cannot be asked whether it is zero, but it certainly is
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return true
+	}
+
+	if v.Type().Implements(isZeroerType) {
+		return v.Interface().(isZeroer).IsZero()
+	} else if v.CanAddr() && v.Addr().Type().Implements(isZeroerType) {
+		return v.Addr().Interface().(isZeroer).IsZero()
+	}
+
+	return v.IsZero()
+}
+
+// a single key-value pair of a map being encoded
+type mapEntry struct {
+	Key     []byte
+	Value   reflect.Value
+	Path    *valuePath
+	SortKey string
+}
+
 // encode maps with a best-attempt at deterministic ordering by stringifying
 // key names and outputing them in lexical order
 func mapEncoder(e *encodeState, v reflect.Value) error {
 	e.writeStrings(`{`)
 
 	keys := v.MapKeys()
+	entries := make([]mapEntry, 0, len(keys))
+	sortable := true
 
-	// this is a trick to provide ordered maps for keys types we can sort by
-	strKeys := make([]string, 0)
-	sortKeyValues := make(map[string]reflect.Value)
-
-	// attempt to convert the key value to a string and map that value to the key itself
 	for _, key := range keys {
+		value := v.MapIndex(key)
+
+		if e.skipsUnsupported() && (e.isUnsupported(key) || e.isUnsupported(value)) {
+			continue
+		}
+
+		entry := mapEntry{
+			Value: value,
+			Path:  e.path.Key(key.Interface()),
+		}
+
+		// rename string keys if a naming strategy was given
+		if e.mapKeyNaming != nil && key.Kind() == reflect.String {
+			key = reflect.ValueOf(e.mapKeyNaming(key.String())).Convert(key.Type())
+		}
+
+		// keys are encoded up front so that those with identical literals can be caught
+		if keyBytes, err := e.encodeKey(key, entry.Path); err == nil {
+			entry.Key = keyBytes
+		} else {
+			return err
+		}
+
+		// this is a trick to provide ordered maps for keys types we can sort by:
+		// attempt to convert the key value to a string and sort on that
 		if str, err := stringutil.ToString(key.Interface()); err == nil {
-			strKeys = append(strKeys, str)
-			sortKeyValues[str] = key
+			entry.SortKey = str
+		} else {
+			sortable = false
 		}
+
+		entries = append(entries, entry)
 	}
 
-	if len(strKeys) == len(keys) {
-		// only sort if we were able to stringify all the keys
-		sort.Strings(strKeys)
-	} else {
-		// otherwise, make sure strKeys is the same size as keys because of what we do with it below
-		strKeys = make([]string, len(keys))
+	// only sort if we were able to stringify all the keys; ties (e.g.: 1 and '1') are
+	// broken by the literal itself so that the output is still deterministic
+	if sortable {
+		sort.SliceStable(entries, func(i, j int) bool {
+			if entries[i].SortKey != entries[j].SortKey {
+				return entries[i].SortKey < entries[j].SortKey
+			}
+
+			return bytes.Compare(entries[i].Key, entries[j].Key) < 0
+		})
+	}
+
+	seenKeys := make(map[string]bool, len(entries))
+
+	for _, entry := range entries {
+		if seenKeys[string(entry.Key)] {
+			return &DuplicateKeyError{
+				Type: v.Type(),
+				Key:  string(entry.Key),
+				Path: e.path.String(),
+			}
+		}
+
+		seenKeys[string(entry.Key)] = true
 	}
 
 	// only break and increase indentation if we have anything to write
-	if len(strKeys) > 0 {
+	if len(entries) > 0 {
 		if e.indentEnabled {
 			e.writeStringsUnindented("\n")
 		}
@@ -340,28 +783,15 @@ func mapEncoder(e *encodeState, v reflect.Value) error {
 		e.indentLevel += 1
 	}
 
-	// iterare over strKeys to get the correct index, but pull the actual key value from keys
-	for i, sortKey := range strKeys {
-		var key reflect.Value
-
-		// attempt to retrieve the sorted key value, otherwise just get the next
-		// one in sequence
-		if k, ok := sortKeyValues[sortKey]; ok {
-			key = k
-		} else {
-			key = keys[i]
-		}
-
-		// get the value at key
-		value := v.MapIndex(key)
-
+	for i, entry := range entries {
 		// encode it
-		if err := keyValueEncoder(e, key, value); err != nil {
+		// values inherit the options of the field that holds the map
+		if err := e.writeKeyValue(entry.Key, entry.Value, e.fieldOptions, entry.Path); err != nil {
 			return err
 		}
 
 		// for all but the last element, add comma and (optionally) linebreak
-		if i < (len(keys) - 1) {
+		if i < (len(entries) - 1) {
 			e.writeStringsUnindented(`,`)
 
 			// trail all but the last field with a space after the comma,
@@ -378,7 +808,7 @@ func mapEncoder(e *encodeState, v reflect.Value) error {
 	}
 
 	// only lower indentation and close if we had anything to write
-	if len(strKeys) > 0 {
+	if len(entries) > 0 {
 		e.indentLevel -= 1
 		e.writeStrings(`}`)
 	} else {
@@ -389,8 +819,91 @@ func mapEncoder(e *encodeState, v reflect.Value) error {
 	return nil
 }
 
+// encode sets as the elements of an array given to Set[]
+func setEncoder(e *encodeState, v reflect.Value) error {
+	// Set is only loaded automatically as of Ruby 3.2
+	e.require(`set`)
+	e.writeStrings(`Set`)
+	return arrayEncoder(e, v)
+}
+
+// encode ranges, parenthesizing beginless and endless ranges so they can be used anywhere
+func rangeEncoder(e *encodeState, v reflect.Value) error {
+	rng := v.Interface().(Range)
+	operator := `..`
+
+	if rng.Exclusive {
+		operator = `...`
+	}
+
+	var begin, end []byte
+	var err error
+
+	if rng.Begin != nil {
+		if begin, err = e.encodeInline(reflect.ValueOf(rng.Begin)); err != nil {
+			return err
+		}
+	}
+
+	if rng.End != nil {
+		if end, err = e.encodeInline(reflect.ValueOf(rng.End)); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case rng.Begin == nil && rng.End == nil:
+		e.writeStrings(`(nil`, operator, `nil)`)
+	case rng.Begin == nil || rng.End == nil:
+		e.writeStrings(`(`, string(begin), operator, string(end), `)`)
+	default:
+		e.writeStrings(string(begin), operator, string(end))
+	}
+
+	return nil
+}
+
+// encode Ruby regular expressions
+func regexpEncoder(e *encodeState, v reflect.Value) error {
+	rx := v.Interface().(Regexp)
+
+	if !rxRegexpFlags.MatchString(rx.Flags) {
+		return &UnsupportedValueError{
+			Value: v,
+			Str:   fmt.Sprintf("regular expression flags '%s'", rx.Flags),
+			Path:  e.path.String(),
+		}
+	}
+
+	e.writeStrings(`/`, escapeRegexpDelimiters(rx.Source), `/`, rx.Flags)
+	return nil
+}
+
+// encode Go regular expressions by rewriting them in Ruby syntax
+func goRegexpEncoder(e *encodeState, v reflect.Value) error {
+	if v.IsNil() {
+		e.writeStrings(`nil`)
+		return nil
+	}
+
+	literal, err := goRegexpLiteral(v.Interface().(*regexp.Regexp))
+
+	if err != nil {
+		return err
+	}
+
+	e.writeStrings(literal)
+	return nil
+}
+
 // encode arrays and slices
 func arrayEncoder(e *encodeState, v reflect.Value) error {
+	// byte slices tagged as raw are written verbatim
+	if e.fieldOptions.Contains(`raw`) && v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+		e.writeBytes(v.Bytes())
+		return nil
+	}
+
 	e.writeStringsUnindented(`[`)
 
 	if e.indentEnabled {
@@ -404,16 +917,33 @@ func arrayEncoder(e *encodeState, v reflect.Value) error {
 		e.writeStringsUnindented(`]`)
 	}()
 
-	// iterare over strKeys to get the correct index, but pull the actual key value from keys
+	arrayPath := e.path
+
+	defer func() {
+		e.path = arrayPath
+	}()
+
+	// determine which elements will be written up front so that separators are placed correctly
+	indices := make([]int, 0, v.Len())
+
 	for i := 0; i < v.Len(); i++ {
+		if e.skipsUnsupported() && e.isUnsupported(v.Index(i)) {
+			continue
+		}
+
+		indices = append(indices, i)
+	}
+
+	for n, i := range indices {
 		value := v.Index(i)
+		e.path = arrayPath.Index(i)
 
-		if err := valueEncoder(value)(e, value); err != nil {
+		if err := e.reflectValue(value); err != nil {
 			return err
 		}
 
 		// for all but the last element
-		if i < (v.Len() - 1) {
+		if n < (len(indices) - 1) {
 			e.writeStringsUnindented(`,`)
 
 			// trail all but the last field with a space after the comma,
@@ -0,0 +1,107 @@
+package ruby
+
+import (
+	"bytes"
+	"testing"
+)
+
+type TestStructNumeric struct {
+	Mode  uint32 `ruby:"mode,octal"`
+	Mask  int    `ruby:"mask,hex"`
+	Flags uint8  `ruby:"flags,binary"`
+	Delta int    `ruby:"delta,hex"`
+	Size  int64  `ruby:"size"`
+}
+
+func TestEncodeStructNumericBases(t *testing.T) {
+	e := &encodeState{}
+
+	in := TestStructNumeric{
+		Mode:  0755,
+		Mask:  0xff00,
+		Flags: 5,
+		Delta: -31,
+		Size:  1000000,
+	}
+
+	shouldBe := `{'mode'=>0o755, 'mask'=>0xff00, 'flags'=>0b101, 'delta'=>-0x1f, 'size'=>1000000}`
+
+	if err := e.marshal(in); err != nil {
+		t.Fatal(err)
+	} else {
+		if s := e.String(); s != shouldBe {
+			t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+		} else {
+			t.Log(s)
+		}
+	}
+}
+
+func TestEncodeStructNumericSliceInheritsBase(t *testing.T) {
+	e := &encodeState{}
+
+	in := struct {
+		Modes []int `ruby:"modes,octal"`
+	}{
+		Modes: []int{0644, 0755},
+	}
+
+	shouldBe := `{'modes'=>[0o644, 0o755]}`
+
+	if err := e.marshal(in); err != nil {
+		t.Fatal(err)
+	} else {
+		if s := e.String(); s != shouldBe {
+			t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+		} else {
+			t.Log(s)
+		}
+	}
+}
+
+func TestEncodeDigitGrouping(t *testing.T) {
+	e := &encodeState{
+		encodeOptions: encodeOptions{
+			digitGroupThreshold: 10000,
+		},
+	}
+
+	in := []interface{}{
+		1000,
+		10000,
+		-1234567,
+		uint64(18446744073709551615),
+		int64(-9223372036854775808),
+	}
+
+	shouldBe := `[1000, 10_000, -1_234_567, 18_446_744_073_709_551_615, -9_223_372_036_854_775_808]`
+
+	if err := e.marshal(in); err != nil {
+		t.Fatal(err)
+	} else {
+		if s := e.String(); s != shouldBe {
+			t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+		} else {
+			t.Log(s)
+		}
+	}
+}
+
+func TestEncoderDigitGrouping(t *testing.T) {
+	var buf bytes.Buffer
+
+	encoder := NewEncoder(&buf)
+	encoder.SetDigitGrouping(1000)
+
+	if err := encoder.Encode(map[string]int{`limit`: 1000000}); err != nil {
+		t.Fatal(err)
+	}
+
+	shouldBe := "{'limit'=>1_000_000}\n"
+
+	if s := buf.String(); s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	} else {
+		t.Log(s)
+	}
+}
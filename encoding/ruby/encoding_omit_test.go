@@ -0,0 +1,83 @@
+package ruby
+
+import (
+	"testing"
+	"time"
+)
+
+type TestOmitNested struct {
+	Key string
+}
+
+type TestStructOmit struct {
+	EmptyString string            `ruby:",omitempty"`
+	EmptySlice  []string          `ruby:",omitempty"`
+	NilSlice    []string          `ruby:",omitempty"`
+	EmptyPtr    *TestOmitNested   `ruby:",omitempty"`
+	ZeroStruct  TestOmitNested    `ruby:",omitempty"`
+	False       bool              `ruby:",omitempty"`
+	NilOnly     []string          `ruby:",omitnil"`
+	NilOnlyNil  []string          `ruby:",omitnil"`
+	NilMap      map[string]string `ruby:",omitnil"`
+	ZeroInt     int               `ruby:",omitnil"`
+	ZeroTime    time.Time         `ruby:",omitzero"`
+	ZeroNested  TestOmitNested    `ruby:",omitzero"`
+	SetNested   TestOmitNested    `ruby:",omitzero"`
+	ZeroPtr     *TestOmitNested   `ruby:",omitzero"`
+}
+
+func TestEncodeStructOmitSemantics(t *testing.T) {
+	e := &encodeState{}
+
+	in := TestStructOmit{
+		EmptySlice: []string{},
+		EmptyPtr:   &TestOmitNested{},
+		NilOnly:    []string{},
+		SetNested: TestOmitNested{
+			Key: `set`,
+		},
+	}
+
+	shouldBe := `{'EmptyPtr'=>{'Key'=>''}, 'ZeroStruct'=>{'Key'=>''}, 'NilOnly'=>[], 'ZeroInt'=>0, 'SetNested'=>{'Key'=>'set'}}`
+
+	if err := e.marshal(in); err != nil {
+		t.Fatal(err)
+	} else {
+		if s := e.String(); s != shouldBe {
+			t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+		} else {
+			t.Log(s)
+		}
+	}
+}
+
+type TestZeroer struct {
+	Value int
+}
+
+func (self TestZeroer) IsZero() bool {
+	return self.Value < 0
+}
+
+func TestEncodeStructOmitZeroMethod(t *testing.T) {
+	e := &encodeState{}
+
+	in := struct {
+		Unset TestZeroer `ruby:",omitzero"`
+		Set   TestZeroer `ruby:",omitzero"`
+	}{
+		Unset: TestZeroer{Value: -1},
+	}
+
+	shouldBe := `{'Set'=>{'Value'=>0}}`
+
+	if err := e.marshal(in); err != nil {
+		t.Fatal(err)
+	} else {
+		if s := e.String(); s != shouldBe {
+			t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+		} else {
+			t.Log(s)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package ruby
 
 import (
+	"math"
 	"testing"
 )
 
@@ -166,6 +167,50 @@ func TestEncodeFloat64(t *testing.T) {
 	}
 }
 
+func TestEncodeFloatSpecial(t *testing.T) {
+	for shouldBe, in := range map[string]float64{
+		`Float::INFINITY`:  math.Inf(1),
+		`-Float::INFINITY`: math.Inf(-1),
+		`Float::NAN`:       math.NaN(),
+	} {
+		data, err := Marshal(in)
+
+		if err != nil {
+			t.Fatal(err)
+		} else if s := string(data); s != shouldBe {
+			t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+		}
+
+		var out float64
+
+		if err := Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		} else if math.IsNaN(in) != math.IsNaN(out) || (!math.IsNaN(in) && out != in) {
+			t.Fatalf("Expected %v, got %v", in, out)
+		}
+	}
+
+	type quoted struct {
+		Limit float64 `ruby:"limit,string"`
+	}
+
+	shouldBe := `{'limit'=>'-Infinity'}`
+
+	if data, err := Marshal(quoted{Limit: math.Inf(-1)}); err != nil {
+		t.Fatal(err)
+	} else if s := string(data); s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	} else {
+		var out quoted
+
+		if err := Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		} else if !math.IsInf(out.Limit, -1) {
+			t.Fatalf("Expected -Inf, got %v", out.Limit)
+		}
+	}
+}
+
 func TestEncodeString(t *testing.T) {
 	e := &encodeState{}
 
@@ -196,6 +241,31 @@ func TestEncodeString(t *testing.T) {
 	}
 }
 
+func TestEncodeStringBackslashes(t *testing.T) {
+	for in, shouldBe := range map[string]string{
+		`a\`:     `'a\\'`,
+		`a\\b`:   `'a\\\\b'`,
+		`it\'s`:  `'it\\\'s'`,
+		`C:\dir`: `'C:\\dir'`,
+	} {
+		data, err := Marshal(in)
+
+		if err != nil {
+			t.Fatal(err)
+		} else if s := string(data); s != shouldBe {
+			t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+		}
+
+		var out string
+
+		if err := Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		} else if out != in {
+			t.Fatalf("Expected \"%s\", got \"%s\"", in, out)
+		}
+	}
+}
+
 func TestEncodeSimpleMapStrInt(t *testing.T) {
 	e := &encodeState{}
 
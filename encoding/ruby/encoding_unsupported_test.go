@@ -0,0 +1,70 @@
+package ruby
+
+import (
+	"bytes"
+	"testing"
+)
+
+type TestStructWithFuncs struct {
+	Name    string
+	Logger  func(string)
+	Cancel  chan struct{}
+	Handler interface{}   `ruby:",skip-unsupported"`
+	Hooks   []interface{} `ruby:",skip-unsupported"`
+}
+
+func TestEncodeUnsupportedPolicies(t *testing.T) {
+	in := TestStructWithFuncs{
+		Name:    `test`,
+		Logger:  func(string) {},
+		Cancel:  make(chan struct{}),
+		Handler: func() {},
+		Hooks:   []interface{}{1, func() {}, `two`},
+	}
+
+	for policy, shouldBe := range map[UnsupportedPolicy]string{
+		UnsupportedSkip: "{'Name'=>'test', 'Hooks'=>[1, 'two']}\n",
+		UnsupportedNil:  "{'Name'=>'test', 'Logger'=>nil, 'Cancel'=>nil, 'Hooks'=>[1, 'two']}\n",
+	} {
+		var buf bytes.Buffer
+
+		encoder := NewEncoder(&buf)
+		encoder.SetUnsupportedPolicy(policy)
+
+		if err := encoder.Encode(in); err != nil {
+			t.Fatal(err)
+		} else if s := buf.String(); s != shouldBe {
+			t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+		} else {
+			t.Log(s)
+		}
+	}
+
+	if _, err := Marshal(in); err == nil {
+		t.Fatal("Expected an error by default")
+	} else if typeErr, ok := err.(*UnsupportedTypeError); !ok || typeErr.Path != `Logger` {
+		t.Fatalf("Expected *UnsupportedTypeError at Logger, got %T (%v)", err, err)
+	}
+}
+
+func TestEncodeUnsupportedSkipMap(t *testing.T) {
+	var buf bytes.Buffer
+
+	encoder := NewEncoder(&buf)
+	encoder.SetUnsupportedPolicy(UnsupportedSkip)
+
+	in := map[string]interface{}{
+		`a`: 1,
+		`b`: make(chan int),
+		`c`: complex(1, 2),
+		`d`: []interface{}{func() {}},
+	}
+
+	shouldBe := "{'a'=>1, 'd'=>[]}\n"
+
+	if err := encoder.Encode(in); err != nil {
+		t.Fatal(err)
+	} else if s := buf.String(); s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	}
+}
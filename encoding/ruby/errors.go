@@ -0,0 +1,272 @@
+package ruby
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// An UnsupportedTypeError is returned when attempting to encode a value whose type
+// has no Ruby representation.
+type UnsupportedTypeError struct {
+	Type reflect.Type
+	Path string
+}
+
+func (self *UnsupportedTypeError) Error() string {
+	if self.Path != `` {
+		return fmt.Sprintf("Unsupported type '%v' at %s, cannot encode", self.Type, self.Path)
+	}
+
+	return fmt.Sprintf("Unsupported type '%v', cannot encode", self.Type)
+}
+
+// An UnsupportedValueError is returned when attempting to encode a value of a supported
+// type that has no valid Ruby representation, such as a Number that is not a number or a
+// Regexp with flags Ruby does not have.
+type UnsupportedValueError struct {
+	Value reflect.Value
+	Str   string
+	Path  string
+}
+
+func (self *UnsupportedValueError) Error() string {
+	if self.Path != `` {
+		return fmt.Sprintf("Unsupported value %s at %s, cannot encode", self.Str, self.Path)
+	}
+
+	return fmt.Sprintf("Unsupported value %s, cannot encode", self.Str)
+}
+
+// A MarshalerError is returned when a type's MarshalRuby method fails.
+type MarshalerError struct {
+	Type reflect.Type
+	Path string
+	Err  error
+}
+
+func (self *MarshalerError) Error() string {
+	if self.Path != `` {
+		return fmt.Sprintf("Error calling MarshalRuby for type '%v' at %s: %v", self.Type, self.Path, self.Err)
+	}
+
+	return fmt.Sprintf("Error calling MarshalRuby for type '%v': %v", self.Type, self.Err)
+}
+
+func (self *MarshalerError) Unwrap() error {
+	return self.Err
+}
+
+// valuePath records where in the input the encoder currently is; it is a linked list
+// from the innermost value outward so that descending is cheap and the path is only
+// rendered when an error needs it.
+type valuePath struct {
+	parent *valuePath
+	field  string
+	key    interface{}
+	index  int
+}
+
+// returns the path to the named struct field within this value
+func (self *valuePath) Field(name string) *valuePath {
+	return &valuePath{
+		parent: self,
+		field:  name,
+		index:  -1,
+	}
+}
+
+// returns the path to the given map key within this value
+func (self *valuePath) Key(key interface{}) *valuePath {
+	return &valuePath{
+		parent: self,
+		key:    key,
+		index:  -1,
+	}
+}
+
+// returns the path to the given array element within this value
+func (self *valuePath) Index(index int) *valuePath {
+	return &valuePath{
+		parent: self,
+		index:  index,
+	}
+}
+
+// renders the path as Go-like accessors, e.g.: Properties["prop-3"].Items[2]
+func (self *valuePath) String() string {
+	segments := make([]string, 0)
+
+	for p := self; p != nil; p = p.parent {
+		switch {
+		case p.field != ``:
+			segments = append(segments, `.`+p.field)
+		case p.index >= 0:
+			segments = append(segments, `[`+strconv.Itoa(p.index)+`]`)
+		default:
+			if str, ok := p.key.(string); ok {
+				segments = append(segments, `[`+strconv.Quote(str)+`]`)
+			} else if sym, ok := p.key.(Symbol); ok {
+				segments = append(segments, `[`+symbolLiteral(string(sym))+`]`)
+			} else {
+				segments = append(segments, fmt.Sprintf("[%v]", p.key))
+			}
+		}
+	}
+
+	var path strings.Builder
+
+	for i := len(segments) - 1; i >= 0; i-- {
+		path.WriteString(segments[i])
+	}
+
+	return strings.TrimPrefix(path.String(), `.`)
+}
+
+// A SyntaxError describes Ruby source that could not be decoded, either because it is not
+// valid Ruby or because it uses constructs the decoder does not support.  Excerpt holds
+// the line of source on which the problem was found.
+type SyntaxError struct {
+	Msg     string
+	Offset  int
+	Line    int
+	Column  int
+	Excerpt string
+}
+
+func (self *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at line %d, column %d", self.Msg, self.Line, self.Column) + formatExcerpt(self.Excerpt, self.Column)
+}
+
+// An EvalError describes Ruby source that could be parsed but not evaluated, because it
+// uses something an Evaluator does not support (or allow), raises an error or exceeds
+// the Evaluator's budget.  Excerpt holds the line of source on which the problem was
+// found.
+type EvalError struct {
+	Msg     string
+	Offset  int
+	Line    int
+	Column  int
+	Excerpt string
+}
+
+func (self *EvalError) Error() string {
+	return fmt.Sprintf("%s at line %d, column %d", self.Msg, self.Line, self.Column) + formatExcerpt(self.Excerpt, self.Column)
+}
+
+// An UnmarshalTypeError is returned when a Ruby value cannot be stored in the Go value it
+// was decoded into.  Value describes the Ruby value (e.g.: "integer 300") and Path the
+// location of the Go value within the one being decoded into.
+type UnmarshalTypeError struct {
+	Path    string
+	Value   string
+	Type    reflect.Type
+	Offset  int
+	Line    int
+	Column  int
+	Excerpt string
+}
+
+func (self *UnmarshalTypeError) Error() string {
+	var msg string
+
+	if self.Path != `` {
+		msg = fmt.Sprintf("Cannot decode Ruby %s into Go value of type '%v' at %s, line %d, column %d", self.Value, self.Type, self.Path, self.Line, self.Column)
+	} else {
+		msg = fmt.Sprintf("Cannot decode Ruby %s into Go value of type '%v' at line %d, column %d", self.Value, self.Type, self.Line, self.Column)
+	}
+
+	return msg + formatExcerpt(self.Excerpt, self.Column)
+}
+
+// An UnmarshalerError is returned when a type's UnmarshalRuby (or, for strings,
+// UnmarshalText) method fails.
+type UnmarshalerError struct {
+	Type    reflect.Type
+	Path    string
+	Err     error
+	Offset  int
+	Line    int
+	Column  int
+	Excerpt string
+}
+
+func (self *UnmarshalerError) Error() string {
+	var msg string
+
+	if self.Path != `` {
+		msg = fmt.Sprintf("Error decoding Ruby value into type '%v' at %s, line %d, column %d: %v", self.Type, self.Path, self.Line, self.Column, self.Err)
+	} else {
+		msg = fmt.Sprintf("Error decoding Ruby value into type '%v' at line %d, column %d: %v", self.Type, self.Line, self.Column, self.Err)
+	}
+
+	return msg + formatExcerpt(self.Excerpt, self.Column)
+}
+
+func (self *UnmarshalerError) Unwrap() error {
+	return self.Err
+}
+
+// An UnknownFieldError is returned by decoders that disallow unknown fields when a hash
+// being decoded into a struct has a key that names none of its fields.  Key holds the
+// source of the key.
+type UnknownFieldError struct {
+	Type    reflect.Type
+	Key     string
+	Path    string
+	Offset  int
+	Line    int
+	Column  int
+	Excerpt string
+}
+
+func (self *UnknownFieldError) Error() string {
+	var msg string
+
+	if self.Path != `` {
+		msg = fmt.Sprintf("Unknown key %s for type '%v' at %s, line %d, column %d", self.Key, self.Type, self.Path, self.Line, self.Column)
+	} else {
+		msg = fmt.Sprintf("Unknown key %s for type '%v' at line %d, column %d", self.Key, self.Type, self.Line, self.Column)
+	}
+
+	return msg + formatExcerpt(self.Excerpt, self.Column)
+}
+
+// An InvalidUnmarshalError is returned when the value given to decode into is not a
+// non-nil pointer.
+type InvalidUnmarshalError struct {
+	Type reflect.Type
+}
+
+func (self *InvalidUnmarshalError) Error() string {
+	if self.Type == nil {
+		return `Cannot decode into nil`
+	} else if self.Type.Kind() != reflect.Ptr {
+		return fmt.Sprintf("Cannot decode into non-pointer type '%v'", self.Type)
+	}
+
+	return fmt.Sprintf("Cannot decode into nil pointer of type '%v'", self.Type)
+}
+
+// renders a line of source beneath an error message, with a caret marking the column
+func formatExcerpt(line string, column int) string {
+	if line == `` {
+		return ``
+	}
+
+	var caret strings.Builder
+
+	// tabs are kept so that the caret lines up however wide they are displayed
+	for i, r := range line {
+		if i >= column-1 {
+			break
+		} else if r == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+
+	return "\n    " + line + "\n    " + caret.String() + `^`
+}
@@ -0,0 +1,113 @@
+package ruby
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type TestStructErrorItems struct {
+	Items []interface{}
+}
+
+type TestMarshaler struct {
+	Fail bool
+}
+
+func (self TestMarshaler) MarshalRuby() ([]byte, error) {
+	if self.Fail {
+		return nil, errors.New(`marshaler failed`)
+	}
+
+	return []byte(`Custom.new`), nil
+}
+
+func TestEncodeUnsupportedTypeError(t *testing.T) {
+	e := &encodeState{}
+
+	in := TestStructComplex{
+		Properties: map[string]interface{}{
+			`prop-3`: &TestStructErrorItems{
+				Items: []interface{}{1, 2, make(chan int)},
+			},
+		},
+	}
+
+	err := e.marshal(in)
+
+	if typeErr, ok := err.(*UnsupportedTypeError); !ok {
+		t.Fatalf("Expected *UnsupportedTypeError, got %T (%v)", err, err)
+	} else if shouldBe := `Properties["prop-3"].Items[2]`; typeErr.Path != shouldBe {
+		t.Fatalf("Expected path %q, got %q", shouldBe, typeErr.Path)
+	} else if typeErr.Type != reflect.TypeOf(make(chan int)) {
+		t.Fatalf("Expected type chan int, got %v", typeErr.Type)
+	} else {
+		t.Log(typeErr)
+	}
+}
+
+func TestEncodeMarshaler(t *testing.T) {
+	e := &encodeState{}
+
+	in := map[Symbol]interface{}{
+		`ok`: []TestMarshaler{{}},
+	}
+
+	shouldBe := `{:ok=>[Custom.new]}`
+
+	if err := e.marshal(in); err != nil {
+		t.Fatal(err)
+	} else if s := e.String(); s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	}
+
+	e.Reset()
+	in[`failing`] = []TestMarshaler{{}, {Fail: true}}
+
+	err := e.marshal(in)
+
+	if marshalerErr, ok := err.(*MarshalerError); !ok {
+		t.Fatalf("Expected *MarshalerError, got %T (%v)", err, err)
+	} else if shouldBe := `[:failing][1]`; marshalerErr.Path != shouldBe {
+		t.Fatalf("Expected path %q, got %q", shouldBe, marshalerErr.Path)
+	} else if marshalerErr.Unwrap().Error() != `marshaler failed` {
+		t.Fatalf("Expected the underlying error to be preserved, got %v", marshalerErr.Unwrap())
+	} else {
+		t.Log(marshalerErr)
+	}
+}
+
+func TestEncodeUnsupportedValueError(t *testing.T) {
+	for path, in := range map[string]interface{}{
+		`[0]`:      []interface{}{Number(`1e`)},
+		`["rx"]`:   map[string]interface{}{`rx`: Regexp{Source: `a`, Flags: `q`}},
+		`Items[1]`: TestStructErrorItems{Items: []interface{}{1, Number(`x`)}},
+	} {
+		e := &encodeState{}
+		err := e.marshal(in)
+
+		if valueErr, ok := err.(*UnsupportedValueError); !ok {
+			t.Fatalf("Expected *UnsupportedValueError, got %T (%v)", err, err)
+		} else if valueErr.Path != path {
+			t.Fatalf("Expected path %q, got %q", path, valueErr.Path)
+		} else {
+			t.Log(valueErr)
+		}
+	}
+}
+
+func TestEncodeDuplicateKeyErrorPath(t *testing.T) {
+	e := &encodeState{}
+
+	in := map[string]interface{}{
+		`ports`: map[interface{}]int{int(1): 1, int64(1): 2},
+	}
+
+	err := e.marshal(in)
+
+	if dupErr, ok := err.(*DuplicateKeyError); !ok {
+		t.Fatalf("Expected *DuplicateKeyError, got %T (%v)", err, err)
+	} else if shouldBe := `Duplicate key 1 in map[interface {}]int at ["ports"]`; dupErr.Error() != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, dupErr.Error())
+	}
+}
@@ -0,0 +1,966 @@
+package ruby
+
+import (
+	"fmt"
+	"github.com/ghetzel/rubyutils/encoding/ruby/ast"
+	"github.com/ghetzel/rubyutils/encoding/ruby/parser"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DefaultEvalBudget is the number of steps an Evaluator may take unless told otherwise.
+const DefaultEvalBudget = 1000000
+
+// An Evaluator reads Ruby source that computes its values rather than writing them out,
+// as configuration files often do: 60 * 60, 'a' + 'b', %w[a b].freeze,
+// [1, 2].map(&:to_s) or File.join('etc', 'app').  It evaluates a side-effect-free subset
+// of Ruby (literals, local variables and constants, operators, conditionals, blocks and
+// the methods of the core classes that neither touch the filesystem, network or process
+// nor depend on the time or chance), and fails with an *EvalError on anything else.
+// Arrays, sets and strings cannot be changed in place (as by <<), though hashes can be
+// unless they are frozen.  Evaluation is limited to a budget of steps, which large values
+// (such as long strings or arrays) use more of, so that no input can run for long or
+// exhaust memory.
+type Evaluator struct {
+	budget    int
+	variables map[string]interface{}
+	filename  string
+}
+
+// NewEvaluator returns a new Evaluator with the default budget.
+func NewEvaluator() *Evaluator {
+	return &Evaluator{
+		budget: DefaultEvalBudget,
+	}
+}
+
+// Eval evaluates the Ruby source in data with a new Evaluator, storing the value of its
+// last statement in the value pointed to by v as Unmarshal does.
+func Eval(data []byte, v interface{}) error {
+	return NewEvaluator().Eval(data, v)
+}
+
+// SetBudget sets the number of steps that evaluating each source may take.
+func (self *Evaluator) SetBudget(steps int) {
+	self.budget = steps
+}
+
+// SetVariables defines the given values before evaluating each source, converted to Ruby
+// as Marshal would write them.  Names beginning with an uppercase letter (such as ENV) are
+// defined as constants and others as local variables.
+func (self *Evaluator) SetVariables(variables map[string]interface{}) {
+	self.variables = variables
+}
+
+// SetFilename sets the name of the file each source is read from, which __FILE__ returns
+// and whose directory __dir__ returns.  Without one, evaluating either fails.
+func (self *Evaluator) SetFilename(name string) {
+	self.filename = name
+}
+
+// Eval evaluates the Ruby source in data, which may be any number of statements (such as
+// assignments to local variables that the last refers to), and stores the value of its
+// last statement in the value pointed to by v as Unmarshal does.  Errors that occur while
+// evaluating are returned as an *EvalError.
+func (self *Evaluator) Eval(data []byte, v interface{}) error {
+	d := newDecodeState(data, 0, 1, 1)
+	file, err := parser.ParseFile(data)
+
+	if err != nil {
+		return d.syntaxError(err)
+	}
+
+	e := newEvalState(d, self.budget)
+	e.filename = self.filename
+
+	if err := e.define(self.variables); err != nil {
+		return err
+	}
+
+	node, err := e.file(file)
+
+	if err != nil {
+		return err
+	}
+
+	return d.unmarshal(node, v)
+}
+
+// evaluates parsed Ruby, reporting errors against the source it was parsed from
+type evalState struct {
+	*decodeState
+	budget int
+	steps  int
+	scope  *evalScope
+	consts map[string]interface{}
+	match  []interface{}
+
+	// the name of the file being evaluated, if it was given
+	filename string
+}
+
+// the local variables visible to the code being evaluated; blocks see those of the code
+// around them
+type evalScope struct {
+	locals map[string]interface{}
+	parent *evalScope
+}
+
+// carries an error out of the evaluation to the method that started it
+type evalBailout struct {
+	err error
+}
+
+func newEvalState(d *decodeState, budget int) *evalState {
+	return &evalState{
+		decodeState: d,
+		budget:      budget,
+		scope:       newEvalScope(nil),
+		consts:      make(map[string]interface{}),
+	}
+}
+
+func newEvalScope(parent *evalScope) *evalScope {
+	return &evalScope{
+		locals: make(map[string]interface{}),
+		parent: parent,
+	}
+}
+
+func (self *evalScope) lookup(name string) (interface{}, bool) {
+	for scope := self; scope != nil; scope = scope.parent {
+		if value, ok := scope.locals[name]; ok {
+			return value, true
+		}
+	}
+
+	return nil, false
+}
+
+// assigns to the variable where it was first assigned, or else creates it in this scope
+func (self *evalScope) assign(name string, value interface{}) {
+	for scope := self; scope != nil; scope = scope.parent {
+		if _, ok := scope.locals[name]; ok {
+			scope.locals[name] = value
+			return
+		}
+	}
+
+	self.locals[name] = value
+}
+
+func (self *evalState) recover(err *error) {
+	if r := recover(); r != nil {
+		if b, ok := r.(evalBailout); ok {
+			*err = b.err
+		} else {
+			panic(r)
+		}
+	}
+}
+
+// stops evaluation with an *EvalError at the given node
+func (self *evalState) fail(node ast.Node, format string, args ...interface{}) {
+	line, column := self.position(node.Pos())
+
+	panic(evalBailout{&EvalError{
+		Msg:     fmt.Sprintf(format, args...),
+		Offset:  node.Pos(),
+		Line:    line,
+		Column:  column,
+		Excerpt: self.sourceLine(node.Pos(), column),
+	}})
+}
+
+// uses up the given number of steps of the budget
+func (self *evalState) step(node ast.Node, steps int) {
+	if steps < 0 || self.steps+steps > self.budget {
+		self.steps = self.budget
+		self.fail(node, "Evaluation exceeded its budget of %d steps", self.budget)
+	}
+
+	self.steps += steps
+}
+
+// defines the given Go values as constants (for names beginning with an uppercase letter)
+// or local variables, converting them by evaluating the Ruby that Marshal writes for them
+func (self *evalState) define(variables map[string]interface{}) error {
+	names := make([]string, 0, len(variables))
+
+	for name := range variables {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		data, err := Marshal(variables[name])
+
+		if err != nil {
+			return err
+		}
+
+		e := newEvalState(newDecodeState(data, 0, 1, 1), DefaultEvalBudget)
+		node, err := parser.ParseExpr(data)
+
+		if err != nil {
+			return e.syntaxError(err)
+		}
+
+		value, err := e.evaluate(node)
+
+		if err != nil {
+			return err
+		} else if name != `` && unicode.IsUpper(rune(name[0])) {
+			self.consts[name] = value
+		} else {
+			self.scope.locals[name] = value
+		}
+	}
+
+	return nil
+}
+
+// evaluates a single expression, returning any error rather than stopping with it
+func (self *evalState) evaluate(node ast.Expr) (value interface{}, err error) {
+	defer self.recover(&err)
+	return self.eval(node), nil
+}
+
+// evaluates every statement of a file, returning the last as literal nodes the decoder
+// can read
+func (self *evalState) file(file *ast.File) (node ast.Expr, err error) {
+	defer self.recover(&err)
+
+	if len(file.Body) == 0 {
+		return &ast.Nil{Span: file.Span}, nil
+	}
+
+	for _, statement := range file.Body[:len(file.Body)-1] {
+		self.eval(statement)
+	}
+
+	return self.fold(file.Body[len(file.Body)-1]), nil
+}
+
+// evaluates the node, keeping the arrays and hashes written as literals (and so the
+// positions of their elements, for errors found when decoding them)
+func (self *evalState) fold(node ast.Expr) ast.Expr {
+	switch n := node.(type) {
+	case *ast.Paren:
+		if len(n.Body) == 1 {
+			return self.fold(n.Body[0])
+		}
+
+	case *ast.Array:
+		elements := make([]ast.Expr, len(n.Elements))
+
+		for i, element := range n.Elements {
+			if _, ok := element.(*ast.Splat); ok {
+				return self.literal(self.eval(node), node)
+			}
+
+			elements[i] = self.fold(element)
+		}
+
+		return &ast.Array{Span: n.Span, Elements: elements}
+
+	case *ast.Hash:
+		pairs := make([]ast.Expr, len(n.Pairs))
+
+		for i, entry := range n.Pairs {
+			pair, ok := entry.(*ast.Pair)
+
+			if !ok {
+				return self.literal(self.eval(node), node)
+			}
+
+			pairs[i] = &ast.Pair{
+				Span:  pair.Span,
+				Key:   self.fold(pair.Key),
+				Value: self.fold(pair.Value),
+				Label: pair.Label,
+			}
+		}
+
+		return &ast.Hash{Span: n.Span, Pairs: pairs, Braces: n.Braces}
+	}
+
+	return self.literal(self.eval(node), node)
+}
+
+// returns the literal nodes for an evaluated value, placed at the node it came from
+func (self *evalState) literal(value interface{}, at ast.Node) ast.Expr {
+	span := ast.Span{Start: at.Pos(), Stop: at.End()}
+	text := func(str string) []ast.Expr {
+		return []ast.Expr{&ast.StringText{Span: span, Value: str}}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return &ast.Nil{Span: span}
+	case bool:
+		return &ast.Bool{Span: span, Value: v}
+	case *big.Int:
+		return &ast.Integer{Span: span, Value: v.String()}
+
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return &ast.Const{Span: span, Scope: &ast.Const{Span: span, Name: `Float`}, Name: `NAN`}
+		case math.IsInf(v, 0):
+			inf := &ast.Const{Span: span, Scope: &ast.Const{Span: span, Name: `Float`}, Name: `INFINITY`}
+
+			if v < 0 {
+				return &ast.Unary{Span: span, Operator: `-`, Operand: inf}
+			}
+
+			return inf
+		}
+
+		return &ast.Float{Span: span, Value: strconv.FormatFloat(v, 'g', -1, 64)}
+
+	case *big.Rat:
+		return &ast.Call{Span: span, Name: `Rational`, Args: []ast.Expr{
+			&ast.Integer{Span: span, Value: v.Num().String()},
+			&ast.Integer{Span: span, Value: v.Denom().String()},
+		}}
+
+	case string:
+		return &ast.String{Span: span, Parts: text(v)}
+	case Symbol:
+		return &ast.Symbol{Span: span, Parts: text(string(v))}
+	case evalPathname:
+		return &ast.Call{Span: span, Receiver: &ast.Const{Span: span, Name: `Pathname`}, Operator: `.`, Name: `new`, Args: []ast.Expr{
+			&ast.String{Span: span, Parts: text(string(v))},
+		}}
+
+	case []interface{}:
+		elements := make([]ast.Expr, len(v))
+
+		for i, element := range v {
+			elements[i] = self.literal(element, at)
+		}
+
+		return &ast.Array{Span: span, Elements: elements}
+
+	case *evalHash:
+		pairs := make([]ast.Expr, len(v.keys))
+
+		for i, key := range v.keys {
+			pairs[i] = &ast.Pair{Span: span, Key: self.literal(key, at), Value: self.literal(v.values[i], at)}
+		}
+
+		return &ast.Hash{Span: span, Pairs: pairs, Braces: true}
+
+	case Range:
+		rng := &ast.Range{Span: span, Exclusive: v.Exclusive}
+
+		if v.Begin != nil {
+			rng.Low = self.literal(v.Begin, at)
+		}
+
+		if v.End != nil {
+			rng.High = self.literal(v.End, at)
+		}
+
+		return rng
+
+	case Set:
+		elements := make([]ast.Expr, len(v))
+
+		for i, element := range v {
+			elements[i] = self.literal(element, at)
+		}
+
+		return &ast.Index{Span: span, Receiver: &ast.Const{Span: span, Name: `Set`}, Args: elements}
+
+	case Regexp:
+		return &ast.Regexp{Span: span, Parts: text(v.Source), Flags: v.Flags}
+
+	case time.Time:
+		args := []ast.Expr{
+			&ast.Integer{Span: span, Value: strconv.FormatInt(v.Unix(), 10)},
+			&ast.Integer{Span: span, Value: strconv.Itoa(v.Nanosecond())},
+			&ast.Symbol{Span: span, Parts: text(`nsec`)},
+		}
+
+		if v.Location() != time.Local {
+			zone := v.Format(`-07:00`)
+
+			if v.Location() == time.UTC {
+				zone = `UTC`
+			}
+
+			args = append(args, &ast.Hash{Span: span, Pairs: []ast.Expr{
+				&ast.Pair{Span: span, Key: &ast.Symbol{Span: span, Parts: text(`in`)}, Value: &ast.String{Span: span, Parts: text(zone)}, Label: true},
+			}})
+		}
+
+		return &ast.Call{Span: span, Receiver: &ast.Const{Span: span, Name: `Time`}, Operator: `.`, Name: `at`, Args: args}
+	}
+
+	self.fail(at, "Cannot decode %s, it has no literal value", className(value))
+	return nil
+}
+
+// evaluates a sequence of statements, returning the value of the last
+func (self *evalState) statements(body []ast.Expr) interface{} {
+	var value interface{}
+
+	for _, statement := range body {
+		value = self.eval(statement)
+	}
+
+	return value
+}
+
+func (self *evalState) eval(node ast.Expr) interface{} {
+	self.step(node, 1)
+
+	switch n := node.(type) {
+	case *ast.Nil:
+		return nil
+	case *ast.Bool:
+		return n.Value
+
+	case *ast.Integer:
+		if value, ok := new(big.Int).SetString(n.Value, 0); ok {
+			return value
+		}
+
+	case *ast.Float:
+		if value, err := strconv.ParseFloat(n.Value, 64); err == nil {
+			return value
+		}
+
+	case *ast.Rational:
+		if value, ok := new(big.Rat).SetString(n.Value); ok {
+			return value
+		}
+
+	case *ast.String:
+		return self.text(n.Parts)
+	case *ast.Symbol:
+		return Symbol(self.text(n.Parts))
+	case *ast.Regexp:
+		return Regexp{Source: self.text(n.Parts), Flags: n.Flags}
+	case *ast.XString:
+		self.fail(node, `Running shell commands is not allowed`)
+	case *ast.Array:
+		return self.elements(n.Elements)
+	case *ast.Hash:
+		return self.hash(n)
+
+	case *ast.Range:
+		rng := Range{Exclusive: n.Exclusive}
+
+		if n.Low != nil {
+			rng.Begin = self.eval(n.Low)
+		}
+
+		if n.High != nil {
+			rng.End = self.eval(n.High)
+		}
+
+		return rng
+
+	case *ast.Ident:
+		if value, ok := self.scope.lookup(n.Name); ok {
+			return value
+		}
+
+		return self.call(&evalCall{node: node, name: n.Name})
+
+	case *ast.Const:
+		return self.constant(n)
+	case *ast.Variable:
+		if group, ok := self.matchGroup(n.Name); ok {
+			return group
+		}
+
+		self.fail(node, "Cannot evaluate '%s', only local variables are supported", n.Name)
+	case *ast.Call:
+		return self.methodCall(n)
+
+	case *ast.Index:
+		receiver := self.eval(n.Receiver)
+		args, block := self.args(n.Args)
+
+		return self.call(&evalCall{node: node, receiver: receiver, hasReceiver: true, name: `[]`, args: args, block: block})
+
+	case *ast.Assign:
+		return self.assign(n)
+	case *ast.Binary:
+		return self.binary(n)
+	case *ast.Unary:
+		return self.unary(n)
+
+	case *ast.If:
+		cond := truthy(self.eval(n.Cond))
+
+		if cond != n.Unless {
+			return self.statements(n.Then)
+		}
+
+		return self.statements(n.Else)
+
+	case *ast.Paren:
+		return self.statements(n.Body)
+	}
+
+	self.fail(node, "Cannot evaluate '%s'", self.code(node))
+	return nil
+}
+
+// returns the first line of a node's source, for error messages
+func (self *evalState) code(node ast.Node) string {
+	code := self.source(node.Pos(), node.End())
+
+	if i := strings.IndexByte(string(code), '\n'); i >= 0 {
+		return string(code[:i]) + `...`
+	}
+
+	return string(code)
+}
+
+// evaluates the text and interpolations of a string, symbol or regexp
+func (self *evalState) text(parts []ast.Expr) string {
+	var str strings.Builder
+
+	for _, part := range parts {
+		switch p := part.(type) {
+		case *ast.StringText:
+			str.WriteString(p.Value)
+		case *ast.Interpolation:
+			str.WriteString(rubyString(self.statements(p.Body)))
+		}
+	}
+
+	if len(parts) > 0 {
+		self.step(parts[0], str.Len()/8)
+	}
+
+	return str.String()
+}
+
+// evaluates the elements of an array, or the arguments to a method, expanding splats
+func (self *evalState) elements(nodes []ast.Expr) []interface{} {
+	values := make([]interface{}, 0, len(nodes))
+
+	for _, node := range nodes {
+		if splat, ok := node.(*ast.Splat); ok {
+			expanded := self.splat(splat, self.eval(splat.Value))
+
+			self.step(splat, len(expanded))
+			values = append(values, expanded...)
+		} else {
+			values = append(values, self.eval(node))
+		}
+	}
+
+	return values
+}
+
+// returns the values a splat expands to: the elements of arrays and ranges, the pairs of
+// hashes, nothing for nil, and anything else as it is
+func (self *evalState) splat(node ast.Node, value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	case *evalHash, Range, Set:
+		return self.toArray(node, v)
+	}
+
+	return []interface{}{value}
+}
+
+func (self *evalState) hash(node *ast.Hash) *evalHash {
+	hash := newEvalHash()
+
+	for _, entry := range node.Pairs {
+		switch e := entry.(type) {
+		case *ast.Pair:
+			hash.set(self.eval(e.Key), self.eval(e.Value))
+
+		case *ast.DoubleSplat:
+			value := self.eval(e.Value)
+
+			if other, ok := value.(*evalHash); ok {
+				self.step(e, other.len())
+				hash.merge(other)
+			} else if value != nil {
+				self.fail(e, "Cannot convert %s into a hash", className(value))
+			}
+		}
+	}
+
+	return hash
+}
+
+// evaluates the arguments of a call, separating out the block passed with &
+func (self *evalState) args(nodes []ast.Expr) ([]interface{}, evalBlock) {
+	var block evalBlock
+
+	if n := len(nodes); n > 0 {
+		if pass, ok := nodes[n-1].(*ast.BlockPass); ok {
+			nodes = nodes[:n-1]
+			block = self.blockPass(pass)
+		}
+	}
+
+	return self.elements(nodes), block
+}
+
+func (self *evalState) methodCall(node *ast.Call) interface{} {
+	call := &evalCall{
+		node: node,
+		name: node.Name,
+	}
+
+	if node.Receiver != nil {
+		call.receiver = self.eval(node.Receiver)
+		call.hasReceiver = true
+
+		if node.Operator == `&.` && call.receiver == nil {
+			return nil
+		}
+	}
+
+	call.args, call.block = self.args(node.Args)
+
+	if node.Block != nil {
+		if call.block != nil {
+			self.fail(node.Block, `Cannot pass both a block argument and a literal block`)
+		}
+
+		call.block = self.block(node.Block)
+	}
+
+	return self.call(call)
+}
+
+// sets an element of a hash, as []= does; arrays are held as values, so their elements
+// cannot be assigned to
+func (self *evalState) setIndex(node *ast.Index, receiver interface{}, args []interface{}, value interface{}) {
+	switch receiver.(type) {
+	case *evalHash:
+		self.call(&evalCall{
+			node:        node,
+			receiver:    receiver,
+			hasReceiver: true,
+			name:        `[]=`,
+			args:        append(append([]interface{}(nil), args...), value),
+		})
+	case []interface{}:
+		self.fail(node, `Cannot assign to an element of an Array, which changes it in place; build a new Array instead`)
+	default:
+		self.fail(node, "Undefined or unsupported method '[]=' for %s", className(receiver))
+	}
+}
+
+// returns a block that calls the method named by a symbol (&:name) on its first argument
+func (self *evalState) blockPass(node *ast.BlockPass) evalBlock {
+	value := self.eval(node.Value)
+	name, ok := value.(Symbol)
+
+	if !ok {
+		self.fail(node, "Cannot pass %s as a block, only symbols are supported", className(value))
+	}
+
+	return func(args []interface{}) interface{} {
+		if len(args) == 0 {
+			self.fail(node, "No receiver given for '%s'", name)
+		}
+
+		return self.call(&evalCall{node: node, receiver: args[0], hasReceiver: true, name: string(name), args: args[1:]})
+	}
+}
+
+// returns a block that evaluates its body with its parameters bound to the arguments
+// given; as in Ruby, a single array given to a block taking several parameters is spread
+// across them
+func (self *evalState) block(node *ast.Block) evalBlock {
+	for _, param := range node.Params {
+		if param.Prefix != `` && param.Prefix != `*` {
+			self.fail(param, "Cannot evaluate block parameter '%s%s'", param.Prefix, param.Name)
+		}
+	}
+
+	return func(args []interface{}) interface{} {
+		if array, ok := singleArray(args); ok && len(node.Params) > 1 {
+			args = array
+		}
+
+		saved := self.scope
+		self.scope = newEvalScope(saved)
+
+		defer func() {
+			self.scope = saved
+		}()
+
+		for i, param := range node.Params {
+			switch {
+			case param.Prefix == `*`:
+				rest := make([]interface{}, 0)
+
+				if i < len(args) {
+					rest = append(rest, args[i:]...)
+				}
+
+				self.scope.locals[param.Name] = rest
+			case i < len(args):
+				self.scope.locals[param.Name] = args[i]
+			case param.Default != nil:
+				self.scope.locals[param.Name] = self.eval(param.Default)
+			default:
+				self.scope.locals[param.Name] = nil
+			}
+		}
+
+		return self.statements(node.Body)
+	}
+}
+
+func singleArray(args []interface{}) ([]interface{}, bool) {
+	if len(args) == 1 {
+		array, ok := args[0].([]interface{})
+		return array, ok
+	}
+
+	return nil, false
+}
+
+func (self *evalState) constant(node *ast.Const) interface{} {
+	if node.Scope == nil {
+		if value, ok := self.consts[node.Name]; ok && !node.TopLevel {
+			return value
+		} else if evalModules[node.Name] {
+			return evalModule(node.Name)
+		}
+
+		self.fail(node, "Uninitialized constant '%s'", node.Name)
+	}
+
+	scope := self.eval(node.Scope)
+
+	if module, ok := scope.(evalModule); ok {
+		if value, ok := moduleConstant(string(module) + `::` + node.Name); ok {
+			return value
+		}
+	}
+
+	self.fail(node, "Uninitialized constant '%s'", self.code(node))
+	return nil
+}
+
+func (self *evalState) assign(node *ast.Assign) interface{} {
+	var current func() (interface{}, bool)
+	var set func(interface{})
+
+	switch target := node.Target.(type) {
+	case *ast.Ident:
+		current = func() (interface{}, bool) {
+			return self.scope.lookup(target.Name)
+		}
+
+		set = func(value interface{}) {
+			self.scope.assign(target.Name, value)
+		}
+
+	case *ast.Const:
+		if target.Scope != nil || target.TopLevel {
+			self.fail(target, "Cannot assign to '%s', only local variables, constants and elements are supported", self.code(target))
+		}
+
+		current = func() (interface{}, bool) {
+			value, ok := self.consts[target.Name]
+			return value, ok
+		}
+
+		set = func(value interface{}) {
+			self.consts[target.Name] = value
+		}
+
+	case *ast.Index:
+		receiver := self.eval(target.Receiver)
+		args, _ := self.args(target.Args)
+
+		current = func() (interface{}, bool) {
+			return self.call(&evalCall{node: target, receiver: receiver, hasReceiver: true, name: `[]`, args: args}), true
+		}
+
+		set = func(value interface{}) {
+			self.setIndex(target, receiver, args, value)
+		}
+
+	default:
+		self.fail(node.Target, "Cannot assign to '%s', only local variables, constants and elements are supported", self.code(node.Target))
+	}
+
+	var value interface{}
+
+	switch node.Operator {
+	case `=`:
+		value = self.eval(node.Value)
+
+	case `||=`, `&&=`:
+		value, _ = current()
+
+		if truthy(value) == (node.Operator == `&&=`) {
+			value = self.eval(node.Value)
+		} else {
+			return value
+		}
+
+	default:
+		left, ok := current()
+
+		if !ok {
+			self.fail(node.Target, "Undefined local variable or constant '%s'", self.code(node.Target))
+		}
+
+		value = self.call(&evalCall{
+			node:        node,
+			receiver:    left,
+			hasReceiver: true,
+			name:        strings.TrimSuffix(node.Operator, `=`),
+			args:        []interface{}{self.eval(node.Value)},
+		})
+	}
+
+	set(value)
+	return value
+}
+
+func (self *evalState) binary(node *ast.Binary) interface{} {
+	switch node.Operator {
+	case `&&`, `and`:
+		if left := self.eval(node.Left); !truthy(left) {
+			return left
+		}
+
+		return self.eval(node.Right)
+
+	case `||`, `or`:
+		if left := self.eval(node.Left); truthy(left) {
+			return left
+		}
+
+		return self.eval(node.Right)
+
+	case `!=`:
+		return !truthy(self.binaryCall(node, `==`))
+	case `!~`:
+		return !truthy(self.binaryCall(node, `=~`))
+	}
+
+	return self.binaryCall(node, node.Operator)
+}
+
+// evaluates a binary operator as the method call on its left operand that it is in Ruby
+func (self *evalState) binaryCall(node *ast.Binary, name string) interface{} {
+	left := self.eval(node.Left)
+	right := self.eval(node.Right)
+
+	return self.call(&evalCall{node: node, receiver: left, hasReceiver: true, name: name, args: []interface{}{right}})
+}
+
+func (self *evalState) unary(node *ast.Unary) interface{} {
+	var name string
+
+	switch node.Operator {
+	case `!`, `not`:
+		return !truthy(self.eval(node.Operand))
+	case `-`, `+`:
+		name = node.Operator + `@`
+	case `~`:
+		name = `~`
+	default:
+		self.fail(node, "Cannot evaluate '%s'", node.Operator)
+	}
+
+	operand := self.eval(node.Operand)
+
+	return self.call(&evalCall{node: node, receiver: operand, hasReceiver: true, name: name})
+}
+
+// reports whether a value counts as true in a condition: anything but nil and false
+func truthy(value interface{}) bool {
+	return value != nil && value != false
+}
+
+// evaluates the interpolations within a string, symbol or regexp (and those within the keys
+// of a hash or the arguments of a call, which are read as they are), leaving the text they
+// produce in their place; names other than the variables the decoder was given are errors
+func (self *decodeState) interpolate(node ast.Expr) (err error) {
+	switch n := node.(type) {
+	case *ast.String:
+		return self.interpolateText(n.Span, &n.Parts)
+	case *ast.Symbol:
+		return self.interpolateText(n.Span, &n.Parts)
+	case *ast.Regexp:
+		return self.interpolateText(n.Span, &n.Parts)
+
+	case *ast.Hash:
+		for _, entry := range n.Pairs {
+			if pair, ok := entry.(*ast.Pair); ok {
+				if err := self.interpolate(pair.Key); err != nil {
+					return err
+				}
+			}
+		}
+
+	case *ast.Call, *ast.Index:
+		ast.Inspect(node, func(child ast.Node) bool {
+			switch c := child.(type) {
+			case *ast.String, *ast.Symbol, *ast.Regexp:
+				if err == nil {
+					err = self.interpolate(c.(ast.Expr))
+				}
+
+				return false
+			}
+
+			return err == nil
+		})
+	}
+
+	return err
+}
+
+func (self *decodeState) interpolateText(span ast.Span, parts *[]ast.Expr) error {
+	literal := true
+
+	for _, part := range *parts {
+		if _, ok := part.(*ast.StringText); !ok {
+			literal = false
+		}
+	}
+
+	if literal {
+		return nil
+	} else if self.interpolator == nil {
+		self.interpolator = newEvalState(self, DefaultEvalBudget)
+
+		if err := self.interpolator.define(self.variables); err != nil {
+			return err
+		}
+	}
+
+	text, err := self.interpolator.evaluate(&ast.String{Span: span, Parts: *parts})
+
+	if err != nil {
+		return err
+	}
+
+	*parts = []ast.Expr{&ast.StringText{Span: span, Value: text.(string)}}
+	return nil
+}
@@ -0,0 +1,1592 @@
+package ruby
+
+import (
+	"github.com/ghetzel/rubyutils/encoding/ruby/ast"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// the methods that change their receiver in Ruby, and the operator that returns the
+// changed value instead; arrays, sets and strings are held as values while evaluating,
+// so they cannot be changed in place without other references to them missing it
+var evalMutators = map[string]string{
+	`Array#<<`:       `+`,
+	`Array#append`:   `+`,
+	`Array#concat`:   `+`,
+	`Array#insert`:   `+`,
+	`Array#prepend`:  `+`,
+	`Array#push`:     `+`,
+	`Array#unshift`:  `+`,
+	`Set#<<`:         `|`,
+	`Set#add`:        `|`,
+	`Set#add?`:       `|`,
+	`Set#delete`:     `-`,
+	`Set#merge`:      `|`,
+	`String#<<`:      `+`,
+	`String#concat`:  `+`,
+	`String#prepend`: `+`,
+}
+
+// calls the block given with each value and returns the receiver, or without a block
+// returns the values, for methods such as map to be called on
+func (self *evalState) each(c *evalCall, receiver interface{}, values []interface{}) interface{} {
+	if c.block == nil {
+		return values
+	}
+
+	for _, value := range values {
+		c.block([]interface{}{value})
+	}
+
+	return receiver
+}
+
+// returns the values a block returns for each value
+func (self *evalState) mapValues(values []interface{}, block evalBlock) []interface{} {
+	mapped := make([]interface{}, len(values))
+
+	for i, value := range values {
+		mapped[i] = block([]interface{}{value})
+	}
+
+	return mapped
+}
+
+// returns the values without duplicates, which are those the block (if any) returns the
+// same value for
+func (self *evalState) uniq(node ast.Node, values []interface{}, block evalBlock) []interface{} {
+	self.step(node, len(values))
+
+	seen := newEvalHash()
+	unique := make([]interface{}, 0, len(values))
+
+	for _, value := range values {
+		key := value
+
+		if block != nil {
+			key = block([]interface{}{value})
+		}
+
+		if seen.find(key) < 0 {
+			seen.set(key, true)
+			unique = append(unique, value)
+		}
+	}
+
+	return unique
+}
+
+// returns the elements of an array with those that are arrays replaced by their own
+// elements, to the given depth (or, if negative, entirely)
+func (self *evalState) flatten(node ast.Node, array []interface{}, depth int) []interface{} {
+	flat := make([]interface{}, 0, len(array))
+
+	for _, element := range array {
+		self.step(node, 1)
+
+		if nested, ok := element.([]interface{}); ok && depth != 0 {
+			flat = append(flat, self.flatten(node, nested, depth-1)...)
+		} else {
+			flat = append(flat, element)
+		}
+	}
+
+	return flat
+}
+
+// looks up each key in turn with [], stopping at nil
+func (self *evalState) dig(c *evalCall, value interface{}, keys []interface{}) interface{} {
+	for _, key := range keys {
+		if value == nil {
+			return nil
+		}
+
+		value = self.call(&evalCall{node: c.node, receiver: value, hasReceiver: true, name: `[]`, args: []interface{}{key}})
+	}
+
+	return value
+}
+
+// reports whether a pattern matches a value as it does in a case statement (or grep)
+func (self *evalState) caseEqual(c *evalCall, pattern interface{}, value interface{}) bool {
+	return truthy(self.call(&evalCall{node: c.node, receiver: pattern, hasReceiver: true, name: `===`, args: []interface{}{value}}))
+}
+
+// reports whether the block given (or, without one, the value itself) is true for a value
+func (self *evalState) test(c *evalCall, value interface{}) bool {
+	if c.block == nil {
+		return truthy(value)
+	}
+
+	return truthy(c.block([]interface{}{value}))
+}
+
+// returns the values sorted by the keys at the same positions
+func (self *evalState) sortBy(c *evalCall, values []interface{}, keys []interface{}) []interface{} {
+	self.step(c.node, len(values))
+
+	order := make([]int, len(values))
+
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		cmp, ok := compareValues(keys[order[i]], keys[order[j]])
+
+		if !ok {
+			self.fail(c.node, "Comparison of %s with %s failed", className(keys[order[i]]), className(keys[order[j]]))
+		}
+
+		return cmp < 0
+	})
+
+	sorted := make([]interface{}, len(values))
+
+	for i, j := range order {
+		sorted[i] = values[j]
+	}
+
+	return sorted
+}
+
+// returns a comparison of two values, by the block given if any
+func (self *evalState) comparator(c *evalCall) func(a, b interface{}) (int, bool) {
+	if c.block == nil {
+		return compareValues
+	}
+
+	return func(a, b interface{}) (int, bool) {
+		result := c.block([]interface{}{a, b})
+		n, ok := smallInt(result)
+
+		if !ok {
+			self.fail(c.node, "Comparison of %s with 0 failed", className(result))
+		}
+
+		return n, true
+	}
+}
+
+// returns a count argument (as given to first or take), which may not be negative
+func (self *evalState) countArg(c *evalCall, i int) int {
+	n := self.intArg(c, i)
+
+	if n < 0 {
+		self.fail(c.node, "Negative array size for '%s'", c.name)
+	}
+
+	return n
+}
+
+func reversed(values []interface{}) []interface{} {
+	reversed := make([]interface{}, len(values))
+
+	for i, value := range values {
+		reversed[len(values)-1-i] = value
+	}
+
+	return reversed
+}
+
+// the methods of Enumerable, which arrays, hashes (as [key, value] pairs), ranges and sets
+// all have
+func (self *evalState) enumerableMethod(c *evalCall, values []interface{}) (interface{}, bool) {
+	switch c.name {
+	case `each`, `each_entry`:
+		return self.each(c, c.receiver, values), true
+	case `reverse_each`:
+		return self.each(c, c.receiver, reversed(values)), true
+	case `to_a`, `entries`:
+		return append([]interface{}(nil), values...), true
+
+	case `map`, `collect`:
+		// without a block, the values are returned for methods such as with_index
+		if c.block == nil {
+			return values, true
+		}
+
+		return self.mapValues(values, c.block), true
+
+	case `flat_map`, `collect_concat`:
+		return self.flatten(c.node, self.mapValues(values, self.requireBlock(c)), 1), true
+
+	case `each_with_index`, `with_index`, `each_with_object`:
+		if c.name == `each_with_object` {
+			self.arity(c, 1, 1)
+
+			memo := c.args[0]
+			block := self.requireBlock(c)
+
+			for _, value := range values {
+				block([]interface{}{value, memo})
+			}
+
+			return memo, true
+		}
+
+		self.arity(c, 0, 1)
+
+		offset := 0
+
+		if len(c.args) == 1 {
+			offset = self.intArg(c, 0)
+		}
+
+		pairs := make([]interface{}, len(values))
+
+		for i, value := range values {
+			pairs[i] = []interface{}{value, newInt(int64(i + offset))}
+		}
+
+		switch {
+		case c.block == nil:
+			return pairs, true
+		case c.name == `with_index`:
+			return self.mapValues(pairs, c.block), true
+		}
+
+		for _, pair := range pairs {
+			c.block(pair.([]interface{}))
+		}
+
+		return c.receiver, true
+
+	case `select`, `filter`, `find_all`, `reject`:
+		selected := make([]interface{}, 0)
+
+		self.requireBlock(c)
+
+		for _, value := range values {
+			if self.test(c, value) == (c.name != `reject`) {
+				selected = append(selected, value)
+			}
+		}
+
+		return selected, true
+
+	case `filter_map`:
+		mapped := make([]interface{}, 0)
+
+		for _, value := range self.mapValues(values, self.requireBlock(c)) {
+			if truthy(value) {
+				mapped = append(mapped, value)
+			}
+		}
+
+		return mapped, true
+
+	case `find`, `detect`:
+		self.requireBlock(c)
+
+		for _, value := range values {
+			if self.test(c, value) {
+				return value, true
+			}
+		}
+
+		return nil, true
+
+	case `find_index`, `index`:
+		self.arity(c, 0, 1)
+
+		for i, value := range values {
+			if (len(c.args) == 1 && rubyEqual(value, c.args[0])) || (len(c.args) == 0 && self.test(c, value)) {
+				return newInt(int64(i)), true
+			}
+		}
+
+		return nil, true
+
+	case `partition`:
+		selected, rejected := make([]interface{}, 0), make([]interface{}, 0)
+
+		self.requireBlock(c)
+
+		for _, value := range values {
+			if self.test(c, value) {
+				selected = append(selected, value)
+			} else {
+				rejected = append(rejected, value)
+			}
+		}
+
+		return []interface{}{selected, rejected}, true
+
+	case `group_by`, `tally`:
+		groups := newEvalHash()
+
+		if c.name == `group_by` {
+			self.requireBlock(c)
+		}
+
+		for _, value := range values {
+			if c.name == `tally` {
+				count, _ := groups.get(value)
+
+				if count == nil {
+					count = newInt(0)
+				}
+
+				groups.set(value, new(big.Int).Add(count.(*big.Int), newInt(1)))
+			} else {
+				key := c.block([]interface{}{value})
+				group, _ := groups.get(key)
+
+				if group == nil {
+					group = make([]interface{}, 0)
+				}
+
+				groups.set(key, append(group.([]interface{}), value))
+			}
+		}
+
+		return groups, true
+
+	case `chunk_while`, `slice_when`:
+		block := self.requireBlock(c)
+		chunks := make([]interface{}, 0)
+
+		for i, value := range values {
+			if i == 0 || truthy(block([]interface{}{values[i-1], value})) != (c.name == `chunk_while`) {
+				chunks = append(chunks, []interface{}{value})
+			} else {
+				last := chunks[len(chunks)-1].([]interface{})
+				chunks[len(chunks)-1] = append(last, value)
+			}
+		}
+
+		return chunks, true
+
+	case `each_slice`, `each_cons`:
+		self.arity(c, 1, 1)
+
+		size := self.intArg(c, 0)
+
+		if size <= 0 {
+			self.fail(c.node, "Invalid size %d for '%s'", size, c.name)
+		}
+
+		groups := make([]interface{}, 0)
+
+		if c.name == `each_slice` {
+			for i := 0; i < len(values); i += size {
+				end := i + size
+
+				if end > len(values) {
+					end = len(values)
+				}
+
+				groups = append(groups, append([]interface{}(nil), values[i:end]...))
+			}
+		} else {
+			for i := 0; i+size <= len(values); i++ {
+				self.step(c.node, size)
+				groups = append(groups, append([]interface{}(nil), values[i:i+size]...))
+			}
+		}
+
+		return self.each(c, c.receiver, groups), true
+
+	case `zip`:
+		others := make([][]interface{}, len(c.args))
+
+		for i, arg := range c.args {
+			others[i] = self.toArray(c.node, arg)
+		}
+
+		zipped := make([]interface{}, len(values))
+
+		for i, value := range values {
+			tuple := []interface{}{value}
+
+			for _, other := range others {
+				if i < len(other) {
+					tuple = append(tuple, other[i])
+				} else {
+					tuple = append(tuple, nil)
+				}
+			}
+
+			zipped[i] = tuple
+		}
+
+		if c.block != nil {
+			self.each(c, nil, zipped)
+			return nil, true
+		}
+
+		return zipped, true
+
+	case `first`, `take`:
+		if c.name == `first` && len(c.args) == 0 {
+			if len(values) == 0 {
+				return nil, true
+			}
+
+			return values[0], true
+		}
+
+		self.arity(c, 1, 1)
+
+		if n := self.countArg(c, 0); n < len(values) {
+			values = values[:n]
+		}
+
+		return append([]interface{}(nil), values...), true
+
+	case `drop`:
+		self.arity(c, 1, 1)
+
+		if n := self.countArg(c, 0); n < len(values) {
+			return append([]interface{}(nil), values[n:]...), true
+		}
+
+		return make([]interface{}, 0), true
+
+	case `take_while`, `drop_while`:
+		self.requireBlock(c)
+
+		i := 0
+
+		for i < len(values) && self.test(c, values[i]) {
+			i++
+		}
+
+		if c.name == `take_while` {
+			return append([]interface{}(nil), values[:i]...), true
+		}
+
+		return append([]interface{}(nil), values[i:]...), true
+
+	case `min`, `max`, `minmax`:
+		self.arity(c, 0, 1)
+
+		sorted := self.sortValues(c.node, values, self.comparator(c))
+
+		if c.name == `max` {
+			sorted = reversed(sorted)
+		}
+
+		if c.name == `minmax` {
+			if len(sorted) == 0 {
+				return []interface{}{nil, nil}, true
+			}
+
+			return []interface{}{sorted[0], sorted[len(sorted)-1]}, true
+		} else if len(c.args) == 1 {
+			if n := self.countArg(c, 0); n < len(sorted) {
+				sorted = sorted[:n]
+			}
+
+			return sorted, true
+		} else if len(sorted) == 0 {
+			return nil, true
+		}
+
+		return sorted[0], true
+
+	case `min_by`, `max_by`, `sort_by`:
+		sorted := self.sortBy(c, values, self.mapValues(values, self.requireBlock(c)))
+
+		switch {
+		case c.name == `sort_by`:
+			return sorted, true
+		case len(sorted) == 0:
+			return nil, true
+		case c.name == `max_by`:
+			return sorted[len(sorted)-1], true
+		}
+
+		return sorted[0], true
+
+	case `sort`:
+		return self.sortValues(c.node, values, self.comparator(c)), true
+
+	case `sum`:
+		self.arity(c, 0, 1)
+
+		var sum interface{} = newInt(0)
+
+		if len(c.args) == 1 {
+			sum = c.args[0]
+		}
+
+		if c.block != nil {
+			values = self.mapValues(values, c.block)
+		}
+
+		return self.sum(c, sum, values), true
+
+	case `inject`, `reduce`:
+		self.arity(c, 0, 2)
+
+		var memo interface{}
+		var block evalBlock
+
+		switch {
+		case len(c.args) == 2:
+			memo, block = c.args[0], self.blockOrSymbol(c, 1)
+		case len(c.args) == 1 && c.block != nil:
+			memo, block = c.args[0], c.block
+		default:
+			block = self.blockOrSymbol(c, 0)
+
+			if len(values) == 0 {
+				return nil, true
+			}
+
+			memo, values = values[0], values[1:]
+		}
+
+		for _, value := range values {
+			memo = block([]interface{}{memo, value})
+		}
+
+		return memo, true
+
+	case `count`:
+		self.arity(c, 0, 1)
+
+		count := 0
+
+		for _, value := range values {
+			if (len(c.args) == 1 && rubyEqual(value, c.args[0])) || (len(c.args) == 0 && (c.block == nil || self.test(c, value))) {
+				count++
+			}
+		}
+
+		return newInt(int64(count)), true
+
+	case `include?`, `member?`:
+		self.arity(c, 1, 1)
+
+		for _, value := range values {
+			if rubyEqual(value, c.args[0]) {
+				return true, true
+			}
+		}
+
+		return false, true
+
+	case `any?`, `all?`, `none?`, `one?`:
+		self.arity(c, 0, 1)
+
+		count := 0
+
+		for _, value := range values {
+			var matched bool
+
+			if len(c.args) == 1 {
+				matched = self.caseEqual(c, c.args[0], value)
+			} else {
+				matched = self.test(c, value)
+			}
+
+			if matched {
+				count++
+			}
+
+			switch {
+			case c.name == `any?` && matched:
+				return true, true
+			case c.name == `all?` && !matched:
+				return false, true
+			case c.name == `none?` && matched:
+				return false, true
+			}
+		}
+
+		switch c.name {
+		case `any?`:
+			return false, true
+		case `one?`:
+			return count == 1, true
+		}
+
+		return true, true
+
+	case `grep`, `grep_v`:
+		self.arity(c, 1, 1)
+
+		matches := make([]interface{}, 0)
+
+		for _, value := range values {
+			if self.caseEqual(c, c.args[0], value) == (c.name == `grep`) {
+				matches = append(matches, value)
+			}
+		}
+
+		if c.block != nil {
+			return self.mapValues(matches, c.block), true
+		}
+
+		return matches, true
+
+	case `uniq`:
+		return self.uniq(c.node, values, c.block), true
+
+	case `to_set`:
+		if c.block != nil {
+			values = self.mapValues(values, c.block)
+		}
+
+		return Set(self.uniq(c.node, values, nil)), true
+
+	case `to_h`:
+		hash := newEvalHash()
+
+		for _, value := range values {
+			if c.block != nil {
+				value = c.block([]interface{}{value})
+			}
+
+			pair, ok := value.([]interface{})
+
+			if !ok {
+				self.fail(c.node, "Wrong element type %s (expected array)", className(value))
+			} else if len(pair) != 2 {
+				self.fail(c.node, "Wrong array length (expected 2, was %d)", len(pair))
+			}
+
+			hash.set(pair[0], pair[1])
+		}
+
+		return hash, true
+
+	case `lazy`:
+		return values, true
+	}
+
+	return nil, false
+}
+
+// adds values to a sum, as Enumerable#sum does: floats are added with compensation for
+// the error of each addition, so that [0.1, 0.2, 0.3].sum is 0.6
+func (self *evalState) sum(c *evalCall, sum interface{}, values []interface{}) interface{} {
+	float := numericKind(sum) == floatKind
+	numeric := numericKind(sum) != notNumeric
+
+	for _, value := range values {
+		switch numericKind(value) {
+		case floatKind:
+			float = true
+		case notNumeric:
+			numeric = false
+		}
+	}
+
+	if !float || !numeric {
+		for _, value := range values {
+			sum = self.call(&evalCall{node: c.node, receiver: sum, hasReceiver: true, name: `+`, args: []interface{}{value}})
+		}
+
+		return sum
+	}
+
+	// Kahan-Babuska summation
+	total, compensation := toFloat(sum), 0.0
+
+	for _, value := range values {
+		x := toFloat(value)
+		t := total + x
+
+		if math.Abs(total) >= math.Abs(x) {
+			compensation += (total - t) + x
+		} else {
+			compensation += (x - t) + total
+		}
+
+		total = t
+	}
+
+	return total + compensation
+}
+
+func (self *evalState) arrayMethod(c *evalCall, receiver []interface{}) (interface{}, bool) {
+	switch c.name {
+	case `[]`, `slice`:
+		self.arity(c, 1, 2)
+
+		start, length, single, ok := self.sliceArgs(c, len(receiver))
+
+		if !ok {
+			return nil, true
+		} else if single {
+			return receiver[start], true
+		}
+
+		return append([]interface{}(nil), receiver[start:start+length]...), true
+
+	case `at`:
+		self.arity(c, 1, 1)
+
+		if i, ok := arrayIndex(self.intArg(c, 0), len(receiver)); ok {
+			return receiver[i], true
+		}
+
+		return nil, true
+
+	case `dig`:
+		self.arity(c, 1, -1)
+		return self.dig(c, receiver, c.args), true
+
+	case `fetch`:
+		self.arity(c, 1, 2)
+
+		if i, ok := arrayIndex(self.intArg(c, 0), len(receiver)); ok {
+			return receiver[i], true
+		} else if c.block != nil {
+			return c.block(c.args[:1]), true
+		} else if len(c.args) == 2 {
+			return c.args[1], true
+		}
+
+		self.fail(c.node, "Index %d outside of array bounds: %d...%d", self.intArg(c, 0), -len(receiver), len(receiver))
+
+	case `last`:
+		if len(c.args) == 0 {
+			if len(receiver) == 0 {
+				return nil, true
+			}
+
+			return receiver[len(receiver)-1], true
+		}
+
+		self.arity(c, 1, 1)
+
+		if n := self.countArg(c, 0); n < len(receiver) {
+			return append([]interface{}(nil), receiver[len(receiver)-n:]...), true
+		}
+
+		return append([]interface{}(nil), receiver...), true
+
+	case `values_at`:
+		values := make([]interface{}, len(c.args))
+
+		for i := range c.args {
+			if j, ok := arrayIndex(self.intArg(c, i), len(receiver)); ok {
+				values[i] = receiver[j]
+			}
+		}
+
+		return values, true
+
+	case `length`, `size`:
+		return newInt(int64(len(receiver))), true
+	case `empty?`:
+		return len(receiver) == 0, true
+	case `to_a`, `to_ary`:
+		return receiver, true
+
+	case `+`:
+		self.arity(c, 1, 1)
+
+		other := self.arrayArg(c, 0)
+		self.step(c.node, (len(receiver)+len(other))/64)
+
+		return append(append([]interface{}(nil), receiver...), other...), true
+
+	case `-`, `difference`:
+		excluded := newEvalHash()
+
+		for i := range c.args {
+			for _, value := range self.arrayArg(c, i) {
+				excluded.set(value, true)
+			}
+		}
+
+		self.step(c.node, len(receiver))
+		difference := make([]interface{}, 0, len(receiver))
+
+		for _, value := range receiver {
+			if excluded.find(value) < 0 {
+				difference = append(difference, value)
+			}
+		}
+
+		return difference, true
+
+	case `*`:
+		self.arity(c, 1, 1)
+
+		if _, ok := c.args[0].(string); ok {
+			return self.join(c, receiver, c.args[0].(string)), true
+		}
+
+		n := self.countArg(c, 0)
+		self.step(c.node, len(receiver)*n)
+		repeated := make([]interface{}, 0, len(receiver)*n)
+
+		for i := 0; i < n; i++ {
+			repeated = append(repeated, receiver...)
+		}
+
+		return repeated, true
+
+	case `&`, `intersection`, `intersect?`:
+		self.arity(c, 1, -1)
+
+		common := self.uniq(c.node, receiver, nil)
+
+		for i := range c.args {
+			other := newEvalHash()
+
+			for _, value := range self.arrayArg(c, i) {
+				other.set(value, true)
+			}
+
+			kept := make([]interface{}, 0, len(common))
+
+			for _, value := range common {
+				if other.find(value) >= 0 {
+					kept = append(kept, value)
+				}
+			}
+
+			common = kept
+		}
+
+		if c.name == `intersect?` {
+			return len(common) > 0, true
+		}
+
+		return common, true
+
+	case `|`, `union`:
+		union := append([]interface{}(nil), receiver...)
+
+		for i := range c.args {
+			union = append(union, self.arrayArg(c, i)...)
+		}
+
+		return self.uniq(c.node, union, nil), true
+
+	case `rindex`:
+		self.arity(c, 0, 1)
+
+		for i := len(receiver) - 1; i >= 0; i-- {
+			if (len(c.args) == 1 && rubyEqual(receiver[i], c.args[0])) || (len(c.args) == 0 && self.test(c, receiver[i])) {
+				return newInt(int64(i)), true
+			}
+		}
+
+		return nil, true
+
+	case `reverse`:
+		return reversed(receiver), true
+
+	case `rotate`:
+		self.arity(c, 0, 1)
+
+		if len(receiver) == 0 {
+			return make([]interface{}, 0), true
+		}
+
+		n := 1
+
+		if len(c.args) == 1 {
+			n = self.intArg(c, 0)
+		}
+
+		n = ((n % len(receiver)) + len(receiver)) % len(receiver)
+		return append(append([]interface{}(nil), receiver[n:]...), receiver[:n]...), true
+
+	case `compact`:
+		compacted := make([]interface{}, 0, len(receiver))
+
+		for _, value := range receiver {
+			if value != nil {
+				compacted = append(compacted, value)
+			}
+		}
+
+		return compacted, true
+
+	case `flatten`:
+		self.arity(c, 0, 1)
+
+		depth := -1
+
+		if len(c.args) == 1 && c.args[0] != nil {
+			depth = self.intArg(c, 0)
+		}
+
+		return self.flatten(c.node, receiver, depth), true
+
+	case `join`:
+		self.arity(c, 0, 1)
+
+		separator := ``
+
+		if len(c.args) == 1 && c.args[0] != nil {
+			separator = self.stringArg(c, 0)
+		}
+
+		return self.join(c, receiver, separator), true
+
+	case `transpose`:
+		if len(receiver) == 0 {
+			return make([]interface{}, 0), true
+		}
+
+		rows := make([][]interface{}, len(receiver))
+
+		for i, row := range receiver {
+			if rows[i], _ = row.([]interface{}); rows[i] == nil {
+				self.fail(c.node, "No implicit conversion of %s into Array", className(row))
+			} else if len(rows[i]) != len(rows[0]) {
+				self.fail(c.node, "Element size differs (%d should be %d)", len(rows[i]), len(rows[0]))
+			}
+		}
+
+		columns := make([]interface{}, len(rows[0]))
+
+		for j := range columns {
+			column := make([]interface{}, len(rows))
+
+			for i, row := range rows {
+				column[i] = row[j]
+			}
+
+			columns[j] = column
+		}
+
+		return columns, true
+
+	case `assoc`:
+		self.arity(c, 1, 1)
+
+		for _, value := range receiver {
+			if pair, ok := value.([]interface{}); ok && len(pair) > 0 && rubyEqual(pair[0], c.args[0]) {
+				return pair, true
+			}
+		}
+
+		return nil, true
+
+	case `product`:
+		products := []interface{}{[]interface{}{}}
+
+		for _, factor := range append([][]interface{}{receiver}, self.arrays(c)...) {
+			self.step(c.node, len(products)*len(factor))
+			next := make([]interface{}, 0, len(products)*len(factor))
+
+			for _, product := range products {
+				for _, value := range factor {
+					next = append(next, append(append([]interface{}(nil), product.([]interface{})...), value))
+				}
+			}
+
+			products = next
+		}
+
+		return products, true
+	}
+
+	return self.enumerableMethod(c, receiver)
+}
+
+// returns the arguments, all of which must be arrays
+func (self *evalState) arrays(c *evalCall) [][]interface{} {
+	arrays := make([][]interface{}, len(c.args))
+
+	for i := range c.args {
+		arrays[i] = self.arrayArg(c, i)
+	}
+
+	return arrays
+}
+
+// returns the position that an index (which counts from the end if negative) refers to,
+// reporting false if it is out of bounds
+func arrayIndex(i int, size int) (int, bool) {
+	if i < 0 {
+		i += size
+	}
+
+	return i, i >= 0 && i < size
+}
+
+// joins the elements of an array (and of the arrays within it) as strings
+func (self *evalState) join(c *evalCall, array []interface{}, separator string) string {
+	parts := make([]string, 0, len(array))
+	length := 0
+
+	for _, element := range self.flatten(c.node, array, -1) {
+		part := rubyString(element)
+		parts = append(parts, part)
+		length += len(part) + len(separator)
+	}
+
+	self.step(c.node, length/64)
+	return strings.Join(parts, separator)
+}
+
+// reports whether a value is, or holds, the given hash; hashes cannot be stored within
+// themselves as nothing that reads them could then finish
+func containsHash(value interface{}, hash *evalHash) bool {
+	switch v := value.(type) {
+	case *evalHash:
+		if v == hash {
+			return true
+		}
+
+		for i, key := range v.keys {
+			if containsHash(key, hash) || containsHash(v.values[i], hash) {
+				return true
+			}
+		}
+
+	case []interface{}:
+		for _, element := range v {
+			if containsHash(element, hash) {
+				return true
+			}
+		}
+
+	case Set:
+		return containsHash([]interface{}(v), hash)
+	case Range:
+		return containsHash(v.Begin, hash) || containsHash(v.End, hash)
+	}
+
+	return false
+}
+
+// stores a value in a hash, as []= does
+func (self *evalState) hashSet(c *evalCall, hash *evalHash, key interface{}, value interface{}) {
+	if containsHash(key, hash) || containsHash(value, hash) {
+		self.fail(c.node, `Cannot store a hash within itself`)
+	}
+
+	hash.set(key, value)
+}
+
+func (self *evalState) hashMethod(c *evalCall, receiver *evalHash) (interface{}, bool) {
+	switch c.name {
+	case `[]=`, `store`, `delete`, `update`, `merge!`:
+		if receiver.frozen {
+			self.fail(c.node, "Cannot call '%s' on a frozen Hash", c.name)
+		}
+	}
+
+	switch c.name {
+	case `[]`:
+		self.arity(c, 1, 1)
+
+		value, _ := receiver.get(c.args[0])
+		return value, true
+
+	case `[]=`, `store`:
+		self.arity(c, 2, 2)
+		self.hashSet(c, receiver, c.args[0], c.args[1])
+
+		return c.args[1], true
+
+	case `fetch`:
+		self.arity(c, 1, 2)
+
+		if value, ok := receiver.get(c.args[0]); ok {
+			return value, true
+		} else if c.block != nil {
+			return c.block(c.args[:1]), true
+		} else if len(c.args) == 2 {
+			return c.args[1], true
+		}
+
+		self.fail(c.node, "Key not found: %s", rubyInspect(c.args[0]))
+
+	case `dig`:
+		self.arity(c, 1, -1)
+		return self.dig(c, receiver, c.args), true
+
+	case `key?`, `has_key?`, `include?`, `member?`:
+		self.arity(c, 1, 1)
+		return receiver.find(c.args[0]) >= 0, true
+
+	case `value?`, `has_value?`, `key`:
+		self.arity(c, 1, 1)
+
+		for i, value := range receiver.values {
+			if rubyEqual(value, c.args[0]) {
+				if c.name == `key` {
+					return receiver.keys[i], true
+				}
+
+				return true, true
+			}
+		}
+
+		if c.name == `key` {
+			return nil, true
+		}
+
+		return false, true
+
+	case `keys`:
+		return append([]interface{}(nil), receiver.keys...), true
+	case `values`:
+		return append([]interface{}(nil), receiver.values...), true
+
+	case `values_at`, `fetch_values`:
+		values := make([]interface{}, len(c.args))
+
+		for i, key := range c.args {
+			value, ok := receiver.get(key)
+
+			if !ok && c.name == `fetch_values` {
+				self.fail(c.node, "Key not found: %s", rubyInspect(key))
+			}
+
+			values[i] = value
+		}
+
+		return values, true
+
+	case `length`, `size`:
+		return newInt(int64(receiver.len())), true
+	case `empty?`:
+		return receiver.len() == 0, true
+	case `default`:
+		return nil, true
+
+	case `to_h`:
+		if c.block == nil {
+			return receiver, true
+		}
+
+	case `delete`:
+		self.arity(c, 1, 1)
+
+		value, _ := receiver.delete(c.args[0])
+		return value, true
+
+	case `merge`, `update`, `merge!`:
+		merged := receiver
+
+		if c.name == `merge` {
+			merged = receiver.copy()
+		}
+
+		for _, arg := range c.args {
+			other, ok := arg.(*evalHash)
+
+			if !ok {
+				self.fail(c.node, "No implicit conversion of %s into Hash", className(arg))
+			}
+
+			for i, key := range other.keys {
+				value := other.values[i]
+
+				if current, ok := merged.get(key); ok && c.block != nil {
+					value = c.block([]interface{}{key, current, value})
+				}
+
+				self.hashSet(c, merged, key, value)
+			}
+		}
+
+		return merged, true
+
+	case `transform_keys`, `transform_values`:
+		transformed := newEvalHash()
+
+		var mapping *evalHash
+
+		if c.name == `transform_keys` && len(c.args) == 1 {
+			mapping, _ = c.args[0].(*evalHash)
+		}
+
+		if mapping == nil {
+			self.requireBlock(c)
+		}
+
+		for i, key := range receiver.keys {
+			value := receiver.values[i]
+
+			switch {
+			case c.name == `transform_values`:
+				value = c.block([]interface{}{value})
+			case mapping != nil && mapping.find(key) >= 0:
+				key, _ = mapping.get(key)
+			case c.block != nil:
+				key = c.block([]interface{}{key})
+			}
+
+			transformed.set(key, value)
+		}
+
+		return transformed, true
+
+	case `select`, `filter`, `reject`:
+		selected := newEvalHash()
+		block := self.requireBlock(c)
+
+		// unlike the methods of Enumerable, these yield the key and value separately
+		for i, key := range receiver.keys {
+			if truthy(block([]interface{}{key, receiver.values[i]})) == (c.name != `reject`) {
+				selected.set(key, receiver.values[i])
+			}
+		}
+
+		return selected, true
+
+	case `slice`, `except`:
+		selected := newEvalHash()
+
+		if c.name == `slice` {
+			for _, key := range c.args {
+				if value, ok := receiver.get(key); ok {
+					selected.set(key, value)
+				}
+			}
+
+			return selected, true
+		}
+
+		selected.merge(receiver)
+
+		for _, key := range c.args {
+			selected.delete(key)
+		}
+
+		return selected, true
+
+	case `invert`:
+		inverted := newEvalHash()
+
+		for i, key := range receiver.keys {
+			inverted.set(receiver.values[i], key)
+		}
+
+		return inverted, true
+
+	case `compact`:
+		compacted := newEvalHash()
+
+		for i, key := range receiver.keys {
+			if receiver.values[i] != nil {
+				compacted.set(key, receiver.values[i])
+			}
+		}
+
+		return compacted, true
+
+	case `each_pair`:
+		return self.each(c, receiver, receiver.pairs()), true
+	case `each_key`:
+		return self.each(c, receiver, receiver.keys), true
+	case `each_value`:
+		return self.each(c, receiver, receiver.values), true
+
+	case `count`:
+		if len(c.args) == 0 && c.block == nil {
+			return newInt(int64(receiver.len())), true
+		}
+
+	}
+
+	return self.enumerableMethod(c, receiver.pairs())
+}
+
+func (self *evalState) rangeMethod(c *evalCall, receiver Range) (interface{}, bool) {
+	begin, beginInt := receiver.Begin.(*big.Int)
+	end, endInt := receiver.End.(*big.Int)
+
+	// the last integer of an integer range
+	last := func() *big.Int {
+		if receiver.Exclusive {
+			return new(big.Int).Sub(end, newInt(1))
+		}
+
+		return end
+	}
+
+	switch c.name {
+	case `begin`:
+		return receiver.Begin, true
+	case `end`:
+		return receiver.End, true
+	case `exclude_end?`:
+		return receiver.Exclusive, true
+
+	case `first`:
+		if len(c.args) == 0 {
+			if receiver.Begin == nil {
+				self.fail(c.node, `Cannot get the first element of beginless range`)
+			}
+
+			return receiver.Begin, true
+		}
+
+		self.arity(c, 1, 1)
+
+		n := self.countArg(c, 0)
+
+		if !beginInt {
+			break
+		}
+
+		// endless ranges (and those to infinity) have as many elements as are asked for
+		values := make([]interface{}, 0)
+
+		for value := begin; len(values) < n; value = new(big.Int).Add(value, newInt(1)) {
+			if receiver.End != nil {
+				if cmp, ok := compareValues(value, receiver.End); !ok || cmp > 0 || (cmp == 0 && receiver.Exclusive) {
+					break
+				}
+			}
+
+			self.step(c.node, 1)
+			values = append(values, value)
+		}
+
+		return values, true
+
+	case `last`:
+		if len(c.args) == 0 {
+			if receiver.End == nil {
+				self.fail(c.node, `Cannot get the last element of endless range`)
+			}
+
+			return receiver.End, true
+		}
+
+		self.arity(c, 1, 1)
+
+		values := self.rangeElements(c.node, receiver)
+
+		if n := self.countArg(c, 0); n < len(values) {
+			return values[len(values)-n:], true
+		}
+
+		return values, true
+
+	case `min`, `max`, `minmax`:
+		if len(c.args) > 0 || c.block != nil || !beginInt || !endInt {
+			break
+		} else if begin.Cmp(last()) > 0 {
+			if c.name == `minmax` {
+				return []interface{}{nil, nil}, true
+			}
+
+			return nil, true
+		}
+
+		switch c.name {
+		case `min`:
+			return begin, true
+		case `max`:
+			return last(), true
+		}
+
+		return []interface{}{begin, last()}, true
+
+	case `size`, `count`:
+		if c.name == `count` && (len(c.args) > 0 || c.block != nil) {
+			break
+		}
+
+		switch {
+		case beginInt && endInt:
+			count := new(big.Int).Add(new(big.Int).Sub(last(), begin), newInt(1))
+
+			if count.Sign() < 0 {
+				return newInt(0), true
+			}
+
+			return count, true
+
+		case numericKind(receiver.Begin) != notNumeric && receiver.End == nil:
+			return math.Inf(1), true
+
+		case c.name == `size`:
+			if numericKind(receiver.Begin) == notNumeric {
+				self.fail(c.node, "Cannot get the size of a range of %s", className(receiver.Begin))
+			}
+		}
+
+	case `include?`, `member?`, `===`, `cover?`:
+		self.arity(c, 1, 1)
+		return rangeIncludes(receiver, c.args[0]), true
+
+	case `sum`:
+		if len(c.args) > 0 || c.block != nil || !beginInt || !endInt {
+			break
+		}
+
+		// the sum of an arithmetic series
+		if begin.Cmp(last()) > 0 {
+			return newInt(0), true
+		}
+
+		count := new(big.Int).Add(new(big.Int).Sub(last(), begin), newInt(1))
+		sum := new(big.Int).Mul(count, new(big.Int).Add(begin, last()))
+
+		return sum.Quo(sum, newInt(2)), true
+
+	case `step`, `%`:
+		self.arity(c, 1, 1)
+		return self.each(c, receiver, self.rangeStep(c, receiver)), true
+
+	case `to_a`, `to_ary`, `entries`:
+		return self.rangeElements(c.node, receiver), true
+	}
+
+	// only listing the elements of a range if the method is not one every object has, as
+	// that may not be possible
+	if value, ok := self.objectMethod(c); ok {
+		return value, true
+	}
+
+	return self.enumerableMethod(c, self.rangeElements(c.node, receiver))
+}
+
+// returns the numbers of a range at intervals of the step given
+func (self *evalState) rangeStep(c *evalCall, rng Range) []interface{} {
+	step := c.args[0]
+
+	if numericKind(rng.Begin) == notNumeric || numericKind(step) == notNumeric {
+		self.fail(c.node, "Cannot step through a range of %s by %s", className(rng.Begin), className(step))
+	} else if cmp, _ := compareValues(step, newInt(0)); cmp < 0 {
+		self.fail(c.node, `Step can't be negative`)
+	} else if cmp == 0 {
+		self.fail(c.node, `Step can't be 0`)
+	} else if rng.End == nil {
+		self.fail(c.node, `Cannot list the elements of an endless range`)
+	}
+
+	values := make([]interface{}, 0)
+
+	// each value is computed from the first, so that floats do not accumulate errors
+	for i := int64(0); ; i++ {
+		value := self.arithmetic(c, `+`, rng.Begin, self.arithmetic(c, `*`, newInt(i), step))
+
+		if cmp, ok := compareValues(value, rng.End); !ok || cmp > 0 || (cmp == 0 && rng.Exclusive) {
+			return values
+		}
+
+		self.step(c.node, 1)
+		values = append(values, value)
+	}
+}
+
+func (self *evalState) setMethod(c *evalCall, receiver Set) (interface{}, bool) {
+	// the elements of the arguments, which may be any collection
+	others := func() [][]interface{} {
+		others := make([][]interface{}, len(c.args))
+
+		for i, arg := range c.args {
+			others[i] = self.toArray(c.node, arg)
+		}
+
+		return others
+	}
+
+	switch c.name {
+	case `include?`, `member?`, `===`, `contain?`:
+		self.arity(c, 1, 1)
+		return setIncludes(receiver, c.args[0]), true
+
+	case `size`, `length`:
+		return newInt(int64(len(receiver))), true
+	case `empty?`:
+		return len(receiver) == 0, true
+	case `to_a`:
+		return append([]interface{}(nil), receiver...), true
+	case `to_set`:
+		return receiver, true
+
+	case `|`, `union`, `+`:
+		union := append([]interface{}(nil), receiver...)
+
+		for _, other := range others() {
+			union = append(union, other...)
+		}
+
+		return Set(self.uniq(c.node, union, nil)), true
+
+	case `&`, `intersection`, `-`, `difference`:
+		self.arity(c, 1, 1)
+
+		other := Set(others()[0])
+		kept := make(Set, 0, len(receiver))
+
+		for _, element := range receiver {
+			if setIncludes(other, element) == (c.name == `&` || c.name == `intersection`) {
+				kept = append(kept, element)
+			}
+		}
+
+		return kept, true
+
+	case `^`:
+		self.arity(c, 1, 1)
+
+		// as in Ruby, the elements only the argument has come first
+		other := Set(self.uniq(c.node, others()[0], nil))
+		result := make(Set, 0)
+
+		for _, element := range other {
+			if !setIncludes(receiver, element) {
+				result = append(result, element)
+			}
+		}
+
+		for _, element := range receiver {
+			if !setIncludes(other, element) {
+				result = append(result, element)
+			}
+		}
+
+		return result, true
+
+	case `subset?`, `<=`, `superset?`, `>=`, `proper_subset?`, `<`, `proper_superset?`, `>`, `disjoint?`, `intersect?`:
+		self.arity(c, 1, 1)
+
+		other, ok := c.args[0].(Set)
+
+		if !ok {
+			self.fail(c.node, "Value must be a set for '%s'", c.name)
+		}
+
+		// the number of elements of each that the other includes
+		var inOther, inReceiver int
+
+		for _, element := range receiver {
+			if setIncludes(other, element) {
+				inOther++
+			}
+		}
+
+		for _, element := range other {
+			if setIncludes(receiver, element) {
+				inReceiver++
+			}
+		}
+
+		switch c.name {
+		case `subset?`, `<=`:
+			return inOther == len(receiver), true
+		case `superset?`, `>=`:
+			return inReceiver == len(other), true
+		case `proper_subset?`, `<`:
+			return inOther == len(receiver) && len(other) > len(receiver), true
+		case `proper_superset?`, `>`:
+			return inReceiver == len(other) && len(receiver) > len(other), true
+		case `disjoint?`:
+			return inOther == 0, true
+		}
+
+		return inOther > 0, true
+
+	case `select`, `filter`, `reject`:
+		value, ok := self.enumerableMethod(c, receiver)
+		return Set(value.([]interface{})), ok
+	}
+
+	return self.enumerableMethod(c, receiver)
+}
@@ -0,0 +1,223 @@
+package ruby
+
+import (
+	"testing"
+)
+
+func TestEvalEnumerable(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`[1, 2, 3].map { |x| x * 2 }`, `[2, 4, 6]`},
+		{`[3, 1, 2].reverse_each.to_a`, `[2, 1, 3]`},
+		{`[[1, 2], [3]].flat_map { |x| x + [0] }`, `[1, 2, 0, 3, 0]`},
+		{`%w[a b].each_with_index.map { |s, i| s * (i + 1) }`, `["a", "bb"]`},
+		{`%w[a b].map.with_index(1) { |s, i| "#{i}:#{s}" }`, `["1:a", "2:b"]`},
+		{`%w[a bb].each_with_object({}) { |s, sizes| sizes[s] = s.size }`, `{"a" => 1, "bb" => 2}`},
+		{`(1..6).select(&:even?)`, `[2, 4, 6]`},
+		{`(1..6).reject(&:even?)`, `[1, 3, 5]`},
+		{`[1, 2, 3, 4].filter_map { |x| x * 2 if x.odd? }`, `[2, 6]`},
+		{`[1, 2, 3, 4].find { |x| x > 2 }`, `3`},
+		{`[1, 2, 3].detect { |x| x > 5 }`, `nil`},
+		{`[5, 6, 7].find_index(6)`, `1`},
+		{`[5, 6, 7].index { |x| x > 5 }`, `1`},
+		{`[1, 2, 3, 4].partition(&:even?)`, `[[2, 4], [1, 3]]`},
+		{`%w[apple avocado banana].group_by { |s| s[0] }`, `{"a" => ["apple", "avocado"], "b" => ["banana"]}`},
+		{`%w[a b a c a].tally`, `{"a" => 3, "b" => 1, "c" => 1}`},
+		{`[1, 2, 4, 5, 7].chunk_while { |a, b| b == a + 1 }`, `[[1, 2], [4, 5], [7]]`},
+		{`[1, 2, 4, 5, 7].slice_when { |a, b| b != a + 1 }.to_a`, `[[1, 2], [4, 5], [7]]`},
+		{`(1..5).each_slice(2).to_a`, `[[1, 2], [3, 4], [5]]`},
+		{`(1..4).each_cons(2).to_a`, `[[1, 2], [2, 3], [3, 4]]`},
+		{`[1, 2, 3].zip([4, 5], %w[a b c])`, `[[1, 4, "a"], [2, 5, "b"], [3, nil, "c"]]`},
+		{`[1, 2, 3].first(2)`, `[1, 2]`},
+		{`[].first`, `nil`},
+		{`[1, 2, 3].take(5)`, `[1, 2, 3]`},
+		{`[1, 2, 3].drop(1)`, `[2, 3]`},
+		{`[1, 2, 3, 1].take_while { |x| x < 3 }`, `[1, 2]`},
+		{`[1, 2, 3, 1].drop_while { |x| x < 3 }`, `[3, 1]`},
+		{`[3, 1, 2].min`, `1`},
+		{`[3, 1, 2].max(2)`, `[3, 2]`},
+		{`[3, 1, 2].minmax`, `[1, 3]`},
+		{`%w[ccc a bb].min_by(&:size)`, `"a"`},
+		{`%w[ccc a bb].max_by(&:size)`, `"ccc"`},
+		{`%w[ccc a bb].sort_by(&:size)`, `["a", "bb", "ccc"]`},
+		{`[3, 1, 2].sort`, `[1, 2, 3]`},
+		{`[3, 1, 2].sort { |a, b| b <=> a }`, `[3, 2, 1]`},
+		{`[1, 2, 3].sum`, `6`},
+		{`[1, 2, 3].sum(0.0)`, `6.0`},
+		{`[0.1, 0.2, 0.3].sum`, `0.6`},
+		{`%w[a b].sum('')`, `"ab"`},
+		{`[1, 2, 3].sum { |x| x * 10 }`, `60`},
+		{`(1..4).inject(:*)`, `24`},
+		{`(1..4).reduce(10) { |sum, x| sum + x }`, `20`},
+		{`(1..4).inject(2, :*)`, `48`},
+		{`[].inject(:+)`, `nil`},
+		{`[1, 2, 2, 3].count(2)`, `2`},
+		{`[1, 2, 3].count(&:odd?)`, `2`},
+		{`[1, 2, 3].include?(2)`, `true`},
+		{`[1, nil].all?`, `false`},
+		{`[1, 'a'].any?(String)`, `true`},
+		{`[].any?`, `false`},
+		{`[1, 2].none? { |x| x > 2 }`, `true`},
+		{`[1, 2, 3].one?(2..2)`, `true`},
+		{`%w[apple banana cherry].grep(/an/)`, `["banana"]`},
+		{`%w[apple banana cherry].grep_v(/an/) { |s| s.upcase }`, `["APPLE", "CHERRY"]`},
+		{`[1, 2, 1, 3].uniq`, `[1, 2, 3]`},
+		{`%w[a B b A].uniq(&:downcase)`, `["a", "B"]`},
+		{`[1, 2, 1].to_set`, `#<Set: {1, 2}>`},
+		{`[[:a, 1], [:b, 2]].to_h`, `{a: 1, b: 2}`},
+		{`%w[a bb].to_h { |s| [s, s.size] }`, `{"a" => 1, "bb" => 2}`},
+		{`(1..3).lazy.map { |x| x * 2 }.first(2)`, `[2, 4]`},
+	})
+}
+
+func TestEvalArray(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`[1, 2, 3][1]`, `2`},
+		{`[1, 2, 3][-1]`, `3`},
+		{`[1, 2, 3][5]`, `nil`},
+		{`[1, 2, 3][1..]`, `[2, 3]`},
+		{`[1, 2, 3][-2, 2]`, `[2, 3]`},
+		{`[1, 2, 3][3, 1]`, `[]`},
+		{`[1, 2, 3][4, 1]`, `nil`},
+		{`[1, 2, 3].slice(0...2)`, `[1, 2]`},
+		{`[1, 2, 3].at(-2)`, `2`},
+		{`[[1, [2]]].dig(0, 1, 0)`, `2`},
+		{`[1, 2].fetch(5, :none)`, `:none`},
+		{`[1, 2].fetch(5) { |i| i * 2 }`, `10`},
+		{`[1, 2, 3].last(2)`, `[2, 3]`},
+		{`%w[a b c].values_at(0, 2, 5)`, `["a", "c", nil]`},
+		{`[1, 2].length`, `2`},
+		{`[].empty?`, `true`},
+		{`[1, 2] + [3]`, `[1, 2, 3]`},
+		{`[1, 2, 2, 3] - [2]`, `[1, 3]`},
+		{`[1, 2] * 2`, `[1, 2, 1, 2]`},
+		{`[1, 2] * ', '`, `"1, 2"`},
+		{`[1, 1, 2, 3] & [3, 1]`, `[1, 3]`},
+		{`[1, 2].intersect?([2, 3])`, `true`},
+		{`[1, 2] | [2, 3]`, `[1, 2, 3]`},
+		{`[1, 2, 1].rindex(1)`, `2`},
+		{`[1, 2, 3].reverse`, `[3, 2, 1]`},
+		{`[1, 2, 3].rotate`, `[2, 3, 1]`},
+		{`[1, 2, 3].rotate(-1)`, `[3, 1, 2]`},
+		{`[1, nil, 2, nil].compact`, `[1, 2]`},
+		{`[1, [2, [3, [4]]]].flatten`, `[1, 2, 3, 4]`},
+		{`[1, [2, [3, [4]]]].flatten(1)`, `[1, 2, [3, [4]]]`},
+		{`[1, [2, nil]].join('-')`, `"1-2-"`},
+		{`[[1, 2], [3, 4]].transpose`, `[[1, 3], [2, 4]]`},
+		{`[[:a, 1], [:b, 2]].assoc(:b)`, `[:b, 2]`},
+		{`[1, 2].product([3, 4])`, `[[1, 3], [1, 4], [2, 3], [2, 4]]`},
+		{`[1, 2].each { |x| x }`, `[1, 2]`},
+	})
+}
+
+func TestEvalHash(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`{a: 1}[:a]`, `1`},
+		{`{a: 1}[:b]`, `nil`},
+		{`h = {}; h[:a] = 1; h.store('b', 2); h`, `{a: 1, "b" => 2}`},
+		{`{a: 1}.fetch(:b, 0)`, `0`},
+		{`{a: 1}.fetch(:b) { |k| k.to_s }`, `"b"`},
+		{`{a: {b: [10, 20]}}.dig(:a, :b, 1)`, `20`},
+		{`{a: 1}.key?(:a)`, `true`},
+		{`{a: 1}.value?(1)`, `true`},
+		{`{a: 1, b: 2}.key(2)`, `:b`},
+		{`{a: 1, b: 2}.keys`, `[:a, :b]`},
+		{`{a: 1, b: 2}.values`, `[1, 2]`},
+		{`{a: 1, b: 2}.values_at(:b, :c)`, `[2, nil]`},
+		{`{a: 1, b: 2}.fetch_values(:b, :a)`, `[2, 1]`},
+		{`{a: 1}.size`, `1`},
+		{`{}.empty?`, `true`},
+		{`h = {a: 1, b: 2}; [h.delete(:a), h]`, `[1, {b: 2}]`},
+		{`{a: 1, b: 2}.merge({b: 3, c: 4})`, `{a: 1, b: 3, c: 4}`},
+		{`{a: 1}.merge({a: 2}) { |key, old, new| old + new }`, `{a: 3}`},
+		{`h = {a: 1}; h.update(b: 2); h`, `{a: 1, b: 2}`},
+		{`{a: 1, b: 2}.transform_values { |v| v * 10 }`, `{a: 10, b: 20}`},
+		{`{a: 1, b: 2}.transform_keys(&:to_s)`, `{"a" => 1, "b" => 2}`},
+		{`{a: 1, b: 2}.transform_keys(a: :x)`, `{x: 1, b: 2}`},
+		{`{a: 1, b: 2}.select { |k, v| v > 1 }`, `{b: 2}`},
+		{`{a: 1, b: 2}.reject { |k, v| v > 1 }`, `{a: 1}`},
+		{`{a: 1, b: 2, c: 3}.slice(:a, :c, :d)`, `{a: 1, c: 3}`},
+		{`{a: 1, b: 2}.except(:a)`, `{b: 2}`},
+		{`{a: 1, b: 2}.invert`, `{1 => :a, 2 => :b}`},
+		{`{a: 1, b: nil}.compact`, `{a: 1}`},
+		{`{a: 1, b: 2}.map { |k, v| "#{k}=#{v}" }.join('&')`, `"a=1&b=2"`},
+		{`{a: 1, b: 2}.to_a`, `[[:a, 1], [:b, 2]]`},
+		{`{a: 2, b: 1}.min_by { |k, v| v }`, `[:b, 1]`},
+		{`{a: 2, b: 1}.sort_by { |k, v| v }.to_h`, `{b: 1, a: 2}`},
+		{`{a: 2, b: 1}.sum { |k, v| v }`, `3`},
+		{`{a: 2, b: 1}.count { |k, v| v > 1 }`, `1`},
+		{`{a: 2, b: 1}.find { |k, v| v == 1 }`, `[:b, 1]`},
+		{`{a: 2, b: 1}.to_h { |k, v| [v, k] }`, `{2 => :a, 1 => :b}`},
+		{`{a: 2, b: 1}.filter_map { |k, v| k if v > 1 }`, `[:a]`},
+		{`{a: 2, b: 1}.any? { |k, v| v > 1 }`, `true`},
+		{`{a: 1}.each_pair.to_a`, `[[:a, 1]]`},
+		{`{a: 1}.each_key.to_a`, `[:a]`},
+		{`{a: 1, b: 2}.each_value.map { |v| v * 2 }`, `[2, 4]`},
+		{`{a: 1}.default`, `nil`},
+		{`{'a' => 1, 2 => [3], nil => true}`, `{"a" => 1, 2 => [3], nil => true}`},
+		{`{"a b": 1}`, `{"a b": 1}`},
+	})
+}
+
+func TestEvalRange(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`(1..3).begin`, `1`},
+		{`(1...3).end`, `3`},
+		{`(1...3).exclude_end?`, `true`},
+		{`(1..10).first`, `1`},
+		{`(1..).first(3)`, `[1, 2, 3]`},
+		{`('a'..'e').first(2)`, `["a", "b"]`},
+		{`(1..10).last`, `10`},
+		{`(1...10).last(2)`, `[8, 9]`},
+		{`(1...10).max`, `9`},
+		{`(1..10).minmax`, `[1, 10]`},
+		{`(5..1).min`, `nil`},
+		{`(1...10).size`, `9`},
+		{`(5..1).size`, `0`},
+		{`(1..).size`, `Infinity`},
+		{`(1..10).count(&:even?)`, `5`},
+		{`(1..10).include?(5.5)`, `true`},
+		{`(1...10).cover?(10)`, `false`},
+		{`(1..5) === 3`, `true`},
+		{`(..5).include?(-100)`, `true`},
+		{`(1..100).sum`, `5050`},
+		{`(1..10).step(3).to_a`, `[1, 4, 7, 10]`},
+		{`(1.0..2.0).step(0.5).to_a`, `[1.0, 1.5, 2.0]`},
+		{`((1..10) % 4).to_a`, `[1, 5, 9]`},
+		{`('a'..'e').to_a`, `["a", "b", "c", "d", "e"]`},
+		{`('y'..'ab').to_a`, `[]`},
+		{`('az'..'bc').to_a`, `["az", "ba", "bb", "bc"]`},
+		{`('a'...'c').to_a`, `["a", "b"]`},
+		{`('9'..'11').to_a`, `["9", "10", "11"]`},
+		{`('08'...'11').to_a`, `["08", "09", "10"]`},
+		{`(1..3).map { |x| x * x }`, `[1, 4, 9]`},
+		{`(1..3).to_s`, `"1..3"`},
+		{`(1...3)`, `1...3`},
+		{`(1..nil)`, `1..`},
+	})
+}
+
+func TestEvalSet(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`Set[1, 2].include?(2)`, `true`},
+		{`Set[1, 2, 2].size`, `2`},
+		{`Set.new([3, 3, 4])`, `#<Set: {3, 4}>`},
+		{`Set[].empty?`, `true`},
+		{`Set[2, 1].to_a`, `[2, 1]`},
+		{`Set[1, 2] | Set[2, 3]`, `#<Set: {1, 2, 3}>`},
+		{`Set[1, 2] + [3]`, `#<Set: {1, 2, 3}>`},
+		{`Set[1, 2] & Set[2, 3]`, `#<Set: {2}>`},
+		{`Set[1, 2] - Set[2, 3]`, `#<Set: {1}>`},
+		{`Set[1, 2] ^ Set[2, 3]`, `#<Set: {3, 1}>`},
+		{`Set[1] <= Set[1, 2]`, `true`},
+		{`Set[1, 2].superset?(Set[1, 2])`, `true`},
+		{`Set[1, 2] > Set[1, 2]`, `false`},
+		{`Set[1].proper_subset?(Set[1, 2])`, `true`},
+		{`Set[1].disjoint?(Set[2])`, `true`},
+		{`Set[1, 2].intersect?(Set[2])`, `true`},
+		{`Set[1, 2, 3].select(&:odd?)`, `#<Set: {1, 3}>`},
+		{`Set[1, 2, 3].reject(&:odd?)`, `#<Set: {2}>`},
+		{`Set[1, 2].map { |x| x * 2 }`, `[2, 4]`},
+		{`Set[1, 2] == Set[2, 1]`, `true`},
+		{`Set[1, 2] === 1`, `true`},
+	})
+}
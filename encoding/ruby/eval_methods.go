@@ -0,0 +1,1610 @@
+package ruby
+
+import (
+	"github.com/ghetzel/rubyutils/encoding/ruby/ast"
+	"math"
+	"math/big"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// a method call being evaluated
+type evalCall struct {
+	node        ast.Node
+	receiver    interface{}
+	hasReceiver bool
+	name        string
+	args        []interface{}
+	block       evalBlock
+}
+
+// the libraries that may be required, none of which add anything not already supported
+var evalLibraries = map[string]bool{
+	`bigdecimal`: true,
+	`date`:       true,
+	`pathname`:   true,
+	`set`:        true,
+	`time`:       true,
+}
+
+// calls a method; each kind of value has its own methods, falling back on those every
+// object has
+func (self *evalState) call(c *evalCall) interface{} {
+	if !c.hasReceiver {
+		return self.allocated(c.node, self.kernelMethod(c))
+	}
+
+	if alternative, ok := evalMutators[className(c.receiver)+`#`+c.name]; ok {
+		self.fail(c.node, "Cannot call '%s', which changes the %s in place; use '%s' instead", c.name, className(c.receiver), alternative)
+	}
+
+	var value interface{}
+	var ok bool
+
+	switch receiver := c.receiver.(type) {
+	case *big.Int, float64, *big.Rat:
+		value, ok = self.numericMethod(c)
+	case string:
+		value, ok = self.stringMethod(c, receiver)
+	case Symbol:
+		value, ok = self.symbolMethod(c, receiver)
+	case []interface{}:
+		value, ok = self.arrayMethod(c, receiver)
+	case *evalHash:
+		value, ok = self.hashMethod(c, receiver)
+	case Range:
+		value, ok = self.rangeMethod(c, receiver)
+	case Set:
+		value, ok = self.setMethod(c, receiver)
+	case Regexp:
+		value, ok = self.regexpMethod(c, receiver)
+	case time.Time:
+		value, ok = self.timeMethod(c, receiver)
+	case evalPathname:
+		value, ok = self.pathnameMethod(c, receiver)
+	case evalModule:
+		value, ok = self.moduleMethod(c, receiver)
+	case nil:
+		value, ok = self.nilMethod(c)
+	case bool:
+		value, ok = self.boolMethod(c, receiver)
+	}
+
+	if !ok {
+		value, ok = self.objectMethod(c)
+	}
+
+	if module, isModule := c.receiver.(evalModule); !ok && isModule {
+		self.fail(c.node, "Undefined or unsupported method '%s' for %s %s", c.name, strings.ToLower(className(module)), module)
+	} else if !ok {
+		self.fail(c.node, "Undefined or unsupported method '%s' for %s", c.name, className(c.receiver))
+	}
+
+	return self.allocated(c.node, value)
+}
+
+// charges for the value a method returned in proportion to its size, as it may be newly
+// allocated, so that no number of calls can build values too large for the budget
+func (self *evalState) allocated(node ast.Node, value interface{}) interface{} {
+	self.step(node, evalSize(value))
+	return value
+}
+
+// checks the number of arguments given; a max of -1 allows any number
+func (self *evalState) arity(c *evalCall, min int, max int) {
+	if n := len(c.args); n < min || (max >= 0 && n > max) {
+		expected := strconv.Itoa(min)
+
+		switch {
+		case max < 0:
+			expected += `+`
+		case max > min:
+			expected += `..` + strconv.Itoa(max)
+		}
+
+		self.fail(c.node, "Wrong number of arguments for '%s' (given %d, expected %s)", c.name, n, expected)
+	}
+}
+
+// returns an argument that must be a small integer
+func (self *evalState) intArg(c *evalCall, i int) int {
+	n, ok := smallInt(c.args[i])
+
+	if !ok {
+		if numericKind(c.args[i]) == integerKind {
+			self.fail(c.node, "Integer argument to '%s' is too large", c.name)
+		}
+
+		self.fail(c.node, "No implicit conversion of %s into Integer for '%s'", className(c.args[i]), c.name)
+	}
+
+	return n
+}
+
+// returns an argument that must be a string (or, where Ruby converts them, a symbol)
+func (self *evalState) stringArg(c *evalCall, i int) string {
+	switch v := c.args[i].(type) {
+	case string:
+		return v
+	case Symbol:
+		return string(v)
+	case evalPathname:
+		return string(v)
+	}
+
+	self.fail(c.node, "No implicit conversion of %s into String for '%s'", className(c.args[i]), c.name)
+	return ``
+}
+
+// returns an argument that must be an array
+func (self *evalState) arrayArg(c *evalCall, i int) []interface{} {
+	if array, ok := c.args[i].([]interface{}); ok {
+		return array
+	}
+
+	self.fail(c.node, "No implicit conversion of %s into Array for '%s'", className(c.args[i]), c.name)
+	return nil
+}
+
+// returns the block given to a method that requires one
+func (self *evalState) requireBlock(c *evalCall) evalBlock {
+	if c.block == nil {
+		self.fail(c.node, "No block given to '%s'", c.name)
+	}
+
+	return c.block
+}
+
+// returns the block given, or one that calls the method named by a symbol argument, as
+// inject(:+) does
+func (self *evalState) blockOrSymbol(c *evalCall, i int) evalBlock {
+	if c.block != nil {
+		return c.block
+	}
+
+	if len(c.args) > i {
+		if name, ok := c.args[i].(Symbol); ok {
+			return func(args []interface{}) interface{} {
+				return self.call(&evalCall{node: c.node, receiver: args[0], hasReceiver: true, name: string(name), args: args[1:]})
+			}
+		}
+	}
+
+	return self.requireBlock(c)
+}
+
+// the methods every object has
+func (self *evalState) objectMethod(c *evalCall) (interface{}, bool) {
+	switch c.name {
+	case `==`, `equal?`:
+		self.arity(c, 1, 1)
+		return rubyEqual(c.receiver, c.args[0]), true
+	case `!=`:
+		self.arity(c, 1, 1)
+		return !rubyEqual(c.receiver, c.args[0]), true
+	case `eql?`:
+		self.arity(c, 1, 1)
+		return rubyEql(c.receiver, c.args[0]), true
+	case `===`:
+		self.arity(c, 1, 1)
+		return rubyEqual(c.receiver, c.args[0]), true
+	case `!`:
+		return !truthy(c.receiver), true
+	case `=~`:
+		return nil, true
+
+	case `<=>`:
+		self.arity(c, 1, 1)
+
+		if cmp, ok := compareValues(c.receiver, c.args[0]); ok {
+			return newInt(int64(cmp)), true
+		} else if rubyEqual(c.receiver, c.args[0]) {
+			return newInt(0), true
+		}
+
+		return nil, true
+
+	case `<`, `>`, `<=`, `>=`:
+		self.arity(c, 1, 1)
+
+		cmp, ok := compareValues(c.receiver, c.args[0])
+
+		if !ok {
+			self.fail(c.node, "Comparison of %s with %s failed", className(c.receiver), rubyInspect(c.args[0]))
+		}
+
+		switch c.name {
+		case `<`:
+			return cmp < 0, true
+		case `>`:
+			return cmp > 0, true
+		case `<=`:
+			return cmp <= 0, true
+		}
+
+		return cmp >= 0, true
+
+	case `between?`, `clamp`:
+		self.arity(c, 1, 2)
+
+		low, high := c.args[0], interface{}(nil)
+
+		if len(c.args) == 2 {
+			high = c.args[1]
+		} else if rng, ok := c.args[0].(Range); ok && c.name == `clamp` && !rng.Exclusive {
+			low, high = rng.Begin, rng.End
+		} else {
+			self.arity(c, 2, 2)
+		}
+
+		below, ok := compareValues(c.receiver, low)
+		above, ok2 := compareValues(c.receiver, high)
+
+		if (!ok && low != nil) || (!ok2 && high != nil) {
+			self.fail(c.node, "Comparison of %s with %s failed", className(c.receiver), className(low))
+		}
+
+		if c.name == `between?` {
+			return below >= 0 && above <= 0, true
+		} else if low != nil && below < 0 {
+			return low, true
+		} else if high != nil && above > 0 {
+			return high, true
+		}
+
+		return c.receiver, true
+
+	case `freeze`, `dup`, `clone`:
+		// hashes are the only values that can be changed in place
+		if hash, ok := c.receiver.(*evalHash); ok {
+			if c.name == `freeze` {
+				hash.frozen = true
+				return hash, true
+			}
+
+			copied := hash.copy()
+			copied.frozen = hash.frozen && c.name == `clone`
+
+			return copied, true
+		}
+
+		return c.receiver, true
+
+	case `itself`, `-@`, `+@`:
+		if c.name == `-@` || c.name == `+@` {
+			if _, ok := c.receiver.(string); !ok {
+				return nil, false
+			}
+		}
+
+		return c.receiver, true
+
+	case `frozen?`:
+		if hash, ok := c.receiver.(*evalHash); ok {
+			return hash.frozen, true
+		}
+
+		return true, true
+	case `nil?`:
+		return c.receiver == nil, true
+	case `to_s`:
+		return rubyString(c.receiver), true
+	case `inspect`:
+		return rubyInspect(c.receiver), true
+	case `class`:
+		return evalModule(className(c.receiver)), true
+
+	case `is_a?`, `kind_of?`, `instance_of?`:
+		self.arity(c, 1, 1)
+
+		module, ok := c.args[0].(evalModule)
+
+		if !ok {
+			self.fail(c.node, "Class or module required for '%s'", c.name)
+		} else if c.name == `instance_of?` {
+			return className(c.receiver) == string(module), true
+		}
+
+		return isA(c.receiver, module), true
+
+	case `then`, `yield_self`:
+		return self.requireBlock(c)([]interface{}{c.receiver}), true
+
+	case `tap`:
+		self.requireBlock(c)([]interface{}{c.receiver})
+		return c.receiver, true
+
+	case `send`, `public_send`:
+		self.arity(c, 1, -1)
+
+		return self.call(&evalCall{
+			node:        c.node,
+			receiver:    c.receiver,
+			hasReceiver: true,
+			name:        self.stringArg(c, 0),
+			args:        c.args[1:],
+			block:       c.block,
+		}), true
+	}
+
+	return nil, false
+}
+
+func (self *evalState) nilMethod(c *evalCall) (interface{}, bool) {
+	switch c.name {
+	case `to_a`:
+		return make([]interface{}, 0), true
+	case `to_h`:
+		return newEvalHash(), true
+	case `to_i`:
+		return newInt(0), true
+	case `to_f`:
+		return 0.0, true
+	case `to_r`:
+		return new(big.Rat), true
+	case `&`:
+		return false, true
+	case `|`:
+		self.arity(c, 1, 1)
+		return truthy(c.args[0]), true
+	}
+
+	return nil, false
+}
+
+func (self *evalState) boolMethod(c *evalCall, receiver bool) (interface{}, bool) {
+	switch c.name {
+	case `&`:
+		self.arity(c, 1, 1)
+		return receiver && truthy(c.args[0]), true
+	case `|`:
+		self.arity(c, 1, 1)
+		return receiver || truthy(c.args[0]), true
+	case `^`:
+		self.arity(c, 1, 1)
+		return receiver != truthy(c.args[0]), true
+	}
+
+	return nil, false
+}
+
+// the methods called without a receiver
+func (self *evalState) kernelMethod(c *evalCall) interface{} {
+	switch c.name {
+	case `Integer`:
+		self.arity(c, 1, 2)
+
+		base := 0
+
+		if len(c.args) == 2 {
+			base = self.intArg(c, 1)
+		}
+
+		switch v := c.args[0].(type) {
+		case string:
+			if n, ok := parseInteger(v, base); ok {
+				return n
+			}
+
+			self.fail(c.node, "Invalid value for Integer(): %s", inspectString(v))
+		case *big.Int, float64, *big.Rat:
+			return self.toInteger(c, v)
+		}
+
+		self.fail(c.node, "Cannot convert %s into Integer", className(c.args[0]))
+
+	case `Float`:
+		self.arity(c, 1, 1)
+
+		switch v := c.args[0].(type) {
+		case string:
+			// Go would also read such as "inf" and "0x1p4", which Ruby does not
+			if literal := strings.TrimSpace(v); rxLeadingFloat.FindString(literal) == literal && literal != `` {
+				f, _ := strconv.ParseFloat(strings.Replace(literal, `_`, ``, -1), 64)
+				return f
+			}
+
+			self.fail(c.node, "Invalid value for Float(): %s", inspectString(v))
+		case *big.Int, float64, *big.Rat:
+			return toFloat(v)
+		}
+
+		self.fail(c.node, "Cannot convert %s into Float", className(c.args[0]))
+
+	case `String`:
+		self.arity(c, 1, 1)
+		return rubyString(c.args[0])
+
+	case `Array`:
+		self.arity(c, 1, 1)
+
+		switch v := c.args[0].(type) {
+		case nil:
+			return make([]interface{}, 0)
+		case []interface{}, *evalHash, Range, Set:
+			return self.toArray(c.node, v)
+		}
+
+		return []interface{}{c.args[0]}
+
+	case `Rational`:
+		self.arity(c, 1, 2)
+
+		value := self.toRational(c, c.args[0])
+
+		if len(c.args) == 2 {
+			divisor := self.toRational(c, c.args[1])
+
+			if divisor.Sign() == 0 {
+				self.fail(c.node, `Divided by 0`)
+			}
+
+			value.Quo(value, divisor)
+		}
+
+		return value
+
+	case `Pathname`:
+		self.arity(c, 1, 1)
+		return evalPathname(self.stringArg(c, 0))
+
+	case `format`, `sprintf`:
+		self.arity(c, 1, -1)
+		return self.format(c, self.stringArg(c, 0), c.args[1:])
+
+	case `require`:
+		self.arity(c, 1, 1)
+
+		if library := self.stringArg(c, 0); evalLibraries[library] {
+			return true
+		}
+
+		self.fail(c.node, "Cannot require '%s', only standard libraries that evaluating supports may be", self.stringArg(c, 0))
+
+	case `__FILE__`, `__dir__`:
+		self.arity(c, 0, 0)
+
+		if self.filename == `` {
+			self.fail(c.node, "Cannot evaluate '%s' without a file name, which SetFilename gives", c.name)
+		} else if c.name == `__dir__` {
+			return dirname(self.filename)
+		}
+
+		return self.filename
+
+	case `raise`, `fail`:
+		if len(c.args) > 0 {
+			self.fail(c.node, "%s", rubyString(c.args[len(c.args)-1]))
+		}
+
+		self.fail(c.node, `Unhandled exception`)
+	}
+
+	if _, ok := c.node.(*ast.Ident); ok {
+		self.fail(c.node, "Undefined local variable or method '%s'", c.name)
+	}
+
+	self.fail(c.node, "Undefined or unsupported method '%s'", c.name)
+	return nil
+}
+
+// returns a value given to Rational() as one
+func (self *evalState) toRational(c *evalCall, value interface{}) *big.Rat {
+	switch v := value.(type) {
+	case *big.Int, *big.Rat:
+		return toRat(v)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			self.fail(c.node, "Cannot convert %s into Rational", floatString(v))
+		}
+
+		return toRat(v)
+	case string:
+		if r, ok := new(big.Rat).SetString(strings.Replace(strings.TrimSpace(v), `_`, ``, -1)); ok {
+			return r
+		}
+
+		self.fail(c.node, "Invalid value for convert(): %s", inspectString(v))
+	}
+
+	self.fail(c.node, "Cannot convert %s into Rational", className(value))
+	return nil
+}
+
+// parses an integer as Integer() does, allowing a sign, underscores and a base prefix
+func parseInteger(str string, base int) (*big.Int, bool) {
+	str = strings.TrimSpace(str)
+
+	if strings.HasPrefix(str, `_`) || strings.HasSuffix(str, `_`) || strings.Contains(str, `__`) {
+		return nil, false
+	}
+
+	str = strings.Replace(str, `_`, ``, -1)
+
+	// Ruby reads a leading 0 as octal, as Go does without the o
+	if base == 0 {
+		digits := strings.TrimLeft(str, `+-`)
+
+		if len(digits) > 1 && digits[0] == '0' && digits[1] >= '0' && digits[1] <= '9' {
+			str = str[:len(str)-len(digits)] + `0o` + digits[1:]
+		}
+	}
+
+	return new(big.Int).SetString(str, base)
+}
+
+// the methods called on classes and modules, such as File.join
+func (self *evalState) moduleMethod(c *evalCall, module evalModule) (interface{}, bool) {
+	switch string(module) + `.` + c.name {
+	case `File.join`:
+		parts := make([]string, 0, len(c.args))
+
+		for _, arg := range c.args {
+			if array, ok := arg.([]interface{}); ok {
+				for _, element := range self.flatten(c.node, array, -1) {
+					parts = append(parts, rubyString(element))
+				}
+			} else {
+				parts = append(parts, rubyString(arg))
+			}
+		}
+
+		return joinPath(parts), true
+
+	case `File.basename`:
+		self.arity(c, 1, 2)
+
+		base := path.Base(self.stringArg(c, 0))
+
+		if base == `.` && self.stringArg(c, 0) == `` {
+			base = ``
+		}
+
+		if len(c.args) == 2 {
+			if suffix := self.stringArg(c, 1); suffix == `.*` {
+				base = strings.TrimSuffix(base, extname(base))
+			} else if base != suffix {
+				base = strings.TrimSuffix(base, suffix)
+			}
+		}
+
+		return base, true
+
+	case `File.dirname`:
+		self.arity(c, 1, 1)
+		return dirname(self.stringArg(c, 0)), true
+
+	case `File.extname`:
+		self.arity(c, 1, 1)
+		return extname(self.stringArg(c, 0)), true
+
+	case `File.split`:
+		self.arity(c, 1, 1)
+		return []interface{}{dirname(self.stringArg(c, 0)), path.Base(self.stringArg(c, 0))}, true
+
+	case `File.absolute_path?`:
+		self.arity(c, 1, 1)
+		return path.IsAbs(self.stringArg(c, 0)), true
+
+	case `File.expand_path`:
+		self.arity(c, 1, 2)
+
+		// only paths that need neither the working directory nor a home directory
+		name := self.stringArg(c, 0)
+
+		switch {
+		case path.IsAbs(name):
+			return path.Clean(name), true
+		case len(c.args) == 2 && path.IsAbs(self.stringArg(c, 1)) && !strings.HasPrefix(name, `~`):
+			return path.Join(self.stringArg(c, 1), name), true
+		}
+
+		self.fail(c.node, "Cannot expand '%s', which depends on the working or home directory", name)
+
+	case `Math.sqrt`, `Math.cbrt`, `Math.exp`, `Math.log2`, `Math.log10`, `Math.sin`, `Math.cos`, `Math.tan`, `Math.atan`:
+		self.arity(c, 1, 1)
+
+		x := self.floatArg(c, 0)
+		fn := map[string]func(float64) float64{
+			`sqrt`:  math.Sqrt,
+			`cbrt`:  math.Cbrt,
+			`exp`:   math.Exp,
+			`log2`:  math.Log2,
+			`log10`: math.Log10,
+			`sin`:   math.Sin,
+			`cos`:   math.Cos,
+			`tan`:   math.Tan,
+			`atan`:  math.Atan,
+		}[c.name]
+
+		if (c.name == `sqrt` || c.name == `log2` || c.name == `log10`) && x < 0 {
+			self.fail(c.node, "Numerical argument is out of domain - \"%s\"", c.name)
+		}
+
+		return fn(x), true
+
+	case `Math.log`:
+		self.arity(c, 1, 2)
+
+		if x := self.floatArg(c, 0); x < 0 {
+			self.fail(c.node, `Numerical argument is out of domain - "log"`)
+		} else if len(c.args) == 2 {
+			return math.Log(x) / math.Log(self.floatArg(c, 1)), true
+		} else {
+			return math.Log(x), true
+		}
+
+	case `Math.atan2`, `Math.hypot`:
+		self.arity(c, 2, 2)
+
+		if c.name == `atan2` {
+			return math.Atan2(self.floatArg(c, 0), self.floatArg(c, 1)), true
+		}
+
+		return math.Hypot(self.floatArg(c, 0), self.floatArg(c, 1)), true
+
+	case `Integer.sqrt`:
+		self.arity(c, 1, 1)
+
+		n, ok := c.args[0].(*big.Int)
+
+		if !ok || n.Sign() < 0 {
+			self.fail(c.node, `Integer.sqrt requires a non-negative integer`)
+		}
+
+		return new(big.Int).Sqrt(n), true
+
+	case `Set.[]`:
+		return Set(self.uniq(c.node, c.args, nil)), true
+
+	case `Set.new`:
+		self.arity(c, 0, 1)
+
+		if len(c.args) == 0 || c.args[0] == nil {
+			return Set{}, true
+		}
+
+		elements := self.toArray(c.node, c.args[0])
+
+		if c.block != nil {
+			elements = self.mapValues(elements, c.block)
+		}
+
+		return Set(self.uniq(c.node, elements, nil)), true
+
+	case `Hash.new`:
+		self.arity(c, 0, 0)
+
+		if c.block != nil {
+			self.fail(c.node, `Hashes with default blocks are not supported`)
+		}
+
+		return newEvalHash(), true
+
+	case `Array.new`:
+		self.arity(c, 0, 2)
+
+		if len(c.args) == 0 {
+			return make([]interface{}, 0), true
+		}
+
+		size := self.intArg(c, 0)
+
+		if size < 0 {
+			self.fail(c.node, `Negative array size`)
+		}
+
+		self.step(c.node, size)
+		array := make([]interface{}, size)
+
+		for i := range array {
+			switch {
+			case c.block != nil:
+				array[i] = c.block([]interface{}{newInt(int64(i))})
+			case len(c.args) == 2:
+				array[i] = c.args[1]
+			}
+		}
+
+		return array, true
+
+	case `String.new`:
+		self.arity(c, 0, 1)
+
+		if len(c.args) == 0 {
+			return ``, true
+		}
+
+		return self.stringArg(c, 0), true
+
+	case `Pathname.new`:
+		self.arity(c, 1, 1)
+		return evalPathname(self.stringArg(c, 0)), true
+
+	case `Regexp.new`, `Regexp.compile`:
+		self.arity(c, 1, 2)
+
+		if rx, ok := c.args[0].(Regexp); ok {
+			return rx, true
+		}
+
+		rx := Regexp{Source: self.stringArg(c, 0)}
+
+		if len(c.args) == 2 {
+			switch flags := c.args[1].(type) {
+			case string:
+				rx.Flags = flags
+			case *big.Int:
+				// Regexp::IGNORECASE, EXTENDED and MULTILINE
+				for i, flag := range []string{`i`, `x`, `m`} {
+					if flags.Int64()&(1<<uint(i)) != 0 {
+						rx.Flags += flag
+					}
+				}
+			default:
+				if truthy(flags) {
+					rx.Flags = `i`
+				}
+			}
+		}
+
+		return rx, true
+
+	case `Regexp.escape`, `Regexp.quote`:
+		self.arity(c, 1, 1)
+		return escapeRegexp(self.stringArg(c, 0)), true
+
+	case `Regexp.union`:
+		sources := make([]string, 0, len(c.args))
+
+		if len(c.args) == 1 {
+			if rx, ok := c.args[0].(Regexp); ok {
+				return rx, true
+			}
+		}
+
+		for _, arg := range c.args {
+			if rx, ok := arg.(Regexp); ok {
+				sources = append(sources, embedRegexp(rx))
+			} else {
+				sources = append(sources, escapeRegexp(rubyString(arg)))
+			}
+		}
+
+		return Regexp{Source: strings.Join(sources, `|`)}, true
+
+	case `Time.at`:
+		return self.timeAt(c), true
+
+	case `Time.utc`, `Time.gm`, `Time.new`, `Time.local`, `Time.mktime`:
+		return self.timeNew(c), true
+	}
+
+	switch c.name {
+	case `name`, `to_s`, `inspect`:
+		return string(module), true
+	case `===`:
+		self.arity(c, 1, 1)
+		return isA(c.args[0], module), true
+	}
+
+	return nil, false
+}
+
+// the constants of classes and modules, such as Float::INFINITY
+func moduleConstant(name string) (interface{}, bool) {
+	switch name {
+	case `Float::INFINITY`:
+		return math.Inf(1), true
+	case `Float::NAN`:
+		return math.NaN(), true
+	case `Float::MAX`:
+		return math.MaxFloat64, true
+	case `Float::MIN`:
+		return 2.2250738585072014e-308, true
+	case `Float::EPSILON`:
+		return 2.220446049250313e-16, true
+	case `Math::PI`:
+		return math.Pi, true
+	case `Math::E`:
+		return math.E, true
+	case `File::SEPARATOR`:
+		return `/`, true
+	case `File::ALT_SEPARATOR`:
+		return nil, true
+	case `Regexp::IGNORECASE`:
+		return newInt(1), true
+	case `Regexp::EXTENDED`:
+		return newInt(2), true
+	case `Regexp::MULTILINE`:
+		return newInt(4), true
+	}
+
+	return nil, false
+}
+
+// returns an argument that must be a number, as a float
+func (self *evalState) floatArg(c *evalCall, i int) float64 {
+	if numericKind(c.args[i]) == notNumeric {
+		self.fail(c.node, "Cannot convert %s into Float for '%s'", className(c.args[i]), c.name)
+	}
+
+	return toFloat(c.args[i])
+}
+
+// joins paths as File.join does, with one separator between each
+func joinPath(parts []string) string {
+	var joined strings.Builder
+
+	for i, part := range parts {
+		if i > 0 {
+			hasSeparator := strings.HasSuffix(joined.String(), `/`)
+
+			switch {
+			case hasSeparator && strings.HasPrefix(part, `/`):
+				part = strings.TrimLeft(part, `/`)
+			case !hasSeparator && !strings.HasPrefix(part, `/`):
+				joined.WriteString(`/`)
+			}
+		}
+
+		joined.WriteString(part)
+	}
+
+	return joined.String()
+}
+
+// returns the directory of a path as File.dirname does, which ignores trailing
+// separators
+func dirname(name string) string {
+	trimmed := strings.TrimRight(name, `/`)
+
+	if trimmed == `` && name != `` {
+		return `/`
+	}
+
+	return path.Dir(trimmed)
+}
+
+// returns the extension of a file name as File.extname does, which ignores leading dots
+func extname(name string) string {
+	base := path.Base(name)
+	trimmed := strings.TrimLeft(base, `.`)
+
+	if i := strings.LastIndexByte(trimmed, '.'); i > 0 {
+		return trimmed[i:]
+	}
+
+	return ``
+}
+
+func (self *evalState) pathnameMethod(c *evalCall, receiver evalPathname) (interface{}, bool) {
+	name := string(receiver)
+
+	switch c.name {
+	case `to_s`, `to_path`:
+		return name, true
+
+	case `+`, `/`, `join`:
+		joined := name
+
+		for i := range c.args {
+			if part := self.stringArg(c, i); path.IsAbs(part) {
+				joined = part
+			} else {
+				joined = path.Join(joined, part)
+			}
+		}
+
+		return evalPathname(joined), true
+
+	case `basename`:
+		return evalPathname(path.Base(name)), true
+	case `dirname`, `parent`:
+		return evalPathname(dirname(name)), true
+	case `extname`:
+		return extname(name), true
+	case `cleanpath`:
+		return evalPathname(path.Clean(name)), true
+	case `absolute?`:
+		return path.IsAbs(name), true
+	case `relative?`:
+		return !path.IsAbs(name), true
+
+	case `sub_ext`:
+		self.arity(c, 1, 1)
+		return evalPathname(strings.TrimSuffix(name, extname(name)) + self.stringArg(c, 0)), true
+	}
+
+	return nil, false
+}
+
+// the methods of integers, floats and rationals
+func (self *evalState) numericMethod(c *evalCall) (interface{}, bool) {
+	receiver := c.receiver
+	kind := numericKind(receiver)
+
+	switch c.name {
+	case `+`, `-`, `*`, `/`, `%`, `modulo`, `**`, `pow`, `div`, `fdiv`, `quo`:
+		if c.name == `pow` && len(c.args) == 2 {
+			return self.modularPow(c), true
+		}
+
+		self.arity(c, 1, 1)
+
+		switch c.name {
+		case `modulo`:
+			return self.arithmetic(c, `%`, receiver, c.args[0]), true
+		case `pow`:
+			return self.arithmetic(c, `**`, receiver, c.args[0]), true
+		case `fdiv`:
+			return self.arithmetic(c, `/`, toFloat(receiver), c.args[0]), true
+		case `quo`:
+			if kind == integerKind && numericKind(c.args[0]) == integerKind {
+				return self.arithmetic(c, `/`, toRat(receiver), c.args[0]), true
+			}
+
+			return self.arithmetic(c, `/`, receiver, c.args[0]), true
+		case `div`:
+			return self.toInteger(c, self.floor(c, self.arithmetic(c, `/`, receiver, c.args[0]))), true
+		}
+
+		return self.arithmetic(c, c.name, receiver, c.args[0]), true
+
+	case `divmod`:
+		self.arity(c, 1, 1)
+
+		quotient := self.floor(c, self.arithmetic(c, `/`, receiver, c.args[0]))
+		return []interface{}{quotient, self.arithmetic(c, `%`, receiver, c.args[0])}, true
+
+	case `-@`:
+		return self.arithmetic(c, `*`, receiver, newInt(-1)), true
+	case `+@`:
+		return receiver, true
+
+	case `abs`, `magnitude`:
+		if cmp, _ := compareValues(receiver, newInt(0)); cmp < 0 {
+			return self.arithmetic(c, `*`, receiver, newInt(-1)), true
+		} else if f, ok := receiver.(float64); ok {
+			return math.Abs(f), true
+		}
+
+		return receiver, true
+
+	case `zero?`, `positive?`, `negative?`, `nonzero?`:
+		cmp, ok := compareValues(receiver, newInt(0))
+
+		switch c.name {
+		case `zero?`:
+			return ok && cmp == 0, true
+		case `positive?`:
+			return ok && cmp > 0, true
+		case `negative?`:
+			return ok && cmp < 0, true
+		}
+
+		if ok && cmp == 0 {
+			return nil, true
+		}
+
+		return receiver, true
+
+	case `to_i`, `to_int`, `truncate`:
+		if c.name == `truncate` && len(c.args) > 0 {
+			return self.round(c, `truncate`), true
+		}
+
+		return self.toInteger(c, receiver), true
+
+	case `to_f`:
+		return toFloat(receiver), true
+
+	case `to_r`, `rationalize`:
+		if f, ok := receiver.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			self.fail(c.node, "Cannot convert %s into Rational", floatString(f))
+		} else if ok && c.name == `rationalize` {
+			self.arity(c, 0, 0)
+			return rationalize(f), true
+		}
+
+		return toRat(receiver), true
+
+	case `to_s`, `inspect`:
+		if n, ok := receiver.(*big.Int); ok && len(c.args) == 1 {
+			base := self.intArg(c, 0)
+
+			if base < 2 || base > 36 {
+				self.fail(c.node, "Invalid radix %d", base)
+			}
+
+			return n.Text(base), true
+		} else if c.name == `inspect` {
+			return rubyInspect(receiver), true
+		}
+
+		return rubyString(receiver), true
+
+	case `round`, `floor`, `ceil`:
+		return self.round(c, c.name), true
+
+	case `integer?`:
+		return kind == integerKind, true
+
+	case `finite?`, `infinite?`, `nan?`:
+		f, isFloat := receiver.(float64)
+
+		switch c.name {
+		case `finite?`:
+			return !isFloat || !(math.IsInf(f, 0) || math.IsNaN(f)), true
+		case `nan?`:
+			return isFloat && math.IsNaN(f), true
+		}
+
+		if isFloat && math.IsInf(f, 1) {
+			return newInt(1), true
+		} else if isFloat && math.IsInf(f, -1) {
+			return newInt(-1), true
+		}
+
+		return nil, true
+
+	case `numerator`, `denominator`:
+		r := toRat(receiver)
+
+		if c.name == `numerator` {
+			return new(big.Int).Set(r.Num()), true
+		}
+
+		return new(big.Int).Set(r.Denom()), true
+
+	case `coerce`:
+		self.arity(c, 1, 1)
+
+		if kind == floatKind || numericKind(c.args[0]) == floatKind {
+			return []interface{}{toFloat(c.args[0]), toFloat(receiver)}, true
+		}
+
+		return []interface{}{c.args[0], receiver}, true
+	}
+
+	if n, ok := receiver.(*big.Int); ok {
+		return self.integerMethod(c, n)
+	}
+
+	return nil, false
+}
+
+// the methods of integers alone
+func (self *evalState) integerMethod(c *evalCall, receiver *big.Int) (interface{}, bool) {
+	switch c.name {
+	case `&`, `|`, `^`, `<<`, `>>`:
+		self.arity(c, 1, 1)
+
+		other, ok := c.args[0].(*big.Int)
+
+		if !ok {
+			self.fail(c.node, "%s can't be coerced into Integer", className(c.args[0]))
+		}
+
+		switch c.name {
+		case `&`:
+			return new(big.Int).And(receiver, other), true
+		case `|`:
+			return new(big.Int).Or(receiver, other), true
+		case `^`:
+			return new(big.Int).Xor(receiver, other), true
+		}
+
+		shift := self.intArg(c, 0)
+
+		if c.name == `>>` {
+			shift = -shift
+		}
+
+		if shift < 0 {
+			return new(big.Int).Rsh(receiver, uint(-shift)), true
+		}
+
+		self.step(c.node, shift/64)
+		return new(big.Int).Lsh(receiver, uint(shift)), true
+
+	case `~`:
+		return new(big.Int).Not(receiver), true
+	case `even?`:
+		return receiver.Bit(0) == 0, true
+	case `odd?`:
+		return receiver.Bit(0) == 1, true
+	case `succ`, `next`:
+		return new(big.Int).Add(receiver, newInt(1)), true
+	case `pred`:
+		return new(big.Int).Sub(receiver, newInt(1)), true
+	case `bit_length`:
+		if receiver.Sign() < 0 {
+			return newInt(int64(new(big.Int).Not(receiver).BitLen())), true
+		}
+
+		return newInt(int64(receiver.BitLen())), true
+
+	case `gcd`, `lcm`:
+		self.arity(c, 1, 1)
+
+		other, ok := c.args[0].(*big.Int)
+
+		if !ok {
+			self.fail(c.node, "Not an integer: %s", rubyInspect(c.args[0]))
+		}
+
+		a, b := new(big.Int).Abs(receiver), new(big.Int).Abs(other)
+		gcd := new(big.Int).GCD(nil, nil, a, b)
+
+		if c.name == `gcd` {
+			return gcd, true
+		} else if gcd.Sign() == 0 {
+			return newInt(0), true
+		}
+
+		return new(big.Int).Mul(new(big.Int).Quo(a, gcd), b), true
+
+	case `digits`:
+		if receiver.Sign() < 0 {
+			self.fail(c.node, `Out of domain`)
+		}
+
+		digits := make([]interface{}, 0)
+		n := new(big.Int).Set(receiver)
+
+		for {
+			self.step(c.node, 1)
+
+			digit := new(big.Int)
+			n.QuoRem(n, newInt(10), digit)
+			digits = append(digits, digit)
+
+			if n.Sign() == 0 {
+				return digits, true
+			}
+		}
+
+	case `chr`:
+		self.arity(c, 0, 1)
+
+		// without an encoding, codes past ASCII are single bytes, as in a binary string
+		if len(c.args) == 0 && receiver.IsInt64() && receiver.Int64() >= 0x80 && receiver.Int64() <= 0xFF {
+			return string([]byte{byte(receiver.Int64())}), true
+		} else if !receiver.IsInt64() || receiver.Int64() < 0 || receiver.Int64() > 0x10FFFF || (len(c.args) == 0 && receiver.Int64() > 0xFF) {
+			self.fail(c.node, "%s out of char range", receiver)
+		} else if !utf8.ValidRune(rune(receiver.Int64())) {
+			self.fail(c.node, "Invalid codepoint 0x%X in UTF-8", receiver.Int64())
+		}
+
+		return string(rune(receiver.Int64())), true
+
+	case `times`, `upto`, `downto`:
+		begin, end := newInt(0), new(big.Int).Sub(receiver, newInt(1))
+
+		if c.name != `times` {
+			self.arity(c, 1, 1)
+
+			other, ok := c.args[0].(*big.Int)
+
+			if !ok {
+				self.fail(c.node, "Cannot iterate from Integer to %s", className(c.args[0]))
+			}
+
+			begin, end = receiver, other
+		}
+
+		var values []interface{}
+
+		if c.name == `downto` {
+			values = self.rangeElements(c.node, Range{Begin: end, End: begin})
+
+			for i, j := 0, len(values)-1; i < j; i, j = i+1, j-1 {
+				values[i], values[j] = values[j], values[i]
+			}
+		} else {
+			values = self.rangeElements(c.node, Range{Begin: begin, End: end})
+		}
+
+		// without a block, the values are returned for methods such as map to be called on
+		if c.block == nil {
+			return values, true
+		}
+
+		for _, value := range values {
+			c.block([]interface{}{value})
+		}
+
+		return receiver, true
+	}
+
+	return nil, false
+}
+
+// performs arithmetic as Ruby does, converting integers to rationals and either to floats
+// when the other operand is one
+func (self *evalState) arithmetic(c *evalCall, op string, a interface{}, b interface{}) interface{} {
+	ka, kb := numericKind(a), numericKind(b)
+
+	if kb == notNumeric {
+		if b == nil {
+			self.fail(c.node, "nil can't be coerced into %s", className(a))
+		}
+
+		self.fail(c.node, "%s can't be coerced into %s", className(b), className(a))
+	}
+
+	kind := ka
+
+	if kb > kind {
+		kind = kb
+	}
+
+	switch kind {
+	case floatKind:
+		x, y := toFloat(a), toFloat(b)
+
+		switch op {
+		case `+`:
+			return x + y
+		case `-`:
+			return x - y
+		case `*`:
+			return x * y
+		case `/`:
+			return x / y
+		case `**`:
+			return math.Pow(x, y)
+		}
+
+		if y == 0 {
+			return math.NaN()
+		}
+
+		m := math.Mod(x, y)
+
+		if m != 0 && (m < 0) != (y < 0) {
+			m += y
+		}
+
+		return m
+
+	case rationalKind:
+		x, y := toRat(a), toRat(b)
+
+		switch op {
+		case `+`:
+			return x.Add(x, y)
+		case `-`:
+			return x.Sub(x, y)
+		case `*`:
+			return x.Mul(x, y)
+		case `**`:
+			if n, ok := b.(*big.Int); ok {
+				return self.ratPow(c, x, n)
+			}
+
+			return math.Pow(toFloat(a), toFloat(b))
+		}
+
+		if y.Sign() == 0 {
+			self.fail(c.node, `Divided by 0`)
+		}
+
+		quotient := new(big.Rat).Quo(x, y)
+
+		if op == `/` {
+			return quotient
+		}
+
+		floor := self.floor(c, quotient).(*big.Int)
+		return x.Sub(x, y.Mul(y, new(big.Rat).SetInt(floor)))
+	}
+
+	x, y := a.(*big.Int), b.(*big.Int)
+
+	switch op {
+	case `+`:
+		return new(big.Int).Add(x, y)
+	case `-`:
+		return new(big.Int).Sub(x, y)
+	case `*`:
+		// multiplying takes longer than the length of the product, so is charged for
+		// each pair of words multiplied
+		self.step(c.node, (x.BitLen()/64+1)*(y.BitLen()/64+1)/64)
+		return new(big.Int).Mul(x, y)
+	case `**`:
+		// an integer to a negative power is a rational, unless it is 1 or -1
+		result := self.ratPow(c, new(big.Rat).SetInt(x), y)
+
+		if result.IsInt() {
+			return new(big.Int).Set(result.Num())
+		}
+
+		return result
+	}
+
+	if y.Sign() == 0 {
+		self.fail(c.node, `Divided by 0`)
+	}
+
+	quotient, remainder := new(big.Int).QuoRem(x, y, new(big.Int))
+
+	// Ruby rounds the quotient toward negative infinity, so the remainder has the
+	// divisor's sign
+	if remainder.Sign() != 0 && (remainder.Sign() < 0) != (y.Sign() < 0) {
+		quotient.Sub(quotient, newInt(1))
+		remainder.Add(remainder, y)
+	}
+
+	if op == `/` {
+		return quotient
+	}
+
+	return remainder
+}
+
+// raises a rational to an integer power
+func (self *evalState) ratPow(c *evalCall, x *big.Rat, n *big.Int) *big.Rat {
+	if !n.IsInt64() || n.Int64() > math.MaxInt32 || n.Int64() < math.MinInt32 {
+		if x.IsInt() && x.Num().CmpAbs(newInt(1)) <= 0 {
+			n = new(big.Int).Rem(n, newInt(2))
+		} else {
+			self.step(c.node, -1)
+		}
+	}
+
+	exponent := n.Int64()
+	negative := exponent < 0
+
+	if negative {
+		exponent = -exponent
+
+		if x.Sign() == 0 {
+			self.fail(c.node, `Divided by 0`)
+		}
+	}
+
+	// charged as multiplying the result by itself would be
+	words := int64(x.Num().BitLen()+x.Denom().BitLen())*exponent/64 + 1
+
+	if words > 1<<20 {
+		self.step(c.node, -1)
+	}
+
+	self.step(c.node, int(words*words/64))
+
+	num := new(big.Int).Exp(x.Num(), big.NewInt(exponent), nil)
+	denom := new(big.Int).Exp(x.Denom(), big.NewInt(exponent), nil)
+
+	if negative {
+		num, denom = denom, num
+	}
+
+	return new(big.Rat).SetFrac(num, denom)
+}
+
+// returns pow(b, m): the receiver to the power b, modulo m
+func (self *evalState) modularPow(c *evalCall) interface{} {
+	x, ok := c.receiver.(*big.Int)
+	y, ok2 := c.args[0].(*big.Int)
+	m, ok3 := c.args[1].(*big.Int)
+
+	if !ok || !ok2 || !ok3 || y.Sign() < 0 {
+		self.fail(c.node, `Integer#pow with a modulus requires non-negative integers`)
+	} else if m.Sign() == 0 {
+		self.fail(c.node, `Divided by 0`)
+	}
+
+	result := new(big.Int).Exp(x, y, new(big.Int).Abs(m))
+
+	if result.Sign() != 0 && m.Sign() < 0 {
+		result.Add(result, m)
+	}
+
+	return result
+}
+
+// converts a number to an integer, truncating any fraction
+func (self *evalState) toInteger(c *evalCall, value interface{}) *big.Int {
+	switch v := value.(type) {
+	case *big.Int:
+		return v
+	case *big.Rat:
+		return new(big.Int).Quo(v.Num(), v.Denom())
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			self.fail(c.node, "%s cannot be converted into an Integer", floatString(v))
+		}
+
+		n, _ := big.NewFloat(v).Int(nil)
+		return n
+	}
+
+	self.fail(c.node, "Cannot convert %s into Integer", className(value))
+	return nil
+}
+
+// returns the largest integer no greater than a number
+func (self *evalState) floor(c *evalCall, value interface{}) interface{} {
+	switch v := value.(type) {
+	case *big.Rat:
+		return new(big.Int).Div(v.Num(), v.Denom())
+	case float64:
+		return self.toInteger(c, math.Floor(v))
+	}
+
+	return value
+}
+
+// rounds a number to the given number of decimal digits (the first argument, if any) as
+// round, floor, ceil and truncate do
+func (self *evalState) round(c *evalCall, mode string) interface{} {
+	self.arity(c, 0, 2)
+
+	digits := 0
+	half := `up`
+
+	if len(c.args) > 0 {
+		if _, ok := c.args[0].(*evalHash); !ok {
+			digits = self.intArg(c, 0)
+		}
+
+		if options, ok := c.args[len(c.args)-1].(*evalHash); ok {
+			for _, key := range options.keys {
+				if key != Symbol(`half`) || mode != `round` {
+					self.fail(c.node, "Unknown keyword %s for %s", rubyInspect(key), mode)
+				}
+			}
+
+			if value, _ := options.get(Symbol(`half`)); value != nil {
+				switch half = rubyString(value); half {
+				case `up`, `down`, `even`:
+				default:
+					self.fail(c.node, "Invalid rounding mode: %s", half)
+				}
+			}
+		}
+	}
+
+	// rounding to fewer digits than a float has would not change it
+	if f, ok := c.receiver.(float64); ok && digits > 0 {
+		if math.IsNaN(f) || math.IsInf(f, 0) || digits >= 17 {
+			return f
+		}
+	}
+
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(newInt(10), newInt(int64(abs(digits))), nil))
+	value := toRat(c.receiver)
+
+	if f, ok := c.receiver.(float64); ok {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			self.fail(c.node, "%s cannot be converted into an Integer", floatString(f))
+		}
+
+		// floats are rounded by their shortest decimal representation, which is what is seen
+		value, _ = new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+
+	if digits >= 0 {
+		value.Mul(value, scale)
+	} else {
+		value.Quo(value, scale)
+	}
+
+	n, remainder := new(big.Int).DivMod(value.Num(), value.Denom(), new(big.Int))
+	twice := new(big.Int).Mul(remainder, newInt(2))
+
+	switch mode {
+	case `ceil`:
+		if remainder.Sign() != 0 {
+			n.Add(n, newInt(1))
+		}
+	case `truncate`:
+		if remainder.Sign() != 0 && value.Sign() < 0 {
+			n.Add(n, newInt(1))
+		}
+	case `round`:
+		// halves round away from zero, toward it or to an even number as half: says
+		cmp := twice.Cmp(value.Denom())
+
+		if cmp == 0 {
+			switch half {
+			case `up`:
+				cmp = value.Sign()
+			case `down`:
+				cmp = -value.Sign()
+			case `even`:
+				cmp = int(n.Bit(0))
+			}
+		}
+
+		if cmp > 0 {
+			n.Add(n, newInt(1))
+		}
+	}
+
+	result := new(big.Rat).SetInt(n)
+
+	if digits >= 0 {
+		result.Quo(result, scale)
+	} else {
+		result.Mul(result, scale)
+	}
+
+	switch c.receiver.(type) {
+	case float64:
+		if digits > 0 {
+			f, _ := result.Float64()
+			return f
+		}
+	case *big.Rat:
+		if digits > 0 {
+			return result
+		}
+	}
+
+	return new(big.Int).Set(result.Num())
+}
+
+// returns the simplest rational that a float could have been rounded from, as
+// Float#rationalize does: 0.1 is 1/10 rather than the fraction its bits stand for
+func rationalize(f float64) *big.Rat {
+	fraction, exponent := math.Frexp(math.Abs(f))
+	mantissa, _ := big.NewFloat(math.Ldexp(fraction, 53)).Int(nil)
+	exponent -= 53
+
+	if mantissa.Sign() == 0 || exponent >= 0 {
+		return toRat(f)
+	}
+
+	// the bounds of the interval rounding to the float, between which the rational
+	// with the smallest denominator is found by its continued fraction
+	denom := new(big.Int).Lsh(newInt(1), uint(1-exponent))
+	twice := new(big.Int).Lsh(mantissa, 1)
+	a := new(big.Rat).SetFrac(new(big.Int).Sub(twice, newInt(1)), denom)
+	b := new(big.Rat).SetFrac(new(big.Int).Add(twice, newInt(1)), denom)
+
+	p0, p1, q0, q1 := newInt(0), newInt(1), newInt(1), newInt(0)
+	var ceil *big.Int
+
+	for {
+		ceil = new(big.Int).Div(a.Num(), a.Denom())
+
+		if !a.IsInt() {
+			ceil.Add(ceil, newInt(1))
+		}
+
+		if new(big.Rat).SetInt(ceil).Cmp(b) < 0 {
+			break
+		}
+
+		k := new(big.Int).Sub(ceil, newInt(1))
+		p2 := new(big.Int).Add(new(big.Int).Mul(k, p1), p0)
+		q2 := new(big.Int).Add(new(big.Int).Mul(k, q1), q0)
+		kr := new(big.Rat).SetInt(k)
+
+		a, b = new(big.Rat).Inv(new(big.Rat).Sub(b, kr)), new(big.Rat).Inv(new(big.Rat).Sub(a, kr))
+		p0, p1, q0, q1 = p1, p2, q1, q2
+	}
+
+	num := new(big.Int).Add(new(big.Int).Mul(ceil, p1), p0)
+	result := new(big.Rat).SetFrac(num, new(big.Int).Add(new(big.Int).Mul(ceil, q1), q0))
+
+	if f < 0 {
+		result.Neg(result)
+	}
+
+	return result
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
@@ -0,0 +1,242 @@
+package ruby
+
+import (
+	"testing"
+)
+
+func TestEvalObject(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`1 == 1.0`, `true`},
+		{`1.eql?(1.0)`, `false`},
+		{`1 != 2`, `true`},
+		{`1 <=> 2`, `-1`},
+		{`1 <=> 'a'`, `nil`},
+		{`5.between?(1, 10)`, `true`},
+		{`15.clamp(1, 10)`, `10`},
+		{`-1.clamp(0..)`, `0`},
+		{`'b'.clamp('a', 'c')`, `"b"`},
+		{`1.class`, `Integer`},
+		{`1.5.class`, `Float`},
+		{`nil.class`, `NilClass`},
+		{`true.class`, `TrueClass`},
+		{`(1..2).class`, `Range`},
+		{`:a.class`, `Symbol`},
+		{`1.is_a?(Numeric)`, `true`},
+		{`1.kind_of?(Comparable)`, `true`},
+		{`[].is_a?(Enumerable)`, `true`},
+		{`'a'.is_a?(Object)`, `true`},
+		{`1.instance_of?(Numeric)`, `false`},
+		{`1.instance_of?(Integer)`, `true`},
+		{`Integer === 3`, `true`},
+		{`String === 3`, `false`},
+		{`Integer.name`, `"Integer"`},
+		{`nil.nil?`, `true`},
+		{`nil.to_a`, `[]`},
+		{`nil.to_h`, `{}`},
+		{`nil.to_s`, `""`},
+		{`nil.inspect`, `"nil"`},
+		{`nil | 1`, `true`},
+		{`true & false`, `false`},
+		{`true ^ true`, `false`},
+		{`5.then { |x| x + 1 }`, `6`},
+		{`[1].tap { |x| x.size }`, `[1]`},
+		{`3.send(:+, 4)`, `7`},
+		{`'a'.public_send(:upcase)`, `"A"`},
+		{`3.itself`, `3`},
+	})
+}
+
+func TestEvalKernel(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`Integer('0x1A')`, `26`},
+		{`Integer('0b101')`, `5`},
+		{`Integer('017')`, `15`},
+		{`Integer('1_000')`, `1000`},
+		{`Integer(' 42 ')`, `42`},
+		{`Integer('ff', 16)`, `255`},
+		{`Integer(3.99)`, `3`},
+		{`Float('1.5')`, `1.5`},
+		{`Float('1_000.5')`, `1000.5`},
+		{`Float(2)`, `2.0`},
+		{`String(12)`, `"12"`},
+		{`Array(nil)`, `[]`},
+		{`Array([1])`, `[1]`},
+		{`Array(1..3)`, `[1, 2, 3]`},
+		{`Array({a: 1})`, `[[:a, 1]]`},
+		{`Array('a')`, `["a"]`},
+		{`Rational(1, 3)`, `(1/3)`},
+		{`Rational('0.75')`, `(3/4)`},
+		{`Rational(3)`, `(3/1)`},
+		{`Rational(0.5)`, `(1/2)`},
+		{`format('%05d', 42)`, `"00042"`},
+		{`require 'set'`, `true`},
+	})
+}
+
+func TestEvalNumeric(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`7 / 2`, `3`},
+		{`-7 / 2`, `-4`},
+		{`-7 % 3`, `2`},
+		{`7 % -3`, `-2`},
+		{`7.0 / 2`, `3.5`},
+		{`7.fdiv(2)`, `3.5`},
+		{`7.quo(2)`, `(7/2)`},
+		{`7.div(2.0)`, `3`},
+		{`6.5.modulo(2)`, `0.5`},
+		{`7.divmod(-2)`, `[-4, -1]`},
+		{`-7.5.divmod(2)`, `[-4, 0.5]`},
+		{`2 ** 10`, `1024`},
+		{`2 ** 64`, `18446744073709551616`},
+		{`2 ** -2`, `(1/4)`},
+		{`1 ** -2`, `1`},
+		{`2 ** 0.5`, `1.4142135623730951`},
+		{`Rational(2, 1) ** 2`, `(4/1)`},
+		{`Rational(1, 2) ** -2`, `(4/1)`},
+		{`4 ** Rational(1, 2)`, `2.0`},
+		{`2.pow(10, 1000)`, `24`},
+		{`10 - 2.5`, `7.5`},
+		{`1 + Rational(1, 2)`, `(3/2)`},
+		{`Rational(1, 2) + 0.5`, `1.0`},
+		{`0.1 + 0.2`, `0.30000000000000004`},
+		{`1.0 / 0`, `Infinity`},
+		{`-1.0 / 0`, `-Infinity`},
+		{`0.0 / 0`, `NaN`},
+		{`-5.abs`, `5`},
+		{`-5.5.abs`, `5.5`},
+		{`0.zero?`, `true`},
+		{`-1.negative?`, `true`},
+		{`0.nonzero?`, `nil`},
+		{`3.nonzero?`, `3`},
+		{`3.7.to_i`, `3`},
+		{`-3.7.truncate`, `-3`},
+		{`3.to_f`, `3.0`},
+		{`0.5.to_r`, `(1/2)`},
+		{`0.1.rationalize`, `(1/10)`},
+		{`(1.0 / 3).rationalize`, `(1/3)`},
+		{`-0.75.rationalize`, `(-3/4)`},
+		{`3.rationalize`, `(3/1)`},
+		{`5.integer?`, `true`},
+		{`5.0.integer?`, `false`},
+		{`(1.0 / 0).infinite?`, `1`},
+		{`1.0.infinite?`, `nil`},
+		{`(0.0 / 0).nan?`, `true`},
+		{`1.5.finite?`, `true`},
+		{`Rational(3, 4).numerator`, `3`},
+		{`0.5.denominator`, `2`},
+		{`1.coerce(2.5)`, `[2.5, 1.0]`},
+		{`1.coerce(2)`, `[2, 1]`},
+		{`255.to_s(2)`, `"11111111"`},
+		{`255.to_s(16)`, `"ff"`},
+		{`1.5.to_s`, `"1.5"`},
+	})
+}
+
+func TestEvalRound(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`2.5.round`, `3`},
+		{`-2.5.round`, `-3`},
+		{`2.5.round(half: :even)`, `2`},
+		{`3.5.round(half: :even)`, `4`},
+		{`2.5.round(half: :down)`, `2`},
+		{`-2.5.round(half: :down)`, `-2`},
+		{`2.5.round(half: :up)`, `3`},
+		{`2.5.round(half: nil)`, `3`},
+		{`0.125.round(2, half: :even)`, `0.12`},
+		{`1.23456.round(2)`, `1.23`},
+		{`1.0.round(2)`, `1.0`},
+		{`1234.round(-2)`, `1200`},
+		{`1250.round(-2)`, `1300`},
+		{`1250.round(-2, half: :even)`, `1200`},
+		{`10.round(1)`, `10`},
+		{`1.5.floor`, `1`},
+		{`-1.5.ceil`, `-1`},
+		{`1.234.floor(1)`, `1.2`},
+		{`1.234.ceil(2)`, `1.24`},
+		{`12.34.truncate(1)`, `12.3`},
+		{`Rational(7, 2).round`, `4`},
+		{`Rational(22, 7).round(2)`, `(157/50)`},
+	})
+}
+
+func TestEvalInteger(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`6 & 3`, `2`},
+		{`6 | 3`, `7`},
+		{`6 ^ 3`, `5`},
+		{`1 << 10`, `1024`},
+		{`-16 >> 2`, `-4`},
+		{`~5`, `-6`},
+		{`4.even?`, `true`},
+		{`3.odd?`, `true`},
+		{`3.succ`, `4`},
+		{`3.pred`, `2`},
+		{`255.bit_length`, `8`},
+		{`-256.bit_length`, `8`},
+		{`12.gcd(18)`, `6`},
+		{`4.lcm(6)`, `12`},
+		{`1234.digits`, `[4, 3, 2, 1]`},
+		{`65.chr`, `"A"`},
+		{`233.chr`, `"\xE9"`},
+		{`233.chr('UTF-8')`, `"é"`},
+		{`3.times.to_a`, `[0, 1, 2]`},
+		{`1.upto(3).to_a`, `[1, 2, 3]`},
+		{`3.downto(1).map { |i| i * 2 }`, `[6, 4, 2]`},
+		{`Integer.sqrt(24)`, `4`},
+	})
+}
+
+func TestEvalModule(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`File.join('a', 'b/', '/c')`, `"a/b/c"`},
+		{`File.join('a', ['b', ['c']])`, `"a/b/c"`},
+		{`File.basename('/a/b.rb')`, `"b.rb"`},
+		{`File.basename('/a/b.rb', '.rb')`, `"b"`},
+		{`File.basename('/a/b.rb', '.*')`, `"b"`},
+		{`File.dirname('/a/b/')`, `"/a"`},
+		{`File.dirname('b')`, `"."`},
+		{`File.dirname('/')`, `"/"`},
+		{`File.extname('a/b.tar.gz')`, `".gz"`},
+		{`File.extname('.bashrc')`, `""`},
+		{`File.extname('foo.')`, `"."`},
+		{`File.split('/a/b')`, `["/a", "b"]`},
+		{`File.absolute_path?('/a')`, `true`},
+		{`File.expand_path('/a/../b')`, `"/b"`},
+		{`File.expand_path('c', '/a/b')`, `"/a/b/c"`},
+		{`Math.sqrt(16)`, `4.0`},
+		{`Math.cbrt(27)`, `3.0`},
+		{`Math.log(Math::E)`, `1.0`},
+		{`Math.log(8, 2)`, `3.0`},
+		{`Math.log2(8)`, `3.0`},
+		{`Math.log10(1000)`, `3.0`},
+		{`Math.hypot(3, 4)`, `5.0`},
+		{`Math.atan2(1, 1)`, `0.7853981633974483`},
+		{`Math::PI.round(5)`, `3.14159`},
+		{`Set.new([1, 2, 2])`, `#<Set: {1, 2}>`},
+		{`Set.new([1, 2]) { |x| x * 2 }`, `#<Set: {2, 4}>`},
+		{`Hash.new`, `{}`},
+		{`Array.new(3)`, `[nil, nil, nil]`},
+		{`Array.new(2, 0)`, `[0, 0]`},
+		{`Array.new(3) { |i| i * i }`, `[0, 1, 4]`},
+		{`String.new('a')`, `"a"`},
+		{`Regexp.new('a.c', Regexp::IGNORECASE)`, `/a.c/i`},
+		{`Regexp.new('a', 5)`, `/a/mi`},
+		{`Regexp.new('a', 'i')`, `/a/i`},
+		{`Regexp.new('a', true)`, `/a/i`},
+	})
+}
+
+func TestEvalPathname(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`Pathname('/a/b') + 'c'`, `#<Pathname:/a/b/c>`},
+		{`(Pathname('/a/b') / '../c').to_s`, `"/a/c"`},
+		{`Pathname('a') + '/b'`, `#<Pathname:/b>`},
+		{`Pathname('/a/b.rb').basename`, `#<Pathname:b.rb>`},
+		{`Pathname('/a/b/').dirname`, `#<Pathname:/a>`},
+		{`Pathname('a.rb').extname`, `".rb"`},
+		{`Pathname('a/./b/../c').cleanpath`, `#<Pathname:a/c>`},
+		{`Pathname('a').relative?`, `true`},
+		{`Pathname.new('/x').absolute?`, `true`},
+		{`Pathname('a.rb').sub_ext('.py')`, `#<Pathname:a.py>`},
+	})
+}
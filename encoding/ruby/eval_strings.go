@@ -0,0 +1,1530 @@
+package ruby
+
+import (
+	"fmt"
+	"github.com/ghetzel/rubyutils/encoding/ruby/ast"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// the leading numbers that String#to_f and #to_r read, ignoring anything after them
+var rxLeadingFloat = regexp.MustCompile(`^[-+]?[0-9]+(?:_[0-9]+)*(?:\.[0-9]+(?:_[0-9]+)*)?(?:[eE][-+]?[0-9]+)?`)
+var rxLeadingRational = regexp.MustCompile(`^[-+]?[0-9]+(?:\.[0-9]+)?(?:/[0-9]+)?`)
+var rxInlineFlags = regexp.MustCompile(`^\(\?([mix]*)(?:-([mix]*))?([:)])`)
+
+// the whitespace that String#split and #strip remove
+const rubyWhitespace = " \t\n\v\f\r"
+
+func (self *evalState) stringMethod(c *evalCall, receiver string) (interface{}, bool) {
+	switch c.name {
+	case `+`:
+		self.arity(c, 1, 1)
+
+		suffix, ok := c.args[0].(string)
+
+		if !ok {
+			self.fail(c.node, "No implicit conversion of %s into String", className(c.args[0]))
+		}
+
+		return receiver + suffix, true
+
+	case `*`:
+		self.arity(c, 1, 1)
+
+		n := self.intArg(c, 0)
+
+		if n < 0 {
+			self.fail(c.node, `Negative argument`)
+		}
+
+		self.step(c.node, len(receiver)*n/8)
+		return strings.Repeat(receiver, n), true
+
+	case `%`:
+		self.arity(c, 1, 1)
+
+		if args, ok := c.args[0].([]interface{}); ok {
+			return self.format(c, receiver, args), true
+		}
+
+		return self.format(c, receiver, c.args), true
+
+	case `=~`:
+		self.arity(c, 1, 1)
+
+		rx, ok := c.args[0].(Regexp)
+
+		if !ok {
+			self.fail(c.node, "Wrong argument type %s (expected Regexp)", className(c.args[0]))
+		}
+
+		match := self.compileRegexp(c, rx).FindStringSubmatchIndex(receiver)
+		self.setMatch(receiver, match)
+
+		if match != nil {
+			return newInt(int64(utf8.RuneCountInString(receiver[:match[0]]))), true
+		}
+
+		return nil, true
+
+	case `match?`:
+		self.arity(c, 1, 1)
+		return self.pattern(c, c.args[0]).MatchString(receiver), true
+
+	case `[]`, `slice`:
+		self.arity(c, 1, 2)
+
+		switch pattern := c.args[0].(type) {
+		case string:
+			if strings.Contains(receiver, pattern) {
+				return pattern, true
+			}
+
+			return nil, true
+
+		case Regexp:
+			group := 0
+
+			if len(c.args) == 2 {
+				group = self.intArg(c, 1)
+			}
+
+			match := self.compileRegexp(c, pattern).FindStringSubmatchIndex(receiver)
+
+			if match == nil || group < 0 || 2*group >= len(match) || match[2*group] < 0 {
+				return nil, true
+			}
+
+			return receiver[match[2*group]:match[2*group+1]], true
+		}
+
+		runes := []rune(receiver)
+		start, length, single, ok := self.sliceArgs(c, len(runes))
+
+		if !ok || (single && start == len(runes)) {
+			return nil, true
+		}
+
+		return string(runes[start : start+length]), true
+
+	case `length`, `size`:
+		return newInt(int64(utf8.RuneCountInString(receiver))), true
+	case `bytesize`:
+		return newInt(int64(len(receiver))), true
+	case `empty?`:
+		return receiver == ``, true
+	case `ascii_only?`:
+		return strings.IndexFunc(receiver, func(r rune) bool { return r > unicode.MaxASCII }) < 0, true
+
+	case `to_s`, `to_str`:
+		return receiver, true
+	case `to_sym`, `intern`:
+		return Symbol(receiver), true
+
+	case `to_i`:
+		self.arity(c, 0, 1)
+
+		base := 10
+
+		if len(c.args) == 1 {
+			if base = self.intArg(c, 0); base < 2 || base > 36 {
+				self.fail(c.node, "Invalid radix %d", base)
+			}
+		}
+
+		return leadingInteger(receiver, base), true
+
+	case `hex`:
+		return leadingInteger(receiver, 16), true
+	case `oct`:
+		return leadingInteger(receiver, 8), true
+
+	case `to_f`:
+		literal := rxLeadingFloat.FindString(strings.TrimLeft(receiver, rubyWhitespace))
+		f, _ := strconv.ParseFloat(strings.Replace(literal, `_`, ``, -1), 64)
+
+		return f, true
+
+	case `to_r`:
+		if r, ok := new(big.Rat).SetString(rxLeadingRational.FindString(strings.TrimLeft(receiver, rubyWhitespace))); ok {
+			return r, true
+		}
+
+		return new(big.Rat), true
+
+	case `upcase`:
+		return strings.ToUpper(receiver), true
+	case `downcase`:
+		return strings.ToLower(receiver), true
+
+	case `capitalize`:
+		if receiver == `` {
+			return receiver, true
+		}
+
+		first, size := utf8.DecodeRuneInString(receiver)
+		return string(unicode.ToUpper(first)) + strings.ToLower(receiver[size:]), true
+
+	case `swapcase`:
+		return strings.Map(func(r rune) rune {
+			if unicode.IsUpper(r) {
+				return unicode.ToLower(r)
+			}
+
+			return unicode.ToUpper(r)
+		}, receiver), true
+
+	case `strip`:
+		return strings.Trim(receiver, rubyWhitespace+"\x00"), true
+	case `lstrip`:
+		return strings.TrimLeft(receiver, rubyWhitespace+"\x00"), true
+	case `rstrip`:
+		return strings.TrimRight(receiver, rubyWhitespace+"\x00"), true
+
+	case `chomp`:
+		self.arity(c, 0, 1)
+
+		if len(c.args) == 1 {
+			return strings.TrimSuffix(receiver, self.stringArg(c, 0)), true
+		} else if strings.HasSuffix(receiver, "\r\n") {
+			return receiver[:len(receiver)-2], true
+		}
+
+		return strings.TrimSuffix(strings.TrimSuffix(receiver, "\n"), "\r"), true
+
+	case `chop`:
+		if strings.HasSuffix(receiver, "\r\n") {
+			return receiver[:len(receiver)-2], true
+		} else if receiver == `` {
+			return receiver, true
+		}
+
+		_, size := utf8.DecodeLastRuneInString(receiver)
+		return receiver[:len(receiver)-size], true
+
+	case `chr`:
+		if receiver == `` {
+			return receiver, true
+		}
+
+		_, size := utf8.DecodeRuneInString(receiver)
+		return receiver[:size], true
+
+	case `ord`:
+		if receiver == `` {
+			self.fail(c.node, `Empty string`)
+		}
+
+		r, _ := utf8.DecodeRuneInString(receiver)
+		return newInt(int64(r)), true
+
+	case `reverse`:
+		runes := []rune(receiver)
+
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+
+		return string(runes), true
+
+	case `include?`:
+		self.arity(c, 1, 1)
+
+		if _, ok := c.args[0].(string); !ok {
+			self.fail(c.node, "No implicit conversion of %s into String", className(c.args[0]))
+		}
+
+		return strings.Contains(receiver, c.args[0].(string)), true
+
+	case `start_with?`:
+		for _, arg := range c.args {
+			if rx, ok := arg.(Regexp); ok {
+				if loc := self.compileRegexp(c, rx).FindStringIndex(receiver); loc != nil && loc[0] == 0 {
+					return true, true
+				}
+			} else if strings.HasPrefix(receiver, rubyString(arg)) {
+				return true, true
+			}
+		}
+
+		return false, true
+
+	case `end_with?`:
+		for i := range c.args {
+			if strings.HasSuffix(receiver, self.stringArg(c, i)) {
+				return true, true
+			}
+		}
+
+		return false, true
+
+	case `delete_prefix`:
+		self.arity(c, 1, 1)
+		return strings.TrimPrefix(receiver, self.stringArg(c, 0)), true
+	case `delete_suffix`:
+		self.arity(c, 1, 1)
+		return strings.TrimSuffix(receiver, self.stringArg(c, 0)), true
+
+	case `index`, `rindex`:
+		self.arity(c, 1, 1)
+
+		var at int
+
+		if rx, ok := c.args[0].(Regexp); ok {
+			matches := self.compileRegexp(c, rx).FindAllStringIndex(receiver, self.matchLimit(c.node, receiver))
+			self.step(c.node, len(matches))
+
+			if len(matches) == 0 {
+				return nil, true
+			} else if c.name == `index` {
+				at = matches[0][0]
+			} else {
+				at = matches[len(matches)-1][0]
+			}
+		} else if c.name == `index` {
+			at = strings.Index(receiver, self.stringArg(c, 0))
+		} else {
+			at = strings.LastIndex(receiver, self.stringArg(c, 0))
+		}
+
+		if at < 0 {
+			return nil, true
+		}
+
+		return newInt(int64(utf8.RuneCountInString(receiver[:at]))), true
+
+	case `casecmp`:
+		self.arity(c, 1, 1)
+		return newInt(int64(strings.Compare(strings.ToLower(receiver), strings.ToLower(self.stringArg(c, 0))))), true
+	case `casecmp?`:
+		self.arity(c, 1, 1)
+		return strings.EqualFold(receiver, self.stringArg(c, 0)), true
+
+	case `center`, `ljust`, `rjust`:
+		self.arity(c, 1, 2)
+
+		width := self.intArg(c, 0)
+		pad := ` `
+
+		if len(c.args) == 2 {
+			if pad = self.stringArg(c, 1); pad == `` {
+				self.fail(c.node, `Zero width padding`)
+			}
+		}
+
+		self.step(c.node, width/8)
+		return justify(receiver, width, []rune(pad), c.name), true
+
+	case `split`:
+		return self.split(c, receiver), true
+
+	case `lines`, `each_line`:
+		lines := make([]interface{}, 0)
+
+		for rest := receiver; rest != ``; {
+			i := strings.IndexByte(rest, '\n') + 1
+
+			if i == 0 {
+				i = len(rest)
+			}
+
+			lines = append(lines, rest[:i])
+			rest = rest[i:]
+		}
+
+		return self.each(c, receiver, lines), true
+
+	case `chars`, `each_char`:
+		chars := make([]interface{}, 0, len(receiver))
+
+		for _, r := range receiver {
+			chars = append(chars, string(r))
+		}
+
+		return self.each(c, receiver, chars), true
+
+	case `bytes`, `each_byte`:
+		bytes := make([]interface{}, len(receiver))
+
+		for i := 0; i < len(receiver); i++ {
+			bytes[i] = newInt(int64(receiver[i]))
+		}
+
+		return self.each(c, receiver, bytes), true
+
+	case `sub`, `gsub`:
+		return self.substitute(c, receiver), true
+
+	case `scan`:
+		self.arity(c, 1, 1)
+
+		rx := self.pattern(c, c.args[0])
+		matches := make([]interface{}, 0)
+
+		for _, match := range rx.FindAllStringSubmatchIndex(receiver, self.matchLimit(c.node, receiver)) {
+			self.step(c.node, 1)
+
+			if len(match) == 2 {
+				matches = append(matches, receiver[match[0]:match[1]])
+				continue
+			}
+
+			groups := make([]interface{}, 0, len(match)/2-1)
+
+			for i := 2; i < len(match); i += 2 {
+				if match[i] < 0 {
+					groups = append(groups, nil)
+				} else {
+					groups = append(groups, receiver[match[i]:match[i+1]])
+				}
+			}
+
+			matches = append(matches, groups)
+		}
+
+		return self.each(c, receiver, matches), true
+
+	case `tr`, `tr_s`:
+		self.arity(c, 2, 2)
+		return translate(receiver, self.stringArg(c, 0), self.stringArg(c, 1), c.name == `tr_s`), true
+
+	case `delete`:
+		self.arity(c, 1, 1)
+
+		set := newCharset(self.stringArg(c, 0))
+
+		return strings.Map(func(r rune) rune {
+			if set.includes(r) {
+				return -1
+			}
+
+			return r
+		}, receiver), true
+
+	case `squeeze`:
+		self.arity(c, 0, 1)
+
+		var set *charset
+
+		if len(c.args) == 1 {
+			set = newCharset(self.stringArg(c, 0))
+		}
+
+		var out strings.Builder
+		last := rune(-1)
+
+		for _, r := range receiver {
+			if r != last || (set != nil && !set.includes(r)) {
+				out.WriteRune(r)
+			}
+
+			last = r
+		}
+
+		return out.String(), true
+
+	case `count`:
+		self.arity(c, 1, 1)
+
+		set := newCharset(self.stringArg(c, 0))
+		count := 0
+
+		for _, r := range receiver {
+			if set.includes(r) {
+				count++
+			}
+		}
+
+		return newInt(int64(count)), true
+
+	case `succ`, `next`:
+		return successor(receiver), true
+
+	case `encoding`:
+		return `UTF-8`, true
+	case `force_encoding`, `encode`, `unicode_normalize`, `scrub`:
+		return receiver, true
+	}
+
+	return nil, false
+}
+
+// the methods of symbols, most of which are those of their names
+func (self *evalState) symbolMethod(c *evalCall, receiver Symbol) (interface{}, bool) {
+	call := *c
+	call.receiver = string(receiver)
+
+	switch c.name {
+	case `to_sym`:
+		return receiver, true
+	case `to_s`, `id2name`, `name`:
+		return string(receiver), true
+
+	case `length`, `size`, `empty?`, `start_with?`, `end_with?`, `[]`, `slice`, `=~`, `match?`, `encoding`:
+		return self.stringMethod(&call, string(receiver))
+
+	case `upcase`, `downcase`, `capitalize`, `swapcase`, `succ`, `next`:
+		value, ok := self.stringMethod(&call, string(receiver))
+		return Symbol(value.(string)), ok
+	}
+
+	return nil, false
+}
+
+func (self *evalState) regexpMethod(c *evalCall, receiver Regexp) (interface{}, bool) {
+	switch c.name {
+	case `source`:
+		return receiver.Source, true
+
+	case `options`:
+		var options int64
+
+		for flag, bit := range map[string]int64{`i`: 1, `x`: 2, `m`: 4} {
+			if strings.Contains(receiver.Flags, flag) {
+				options |= bit
+			}
+		}
+
+		return newInt(options), true
+
+	case `casefold?`:
+		return strings.Contains(receiver.Flags, `i`), true
+
+	case `names`:
+		names := make([]interface{}, 0)
+
+		for _, name := range self.compileRegexp(c, receiver).SubexpNames() {
+			if name != `` {
+				names = append(names, name)
+			}
+		}
+
+		return names, true
+
+	case `match?`, `=~`, `===`:
+		self.arity(c, 1, 1)
+
+		var str string
+
+		switch v := c.args[0].(type) {
+		case string:
+			str = v
+		case Symbol:
+			str = string(v)
+		case nil:
+			if c.name == `=~` {
+				return nil, true
+			}
+
+			return false, true
+		default:
+			if c.name == `===` {
+				return false, true
+			}
+
+			self.fail(c.node, "No implicit conversion of %s into String", className(c.args[0]))
+		}
+
+		if c.name == `match?` {
+			return self.compileRegexp(c, receiver).MatchString(str), true
+		}
+
+		loc := self.compileRegexp(c, receiver).FindStringSubmatchIndex(str)
+		self.setMatch(str, loc)
+
+		if c.name != `=~` {
+			return loc != nil, true
+		} else if loc == nil {
+			return nil, true
+		}
+
+		return newInt(int64(utf8.RuneCountInString(str[:loc[0]]))), true
+	}
+
+	return nil, false
+}
+
+// records the groups of a match, which $1, $2 and so on then refer to
+func (self *evalState) setMatch(str string, match []int) {
+	if match == nil {
+		self.match = nil
+		return
+	}
+
+	self.match = make([]interface{}, len(match)/2)
+
+	for i := range self.match {
+		if match[2*i] >= 0 {
+			self.match[i] = str[match[2*i]:match[2*i+1]]
+		}
+	}
+}
+
+// returns the group of the last match that a variable such as $1 refers to
+func (self *evalState) matchGroup(name string) (interface{}, bool) {
+	n, err := strconv.Atoi(strings.TrimPrefix(name, `$`))
+
+	if err != nil || n < 1 || !strings.HasPrefix(name, `$`) {
+		return nil, false
+	} else if n < len(self.match) {
+		return self.match[n], true
+	}
+
+	return nil, true
+}
+
+// returns the regular expression a pattern argument (a Regexp or a string to be matched
+// literally) stands for
+func (self *evalState) pattern(c *evalCall, value interface{}) *regexp.Regexp {
+	switch v := value.(type) {
+	case Regexp:
+		return self.compileRegexp(c, v)
+	case string:
+		return regexp.MustCompile(regexp.QuoteMeta(v))
+	}
+
+	self.fail(c.node, "Wrong argument type %s (expected Regexp)", className(value))
+	return nil
+}
+
+// compiles a Ruby regular expression as a Go one, in which ^ and $ match at line
+// boundaries as they always do in Ruby; extended (x) patterns have their whitespace and
+// comments removed, and \h and named groups are rewritten as Go expects them
+func (self *evalState) compileRegexp(c *evalCall, rx Regexp) *regexp.Regexp {
+	flags := `m`
+	extended := false
+
+	for _, flag := range rx.Flags {
+		switch flag {
+		case 'i':
+			flags += `i`
+		case 'm':
+			flags += `s`
+		case 'x':
+			extended = true
+		case 'n', 'e', 's', 'u', 'o':
+			// encodings and interpolation have no bearing on the pattern
+		default:
+			self.fail(c.node, "Unknown regular expression flag '%c'", flag)
+		}
+	}
+
+	self.step(c.node, len(rx.Source)/16)
+
+	var pattern strings.Builder
+	source := rx.Source
+	inClass := false
+
+	for i := 0; i < len(source); i++ {
+		switch ch := source[i]; {
+		case ch == '\\' && i+1 < len(source):
+			switch next := source[i+1]; next {
+			case 'h', 'H':
+				class := `0-9a-fA-F`
+
+				if next == 'H' {
+					class = `^` + class
+				}
+
+				if inClass {
+					pattern.WriteString(class)
+				} else {
+					pattern.WriteString(`[` + class + `]`)
+				}
+			case ' ':
+				pattern.WriteByte(' ')
+			default:
+				pattern.WriteString(source[i : i+2])
+			}
+
+			i++
+
+		case inClass:
+			if ch == ']' {
+				inClass = false
+			}
+
+			pattern.WriteByte(ch)
+
+		case ch == '[':
+			inClass = true
+			pattern.WriteByte(ch)
+
+			// a ] first in a class is one of its characters
+			if strings.HasPrefix(source[i+1:], `]`) || strings.HasPrefix(source[i+1:], `^]`) {
+				n := strings.IndexByte(source[i+1:], ']') + 1
+				pattern.WriteString(source[i+1 : i+1+n])
+				i += n
+			}
+
+		case extended && strings.IndexByte(rubyWhitespace, ch) >= 0:
+			// whitespace is ignored in extended patterns
+
+		case extended && ch == '#':
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+
+		case ch == '(' && rxInlineFlags.MatchString(source[i:]):
+			// Ruby's m is Go's s, and Go has no x (which is ignored in a group)
+			flags := rxInlineFlags.FindStringSubmatch(source[i:])
+			on := strings.NewReplacer(`m`, `s`, `x`, ``).Replace(flags[1])
+			off := strings.NewReplacer(`m`, `s`, `x`, ``).Replace(flags[2])
+
+			if off != `` {
+				on += `-` + off
+			}
+
+			pattern.WriteString(`(?` + on + flags[3])
+			i += len(flags[0]) - 1
+
+		case ch == '(' && strings.HasPrefix(source[i:], `(?<`) && !strings.HasPrefix(source[i:], `(?<=`) && !strings.HasPrefix(source[i:], `(?<!`):
+			pattern.WriteString(`(?P<`)
+			i += 2
+
+		default:
+			pattern.WriteByte(ch)
+		}
+	}
+
+	compiled, err := regexp.Compile(`(?` + flags + `)` + pattern.String())
+
+	if err != nil {
+		self.fail(c.node, "Cannot evaluate regular expression %s: %v", rubyInspect(rx), err)
+	}
+
+	return compiled
+}
+
+// returns the source of a regular expression as a group that keeps its options when
+// embedded in another, as Regexp#to_s does
+func embedRegexp(rx Regexp) string {
+	var on, off string
+
+	for _, flag := range `mix` {
+		if strings.ContainsRune(rx.Flags, flag) {
+			on += string(flag)
+		} else {
+			off += string(flag)
+		}
+	}
+
+	if off != `` {
+		off = `-` + off
+	}
+
+	return `(?` + on + off + `:` + rx.Source + `)`
+}
+
+// returns a string with its regular expression metacharacters escaped, as Regexp.escape
+// does
+func escapeRegexp(str string) string {
+	var out strings.Builder
+
+	for _, r := range str {
+		switch r {
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\r':
+			out.WriteString(`\r`)
+		case '\f':
+			out.WriteString(`\f`)
+		case '\v':
+			out.WriteString(`\v`)
+		case ' ':
+			out.WriteString(`\ `)
+		default:
+			if strings.ContainsRune(`[]{}()|-*.\?+^$#`, r) {
+				out.WriteByte('\\')
+			}
+
+			out.WriteRune(r)
+		}
+	}
+
+	return out.String()
+}
+
+// returns the start and length of the part of a string or array that the arguments to []
+// (an index, a start and length, or a range) refer to, reporting false if it is out of
+// bounds; single is true for a lone index, which refers to one element
+func (self *evalState) sliceArgs(c *evalCall, size int) (start int, length int, single bool, ok bool) {
+	if rng, isRange := c.args[0].(Range); isRange && len(c.args) == 1 {
+		end := size - 1
+
+		if rng.Begin != nil {
+			start = self.rangeBound(c, rng.Begin)
+		}
+
+		if rng.End != nil {
+			end = self.rangeBound(c, rng.End)
+
+			if end < 0 {
+				end += size
+			}
+
+			if rng.Exclusive {
+				end--
+			}
+		}
+
+		if start < 0 {
+			start += size
+		}
+
+		if start < 0 || start > size {
+			return 0, 0, false, false
+		}
+
+		length = end - start + 1
+	} else {
+		start = self.intArg(c, 0)
+
+		if start < 0 {
+			start += size
+		}
+
+		if len(c.args) == 1 {
+			return start, 1, true, start >= 0 && start < size
+		} else if length = self.intArg(c, 1); length < 0 || start < 0 || start > size {
+			return 0, 0, false, false
+		}
+	}
+
+	if length < 0 {
+		length = 0
+	} else if start+length > size {
+		length = size - start
+	}
+
+	return start, length, false, true
+}
+
+// returns an integer at either end of a range used as an index
+func (self *evalState) rangeBound(c *evalCall, value interface{}) int {
+	n, ok := smallInt(value)
+
+	if !ok {
+		self.fail(c.node, "No implicit conversion of %s into Integer for '%s'", className(value), c.name)
+	}
+
+	return n
+}
+
+// returns the integer at the start of a string in the given base, or 0, as String#to_i
+// does
+func leadingInteger(str string, base int) *big.Int {
+	str = strings.TrimLeft(str, rubyWhitespace)
+	sign := ``
+
+	if strings.HasPrefix(str, `-`) || strings.HasPrefix(str, `+`) {
+		sign, str = str[:1], str[1:]
+	}
+
+	prefixes := map[int]string{2: `0b`, 8: `0o`, 16: `0x`}
+
+	if prefix, ok := prefixes[base]; ok && len(str) > 2 && strings.EqualFold(str[:2], prefix) {
+		str = str[2:]
+	}
+
+	var digits strings.Builder
+
+	for i, r := range str {
+		if r == '_' && i > 0 && i+1 < len(str) && str[i-1] != '_' {
+			continue
+		} else if d := digitValue(r); d < 0 || d >= base {
+			break
+		}
+
+		digits.WriteRune(r)
+	}
+
+	if n, ok := new(big.Int).SetString(sign+digits.String(), base); ok {
+		return n
+	}
+
+	return newInt(0)
+}
+
+// returns the value of a digit in bases of up to 36, or -1
+func digitValue(r rune) int {
+	switch {
+	case r >= '0' && r <= '9':
+		return int(r - '0')
+	case r >= 'a' && r <= 'z':
+		return int(r-'a') + 10
+	case r >= 'A' && r <= 'Z':
+		return int(r-'A') + 10
+	}
+
+	return -1
+}
+
+// pads a string to the given width in characters, as center, ljust and rjust do
+func justify(str string, width int, pad []rune, method string) string {
+	n := width - utf8.RuneCountInString(str)
+
+	if n <= 0 {
+		return str
+	}
+
+	padding := func(n int) string {
+		runes := make([]rune, n)
+
+		for i := range runes {
+			runes[i] = pad[i%len(pad)]
+		}
+
+		return string(runes)
+	}
+
+	switch method {
+	case `ljust`:
+		return str + padding(n)
+	case `rjust`:
+		return padding(n) + str
+	}
+
+	return padding(n/2) + str + padding(n-n/2)
+}
+
+// charges for searching a string, returning the most matches the budget then allows
+// for (as each is charged a step), for finding all matches of a regular expression
+func (self *evalState) matchLimit(node ast.Node, str string) int {
+	self.step(node, len(str)/8)
+	return self.budget - self.steps + 1
+}
+
+// splits a string as String#split does: on whitespace by default, dropping trailing
+// empty strings unless a negative limit is given
+func (self *evalState) split(c *evalCall, str string) []interface{} {
+	self.arity(c, 0, 2)
+
+	limit := 0
+
+	if len(c.args) == 2 {
+		limit = self.intArg(c, 1)
+	}
+
+	var parts []string
+	n := self.matchLimit(c.node, str)
+
+	if limit > 0 && limit < n {
+		n = limit
+	}
+
+	switch {
+	case len(c.args) == 0 || c.args[0] == nil || c.args[0] == ` `:
+		str = strings.TrimLeft(str, rubyWhitespace)
+
+		if str != `` {
+			parts = regexp.MustCompile(`[`+rubyWhitespace+`]+`).Split(str, n)
+		}
+
+	case c.args[0] == ``:
+		for i, r := range str {
+			if len(parts) == n-1 {
+				parts = append(parts, str[i:])
+				break
+			}
+
+			parts = append(parts, string(r))
+		}
+
+	default:
+		if str != `` {
+			parts = splitRegexp(self.pattern(c, c.args[0]), str, n)
+		}
+	}
+
+	if limit == 0 {
+		for len(parts) > 0 && parts[len(parts)-1] == `` {
+			parts = parts[:len(parts)-1]
+		}
+	}
+
+	self.step(c.node, len(parts))
+	values := make([]interface{}, len(parts))
+
+	for i, part := range parts {
+		values[i] = part
+	}
+
+	return values
+}
+
+// splits a string around at most n-1 matches of a regular expression, as Regexp.Split
+// does, but also returning what the groups of each match captured, as Ruby does
+func splitRegexp(rx *regexp.Regexp, str string, n int) []string {
+	parts := make([]string, 0)
+	begin, end, splits := 0, 0, 0
+
+	for _, match := range rx.FindAllStringSubmatchIndex(str, n) {
+		if n > 0 && splits == n-1 {
+			break
+		}
+
+		// an empty match at the start splits nothing off
+		if match[1] == 0 {
+			continue
+		}
+
+		end = match[0]
+		parts = append(parts, str[begin:end])
+
+		for i := 2; i < len(match); i += 2 {
+			if match[i] >= 0 {
+				parts = append(parts, str[match[i]:match[i+1]])
+			}
+		}
+
+		begin = match[1]
+		splits++
+	}
+
+	if end != len(str) {
+		parts = append(parts, str[begin:])
+	}
+
+	return parts
+}
+
+// replaces the first match of a pattern (or, for gsub, every match) with a string in which
+// \1, \k<name> and so on refer to the match, the value of a hash for the text matched, or
+// the value of a block given it
+func (self *evalState) substitute(c *evalCall, str string) string {
+	if c.block != nil {
+		self.arity(c, 1, 1)
+	} else {
+		self.arity(c, 2, 2)
+	}
+
+	rx := self.pattern(c, c.args[0])
+	n := 1
+
+	if c.name == `gsub` {
+		n = self.matchLimit(c.node, str)
+	}
+
+	var out strings.Builder
+	last := 0
+
+	for _, match := range rx.FindAllStringSubmatchIndex(str, n) {
+		self.step(c.node, 1)
+		out.WriteString(str[last:match[0]])
+
+		matched := str[match[0]:match[1]]
+
+		switch {
+		case c.block != nil:
+			self.setMatch(str, match)
+			out.WriteString(rubyString(c.block([]interface{}{matched})))
+
+		default:
+			switch replacement := c.args[1].(type) {
+			case *evalHash:
+				value, _ := replacement.get(matched)
+				out.WriteString(rubyString(value))
+			case string:
+				out.WriteString(expandReplacement(replacement, rx, str, match))
+			default:
+				self.fail(c.node, "No implicit conversion of %s into String", className(replacement))
+			}
+		}
+
+		last = match[1]
+	}
+
+	out.WriteString(str[last:])
+	return out.String()
+}
+
+// expands the references to a match in a replacement string given to sub or gsub
+func expandReplacement(replacement string, rx *regexp.Regexp, str string, match []int) string {
+	var out strings.Builder
+
+	group := func(i int) string {
+		if i >= 0 && 2*i < len(match) && match[2*i] >= 0 {
+			return str[match[2*i]:match[2*i+1]]
+		}
+
+		return ``
+	}
+
+	for i := 0; i < len(replacement); i++ {
+		if replacement[i] != '\\' || i+1 == len(replacement) {
+			out.WriteByte(replacement[i])
+			continue
+		}
+
+		i++
+
+		switch ch := replacement[i]; {
+		case ch >= '0' && ch <= '9':
+			out.WriteString(group(int(ch - '0')))
+		case ch == '&':
+			out.WriteString(group(0))
+		case ch == '`':
+			out.WriteString(str[:match[0]])
+		case ch == '\'':
+			out.WriteString(str[match[1]:])
+		case ch == '\\':
+			out.WriteByte('\\')
+
+		case ch == 'k' && strings.HasPrefix(replacement[i+1:], `<`) && strings.Contains(replacement[i:], `>`):
+			end := strings.IndexByte(replacement[i:], '>')
+			out.WriteString(group(rx.SubexpIndex(replacement[i+2 : i+end])))
+			i += end
+
+		default:
+			out.WriteByte('\\')
+			out.WriteByte(ch)
+		}
+	}
+
+	return out.String()
+}
+
+// a set of characters, as given to tr, delete, squeeze and count: ranges such as a-z may
+// be given, and a leading ^ negates the set
+type charset struct {
+	runes   []rune
+	negated bool
+}
+
+func newCharset(spec string) *charset {
+	set := &charset{}
+	runes := []rune(spec)
+
+	if len(runes) > 1 && runes[0] == '^' {
+		set.negated = true
+		runes = runes[1:]
+	}
+
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\\' && i+1 < len(runes):
+			i++
+			set.runes = append(set.runes, runes[i])
+
+		case i+2 < len(runes) && runes[i+1] == '-':
+			for r := runes[i]; r <= runes[i+2]; r++ {
+				set.runes = append(set.runes, r)
+			}
+
+			i += 2
+
+		default:
+			set.runes = append(set.runes, runes[i])
+		}
+	}
+
+	return set
+}
+
+// returns the position of a character in the set, or -1
+func (self *charset) index(r rune) int {
+	for i, member := range self.runes {
+		if member == r {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (self *charset) includes(r rune) bool {
+	return (self.index(r) >= 0) != self.negated
+}
+
+// replaces the characters of one set with those at the same positions of another, as tr
+// does; tr_s also collapses runs of the same replacement
+func translate(str string, from string, to string, squeeze bool) string {
+	source := newCharset(from)
+	target := newCharset(to).runes
+
+	var out strings.Builder
+	last := rune(-1)
+
+	for _, r := range str {
+		if !source.includes(r) {
+			out.WriteRune(r)
+			last = -1
+			continue
+		} else if len(target) == 0 {
+			continue
+		}
+
+		replacement := target[len(target)-1]
+
+		if i := source.index(r); !source.negated && i < len(target) {
+			replacement = target[i]
+		}
+
+		if !squeeze || replacement != last {
+			out.WriteRune(replacement)
+		}
+
+		last = replacement
+	}
+
+	return out.String()
+}
+
+// returns the string that follows another, as String#succ does: the rightmost letter or
+// digit is incremented, carrying into the letters and digits to its left (skipping
+// anything else), or the rightmost character if there are none
+func successor(str string) string {
+	runes := []rune(str)
+	carried := -1
+
+	for i := len(runes) - 1; i >= 0; i-- {
+		switch r := runes[i]; {
+		case r == 'z' || r == 'Z' || r == '9':
+			runes[i] = map[rune]rune{'z': 'a', 'Z': 'A', '9': '0'}[r]
+			carried = i
+
+		case r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9':
+			runes[i]++
+			return string(runes)
+		}
+	}
+
+	// add a letter or digit for a carry out of the leftmost
+	if carried >= 0 {
+		carry := map[rune]rune{'a': 'a', 'A': 'A', '0': '1'}[runes[carried]]
+		return string(runes[:carried]) + string(carry) + string(runes[carried:])
+	}
+
+	if len(runes) > 0 {
+		runes[len(runes)-1]++
+	}
+
+	return string(runes)
+}
+
+// the widest field (and greatest precision) that Go's fmt writes
+const maxFormatWidth = 1000000
+
+// formats values as Kernel#format and String#% do, using the directives of Ruby (which
+// are mostly those of Go's fmt), including references to hash values as %<name>s or
+// %{name}
+func (self *evalState) format(c *evalCall, spec string, args []interface{}) string {
+	var out strings.Builder
+	next := 0
+
+	arg := func() interface{} {
+		if next >= len(args) {
+			self.fail(c.node, `Too few arguments for format`)
+		}
+
+		next++
+		return args[next-1]
+	}
+
+	named := func(name string) interface{} {
+		var hash *evalHash
+
+		if len(args) == 1 {
+			hash, _ = args[0].(*evalHash)
+		}
+
+		if hash == nil {
+			self.fail(c.node, `One hash required for named references in format`)
+		}
+
+		value, ok := hash.get(Symbol(name))
+
+		if !ok {
+			self.fail(c.node, "Key<%s> not found", name)
+		}
+
+		return value
+	}
+
+	for i := 0; i < len(spec); i++ {
+		if spec[i] != '%' {
+			out.WriteByte(spec[i])
+			continue
+		} else if i+1 == len(spec) {
+			self.fail(c.node, `Incomplete format specifier; use %%%% (double %%) instead`)
+		}
+
+		var flags, width, precision string
+		var value interface{}
+		var verb byte
+		hasValue := false
+		j := i + 1
+
+		readFlags := func() {
+			for j < len(spec) && strings.IndexByte(`-+ 0#`, spec[j]) >= 0 {
+				flags += spec[j : j+1]
+				j++
+			}
+		}
+
+		readNumber := func() string {
+			if j < len(spec) && spec[j] == '*' {
+				j++
+				n, ok := smallInt(arg())
+
+				if !ok {
+					self.fail(c.node, `Width or precision given with * must be an integer`)
+				}
+
+				return strconv.Itoa(n)
+			}
+
+			start := j
+
+			for j < len(spec) && spec[j] >= '0' && spec[j] <= '9' {
+				j++
+			}
+
+			return spec[start:j]
+		}
+
+		readFlags()
+		width = readNumber()
+
+		if j < len(spec) && (spec[j] == '<' || spec[j] == '{') {
+			end := strings.IndexByte(spec[j:], map[byte]byte{'<': '>', '{': '}'}[spec[j]])
+
+			if end < 0 {
+				self.fail(c.node, "Malformed name in format: %s", spec[i:])
+			}
+
+			value, hasValue = named(spec[j+1:j+end]), true
+
+			// %{name} is replaced by the value as it is, with no directive following
+			if spec[j] == '{' {
+				verb = 's'
+				j += end
+			} else {
+				j += end + 1
+			}
+		}
+
+		if verb == 0 {
+			readFlags()
+
+			if width == `` {
+				width = readNumber()
+			}
+
+			if j < len(spec) && spec[j] == '.' {
+				j++
+
+				if precision = readNumber(); precision == `` {
+					precision = `0`
+				}
+			}
+
+			if j == len(spec) {
+				self.fail(c.node, `Malformed format string - %s`, spec[i:])
+			}
+
+			verb = spec[j]
+		}
+
+		i = j
+
+		if verb == '%' {
+			out.WriteByte('%')
+			continue
+		} else if !hasValue {
+			value = arg()
+		}
+
+		// a negative width given with * left-justifies, and a negative precision is ignored
+		if strings.HasPrefix(width, `-`) {
+			flags, width = flags+`-`, width[1:]
+		}
+
+		if strings.HasPrefix(precision, `-`) {
+			precision = ``
+		}
+
+		widthN := self.formatNumber(c, width, `Width`)
+		precisionN := self.formatNumber(c, precision, `Precision`)
+
+		self.step(c.node, (widthN+precisionN)/64)
+
+		directive := `%` + flags + width
+
+		if precision != `` {
+			directive += `.` + precision
+		}
+
+		switch verb {
+		case 'd', 'i', 'u', 'x', 'X', 'o', 'b', 'B':
+			var n *big.Int
+
+			switch v := value.(type) {
+			case string:
+				parsed, ok := parseInteger(v, 0)
+
+				if !ok {
+					self.fail(c.node, "Invalid value for Integer(): %s", inspectString(v))
+				}
+
+				n = parsed
+			default:
+				n = self.toInteger(c, value)
+			}
+
+			// Ruby writes negative numbers in these bases as their two's complement
+			if n.Sign() < 0 && strings.IndexByte(`xXobB`, verb) >= 0 && !strings.ContainsAny(flags, `+ `) {
+				out.WriteString(formatComplement(n, verb, flags, widthN, precision != ``, precisionN))
+				continue
+			}
+
+			switch verb {
+			case 'i', 'u':
+				verb = 'd'
+			case 'B':
+				out.WriteString(strings.Replace(fmt.Sprintf(directive+`b`, n), `0b`, `0B`, 1))
+				continue
+			}
+
+			fmt.Fprintf(&out, directive+string(verb), n)
+
+		case 'f', 'e', 'E', 'g', 'G', 'a', 'A':
+			var f float64
+
+			switch v := value.(type) {
+			case string:
+				parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+
+				if err != nil {
+					self.fail(c.node, "Invalid value for Float(): %s", inspectString(v))
+				}
+
+				f = parsed
+			default:
+				if numericKind(value) == notNumeric {
+					self.fail(c.node, "Cannot convert %s into Float", className(value))
+				}
+
+				f = toFloat(value)
+			}
+
+			switch verb {
+			case 'a':
+				verb = 'x'
+			case 'A':
+				verb = 'X'
+			}
+
+			formatted := fmt.Sprintf(directive+string(verb), f)
+
+			// Ruby writes infinity without a sign unless asked for one
+			if math.IsInf(f, 1) && !strings.Contains(flags, `+`) {
+				formatted = strings.Replace(formatted, `+Inf`, `Inf`, 1)
+			}
+
+			out.WriteString(formatted)
+
+		case 's', 'p':
+			str := rubyString(value)
+
+			if verb == 'p' {
+				str = rubyInspect(value)
+			}
+
+			fmt.Fprintf(&out, strings.Replace(directive, `0`, ``, -1)+`s`, str)
+
+		case 'c':
+			var str string
+
+			if n, ok := value.(*big.Int); ok {
+				if !n.IsInt64() || n.Int64() < 0 || n.Int64() > utf8.MaxRune || !utf8.ValidRune(rune(n.Int64())) {
+					self.fail(c.node, "%s out of char range", n.String())
+				}
+
+				str = string(rune(n.Int64()))
+			} else if s := rubyString(value); s != `` {
+				r, _ := utf8.DecodeRuneInString(s)
+				str = string(r)
+			}
+
+			fmt.Fprintf(&out, `%`+strings.Replace(flags, `0`, ``, -1)+width+`s`, str)
+
+		default:
+			self.fail(c.node, "Malformed format string - %%%c", verb)
+		}
+	}
+
+	return out.String()
+}
+
+// reads the width or precision of a format directive, which may be empty
+func (self *evalState) formatNumber(c *evalCall, digits string, name string) int {
+	if digits == `` {
+		return 0
+	}
+
+	n, err := strconv.Atoi(digits)
+
+	if err != nil || n > maxFormatWidth {
+		self.fail(c.node, "%s too big", name)
+	}
+
+	return n
+}
+
+// writes a negative integer in hexadecimal, octal or binary as Ruby does: as its two's
+// complement, with the infinitely repeated leading digit written as "..", e.g. ..f01
+func formatComplement(n *big.Int, verb byte, flags string, width int, hasPrecision bool, precision int) string {
+	base := map[byte]int{'x': 16, 'X': 16, 'o': 8, 'b': 2, 'B': 2}[verb]
+	size := len(new(big.Int).Neg(n).Text(base)) + 1
+
+	// n modulo a power of the base great enough to leave its leading digit the greatest
+	complement := new(big.Int).Exp(big.NewInt(int64(base)), big.NewInt(int64(size)), nil)
+	digits := complement.Add(complement, n).Text(base)
+	fill := strconv.FormatInt(int64(base-1), base)
+
+	for len(digits) > 1 && digits[:1] == fill && digits[1:2] == fill {
+		digits = digits[1:]
+	}
+
+	var prefix string
+
+	if strings.Contains(flags, `#`) {
+		prefix = map[byte]string{'x': `0x`, 'X': `0X`, 'o': `0`, 'b': `0b`, 'B': `0B`}[verb]
+	}
+
+	// the precision, or the width when padding with zeroes, includes the ..
+	minimum := precision
+
+	if !hasPrecision && strings.Contains(flags, `0`) && !strings.Contains(flags, `-`) {
+		minimum = width - len(prefix)
+	}
+
+	if pad := minimum - len(digits) - 2; pad > 0 {
+		digits = strings.Repeat(fill, pad) + digits
+	}
+
+	str := prefix + `..` + digits
+
+	if verb == 'X' {
+		str = strings.ToUpper(str)
+	}
+
+	if pad := width - len(str); pad > 0 {
+		if strings.Contains(flags, `-`) {
+			return str + strings.Repeat(` `, pad)
+		}
+
+		return strings.Repeat(` `, pad) + str
+	}
+
+	return str
+}
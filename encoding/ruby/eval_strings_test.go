@@ -0,0 +1,193 @@
+package ruby
+
+import (
+	"testing"
+)
+
+func TestEvalString(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`'ab' + 'cd'`, `"abcd"`},
+		{`'ab' * 3`, `"ababab"`},
+		{`'hello'[1]`, `"e"`},
+		{`'hello'[-3, 2]`, `"ll"`},
+		{`'hello'[1..3]`, `"ell"`},
+		{`'hello'[1..]`, `"ello"`},
+		{`'hello'[5]`, `nil`},
+		{`'hello'[5, 2]`, `""`},
+		{`'hello'[6, 2]`, `nil`},
+		{`'hello'['ll']`, `"ll"`},
+		{`'hello'['z']`, `nil`},
+		{`'key=val'[/(\w+)=(\w+)/, 2]`, `"val"`},
+		{`'key=val'[/\d/]`, `nil`},
+		{`'hello' =~ /ll/`, `2`},
+		{`'héllo' =~ /l/`, `2`},
+		{`'hello' =~ /z/`, `nil`},
+		{`'hello'.match?(/l+/)`, `true`},
+		{`('2024-05' =~ /(\d+)-(\d+)/) && $2`, `"05"`},
+		{`'héllo'.size`, `5`},
+		{`'héllo'.bytesize`, `6`},
+		{`'héllo'.ascii_only?`, `false`},
+		{`''.empty?`, `true`},
+		{`'hello world'.capitalize`, `"Hello world"`},
+		{`'Hello'.swapcase`, `"hELLO"`},
+		{`'Hello'.upcase`, `"HELLO"`},
+		{`" \tx \n".strip`, `"x"`},
+		{`'  x '.lstrip`, `"x "`},
+		{`'  x '.rstrip`, `"  x"`},
+		{`"line\r\n".chomp`, `"line"`},
+		{`"line\n\n".chomp`, `"line\n"`},
+		{`'file.rb'.chomp('.rb')`, `"file"`},
+		{`'abc'.chop`, `"ab"`},
+		{`'héllo'.reverse`, `"olléh"`},
+		{`'abc'.ord`, `97`},
+		{`'abc'.chr`, `"a"`},
+		{`'hello'.include?('ell')`, `true`},
+		{`'hello'.start_with?('x', 'he')`, `true`},
+		{`'hello'.start_with?(/h.l/)`, `true`},
+		{`'hello'.end_with?('lo')`, `true`},
+		{`'v1.2'.delete_prefix('v')`, `"1.2"`},
+		{`'app.rb'.delete_suffix('.rb')`, `"app"`},
+		{`'hello'.index('l')`, `2`},
+		{`'hello'.rindex('l')`, `3`},
+		{`'hello'.index(/l+/)`, `2`},
+		{`'hello'.index('z')`, `nil`},
+		{`'abc'.casecmp('ABD')`, `-1`},
+		{`'abc'.casecmp?('ABC')`, `true`},
+		{`'abc'.center(8, '*')`, `"**abc***"`},
+		{`'abc'.ljust(6, '12')`, `"abc121"`},
+		{`'abc'.rjust(5)`, `"  abc"`},
+		{`'abcdef'.rjust(3)`, `"abcdef"`},
+		{`"a\nb\n".lines`, `["a\n", "b\n"]`},
+		{`'héllo'.chars.first(2)`, `["h", "é"]`},
+		{`'ab'.bytes`, `[97, 98]`},
+		{`'hello'.count('lo')`, `3`},
+		{`'hello'.delete('l')`, `"heo"`},
+		{`'aaabbbccc'.squeeze`, `"abc"`},
+		{`'aaabbb'.squeeze('a')`, `"abbb"`},
+		{`'hello'.tr('el', 'ip')`, `"hippo"`},
+		{`'hello'.tr('a-y', 'b-z')`, `"ifmmp"`},
+		{`'hello'.tr('^l', '*')`, `"**ll*"`},
+		{`'aabbcc'.tr_s('ab', 'x')`, `"xcc"`},
+		{`'12abc'.to_i`, `12`},
+		{`' -3'.to_i`, `-3`},
+		{`'1_000'.to_i`, `1000`},
+		{`'abc'.to_i`, `0`},
+		{`'ff'.to_i(16)`, `255`},
+		{`'0x1A'.hex`, `26`},
+		{`'777'.oct`, `511`},
+		{`'1.5e3x'.to_f`, `1500.0`},
+		{`'0.75'.to_r`, `(3/4)`},
+		{`'1/3'.to_r`, `(1/3)`},
+		{`'hi'.to_sym`, `:hi`},
+		{`'hello world'.to_sym`, `:"hello world"`},
+	})
+}
+
+func TestEvalStringSplit(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`" a b  c\n".split`, `["a", "b", "c"]`},
+		{`' a b '.split(' ')`, `["a", "b"]`},
+		{`'a,b,,c,,'.split(',')`, `["a", "b", "", "c"]`},
+		{`'a,b,,c,,'.split(',', -1)`, `["a", "b", "", "c", "", ""]`},
+		{`'a,b,c'.split(',', 2)`, `["a", "b,c"]`},
+		{`'abc'.split('')`, `["a", "b", "c"]`},
+		{`'abc'.split(//)`, `["a", "b", "c"]`},
+		{`'abc'.split(//, 2)`, `["a", "bc"]`},
+		{`'a1b22c'.split(/\d+/)`, `["a", "b", "c"]`},
+		{`'a1b'.split(/(\d)/)`, `["a", "1", "b"]`},
+		{`'a-b_c'.split(/(-)|(_)/)`, `["a", "-", "b", "_", "c"]`},
+		{`''.split(',')`, `[]`},
+	})
+}
+
+func TestEvalStringSubstitute(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`'hello'.sub(/l/, 'L')`, `"heLlo"`},
+		{`'hello'.gsub('l', 'L')`, `"heLLo"`},
+		{`'a.b'.gsub('.', '-')`, `"a-b"`},
+		{`'a-b'.gsub(/(\w)/, '<\1>')`, `"<a>-<b>"`},
+		{`'a1'.sub(/(?<d>\d)/, '[\k<d>]')`, `"a[1]"`},
+		{`'ab'.gsub(/b/, '\0\0')`, `"abb"`},
+		{`'john smith'.gsub(/(\w+)/) { $1.capitalize }`, `"John Smith"`},
+		{`'cat'.gsub(/[aeiou]/, 'a' => '4')`, `"c4t"`},
+		{`'a1b22'.scan(/\d+/)`, `["1", "22"]`},
+		{`'k=v, x=y'.scan(/(\w)=(\w)/)`, `[["k", "v"], ["x", "y"]]`},
+	})
+}
+
+func TestEvalStringSucc(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`'a'.succ`, `"b"`},
+		{`'az'.succ`, `"ba"`},
+		{`'zz'.succ`, `"aaa"`},
+		{`'a9'.succ`, `"b0"`},
+		{`'Zz'.succ`, `"AAa"`},
+		{`'1.9'.succ`, `"2.0"`},
+		{`'a-9'.succ`, `"b-0"`},
+		{`'-9'.succ`, `"-10"`},
+		{`'***'.succ`, `"**+"`},
+		{`''.succ`, `""`},
+	})
+}
+
+func TestEvalFormat(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`'%05.1f' % 3.14159`, `"003.1"`},
+		{`'%-5s|' % 'ab'`, `"ab   |"`},
+		{`'%+d' % 5`, `"+5"`},
+		{`'%.3d' % 7`, `"007"`},
+		{`'%x' % 255`, `"ff"`},
+		{`'%X' % 255`, `"FF"`},
+		{`'%#x' % 255`, `"0xff"`},
+		{`'%o' % 8`, `"10"`},
+		{`'%08b' % 5`, `"00000101"`},
+		{`'%x' % -255`, `"..f01"`},
+		{`'%e' % 12345.678`, `"1.234568e+04"`},
+		{`'%g' % 1e10`, `"1e+10"`},
+		{`'%g' % 0.5`, `"0.5"`},
+		{`'%.2s' % 'abc'`, `"ab"`},
+		{`'%c%c' % [65, 'hello']`, `"Ah"`},
+		{`'%s and %p' % ['a', 'a']`, `"a and \"a\""`},
+		{`'%d%%' % 50`, `"50%"`},
+		{`'%<a>d-%<b>s' % {a: 1, b: 'x'}`, `"1-x"`},
+		{`'%{a}!' % {a: 'hi'}`, `"hi!"`},
+		{`format('%5.2f', 1)`, `" 1.00"`},
+	})
+}
+
+func TestEvalSymbol(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`:a.upcase`, `:A`},
+		{`:a.succ`, `:b`},
+		{`:abc.size`, `3`},
+		{`:abc[1]`, `"b"`},
+		{`:abc.start_with?('a')`, `true`},
+		{`:abc.to_s`, `"abc"`},
+		{`:"a b"`, `:"a b"`},
+	})
+}
+
+func TestEvalRegexp(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`/x/i.options`, `1`},
+		{`/x/i.casefold?`, `true`},
+		{`/a(?<n>b)/.names`, `["n"]`},
+		{`/(\d+)-(\d+)/.source`, `"(\\d+)-(\\d+)"`},
+		{`/b/ =~ 'abc'`, `1`},
+		{`/b/.match?('abc')`, `true`},
+		{`/z/ === 'abc'`, `false`},
+		{`/A/i.match?('a')`, `true`},
+		{`/a.c/m.match?("a\nc")`, `true`},
+		{`/^b/.match?("a\nb")`, `true`},
+		{`/\h+/.match?('ff')`, `true`},
+		{`/a # letter
+		  b/x.match?('ab')`, `true`},
+		{`/a/i.to_s`, `"(?i-mx:a)"`},
+		{`Regexp.escape('a.b*')`, `"a\\.b\\*"`},
+		{`Regexp.union('a', 'b.c')`, `/a|b\.c/`},
+		{`Regexp.union(/a/i, /b/)`, `/(?i-mx:a)|(?-mix:b)/`},
+		{`Regexp.union(/a/i, /b/).match?('A')`, `true`},
+		{`Regexp.union(/a/i, /b/).match?('B')`, `false`},
+		{`/x#{/a/i}/.match?('xA')`, `true`},
+	})
+}
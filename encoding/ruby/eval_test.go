@@ -0,0 +1,145 @@
+package ruby
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		Source   string
+		Expected interface{}
+	}{
+		{`60 * 60`, int64(3600)},
+		{`'a' + 'b'`, `ab`},
+		{`%w[a b].freeze`, []interface{}{`a`, `b`}},
+		{`[1, 2].map(&:to_s)`, []interface{}{`1`, `2`}},
+		{`File.join('a', 'b')`, `a/b`},
+		{"port = 8080\n\"localhost:#{port}\"", `localhost:8080`},
+		{"TIMEOUT = 30\n{timeout: TIMEOUT * 2}", map[string]interface{}{`timeout`: int64(60)}},
+		{"total = 0\n[1, 2, 3].each { |x| total += x }\ntotal", int64(6)},
+		{`(1..3).select(&:odd?).sum`, int64(4)},
+		{`'web-01'.sub(/-(\d+)/) { "_#{$1.to_i}" }`, `web_1`},
+		{`'%05.1f' % 3.14159`, `003.1`},
+		{`['%x' % -255, '%#X' % -255, '%o' % -123, '%b' % -11, '%08b' % -11, '%20.8x' % -11, '%+x' % -255]`, []interface{}{`..f01`, `0X..F01`, `..7605`, `..10101`, `..110101`, `            ..fffff5`, `-ff`}},
+		{`'%*d|%.*d' % [-4, 1, -1, 2]`, `1   |2`},
+		{`('a' * 10**5).split('', 10**5 - 1).last`, `aa`},
+		{`{'a' => 1}.transform_keys(&:to_sym)[:a]`, int64(1)},
+		{`nil.to_a.empty? ? 'none' : 'some'`, `none`},
+		{"a = []\nb = a + [1]\n[a, b]", []interface{}{[]interface{}{}, []interface{}{int64(1)}}},
+		{"h = {}\ng = h\ng[:a] = 1\nh", map[string]interface{}{`a`: int64(1)}},
+		{"h = {a: 1}.freeze\n[h.frozen?, h.dup.frozen?, h.clone.frozen?, h.dup.merge!(b: 2).size]", []interface{}{true, false, true, int64(2)}},
+	}
+
+	for _, test := range tests {
+		var value interface{}
+
+		if err := Eval([]byte(test.Source), &value); err != nil {
+			t.Fatalf("%s: %v", test.Source, err)
+		} else if !reflect.DeepEqual(value, test.Expected) {
+			t.Fatalf("%s: Expected %#v, got %#v", test.Source, test.Expected, value)
+		}
+	}
+}
+
+func TestEvalStruct(t *testing.T) {
+	var out TestDecodeInner
+
+	if err := Eval([]byte("hosts = %w[db1 db2]\n{host: hosts.last, port: 5432 + 1}"), &out); err != nil {
+		t.Fatal(err)
+	} else if out.Host != `db2` || out.Port != 5433 {
+		t.Fatalf("Expected db2:5433, got %s:%d", out.Host, out.Port)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		Source   string
+		Expected string
+	}{
+		{`File.read('/etc/passwd')`, `Undefined or unsupported method 'read' for class File`},
+		{`ENV['HOME']`, `Uninitialized constant 'ENV'`},
+		{"`ls`", `Running shell commands is not allowed`},
+		{`system('ls')`, `Undefined or unsupported method 'system'`},
+		{`Time.now`, `Undefined or unsupported method 'now' for class Time`},
+		{`(1..10**9).to_a`, `Evaluation exceeded its budget of 1000000 steps`},
+		{`'a' * 10**9`, `Evaluation exceeded its budget of 1000000 steps`},
+		{`x = [1]; 40.times { x = x + x }`, `Evaluation exceeded its budget of 1000000 steps`},
+		{`x = 'a'; 40.times { x = "#{x}#{x}" }`, `Evaluation exceeded its budget of 1000000 steps`},
+		{`x = [1]; 40.times { x = [*x, *x] }`, `Evaluation exceeded its budget of 1000000 steps`},
+		{`x = 3; 40.times { x = x * x }`, `Evaluation exceeded its budget of 1000000 steps`},
+		{"x = 1\nx.nope", `Undefined or unsupported method 'nope' for Integer`},
+		{`'%1000000000d' % 1`, `Width too big`},
+		{`'%.*f' % [10**9, 1.0]`, `Precision too big`},
+		{`'%c' % 10000000`, `10000000 out of char range`},
+		{`a = []; b = a; b << 1; a`, `Cannot call '<<', which changes the Array in place; use '+' instead`},
+		{`[1, 2].each_with_object([]) { |x, all| all << x }`, `Cannot call '<<', which changes the Array in place; use '+' instead`},
+		{`s = 'a'; s << 'b'`, `Cannot call '<<', which changes the String in place; use '+' instead`},
+		{`Set[1].add(2)`, `Cannot call 'add', which changes the Set in place; use '|' instead`},
+		{`a = [1]; a[0] = 2`, `Cannot assign to an element of an Array, which changes it in place; build a new Array instead`},
+		{`h = {a: 1}.freeze; h[:b] = 2`, `Cannot call '[]=' on a frozen Hash`},
+		{`{a: 1}.freeze.clone.merge!(b: 2)`, `Cannot call 'merge!' on a frozen Hash`},
+		{`File.dirname(__FILE__)`, `Cannot evaluate '__FILE__' without a file name, which SetFilename gives`},
+	}
+
+	for _, test := range tests {
+		var value interface{}
+
+		err := Eval([]byte(test.Source), &value)
+
+		if evalErr, ok := err.(*EvalError); !ok {
+			t.Fatalf("%s: Expected *EvalError, got %T (%v)", test.Source, err, err)
+		} else if evalErr.Msg != test.Expected {
+			t.Fatalf("%s: Expected %q, got %q", test.Source, test.Expected, evalErr.Msg)
+		}
+	}
+}
+
+func TestEvalBudget(t *testing.T) {
+	var value interface{}
+
+	evaluator := NewEvaluator()
+	evaluator.SetBudget(10)
+
+	if err := evaluator.Eval([]byte(`(1..100).map { |x| x * 2 }`), &value); err == nil {
+		t.Fatalf("Expected an error, got %v", value)
+	} else if evalErr, ok := err.(*EvalError); !ok {
+		t.Fatalf("Expected *EvalError, got %T (%v)", err, err)
+	} else if evalErr.Line != 1 || evalErr.Column != 1 {
+		t.Fatalf("Expected line 1, column 1, got line %d, column %d", evalErr.Line, evalErr.Column)
+	}
+}
+
+func TestEvalVariables(t *testing.T) {
+	var value interface{}
+
+	evaluator := NewEvaluator()
+	evaluator.SetVariables(map[string]interface{}{
+		`ENV`:     map[string]string{`WORKERS`: `4`},
+		`threads`: 5,
+	})
+
+	if err := evaluator.Eval([]byte(`ENV.fetch('WORKERS', '1').to_i * threads`), &value); err != nil {
+		t.Fatal(err)
+	} else if value != int64(20) {
+		t.Fatalf("Expected 20, got %v", value)
+	}
+}
+
+// a source and what Ruby's inspect returns for the value it evaluates to
+type evalInspectTest struct {
+	Source   string
+	Expected string
+}
+
+func testEvalInspect(t *testing.T, tests []evalInspectTest) {
+	for _, test := range tests {
+		var inspected string
+
+		if err := Eval([]byte("(\n"+test.Source+"\n).inspect"), &inspected); err != nil {
+			t.Errorf("%s: %v", test.Source, err)
+		} else if inspected != test.Expected {
+			t.Errorf("%s: Expected %s, got %s", test.Source, test.Expected, inspected)
+		}
+	}
+}
@@ -0,0 +1,569 @@
+package ruby
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the month names (or their abbreviations) that Time.new and Time.utc accept
+var timeMonths = map[string]time.Month{
+	`jan`: time.January,
+	`feb`: time.February,
+	`mar`: time.March,
+	`apr`: time.April,
+	`may`: time.May,
+	`jun`: time.June,
+	`jul`: time.July,
+	`aug`: time.August,
+	`sep`: time.September,
+	`oct`: time.October,
+	`nov`: time.November,
+	`dec`: time.December,
+}
+
+// returns the time given to Time.at: a number of seconds since the Unix epoch (or another
+// time), optionally followed by a fraction of a second in the given unit (microseconds
+// by default) and the time zone (in:) to give it in
+func (self *evalState) timeAt(c *evalCall) time.Time {
+	call := *c
+	call.args = self.timeOptions(c)
+	location := self.timeZone(c)
+
+	self.arity(&call, 1, 3)
+
+	if t, ok := call.args[0].(time.Time); ok && len(call.args) == 1 {
+		if location != nil {
+			return t.In(location)
+		}
+
+		return t
+	} else if location == nil {
+		location = time.Local
+	}
+
+	nanoseconds := new(big.Rat).Mul(self.toRational(&call, call.args[0]), big.NewRat(1e9, 1))
+
+	if len(call.args) > 1 {
+		unit := timeUnits[`usec`]
+
+		if len(call.args) == 3 {
+			name, _ := call.args[2].(Symbol)
+
+			if unit = timeUnits[string(name)]; unit == 0 {
+				self.fail(c.node, "Unexpected unit: %s", rubyInspect(call.args[2]))
+			}
+		}
+
+		fraction := self.toRational(&call, call.args[1])
+		nanoseconds.Add(nanoseconds, fraction.Mul(fraction, big.NewRat(unit, 1)))
+	}
+
+	t, ok := unixTime(nanoseconds, location)
+
+	if !ok {
+		self.fail(c.node, `Time out of range`)
+	}
+
+	return t
+}
+
+// returns the time given to Time.utc, Time.gm, Time.new, Time.local or Time.mktime as its
+// year, month, day, hour, minute and second, in UTC, the local time zone or (for new) the
+// zone given
+func (self *evalState) timeNew(c *evalCall) time.Time {
+	call := *c
+	call.args = self.timeOptions(c)
+	location := self.timeZone(c)
+	module := c.receiver.(evalModule)
+
+	if len(call.args) == 0 {
+		self.fail(c.node, `Cannot evaluate the current time`)
+	}
+
+	self.arity(&call, 1, 7)
+
+	switch {
+	case c.name == `utc` || c.name == `gm`:
+		location = time.UTC
+	case c.name == `new` && len(call.args) == 7:
+		zone := self.stringArg(&call, 6)
+
+		// named zones are not supported, as what they refer to depends on the system
+		if location, _ = timeLocation(zone); location == nil {
+			self.fail(c.node, "Invalid time zone offset '%s'", zone)
+		}
+	case location == nil:
+		location = time.Local
+	}
+
+	fields := []int{0, 1, 1, 0, 0}
+
+	for i := 0; i < len(call.args) && i < len(fields); i++ {
+		if month, ok := call.args[i].(string); ok && i == 1 {
+			if m, ok := timeMonths[strings.ToLower(month)]; ok {
+				fields[i] = int(m)
+				continue
+			} else if n, err := strconv.Atoi(month); err == nil {
+				fields[i] = n
+				continue
+			}
+
+			self.fail(c.node, "Invalid month '%s' for %s.%s", month, module, c.name)
+		}
+
+		fields[i] = self.intArg(&call, i)
+	}
+
+	// seconds may have a fraction, as may the microseconds Time.utc takes after them
+	nanoseconds := new(big.Rat)
+
+	if len(call.args) > 5 {
+		nanoseconds.Mul(self.toRational(&call, call.args[5]), big.NewRat(1e9, 1))
+	}
+
+	if len(call.args) == 7 && location == time.UTC && c.name != `new` {
+		nanoseconds.Add(nanoseconds, new(big.Rat).Mul(self.toRational(&call, call.args[6]), big.NewRat(1e3, 1)))
+	}
+
+	ns := new(big.Int).Quo(nanoseconds.Num(), nanoseconds.Denom())
+
+	if !ns.IsInt64() || fields[1] < 1 || fields[1] > 12 || fields[2] < 1 || fields[2] > 31 || fields[3] > 24 || fields[4] > 59 {
+		self.fail(c.node, "Argument out of range for %s.%s", module, c.name)
+	}
+
+	return time.Date(fields[0], time.Month(fields[1]), fields[2], fields[3], fields[4], 0, 0, location).Add(time.Duration(ns.Int64()))
+}
+
+// returns the arguments to a method of Time without the keyword arguments at the end
+func (self *evalState) timeOptions(c *evalCall) []interface{} {
+	if n := len(c.args); n > 0 {
+		if _, ok := c.args[n-1].(*evalHash); ok {
+			return c.args[:n-1]
+		}
+	}
+
+	return c.args
+}
+
+// returns the time zone given to a method of Time as the keyword argument in:, or nil
+func (self *evalState) timeZone(c *evalCall) *time.Location {
+	n := len(c.args)
+
+	if n == 0 {
+		return nil
+	}
+
+	options, ok := c.args[n-1].(*evalHash)
+
+	if !ok {
+		return nil
+	}
+
+	for _, key := range options.keys {
+		if key != Symbol(`in`) {
+			self.fail(c.node, "Unknown keyword %s for Time.%s", rubyInspect(key), c.name)
+		}
+	}
+
+	zone, ok := options.get(Symbol(`in`))
+
+	if !ok || zone == nil {
+		return nil
+	}
+
+	location, ok := timeLocation(rubyString(zone))
+
+	if !ok {
+		self.fail(c.node, "Invalid time zone offset '%s'", rubyString(zone))
+	}
+
+	return location
+}
+
+func (self *evalState) timeMethod(c *evalCall, receiver time.Time) (interface{}, bool) {
+	// the time as a number of nanoseconds since the Unix epoch
+	nanoseconds := func() *big.Rat {
+		ns := new(big.Int).Mul(big.NewInt(receiver.Unix()), big.NewInt(1e9))
+		return new(big.Rat).SetInt(ns.Add(ns, big.NewInt(int64(receiver.Nanosecond()))))
+	}
+
+	switch c.name {
+	case `year`:
+		return newInt(int64(receiver.Year())), true
+	case `month`, `mon`:
+		return newInt(int64(receiver.Month())), true
+	case `day`, `mday`:
+		return newInt(int64(receiver.Day())), true
+	case `hour`:
+		return newInt(int64(receiver.Hour())), true
+	case `min`:
+		return newInt(int64(receiver.Minute())), true
+	case `sec`:
+		return newInt(int64(receiver.Second())), true
+	case `nsec`, `tv_nsec`:
+		return newInt(int64(receiver.Nanosecond())), true
+	case `usec`, `tv_usec`:
+		return newInt(int64(receiver.Nanosecond() / 1e3)), true
+	case `wday`:
+		return newInt(int64(receiver.Weekday())), true
+	case `yday`:
+		return newInt(int64(receiver.YearDay())), true
+	case `to_i`, `tv_sec`:
+		return newInt(receiver.Unix()), true
+
+	case `subsec`:
+		subsec := big.NewRat(int64(receiver.Nanosecond()), 1e9)
+
+		if subsec.IsInt() {
+			return newInt(0), true
+		}
+
+		return subsec, true
+
+	case `to_r`:
+		return nanoseconds().Quo(nanoseconds(), big.NewRat(1e9, 1)), true
+
+	case `to_f`:
+		f, _ := nanoseconds().Quo(nanoseconds(), big.NewRat(1e9, 1)).Float64()
+		return f, true
+
+	case `utc`, `getutc`, `gmtime`, `getgm`:
+		return receiver.UTC(), true
+	case `utc?`, `gmt?`:
+		return receiver.Location() == time.UTC, true
+
+	case `localtime`, `getlocal`:
+		self.arity(c, 0, 1)
+
+		if len(c.args) == 0 {
+			return receiver.Local(), true
+		} else if location, ok := timeLocation(self.stringArg(c, 0)); ok {
+			return receiver.In(location), true
+		}
+
+		self.fail(c.node, "Invalid time zone offset '%s'", self.stringArg(c, 0))
+
+	case `utc_offset`, `gmt_offset`, `gmtoff`:
+		_, offset := receiver.Zone()
+		return newInt(int64(offset)), true
+
+	case `zone`:
+		if receiver.Location() == time.UTC {
+			return `UTC`, true
+		} else if name, _ := receiver.Zone(); receiver.Location() == time.Local {
+			return name, true
+		}
+
+		return nil, true
+
+	case `monday?`, `tuesday?`, `wednesday?`, `thursday?`, `friday?`, `saturday?`, `sunday?`:
+		return strings.ToLower(receiver.Weekday().String())+`?` == c.name, true
+
+	case `+`, `-`:
+		self.arity(c, 1, 1)
+
+		if other, ok := c.args[0].(time.Time); ok && c.name == `-` {
+			difference := nanoseconds()
+			ns := new(big.Int).Mul(big.NewInt(other.Unix()), big.NewInt(1e9))
+
+			difference.Sub(difference, new(big.Rat).SetInt(ns.Add(ns, big.NewInt(int64(other.Nanosecond())))))
+			f, _ := difference.Quo(difference, big.NewRat(1e9, 1)).Float64()
+
+			return f, true
+		} else if numericKind(c.args[0]) == notNumeric {
+			self.fail(c.node, "Cannot add %s to a Time", className(c.args[0]))
+		}
+
+		offset := new(big.Rat).Mul(self.toRational(c, c.args[0]), big.NewRat(1e9, 1))
+
+		if c.name == `-` {
+			offset.Neg(offset)
+		}
+
+		t, ok := unixTime(offset.Add(offset, nanoseconds()), receiver.Location())
+
+		if !ok {
+			self.fail(c.node, `Time out of range`)
+		}
+
+		return t, true
+
+	case `strftime`:
+		self.arity(c, 1, 1)
+		return strftime(receiver, self.stringArg(c, 0)), true
+
+	case `iso8601`, `xmlschema`:
+		self.arity(c, 0, 1)
+
+		layout := `2006-01-02T15:04:05`
+
+		if len(c.args) == 1 {
+			if digits := self.intArg(c, 0); digits > 0 {
+				layout += `.` + strings.Repeat(`0`, digits)[:min9(digits)]
+			}
+		}
+
+		if receiver.Location() == time.UTC {
+			return receiver.Format(layout + `Z`), true
+		}
+
+		return receiver.Format(layout + `-07:00`), true
+	}
+
+	return nil, false
+}
+
+// limits a number of fractional digits to the nine that times have
+func min9(n int) int {
+	if n > 9 {
+		return 9
+	}
+
+	return n
+}
+
+// formats a time as Time#strftime does
+func strftime(t time.Time, format string) string {
+	var out strings.Builder
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			out.WriteByte(format[i])
+			continue
+		}
+
+		j := i + 1
+		flags := ``
+
+		for j < len(format) && strings.IndexByte(`-0^_#`, format[j]) >= 0 {
+			flags += format[j : j+1]
+			j++
+		}
+
+		width := -1
+
+		if start := j; j < len(format) {
+			for j < len(format) && format[j] >= '0' && format[j] <= '9' {
+				j++
+			}
+
+			if j > start {
+				width, _ = strconv.Atoi(format[start:j])
+			}
+		}
+
+		colons := 0
+
+		for j < len(format) && format[j] == ':' {
+			colons++
+			j++
+		}
+
+		if j == len(format) {
+			out.WriteString(format[i:])
+			break
+		}
+
+		// pads a number to the directive's width, with zeros or spaces as the flags say
+		number := func(n int, digits int, pad byte) string {
+			switch {
+			case strings.Contains(flags, `-`):
+				digits = 0
+			case strings.Contains(flags, `0`):
+				pad = '0'
+			case strings.Contains(flags, `_`):
+				pad = ' '
+			}
+
+			if width >= 0 {
+				digits = width
+			}
+
+			str := strconv.Itoa(abs(n))
+
+			for len(str) < digits {
+				str = string(pad) + str
+			}
+
+			if n < 0 {
+				return `-` + str
+			}
+
+			return str
+		}
+
+		// the fraction of a second, to the given number of digits
+		fraction := func(digits int) string {
+			if width > 0 {
+				digits = width
+			}
+
+			str := strconv.Itoa(t.Nanosecond())
+			str = strings.Repeat(`0`, 9-len(str)) + str
+
+			if digits <= 9 {
+				return str[:digits]
+			}
+
+			return str + strings.Repeat(`0`, digits-9)
+		}
+
+		hour12 := t.Hour() % 12
+
+		if hour12 == 0 {
+			hour12 = 12
+		}
+
+		var str string
+		text := true
+		swapCase := strings.Contains(flags, `#`)
+
+		switch format[j] {
+		case 'Y':
+			str, text = number(t.Year(), 0, '0'), false
+		case 'C':
+			str, text = number(t.Year()/100, 2, '0'), false
+		case 'y':
+			str, text = number(t.Year()%100, 2, '0'), false
+		case 'm':
+			str, text = number(int(t.Month()), 2, '0'), false
+		case 'd':
+			str, text = number(t.Day(), 2, '0'), false
+		case 'e':
+			str, text = number(t.Day(), 2, ' '), false
+		case 'j':
+			str, text = number(t.YearDay(), 3, '0'), false
+		case 'H':
+			str, text = number(t.Hour(), 2, '0'), false
+		case 'k':
+			str, text = number(t.Hour(), 2, ' '), false
+		case 'I':
+			str, text = number(hour12, 2, '0'), false
+		case 'l':
+			str, text = number(hour12, 2, ' '), false
+		case 'M':
+			str, text = number(t.Minute(), 2, '0'), false
+		case 'S':
+			str, text = number(t.Second(), 2, '0'), false
+		case 'u':
+			str, text = number((int(t.Weekday())+6)%7+1, 1, '0'), false
+		case 'w':
+			str, text = number(int(t.Weekday()), 1, '0'), false
+		case 's':
+			str, text = strconv.FormatInt(t.Unix(), 10), false
+		case 'L':
+			str, text = fraction(3), false
+		case 'N':
+			str, text = fraction(9), false
+		case 'B':
+			str = t.Month().String()
+		case 'b', 'h':
+			str = t.Month().String()[:3]
+		case 'A':
+			str = t.Weekday().String()
+		case 'a':
+			str = t.Weekday().String()[:3]
+		case 'p':
+			// # lowercases, where it uppercases the other names
+			if str = t.Format(`PM`); swapCase {
+				str, swapCase = strings.ToLower(str), false
+			}
+		case 'P':
+			str = strings.ToLower(t.Format(`PM`))
+
+		case 'Z':
+			if t.Location() == time.UTC {
+				str = `UTC`
+			} else if t.Location() == time.Local {
+				str, _ = t.Zone()
+			}
+
+			if swapCase {
+				str, swapCase = strings.ToLower(str), false
+			}
+
+		case 'U':
+			str, text = number((t.YearDay()+6-int(t.Weekday()))/7, 2, '0'), false
+		case 'W':
+			str, text = number((t.YearDay()+6-(int(t.Weekday())+6)%7)/7, 2, '0'), false
+		case 'G':
+			year, _ := t.ISOWeek()
+			str, text = number(year, 0, '0'), false
+		case 'g':
+			year, _ := t.ISOWeek()
+			str, text = number(year%100, 2, '0'), false
+		case 'V':
+			_, week := t.ISOWeek()
+			str, text = number(week, 2, '0'), false
+
+		case 'z':
+			_, offset := t.Zone()
+			sign := `+`
+
+			if offset < 0 {
+				sign, offset = `-`, -offset
+			}
+
+			str = sign + number(offset/3600, 2, '0')
+
+			switch colons {
+			case 0:
+				str += number(offset%3600/60, 2, '0')
+			case 1:
+				str += `:` + number(offset%3600/60, 2, '0')
+			default:
+				str += `:` + number(offset%3600/60, 2, '0') + `:` + number(offset%60, 2, '0')
+			}
+
+			text = false
+
+		case 'F':
+			str = strftime(t, `%Y-%m-%d`)
+		case 'T', 'X':
+			str = strftime(t, `%H:%M:%S`)
+		case 'D', 'x':
+			str = strftime(t, `%m/%d/%y`)
+		case 'R':
+			str = strftime(t, `%H:%M`)
+		case 'r':
+			str = strftime(t, `%I:%M:%S %p`)
+		case 'c':
+			str = strftime(t, `%a %b %e %H:%M:%S %Y`)
+		case 'v':
+			str = strftime(t, `%e-%^b-%4Y`)
+		case '+':
+			str = strftime(t, `%a %b %e %H:%M:%S %Z %Y`)
+		case 'n':
+			str = "\n"
+		case 't':
+			str = "\t"
+		case '%':
+			str = `%`
+		default:
+			// unknown directives are written as they are
+			str = format[i : j+1]
+		}
+
+		if strings.Contains(flags, `^`) || (swapCase && text) {
+			str = strings.ToUpper(str)
+		}
+
+		// text is padded with spaces to the width given, unless - says not to pad
+		if text && width > len(str) && !strings.Contains(flags, `-`) {
+			pad := ` `
+
+			if strings.Contains(flags, `0`) {
+				pad = `0`
+			}
+
+			str = strings.Repeat(pad, width-len(str)) + str
+		}
+
+		out.WriteString(str)
+		i = j
+	}
+
+	return out.String()
+}
@@ -0,0 +1,80 @@
+package ruby
+
+import (
+	"testing"
+)
+
+func TestEvalTime(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`Time.at(0).utc`, `1970-01-01 00:00:00 UTC`},
+		{`Time.at(1.5).utc`, `1970-01-01 00:00:01.5 UTC`},
+		{`Time.at(-1.5).utc`, `1969-12-31 23:59:58.5 UTC`},
+		{`Time.at(0, 500, :millisecond).utc.usec`, `500000`},
+		{`Time.at(0, in: '+09:00')`, `1970-01-01 09:00:00 +0900`},
+		{`Time.at(Time.at(0), in: 'UTC')`, `1970-01-01 00:00:00 UTC`},
+		{`Time.utc(2024, 5, 6, 7, 8, 9)`, `2024-05-06 07:08:09 UTC`},
+		{`Time.utc(2024, 'may', 6)`, `2024-05-06 00:00:00 UTC`},
+		{`Time.gm(2024, 1, 1, 0, 0, 0, 250)`, `2024-01-01 00:00:00.00025 UTC`},
+		{`Time.utc(2024, 5, 6, 7, 8, 9.5).subsec`, `(1/2)`},
+		{`Time.utc(2024, 5, 6).subsec`, `0`},
+		{`Time.new(2024, 1, 2, 3, 4, 5, '+05:30')`, `2024-01-02 03:04:05 +0530`},
+		{`Time.new(2024, 1, 2, 3, 4, 5, '+05:30').utc`, `2024-01-01 21:34:05 UTC`},
+		{`Time.new(2024, 1, 2, 3, 4, 5, '+05:30').utc_offset`, `19800`},
+		{`Time.new(2024, 1, 2, 3, 4, 5, '+05:30').zone`, `nil`},
+		{`Time.new(2024, 1, 2, in: 'Z')`, `2024-01-02 00:00:00 UTC`},
+		{`Time.utc(2024, 5, 6).zone`, `"UTC"`},
+		{`Time.utc(2024, 5, 6).utc?`, `true`},
+		{`Time.utc(2024, 5, 6, 7, 8, 9).year`, `2024`},
+		{`Time.utc(2024, 5, 6, 7, 8, 9).month`, `5`},
+		{`Time.utc(2024, 5, 6, 7, 8, 9).day`, `6`},
+		{`Time.utc(2024, 5, 6, 7, 8, 9).hour`, `7`},
+		{`Time.utc(2024, 5, 6, 7, 8, 9).min`, `8`},
+		{`Time.utc(2024, 5, 6, 7, 8, 9).sec`, `9`},
+		{`Time.utc(2024, 5, 6).wday`, `1`},
+		{`Time.utc(2024, 5, 6).yday`, `127`},
+		{`Time.utc(2024, 5, 6).monday?`, `true`},
+		{`Time.utc(1970, 1, 2).to_i`, `86400`},
+		{`Time.utc(1970, 1, 1, 0, 0, 1.5).to_f`, `1.5`},
+		{`Time.utc(1970, 1, 1, 0, 0, 1.5).to_r`, `(3/2)`},
+		{`Time.utc(2024, 5, 6) + 86400`, `2024-05-07 00:00:00 UTC`},
+		{`Time.utc(2024, 5, 6) - 0.5`, `2024-05-05 23:59:59.5 UTC`},
+		{`Time.utc(2024, 5, 6) - Time.utc(2024, 5, 5)`, `86400.0`},
+		{`Time.utc(2024, 5, 6) < Time.utc(2024, 5, 7)`, `true`},
+		{`Time.utc(2024, 5, 6, 7, 8, 9).to_s`, `"2024-05-06 07:08:09 UTC"`},
+		{`Time.new(2024, 5, 6, 7, 8, 9, '-04:00').to_s`, `"2024-05-06 07:08:09 -0400"`},
+		{`Time.utc(2024, 5, 6, 7, 8, 9).iso8601`, `"2024-05-06T07:08:09Z"`},
+		{`Time.utc(2024, 5, 6, 7, 8, 9.25).iso8601(3)`, `"2024-05-06T07:08:09.250Z"`},
+		{`Time.new(2024, 5, 6, 7, 8, 9, '-04:00').xmlschema`, `"2024-05-06T07:08:09-04:00"`},
+	})
+}
+
+func TestEvalStrftime(t *testing.T) {
+	// a Monday afternoon, with a fraction of a second to every digit
+	const monday = `Time.utc(2024, 5, 6, 14, 8, Rational(9123456789, 1000000000))`
+
+	testEvalInspect(t, []evalInspectTest{
+		{monday + `.strftime('%F %T')`, `"2024-05-06 14:08:09"`},
+		{monday + `.strftime('%Y%m%d')`, `"20240506"`},
+		{monday + `.strftime('%C %y')`, `"20 24"`},
+		{monday + `.strftime('%-m/%-d')`, `"5/6"`},
+		{monday + `.strftime('%e|%3d|%_3d')`, `" 6|006|  6"`},
+		{monday + `.strftime('%j')`, `"127"`},
+		{monday + `.strftime('%H %k %I %l')`, `"14 14 02  2"`},
+		{monday + `.strftime('%M %S')`, `"08 09"`},
+		{monday + `.strftime('%L %N %6N')`, `"123 123456789 123456"`},
+		{monday + `.strftime('%u %w')`, `"1 1"`},
+		{monday + `.strftime('%A %a %^a %#A')`, `"Monday Mon MON MONDAY"`},
+		{monday + `.strftime('%B %b %h')`, `"May May May"`},
+		{monday + `.strftime('%p %P %#p')`, `"PM pm pm"`},
+		{monday + `.strftime('%Z %#Z %z %:z %::z')`, `"UTC utc +0000 +00:00 +00:00:00"`},
+		{monday + `.strftime('%s')`, `"1715004489"`},
+		{monday + `.strftime('%D %R %r')`, `"05/06/24 14:08 02:08:09 PM"`},
+		{monday + `.strftime('%c')`, `"Mon May  6 14:08:09 2024"`},
+		{monday + `.strftime('%v')`, `" 6-MAY-2024"`},
+		{monday + `.strftime('%+')`, `"Mon May  6 14:08:09 UTC 2024"`},
+		{monday + `.strftime('%U %W %V %G %g')`, `"18 19 19 2024 24"`},
+		{monday + `.strftime('%10A|%-10A')`, `"    Monday|Monday"`},
+		{monday + `.strftime('100%% %Q')`, `"100% %Q"`},
+		{`Time.new(2024, 1, 2, 3, 4, 5, '+05:30').strftime('%z %:z %Z.')`, `"+0530 +05:30 ."`},
+	})
+}
@@ -0,0 +1,961 @@
+package ruby
+
+import (
+	"fmt"
+	"github.com/ghetzel/rubyutils/encoding/ruby/ast"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// While evaluating, Ruby values are held as:
+//
+//	nil, true, false     nil, bool
+//	integers             *big.Int
+//	floats               float64
+//	rationals            *big.Rat
+//	strings, symbols     string, Symbol
+//	arrays               []interface{}
+//	hashes               *evalHash
+//	ranges, sets         Range, Set (of these values)
+//	regular expressions  Regexp
+//	times                time.Time
+//	paths                evalPathname
+//	classes and modules  evalModule
+
+// a Ruby hash, whose keys keep the order they were added in and may be of any type
+type evalHash struct {
+	keys   []interface{}
+	values []interface{}
+	index  map[interface{}]int
+	frozen bool
+}
+
+// the classes and modules that may be referred to by name
+var evalModules = map[string]bool{
+	`Array`:       true,
+	`BasicObject`: true,
+	`Class`:       true,
+	`Comparable`:  true,
+	`Enumerable`:  true,
+	`FalseClass`:  true,
+	`File`:        true,
+	`Float`:       true,
+	`Hash`:        true,
+	`Integer`:     true,
+	`Kernel`:      true,
+	`Math`:        true,
+	`Module`:      true,
+	`NilClass`:    true,
+	`Numeric`:     true,
+	`Object`:      true,
+	`Pathname`:    true,
+	`Range`:       true,
+	`Rational`:    true,
+	`Regexp`:      true,
+	`Set`:         true,
+	`String`:      true,
+	`Symbol`:      true,
+	`Time`:        true,
+	`TrueClass`:   true,
+}
+
+// a class or module, such as File
+type evalModule string
+
+// a Pathname, which joins paths with + and / rather than concatenating them
+type evalPathname string
+
+// a block given to a method
+type evalBlock func(args []interface{}) interface{}
+
+// hash keys that are compared as Go values rather than one by one
+type intKey string
+type ratKey string
+
+func newEvalHash() *evalHash {
+	return &evalHash{
+		keys:   make([]interface{}, 0),
+		values: make([]interface{}, 0),
+		index:  make(map[interface{}]int),
+	}
+}
+
+// returns the key a value is indexed by, if it can be compared as a Go value
+func hashIndexKey(key interface{}) (interface{}, bool) {
+	switch k := key.(type) {
+	case nil, bool, string, Symbol, evalPathname, evalModule:
+		return k, true
+	case float64:
+		return k, !math.IsNaN(k)
+	case *big.Int:
+		return intKey(k.String()), true
+	case *big.Rat:
+		return ratKey(k.RatString()), true
+	}
+
+	return nil, false
+}
+
+// returns the position of the key, or -1
+func (self *evalHash) find(key interface{}) int {
+	if indexKey, ok := hashIndexKey(key); ok {
+		if i, ok := self.index[indexKey]; ok {
+			return i
+		}
+
+		return -1
+	}
+
+	for i, k := range self.keys {
+		if rubyEql(k, key) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (self *evalHash) get(key interface{}) (interface{}, bool) {
+	if i := self.find(key); i >= 0 {
+		return self.values[i], true
+	}
+
+	return nil, false
+}
+
+func (self *evalHash) set(key interface{}, value interface{}) {
+	if i := self.find(key); i >= 0 {
+		self.values[i] = value
+		return
+	}
+
+	if indexKey, ok := hashIndexKey(key); ok {
+		self.index[indexKey] = len(self.keys)
+	}
+
+	self.keys = append(self.keys, key)
+	self.values = append(self.values, value)
+}
+
+// removes a key, returning its value
+func (self *evalHash) delete(key interface{}) (interface{}, bool) {
+	i := self.find(key)
+
+	if i < 0 {
+		return nil, false
+	}
+
+	value := self.values[i]
+	keys, values := self.keys, self.values
+
+	self.keys = append(keys[:i:i], keys[i+1:]...)
+	self.values = append(values[:i:i], values[i+1:]...)
+	self.index = make(map[interface{}]int)
+
+	for j, k := range self.keys {
+		if indexKey, ok := hashIndexKey(k); ok {
+			self.index[indexKey] = j
+		}
+	}
+
+	return value, true
+}
+
+// returns a copy of the hash
+func (self *evalHash) copy() *evalHash {
+	hash := newEvalHash()
+	hash.merge(self)
+
+	return hash
+}
+
+func (self *evalHash) merge(other *evalHash) {
+	for i, key := range other.keys {
+		self.set(key, other.values[i])
+	}
+}
+
+func (self *evalHash) len() int {
+	return len(self.keys)
+}
+
+// returns the [key, value] pairs of the hash
+func (self *evalHash) pairs() []interface{} {
+	pairs := make([]interface{}, len(self.keys))
+
+	for i, key := range self.keys {
+		pairs[i] = []interface{}{key, self.values[i]}
+	}
+
+	return pairs
+}
+
+// returns the name of a value's Ruby class
+func className(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return `NilClass`
+	case bool:
+		if v {
+			return `TrueClass`
+		}
+
+		return `FalseClass`
+	case *big.Int:
+		return `Integer`
+	case float64:
+		return `Float`
+	case *big.Rat:
+		return `Rational`
+	case string:
+		return `String`
+	case Symbol:
+		return `Symbol`
+	case []interface{}:
+		return `Array`
+	case *evalHash:
+		return `Hash`
+	case Range:
+		return `Range`
+	case Set:
+		return `Set`
+	case Regexp:
+		return `Regexp`
+	case time.Time:
+		return `Time`
+	case evalPathname:
+		return `Pathname`
+	case evalModule:
+		switch v {
+		case `Comparable`, `Enumerable`, `Kernel`, `Math`:
+			return `Module`
+		}
+
+		return `Class`
+	}
+
+	return fmt.Sprintf("%T", value)
+}
+
+// reports whether a value is an instance of the given class or module
+func isA(value interface{}, module evalModule) bool {
+	switch module {
+	case `Numeric`:
+		return numericKind(value) != 0
+	case `Object`, `BasicObject`, `Kernel`:
+		return true
+	case `Module`:
+		_, ok := value.(evalModule)
+		return ok
+	case `Comparable`:
+		switch value.(type) {
+		case *big.Int, float64, *big.Rat, string, Symbol, time.Time:
+			return true
+		}
+
+		return false
+	case `Enumerable`:
+		switch value.(type) {
+		case []interface{}, *evalHash, Range, Set:
+			return true
+		}
+
+		return false
+	}
+
+	return className(value) == string(module)
+}
+
+// the kinds of number, in the order that arithmetic on two of them converts to
+const (
+	notNumeric = iota
+	integerKind
+	rationalKind
+	floatKind
+)
+
+func numericKind(value interface{}) int {
+	switch value.(type) {
+	case *big.Int:
+		return integerKind
+	case *big.Rat:
+		return rationalKind
+	case float64:
+		return floatKind
+	}
+
+	return notNumeric
+}
+
+func toFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f
+	case *big.Rat:
+		f, _ := v.Float64()
+		return f
+	case float64:
+		return v
+	}
+
+	return 0
+}
+
+func toRat(value interface{}) *big.Rat {
+	switch v := value.(type) {
+	case *big.Int:
+		return new(big.Rat).SetInt(v)
+	case *big.Rat:
+		return new(big.Rat).Set(v)
+	case float64:
+		if r := new(big.Rat); r.SetFloat64(v) != nil {
+			return r
+		}
+	}
+
+	return new(big.Rat)
+}
+
+func newInt(n int64) *big.Int {
+	return big.NewInt(n)
+}
+
+// returns the steps that building a value is charged: one for each element of an array,
+// set or hash, one for every 8 bytes of a string and one for every word of an integer
+func evalSize(value interface{}) int {
+	switch v := value.(type) {
+	case *big.Int:
+		return v.BitLen() / 64
+	case []interface{}:
+		return len(v)
+	case Set:
+		return len(v)
+	case *evalHash:
+		return v.len()
+	case string:
+		return len(v) / 8
+	case evalPathname:
+		return len(v) / 8
+	}
+
+	return 0
+}
+
+// returns the value of a small integer, reporting false for anything else
+func smallInt(value interface{}) (int, bool) {
+	if n, ok := value.(*big.Int); ok && n.IsInt64() && n.Int64() >= math.MinInt32 && n.Int64() <= math.MaxInt32 {
+		return int(n.Int64()), true
+	}
+
+	return 0, false
+}
+
+// compares two values as <=> does, reporting false if they cannot be compared
+func compareValues(a interface{}, b interface{}) (int, bool) {
+	ka, kb := numericKind(a), numericKind(b)
+
+	if ka != notNumeric && kb != notNumeric {
+		switch {
+		case ka == floatKind || kb == floatKind:
+			x, y := toFloat(a), toFloat(b)
+
+			if math.IsNaN(x) || math.IsNaN(y) {
+				return 0, false
+			} else if math.IsInf(x, 0) || math.IsInf(y, 0) || (ka == floatKind && kb == floatKind) {
+				return compareFloats(x, y), true
+			}
+
+			return toRat(a).Cmp(toRat(b)), true
+		case ka == rationalKind || kb == rationalKind:
+			return toRat(a).Cmp(toRat(b)), true
+		}
+
+		return a.(*big.Int).Cmp(b.(*big.Int)), true
+	}
+
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case Symbol:
+		if y, ok := b.(Symbol); ok {
+			return strings.Compare(string(x), string(y)), true
+		}
+	case evalPathname:
+		if y, ok := b.(evalPathname); ok {
+			return strings.Compare(string(x), string(y)), true
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			switch {
+			case x.Before(y):
+				return -1, true
+			case x.After(y):
+				return 1, true
+			}
+
+			return 0, true
+		}
+	case []interface{}:
+		if y, ok := b.([]interface{}); ok {
+			for i := 0; i < len(x) && i < len(y); i++ {
+				if c, ok := compareValues(x[i], y[i]); !ok || c != 0 {
+					return c, ok
+				}
+			}
+
+			return compareInts(len(x), len(y)), true
+		}
+	}
+
+	return 0, false
+}
+
+func compareFloats(x float64, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+
+	return 0
+}
+
+func compareInts(x int, y int) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+
+	return 0
+}
+
+// reports whether two values are equal as == does, which treats numbers of different
+// kinds as equal if their values are
+func rubyEqual(a interface{}, b interface{}) bool {
+	if numericKind(a) != notNumeric && numericKind(b) != notNumeric {
+		c, ok := compareValues(a, b)
+		return ok && c == 0
+	}
+
+	switch x := a.(type) {
+	case []interface{}:
+		y, ok := b.([]interface{})
+
+		if !ok || len(x) != len(y) {
+			return false
+		}
+
+		for i := range x {
+			if !rubyEqual(x[i], y[i]) {
+				return false
+			}
+		}
+
+		return true
+
+	case *evalHash:
+		y, ok := b.(*evalHash)
+
+		if !ok || x.len() != y.len() {
+			return false
+		}
+
+		for i, key := range x.keys {
+			if value, ok := y.get(key); !ok || !rubyEqual(x.values[i], value) {
+				return false
+			}
+		}
+
+		return true
+
+	case Set:
+		y, ok := b.(Set)
+
+		if !ok || len(x) != len(y) {
+			return false
+		}
+
+		for _, element := range x {
+			if !setIncludes(y, element) {
+				return false
+			}
+		}
+
+		return true
+
+	case Range:
+		y, ok := b.(Range)
+		return ok && x.Exclusive == y.Exclusive && rubyEql(x.Begin, y.Begin) && rubyEql(x.End, y.End)
+
+	case time.Time:
+		y, ok := b.(time.Time)
+		return ok && x.Equal(y)
+	}
+
+	return rubyEql(a, b)
+}
+
+// reports whether two values are equal as eql? (and so hash keys) does, which requires
+// numbers to be of the same kind
+func rubyEql(a interface{}, b interface{}) bool {
+	switch x := a.(type) {
+	case *big.Int:
+		y, ok := b.(*big.Int)
+		return ok && x.Cmp(y) == 0
+	case *big.Rat:
+		y, ok := b.(*big.Rat)
+		return ok && x.Cmp(y) == 0
+	case float64:
+		y, ok := b.(float64)
+		return ok && x == y
+
+	case []interface{}:
+		y, ok := b.([]interface{})
+
+		if !ok || len(x) != len(y) {
+			return false
+		}
+
+		for i := range x {
+			if !rubyEql(x[i], y[i]) {
+				return false
+			}
+		}
+
+		return true
+
+	case *evalHash, Set, Range, time.Time:
+		return numericKind(b) == notNumeric && rubyEqual(a, b)
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func setIncludes(set Set, value interface{}) bool {
+	for _, element := range set {
+		if rubyEql(element, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// returns a value as to_s does
+func rubyString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ``
+	case string:
+		return v
+	case Symbol:
+		return string(v)
+	case evalPathname:
+		return string(v)
+	case evalModule:
+		return string(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case *big.Int:
+		return v.String()
+	case float64:
+		return floatString(v)
+	case *big.Rat:
+		return v.Num().String() + `/` + v.Denom().String()
+
+	case Range:
+		operator := `..`
+
+		if v.Exclusive {
+			operator = `...`
+		}
+
+		return rubyString(v.Begin) + operator + rubyString(v.End)
+
+	case Regexp:
+		return embedRegexp(v)
+
+	case time.Time:
+		if v.Location() == time.UTC {
+			return v.Format(`2006-01-02 15:04:05 UTC`)
+		}
+
+		return v.Format(`2006-01-02 15:04:05 -0700`)
+	}
+
+	return rubyInspect(value)
+}
+
+// returns a value as inspect does
+func rubyInspect(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return `nil`
+	case string:
+		return inspectString(v)
+
+	case Symbol:
+		if rxBareSymbol.MatchString(string(v)) || rxSymbolName.MatchString(string(v)) {
+			return `:` + string(v)
+		}
+
+		return `:` + inspectString(string(v))
+
+	case *big.Rat:
+		return `(` + rubyString(v) + `)`
+
+	case []interface{}:
+		items := make([]string, len(v))
+
+		for i, element := range v {
+			items[i] = rubyInspect(element)
+		}
+
+		return `[` + strings.Join(items, `, `) + `]`
+
+	case *evalHash:
+		items := make([]string, len(v.keys))
+
+		for i, key := range v.keys {
+			if sym, ok := key.(Symbol); ok {
+				if rxBareSymbol.MatchString(string(sym)) {
+					items[i] = string(sym) + `: ` + rubyInspect(v.values[i])
+				} else {
+					items[i] = inspectString(string(sym)) + `: ` + rubyInspect(v.values[i])
+				}
+			} else {
+				items[i] = rubyInspect(key) + ` => ` + rubyInspect(v.values[i])
+			}
+		}
+
+		return `{` + strings.Join(items, `, `) + `}`
+
+	case Range:
+		operator := `..`
+
+		if v.Exclusive {
+			operator = `...`
+		}
+
+		var begin, end string
+
+		// a range without either end is written as nil..nil
+		if v.Begin != nil || v.End == nil {
+			begin = rubyInspect(v.Begin)
+		}
+
+		if v.End != nil || v.Begin == nil {
+			end = rubyInspect(v.End)
+		}
+
+		return begin + operator + end
+
+	case Set:
+		items := make([]string, len(v))
+
+		for i, element := range v {
+			items[i] = rubyInspect(element)
+		}
+
+		return `#<Set: {` + strings.Join(items, `, `) + `}>`
+
+	case Regexp:
+		// the options are written in the order Ruby writes them, whatever the literal's
+		flags := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`mix`, r) {
+				return -1
+			}
+
+			return r
+		}, v.Flags)
+
+		for _, flag := range `xim` {
+			if strings.ContainsRune(v.Flags, flag) {
+				flags = string(flag) + flags
+			}
+		}
+
+		return `/` + escapeRegexpDelimiters(v.Source) + `/` + flags
+	case evalPathname:
+		return `#<Pathname:` + string(v) + `>`
+
+	case time.Time:
+		// unlike to_s, inspect gives any fraction of a second
+		if v.Location() == time.UTC {
+			return v.Format(`2006-01-02 15:04:05.999999999 UTC`)
+		}
+
+		return v.Format(`2006-01-02 15:04:05.999999999 -0700`)
+	}
+
+	return rubyString(value)
+}
+
+// returns a string as a double-quoted Ruby literal
+func inspectString(str string) string {
+	var out strings.Builder
+
+	out.WriteByte('"')
+
+	for i, r := range str {
+		switch {
+		case r == utf8.RuneError:
+			if _, size := utf8.DecodeRuneInString(str[i:]); size == 1 {
+				fmt.Fprintf(&out, "\\x%02X", str[i])
+			} else {
+				out.WriteRune(r)
+			}
+		case r == '"' || r == '\\':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case r == '#' && i+1 < len(str) && strings.ContainsRune(`{$@`, rune(str[i+1])):
+			out.WriteString(`\#`)
+		case r == '\n':
+			out.WriteString(`\n`)
+		case r == '\t':
+			out.WriteString(`\t`)
+		case r == '\r':
+			out.WriteString(`\r`)
+		case r == '\x1b':
+			out.WriteString(`\e`)
+		case r == '\a':
+			out.WriteString(`\a`)
+		case r == '\b':
+			out.WriteString(`\b`)
+		case r == '\f':
+			out.WriteString(`\f`)
+		case r == '\v':
+			out.WriteString(`\v`)
+		case !unicode.IsPrint(r) && r != ' ':
+			if r > 0xFFFF {
+				fmt.Fprintf(&out, "\\u{%X}", r)
+			} else {
+				fmt.Fprintf(&out, "\\u%04X", r)
+			}
+		default:
+			out.WriteRune(r)
+		}
+	}
+
+	out.WriteByte('"')
+	return out.String()
+}
+
+// returns a float as Ruby writes it: always with a decimal point, and in scientific
+// notation when very large or small
+func floatString(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return `NaN`
+	case math.IsInf(f, 1):
+		return `Infinity`
+	case math.IsInf(f, -1):
+		return `-Infinity`
+	}
+
+	if abs := math.Abs(f); abs == 0 || (abs >= 1e-4 && abs < 1e16) {
+		str := strconv.FormatFloat(f, 'f', -1, 64)
+
+		if !strings.Contains(str, `.`) {
+			str += `.0`
+		}
+
+		return str
+	}
+
+	str := strconv.FormatFloat(f, 'e', -1, 64)
+	e := strings.IndexByte(str, 'e')
+
+	if !strings.Contains(str[:e], `.`) {
+		return str[:e] + `.0` + str[e:]
+	}
+
+	return str
+}
+
+// returns the elements of an array, or the elements that any other collection holds
+func (self *evalState) toArray(node ast.Node, value interface{}) []interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		return v
+	case *evalHash:
+		return v.pairs()
+	case Set:
+		return []interface{}(v)
+	case Range:
+		return self.rangeElements(node, v)
+	}
+
+	self.fail(node, "Cannot convert %s into an array", className(value))
+	return nil
+}
+
+// returns the integers (or strings) that a range includes
+func (self *evalState) rangeElements(node ast.Node, rng Range) []interface{} {
+	switch begin := rng.Begin.(type) {
+	case *big.Int:
+		end, ok := rng.End.(*big.Int)
+
+		if !ok {
+			if rng.End == nil {
+				self.fail(node, `Cannot list the elements of an endless range`)
+			}
+
+			self.fail(node, "Cannot list the elements of a range from %s to %s", className(rng.Begin), className(rng.End))
+		}
+
+		last := new(big.Int).Set(end)
+
+		if rng.Exclusive {
+			last.Sub(last, newInt(1))
+		}
+
+		count := new(big.Int).Sub(last, begin)
+
+		if count.Sign() < 0 {
+			return make([]interface{}, 0)
+		} else if !count.IsInt64() || count.Int64() >= int64(self.budget) {
+			self.step(node, -1)
+		}
+
+		self.step(node, int(count.Int64())+1)
+
+		elements := make([]interface{}, 0, count.Int64()+1)
+
+		for n := new(big.Int).Set(begin); n.Cmp(last) <= 0; n = new(big.Int).Add(n, newInt(1)) {
+			elements = append(elements, n)
+		}
+
+		return elements
+
+	case string:
+		end, ok := rng.End.(string)
+
+		if !ok {
+			self.fail(node, "Cannot list the elements of a range from %s to %s", className(rng.Begin), className(rng.End))
+		}
+
+		return self.stringRangeElements(node, begin, end, rng.Exclusive)
+	}
+
+	self.fail(node, "Cannot list the elements of a range of %s", className(rng.Begin))
+	return nil
+}
+
+// the names of operators, variables and setters, which symbols are written as without
+// quotes
+var rxSymbolName = regexp.MustCompile(`^(?:(?:@@?|\$)[A-Za-z_][A-Za-z0-9_]*|[A-Za-z_][A-Za-z0-9_]*=|\[\]=?|[-+]@|\*\*|<=>|===?|=~|!=|!~|<<|>>|<=|>=|[-+*/%<>!~^&|])$`)
+
+// strings of decimal digits, which ranges list as numbers
+var rxDigits = regexp.MustCompile(`^[0-9]+$`)
+
+// returns the strings from one to another, as String#upto does: single characters in
+// order, numbers of at least the first's width, or each successor of the first until the
+// last or one longer than it
+func (self *evalState) stringRangeElements(node ast.Node, begin string, end string, exclusive bool) []interface{} {
+	elements := make([]interface{}, 0)
+
+	if utf8.RuneCountInString(begin) == 1 && utf8.RuneCountInString(end) == 1 {
+		first, _ := utf8.DecodeRuneInString(begin)
+		last, _ := utf8.DecodeRuneInString(end)
+
+		if exclusive {
+			last -= 1
+		}
+
+		for r := first; r <= last; r++ {
+			self.step(node, 1)
+			elements = append(elements, string(r))
+		}
+
+		return elements
+	}
+
+	if rxDigits.MatchString(begin) && rxDigits.MatchString(end) {
+		first, _ := new(big.Int).SetString(begin, 10)
+		last, _ := new(big.Int).SetString(end, 10)
+
+		for _, n := range self.rangeElements(node, Range{Begin: first, End: last, Exclusive: exclusive}) {
+			str := n.(*big.Int).String()
+
+			if len(str) < len(begin) {
+				str = strings.Repeat(`0`, len(begin)-len(str)) + str
+			}
+
+			elements = append(elements, str)
+		}
+
+		return elements
+	}
+
+	if cmp := strings.Compare(begin, end); cmp > 0 || (cmp == 0 && exclusive) {
+		return elements
+	}
+
+	for current := begin; !exclusive || current != end; {
+		self.step(node, 1+len(current)/8)
+		elements = append(elements, current)
+
+		next := successor(current)
+
+		if current == end || next == `` || len(next) > len(end) {
+			break
+		}
+
+		current = next
+	}
+
+	return elements
+}
+
+// reports whether a range includes the value, as include? and === do
+func rangeIncludes(rng Range, value interface{}) bool {
+	if rng.Begin != nil {
+		if c, ok := compareValues(rng.Begin, value); !ok || c > 0 {
+			return false
+		}
+	}
+
+	if rng.End != nil {
+		c, ok := compareValues(value, rng.End)
+
+		if !ok || c > 0 || (c == 0 && rng.Exclusive) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sorts values, failing if any two cannot be compared
+func (self *evalState) sortValues(node ast.Node, values []interface{}, less func(a, b interface{}) (int, bool)) []interface{} {
+	sorted := append([]interface{}(nil), values...)
+
+	self.step(node, len(sorted))
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		c, ok := less(sorted[i], sorted[j])
+
+		if !ok {
+			self.fail(node, "Comparison of %s with %s failed", className(sorted[i]), className(sorted[j]))
+		}
+
+		return c < 0
+	})
+
+	return sorted
+}
@@ -0,0 +1,120 @@
+package ruby
+
+import (
+	"testing"
+)
+
+func TestEvalInspect(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`1e16`, `1.0e+16`},
+		{`1e15`, `1000000000000000.0`},
+		{`1e-5`, `1.0e-05`},
+		{`0.0001`, `0.0001`},
+		{`-0.0`, `-0.0`},
+		{`1.5e300`, `1.5e+300`},
+		{`1.23e-10`, `1.23e-10`},
+		{`2.0 / 3`, `0.6666666666666666`},
+		{`100.0`, `100.0`},
+		{`Rational(-1, 2)`, `(-1/2)`},
+		{`2 ** 70`, `1180591620717411303424`},
+		{`nil`, `nil`},
+		{`"a\"b\\c"`, `"a\"b\\c"`},
+		{`"tab\t\e"`, `"tab\t\e"`},
+		{`'#{x}'`, `"\#{x}"`},
+		{`'#a'`, `"#a"`},
+		{`"\u0000"`, `"\u0000"`},
+		{`"é"`, `"é"`},
+		{`"\u200b"`, `"\u200B"`},
+		{`:a?`, `:a?`},
+		{`:A`, `:A`},
+		{`:"9a"`, `:"9a"`},
+		{`:"a="`, `:a=`},
+		{`:"+"`, `:+`},
+		{`:"[]"`, `:[]`},
+		{`:"<=>"`, `:<=>`},
+		{`:"@a"`, `:@a`},
+		{`:"a-b"`, `:"a-b"`},
+		{`[1, [2.0, nil], {a: :b}, 'c']`, `[1, [2.0, nil], {a: :b}, "c"]`},
+		{`{1 => 'a', nil => true, [1] => {}}`, `{1 => "a", nil => true, [1] => {}}`},
+		{`{'a b': 1, 'a': 2, "+": 3}`, `{"a b": 1, a: 2, "+": 3}`},
+		{`(1..)`, `1..`},
+		{`(..1)`, `..1`},
+		{`(nil..nil)`, `nil..nil`},
+		{`('a'...'c')`, `"a"..."c"`},
+		{`(1.5..2)`, `1.5..2`},
+		{`/a\/b/i`, `/a\/b/i`},
+		{`Pathname('a')`, `#<Pathname:a>`},
+	})
+}
+
+func TestEvalEquality(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`1.eql?(1)`, `true`},
+		{`'a' == :a`, `false`},
+		{`[1, 2] == [1, 2.0]`, `true`},
+		{`[1, 2].eql?([1, 2.0])`, `false`},
+		{`{a: 1} == {a: 1.0}`, `true`},
+		{`{a: 1, b: 2} == {b: 2, a: 1}`, `true`},
+		{`Set[1, 2] == Set[2, 1]`, `true`},
+		{`(1..2) == (1..2)`, `true`},
+		{`(1..2) == (1...2)`, `false`},
+		{`Rational(1, 2) == 0.5`, `true`},
+		{`nil == false`, `false`},
+		{`0.1 + 0.2 == 0.3`, `false`},
+		{`(0.0 / 0) == (0.0 / 0)`, `false`},
+		{`{1 => :a, 1.0 => :b}.size`, `2`},
+		{`{1 => :a}[1.0]`, `nil`},
+		{`[1, 1.0].uniq`, `[1, 1.0]`},
+		{`{[1] => 2}[[1]]`, `2`},
+		{`{'a' => 1}['a']`, `1`},
+	})
+}
+
+func TestEvalComparison(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`[1, 2] <=> [1, 3]`, `-1`},
+		{`[1, 2] <=> [1]`, `1`},
+		{`'a' <=> 'b'`, `-1`},
+		{`'B' <=> 'a'`, `-1`},
+		{`:a <=> :b`, `-1`},
+		{`1 <=> 2.5`, `-1`},
+		{`Rational(1, 3) <=> 0.3`, `1`},
+		{`nil <=> nil`, `0`},
+		{`[3, 1.5, Rational(1, 2)].sort`, `[(1/2), 1.5, 3]`},
+		{`%w[b A a].sort`, `["A", "a", "b"]`},
+		{`[[2, 'a'], [1, 'b']].sort`, `[[1, "b"], [2, "a"]]`},
+		{`[[1, 'b'], [1, 'a']].max`, `[1, "b"]`},
+	})
+}
+
+func TestEvalClass(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`[1].class`, `Array`},
+		{`{}.class`, `Hash`},
+		{`Set[1].class`, `Set`},
+		{`/a/.class`, `Regexp`},
+		{`Rational(1, 2).class`, `Rational`},
+		{`(2 ** 70).class`, `Integer`},
+		{`Pathname('a').class`, `Pathname`},
+		{`Time.at(0).class`, `Time`},
+		{`false.class`, `FalseClass`},
+		{`Integer.class`, `Class`},
+		{`Math.class`, `Module`},
+		{`Integer.is_a?(Module)`, `true`},
+		{`1.is_a?(Module)`, `false`},
+	})
+}
+
+func TestEvalTruthiness(t *testing.T) {
+	testEvalInspect(t, []evalInspectTest{
+		{`0 ? 1 : 2`, `1`},
+		{`'' ? 1 : 2`, `1`},
+		{`[] ? 1 : 2`, `1`},
+		{`nil || false`, `false`},
+		{`false || nil`, `nil`},
+		{`1 && 2`, `2`},
+		{`nil && 2`, `nil`},
+		{`!nil`, `true`},
+		{`!0`, `false`},
+	})
+}
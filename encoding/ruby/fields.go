@@ -0,0 +1,346 @@
+package ruby
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// the struct tag keys consulted when none are configured
+var defaultTagKeys = []string{`ruby`}
+
+// describes a single struct field that will be written by the encoder
+type structField struct {
+	Name    string
+	GoName  string
+	Tagged  bool
+	Index   []int
+	Type    reflect.Type
+	Options tagOptions
+}
+
+type cachedFields struct {
+	collected []structField
+	fields    []structField
+	class     classSpec
+	err       error
+}
+
+type fieldCacheKey struct {
+	Type    reflect.Type
+	TagKeys string
+}
+
+// parsed and validated fields, keyed on struct type and the tag keys consulted
+var fieldCache sync.Map
+
+// returns the encodable fields of the given struct type, parsing and validating
+// their tags the first time the type is seen.  The first of the given struct tag
+// keys present on a field is used; only the `ruby` tag is validated strictly, while
+// options in other tags (e.g.: `json`) that do not apply here are ignored.  Fields
+// not named by a tag are named using the given strategy, if any.
+func typeFields(t reflect.Type, tagKeys []string, naming NamingStrategy) ([]structField, error) {
+	entry := loadFields(t, tagKeys)
+
+	// renamed fields may collide differently, so they are resolved anew
+	if entry.err == nil && naming != nil {
+		return dominantFields(t, entry.collected, naming)
+	}
+
+	return entry.fields, entry.err
+}
+
+// returns the Ruby class (if any) that instances of the given struct type are
+// constructed as, as declared by an embedded Class marker
+func typeClass(t reflect.Type, tagKeys []string) classSpec {
+	return loadFields(t, tagKeys).class
+}
+
+func loadFields(t reflect.Type, tagKeys []string) *cachedFields {
+	if len(tagKeys) == 0 {
+		tagKeys = defaultTagKeys
+	}
+
+	key := fieldCacheKey{
+		Type:    t,
+		TagKeys: strings.Join(tagKeys, `,`),
+	}
+
+	if cached, ok := fieldCache.Load(key); ok {
+		return cached.(*cachedFields)
+	}
+
+	entry := new(cachedFields)
+	entry.class, entry.err = collectClass(t)
+
+	if entry.err == nil {
+		entry.collected, entry.err = collectFields(t, tagKeys, nil, map[reflect.Type]bool{})
+	}
+
+	if entry.err == nil {
+		entry.fields, entry.err = dominantFields(t, entry.collected, nil)
+	}
+
+	cached, _ := fieldCache.LoadOrStore(key, entry)
+	return cached.(*cachedFields)
+}
+
+// walks the fields of a struct type, descending into inlined structs
+func collectFields(t reflect.Type, tagKeys []string, parentIndex []int, inlining map[reflect.Type]bool) ([]structField, error) {
+	fields := make([]structField, 0, t.NumField())
+
+	inlining[t] = true
+	defer delete(inlining, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		// unexported fields and Class markers are never written
+		if sf.PkgPath != `` || sf.Type == classType {
+			continue
+		}
+
+		tagKey, tag := lookupTag(sf.Tag, tagKeys)
+		name, options := parseTag(tag)
+
+		// specifying a field name of "-" (and nothing else) skips that field
+		if tag == `-` {
+			continue
+		}
+
+		if tagKey != `ruby` {
+			options = options.applicable(name, sf.Type)
+		}
+
+		if reason := options.validate(name, sf.Type); reason != `` {
+			return nil, &TagError{
+				Struct: t,
+				Field:  sf.Name,
+				Tag:    tag,
+				Reason: reason,
+			}
+		}
+
+		index := make([]int, len(parentIndex)+1)
+		copy(index, parentIndex)
+		index[len(parentIndex)] = i
+
+		if options.Contains(`inline`) {
+			inlineType := indirectType(sf.Type)
+
+			if inlining[inlineType] {
+				return nil, &TagError{
+					Struct: t,
+					Field:  sf.Name,
+					Tag:    tag,
+					Reason: `inlined struct contains itself`,
+				}
+			}
+
+			if inlined, err := collectFields(inlineType, tagKeys, index, inlining); err == nil {
+				fields = append(fields, inlined...)
+			} else {
+				return nil, err
+			}
+
+			continue
+		}
+
+		tagged := (name != ``)
+
+		// default struct field name to the field's name
+		if !tagged {
+			name = sf.Name
+		}
+
+		fields = append(fields, structField{
+			Name:    name,
+			GoName:  sf.Name,
+			Tagged:  tagged,
+			Index:   index,
+			Type:    sf.Type,
+			Options: options,
+		})
+	}
+
+	return fields, nil
+}
+
+// A DuplicateKeyError is returned when two values would be written to a Ruby hash under
+// the same key, such as two struct fields renamed to the same name or two map keys
+// whose Ruby literals are identical.  Decoders that disallow duplicate keys return one
+// for a hash that repeats a key, with Key holding its source and the remaining fields
+// locating the second occurrence.
+type DuplicateKeyError struct {
+	Type    reflect.Type
+	Key     string
+	Fields  []string
+	Path    string
+	Offset  int
+	Line    int
+	Column  int
+	Excerpt string
+}
+
+func (self *DuplicateKeyError) Error() string {
+	if len(self.Fields) > 0 {
+		return fmt.Sprintf("Duplicate key '%s' in %v, written by fields '%s'", self.Key, self.Type, strings.Join(self.Fields, `', '`))
+	} else if self.Line == 0 && self.Path != `` {
+		return fmt.Sprintf("Duplicate key %s in %v at %s", self.Key, self.Type, self.Path)
+	} else if self.Line == 0 {
+		return fmt.Sprintf("Duplicate key %s in %v", self.Key, self.Type)
+	}
+
+	var msg string
+
+	if self.Path != `` {
+		msg = fmt.Sprintf("Duplicate key %s in %v at %s, line %d, column %d", self.Key, self.Type, self.Path, self.Line, self.Column)
+	} else {
+		msg = fmt.Sprintf("Duplicate key %s in %v at line %d, column %d", self.Key, self.Type, self.Line, self.Column)
+	}
+
+	return msg + formatExcerpt(self.Excerpt, self.Column)
+}
+
+// names the given fields (applying the naming strategy to those not named by a tag)
+// and resolves fields that share a name using Go's rules for promoted fields: the
+// shallowest field wins, then a field named by a tag.  Fields that remain ambiguous
+// yield a *DuplicateKeyError.
+func dominantFields(t reflect.Type, fields []structField, naming NamingStrategy) ([]structField, error) {
+	named := make([]structField, len(fields))
+	byName := make(map[string][]int)
+
+	for i, field := range fields {
+		if !field.Tagged {
+			if naming != nil {
+				field.Name = naming(field.GoName)
+			} else {
+				field.Name = field.GoName
+			}
+		}
+
+		named[i] = field
+		byName[field.Name] = append(byName[field.Name], i)
+	}
+
+	dominant := make([]structField, 0, len(named))
+	resolved := make(map[string]bool)
+
+	for _, field := range named {
+		candidates := byName[field.Name]
+
+		if len(candidates) == 1 {
+			dominant = append(dominant, field)
+			continue
+		}
+
+		// only the first field with a given name decides what is written, and where
+		if resolved[field.Name] {
+			continue
+		}
+
+		resolved[field.Name] = true
+
+		sort.SliceStable(candidates, func(a, b int) bool {
+			fa, fb := named[candidates[a]], named[candidates[b]]
+
+			if len(fa.Index) != len(fb.Index) {
+				return len(fa.Index) < len(fb.Index)
+			}
+
+			return fa.Tagged && !fb.Tagged
+		})
+
+		first, second := named[candidates[0]], named[candidates[1]]
+
+		if len(first.Index) == len(second.Index) && first.Tagged == second.Tagged {
+			err := &DuplicateKeyError{
+				Type: t,
+				Key:  field.Name,
+			}
+
+			for _, c := range candidates {
+				err.Fields = append(err.Fields, named[c].GoName)
+			}
+
+			return nil, err
+		}
+
+		dominant = append(dominant, first)
+	}
+
+	return dominant, nil
+}
+
+// returns the first of the given keys present in the struct tag, along with its value
+func lookupTag(tag reflect.StructTag, tagKeys []string) (string, string) {
+	for _, key := range tagKeys {
+		if value, ok := tag.Lookup(key); ok {
+			return key, value
+		}
+	}
+
+	return ``, ``
+}
+
+// retrieves the value of a (possibly inlined) field, reporting false if a nil
+// pointer was encountered along the way
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 {
+			for v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					return reflect.Value{}, false
+				}
+
+				v = v.Elem()
+			}
+		}
+
+		v = v.Field(x)
+	}
+
+	return v, true
+}
+
+// ValidateType checks the `ruby` struct tags of the given type and of every struct
+// type reachable from it through fields, pointers, slices, arrays and maps.  It
+// returns a *TagError describing the first invalid tag found, if any.
+func ValidateType(t reflect.Type) error {
+	return validateType(t, map[reflect.Type]bool{})
+}
+
+func validateType(t reflect.Type, seen map[reflect.Type]bool) error {
+	if t == nil || seen[t] {
+		return nil
+	}
+
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return validateType(t.Elem(), seen)
+	case reflect.Map:
+		if err := validateType(t.Key(), seen); err != nil {
+			return err
+		}
+
+		return validateType(t.Elem(), seen)
+	case reflect.Struct:
+		fields, err := typeFields(t, nil, nil)
+
+		if err != nil {
+			return err
+		}
+
+		for _, field := range fields {
+			if err := validateType(field.Type, seen); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package ruby
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type TestStructDominanceBase struct {
+	Name  string `ruby:"name"`
+	Label string
+}
+
+type TestStructDominance struct {
+	TestStructDominanceBase `ruby:",inline"`
+	Name                    string `ruby:"name"`
+	Tagged                  string `ruby:"Label"`
+}
+
+type TestStructAmbiguous struct {
+	Name      string `ruby:"name"`
+	OtherName string `ruby:"name"`
+}
+
+type TestStructRenamedCollision struct {
+	HostName  string
+	Host_Name string
+}
+
+func TestEncodeStructDominance(t *testing.T) {
+	e := &encodeState{}
+
+	in := TestStructDominance{
+		TestStructDominanceBase: TestStructDominanceBase{
+			Name:  `inner`,
+			Label: `inner-label`,
+		},
+		Name:   `outer`,
+		Tagged: `outer-label`,
+	}
+
+	shouldBe := `{'name'=>'outer', 'Label'=>'outer-label'}`
+
+	if err := e.marshal(in); err != nil {
+		t.Fatal(err)
+	} else {
+		if s := e.String(); s != shouldBe {
+			t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+		} else {
+			t.Log(s)
+		}
+	}
+}
+
+func TestEncodeStructDuplicateKeys(t *testing.T) {
+	err := ValidateType(reflect.TypeOf(TestStructAmbiguous{}))
+
+	if dupErr, ok := err.(*DuplicateKeyError); !ok {
+		t.Fatalf("Expected *DuplicateKeyError, got %T (%v)", err, err)
+	} else if dupErr.Key != `name` || len(dupErr.Fields) != 2 {
+		t.Fatalf("Expected both fields to be reported for key 'name', got %v", dupErr)
+	} else {
+		t.Log(dupErr)
+	}
+
+	// these are only duplicates once renamed
+	if err := ValidateType(reflect.TypeOf(TestStructRenamedCollision{})); err != nil {
+		t.Fatal(err)
+	}
+
+	encoder := NewEncoder(&bytes.Buffer{})
+	encoder.SetFieldNaming(SnakeCase)
+
+	if err := encoder.Encode(TestStructRenamedCollision{}); err == nil {
+		t.Fatal("Expected an error for fields that collide once renamed")
+	} else if _, ok := err.(*DuplicateKeyError); !ok {
+		t.Fatalf("Expected *DuplicateKeyError, got %T (%v)", err, err)
+	} else {
+		t.Log(err)
+	}
+}
+
+func TestEncodeMapDuplicateKeys(t *testing.T) {
+	e := &encodeState{}
+
+	// distinct keys with distinct literals are fine, and sort deterministically
+	if err := e.marshal(map[interface{}]int{1: 1, `1`: 2}); err != nil {
+		t.Fatal(err)
+	} else if s, shouldBe := e.String(), `{'1'=>2, 1=>1}`; s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	}
+
+	encoder := NewEncoder(&bytes.Buffer{})
+	encoder.SetMapKeyNaming(SnakeCase)
+
+	err := encoder.Encode(map[string]int{
+		`HostName`:  1,
+		`host_name`: 2,
+	})
+
+	if dupErr, ok := err.(*DuplicateKeyError); !ok {
+		t.Fatalf("Expected *DuplicateKeyError, got %T (%v)", err, err)
+	} else if dupErr.Key != `'host_name'` {
+		t.Fatalf("Expected duplicate key 'host_name', got %v", dupErr)
+	} else {
+		t.Log(dupErr)
+	}
+}
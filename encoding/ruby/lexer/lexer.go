@@ -0,0 +1,820 @@
+package lexer
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrNeedMore is returned by an incremental Lexer when the input given to it so far ends
+// partway through a token.  Once more input is appended (or the input is closed), the
+// same token can be read again.
+var ErrNeedMore = errors.New(`Incomplete input, more is needed to read the next token`)
+
+var keywords = map[string]bool{
+	`__ENCODING__`: true,
+	`__FILE__`:     true,
+	`__LINE__`:     true,
+	`BEGIN`:        true,
+	`END`:          true,
+	`alias`:        true,
+	`and`:          true,
+	`begin`:        true,
+	`break`:        true,
+	`case`:         true,
+	`class`:        true,
+	`def`:          true,
+	`defined?`:     true,
+	`do`:           true,
+	`else`:         true,
+	`elsif`:        true,
+	`end`:          true,
+	`ensure`:       true,
+	`false`:        true,
+	`for`:          true,
+	`if`:           true,
+	`in`:           true,
+	`module`:       true,
+	`next`:         true,
+	`nil`:          true,
+	`not`:          true,
+	`or`:           true,
+	`redo`:         true,
+	`rescue`:       true,
+	`retry`:        true,
+	`return`:       true,
+	`self`:         true,
+	`super`:        true,
+	`then`:         true,
+	`true`:         true,
+	`undef`:        true,
+	`unless`:       true,
+	`until`:        true,
+	`when`:         true,
+	`while`:        true,
+	`yield`:        true,
+}
+
+// operators, longest first so that the longest match wins
+var operators = []string{
+	`**=`, `<=>`, `===`, `...`, `<<=`, `>>=`, `&&=`, `||=`,
+	`**`, `==`, `!=`, `>=`, `<=`, `&&`, `||`, `<<`, `>>`, `=~`, `!~`, `+=`, `-=`, `*=`,
+	`/=`, `%=`, `|=`, `&=`, `^=`, `..`, `::`, `->`, `=>`, `&.`,
+	`+`, `-`, `*`, `/`, `%`, `=`, `<`, `>`, `!`, `&`, `|`, `^`, `~`, `?`, `:`, `,`, `.`,
+	`;`, `(`, `)`, `[`, `]`, `{`, `}`,
+}
+
+// operators that can be written as symbols, longest first
+var symbolOperators = []string{
+	`[]=`, `<=>`, `===`, `[]`, `**`, `==`, `=~`, `!=`, `!~`, `<<`, `>>`, `<=`, `>=`, `+@`,
+	`-@`, `+`, `-`, `*`, `/`, `%`, `<`, `>`, `!`, `~`, `^`, `&`, `|`,
+}
+
+// A Lexer reads tokens from Ruby source.  Whether a character such as / or % begins a
+// literal or is an operator depends on the tokens before it, so a Lexer must be read
+// from start to finish.
+type Lexer struct {
+	src         []byte
+	base        int
+	pos         int
+	line        int
+	col         int
+	final       bool
+	short       bool
+	prev        Token
+	hasPrev     bool
+	spaceBefore bool
+	resume      int
+	resumeLine  int
+	ended       bool
+}
+
+// a position in the source, relative to the start of the retained input
+type mark struct {
+	pos  int
+	line int
+	col  int
+}
+
+// New returns a Lexer that reads the given source.
+func New(src []byte) *Lexer {
+	return NewAt(src, 0, 1, 1)
+}
+
+// NewAt returns a Lexer that reads source found at the given offset, line and column of
+// some larger input, such as the code of an interpolation.
+func NewAt(src []byte, offset int, line int, column int) *Lexer {
+	return &Lexer{
+		src:    src,
+		base:   offset,
+		line:   line,
+		col:    column,
+		final:  true,
+		resume: -1,
+	}
+}
+
+// NewIncremental returns a Lexer whose input is given piecemeal with Append.  Until Close
+// is called, reading a token that may continue past the input given so far returns
+// ErrNeedMore.
+func NewIncremental() *Lexer {
+	return &Lexer{
+		line:   1,
+		col:    1,
+		resume: -1,
+	}
+}
+
+// Tokenize returns all tokens in the given source, up to and including the EOF token.
+func Tokenize(src []byte) ([]Token, error) {
+	lex := New(src)
+	tokens := make([]Token, 0)
+
+	for {
+		tok, err := lex.Next()
+
+		if err != nil {
+			return tokens, err
+		}
+
+		tokens = append(tokens, tok)
+
+		if tok.Kind == EOF {
+			return tokens, nil
+		}
+	}
+}
+
+// Append adds input to an incremental Lexer.
+func (self *Lexer) Append(p []byte) {
+	self.src = append(self.src, p...)
+}
+
+// Close marks the end of an incremental Lexer's input.
+func (self *Lexer) Close() {
+	self.final = true
+}
+
+// Offset returns the byte offset at which the next token will be read.
+func (self *Lexer) Offset() int {
+	return self.base + self.pos
+}
+
+// Pending returns how much of the input given to an incremental Lexer has yet to be read
+// as tokens, including any token it needs more input to finish.
+func (self *Lexer) Pending() int {
+	return len(self.src) - self.pos
+}
+
+// Discard releases the input before the given offset, which will no longer be needed.
+// Input that has not yet been read is always retained.
+func (self *Lexer) Discard(offset int) {
+	n := offset - self.base
+
+	if n > self.pos {
+		n = self.pos
+	}
+
+	if n > 0 {
+		self.src = self.src[n:]
+		self.base += n
+		self.pos -= n
+	}
+}
+
+// Source returns the retained input between the given offsets, or nil if some of it was
+// discarded or has not been given yet.
+func (self *Lexer) Source(start int, end int) []byte {
+	s, e := start-self.base, end-self.base
+
+	if s < 0 || e > len(self.src) || s > e {
+		return nil
+	}
+
+	return self.src[s:e]
+}
+
+// Next reads the next token.  Once the end of the input is reached, it returns an EOF
+// token for every call.
+func (self *Lexer) Next() (Token, error) {
+	saved := *self
+	tok, err := self.next()
+
+	if self.short {
+		*self = saved
+		return Token{}, ErrNeedMore
+	}
+
+	return tok, err
+}
+
+func (self *Lexer) next() (Token, error) {
+	tok, err := self.scan()
+
+	if err == nil && tok.Kind != Comment {
+		self.prev = tok
+		self.hasPrev = true
+	}
+
+	return tok, err
+}
+
+// returns the byte at the given distance from the current position, or 0 past the end of
+// the input (noting that more is needed if the input isn't complete)
+func (self *Lexer) at(i int) byte {
+	if p := self.pos + i; p < len(self.src) {
+		return self.src[p]
+	}
+
+	if !self.final {
+		self.short = true
+	}
+
+	return 0
+}
+
+func (self *Lexer) atEnd() bool {
+	return self.at(0) == 0 && self.pos >= len(self.src)
+}
+
+func (self *Lexer) hasPrefix(prefix string) bool {
+	return self.hasPrefixAt(0, prefix)
+}
+
+func (self *Lexer) hasPrefixAt(offset int, prefix string) bool {
+	for i := 0; i < len(prefix); i++ {
+		if self.at(offset+i) != prefix[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (self *Lexer) advance(n int) {
+	for i := 0; i < n && self.pos < len(self.src); i++ {
+		if self.src[self.pos] == '\n' {
+			self.line += 1
+			self.col = 1
+		} else {
+			self.col += 1
+		}
+
+		self.pos += 1
+	}
+}
+
+func (self *Lexer) mark() mark {
+	return mark{
+		pos:  self.pos,
+		line: self.line,
+		col:  self.col,
+	}
+}
+
+func (self *Lexer) errorAt(at mark, msg string) *Error {
+	return &Error{
+		Offset: self.base + at.pos,
+		Line:   at.line,
+		Column: at.col,
+		Msg:    msg,
+	}
+}
+
+// moves past a line break, skipping the bodies of any heredocs begun on the line
+func (self *Lexer) advanceLine() {
+	self.advance(1)
+
+	if self.resume >= 0 {
+		self.pos = self.resume - self.base
+		self.line = self.resumeLine
+		self.col = 1
+		self.resume = -1
+	}
+}
+
+func (self *Lexer) scan() (Token, error) {
+	self.spaceBefore = false
+
+	for {
+		if c := self.at(0); c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v' {
+			self.advance(1)
+		} else if c == '\\' && self.at(1) == '\n' {
+			// line continuation
+			self.advance(1)
+			self.advanceLine()
+		} else if c == '\\' && self.at(1) == '\r' && self.at(2) == '\n' {
+			self.advance(2)
+			self.advanceLine()
+		} else {
+			break
+		}
+
+		self.spaceBefore = true
+	}
+
+	start := self.mark()
+	tok := Token{
+		Offset:      self.Offset(),
+		Line:        self.line,
+		Column:      self.col,
+		SpaceBefore: self.spaceBefore,
+	}
+
+	if self.ended || self.atEnd() {
+		tok.Kind = EOF
+		return tok, nil
+	}
+
+	if self.col == 1 {
+		if self.hasPrefix(`=begin`) && isSpaceOrEnd(self.at(6)) {
+			return self.scanBlockComment(tok, start)
+		} else if self.hasPrefix(`__END__`) && (self.at(7) == '\n' || self.at(7) == '\r' || self.pos+7 >= len(self.src)) {
+			// everything that follows is data, not code
+			self.ended = true
+			tok.Kind = EOF
+			return tok, nil
+		}
+	}
+
+	c := self.at(0)
+
+	switch {
+	case c == '\n':
+		tok.Kind = Newline
+		tok.Text = "\n"
+		self.advanceLine()
+		return tok, nil
+
+	case c == '#':
+		return self.finish(tok, start, Comment, ``), nil
+
+	case isDigit(c), (c == '-' || c == '+') && isDigit(self.at(1)) && self.valueExpected(1):
+		return self.scanNumber(tok, start)
+
+	case isIdentStart(c):
+		return self.scanIdentifier(tok, start), nil
+
+	case c == '@':
+		n := 1
+
+		if self.at(1) == '@' {
+			n = 2
+			tok.Kind = CVar
+		} else {
+			tok.Kind = IVar
+		}
+
+		if !isIdentStart(self.at(n)) {
+			return tok, self.errorAt(start, `Invalid instance variable name`)
+		}
+
+		for isIdentChar(self.at(n)) {
+			n += 1
+		}
+
+		self.advance(n)
+		tok.Text = string(self.src[start.pos:self.pos])
+		tok.Value = tok.Text
+		return tok, nil
+
+	case c == '$':
+		n := 1
+
+		if isIdentStart(self.at(1)) {
+			for isIdentChar(self.at(n)) {
+				n += 1
+			}
+		} else if isDigit(self.at(1)) {
+			for isDigit(self.at(n)) {
+				n += 1
+			}
+		} else if self.at(1) != 0 && strings.IndexByte("~*$?!@/\\;,.=:<>\"&`'+", self.at(1)) >= 0 {
+			n = 2
+		} else {
+			return tok, self.errorAt(start, `Invalid global variable name`)
+		}
+
+		self.advance(n)
+		tok.Kind = GVar
+		tok.Text = string(self.src[start.pos:self.pos])
+		tok.Value = tok.Text
+		return tok, nil
+
+	case c == '\'':
+		self.advance(1)
+		return self.scanString(tok, start, String, quote{open: '\'', close: '\'', mode: rawQuotes})
+
+	case c == '"':
+		self.advance(1)
+		return self.scanString(tok, start, String, quote{open: '"', close: '"', mode: escapedQuotes, interpolate: true})
+
+	case c == '`':
+		self.advance(1)
+		return self.scanString(tok, start, XString, quote{open: '`', close: '`', mode: escapedQuotes, interpolate: true})
+
+	case c == ':' && self.at(1) != ':':
+		if tok, ok, err := self.scanSymbol(tok, start); ok || err != nil {
+			return tok, err
+		}
+
+	case c == '%' && self.valueExpected(1) && self.percentLiteralAhead():
+		return self.scanPercent(tok, start)
+
+	case c == '/' && self.valueExpected(1):
+		self.advance(1)
+		return self.scanRegexp(tok, start, quote{open: '/', close: '/', mode: regexpQuotes, interpolate: true})
+
+	case c == '<' && self.at(1) == '<' && self.valueExpected(2) && self.heredocAhead():
+		return self.scanHeredoc(tok, start)
+
+	case c == '?' && self.valueExpected(1) && self.characterAhead():
+		return self.scanCharacter(tok, start)
+	}
+
+	for _, op := range operators {
+		if self.hasPrefix(op) {
+			self.advance(len(op))
+			return self.finish(tok, start, Operator, op), nil
+		}
+	}
+
+	r, _ := utf8.DecodeRune(self.src[self.pos:])
+	return tok, self.errorAt(start, `Unexpected character '`+string(r)+`'`)
+}
+
+// completes a token from the source read since the given mark
+func (self *Lexer) finish(tok Token, start mark, kind Kind, value string) Token {
+	if kind == Comment {
+		self.advance(self.lineEnd() - self.pos)
+	}
+
+	tok.Kind = kind
+	tok.Text = string(self.src[start.pos:self.pos])
+	tok.Value = value
+
+	return tok
+}
+
+// returns the position of the next line break, or the end of the input
+func (self *Lexer) lineEnd() int {
+	if i := bytes.IndexByte(self.src[self.pos:], '\n'); i >= 0 {
+		return self.pos + i
+	}
+
+	if !self.final {
+		self.short = true
+	}
+
+	return len(self.src)
+}
+
+// reports whether a value (rather than an operator) can begin at the current position,
+// judging by the token before it; this decides whether e.g. / begins a regexp or divides.
+// After a method name, a value is only expected where a space separates the two and
+// doesn't also follow the operator-like character, as in: puts -1, get /path/
+func (self *Lexer) valueExpected(width int) bool {
+	if !self.hasPrev {
+		return true
+	}
+
+	switch self.prev.Kind {
+	case Newline, Label:
+		return true
+	case Operator:
+		switch self.prev.Value {
+		case `)`, `]`, `}`:
+			return false
+		}
+
+		return true
+	case Keyword:
+		switch self.prev.Value {
+		case `end`, `self`, `nil`, `true`, `false`, `__FILE__`, `__LINE__`, `__ENCODING__`:
+			return false
+		}
+
+		return true
+	case Ident:
+		c := self.at(width)
+		return self.spaceBefore && !isSpace(c) && c != '=' && c != 0
+	}
+
+	return false
+}
+
+// reports whether a label may be read here; after the ? of a ternary, "a ? b: c" is
+// taken to mean the choice between b and c
+func (self *Lexer) labelAllowed() bool {
+	return !(self.hasPrev && self.prev.Is(Operator, `?`))
+}
+
+func (self *Lexer) scanIdentifier(tok Token, start mark) Token {
+	n := 0
+
+	for isIdentChar(self.at(n)) {
+		n += 1
+	}
+
+	// method names may end in ? or !, so long as that isn't the start of != or ?:
+	if c := self.at(n); (c == '?' || c == '!') && self.at(n+1) != '=' && !isUpper(self.src[self.pos]) {
+		if c == '!' || self.at(n+1) != ':' {
+			n += 1
+		}
+	}
+
+	name := string(self.src[self.pos : self.pos+n])
+
+	if self.at(n) == ':' && self.at(n+1) != ':' && self.labelAllowed() {
+		self.advance(n + 1)
+		return self.finish(tok, start, Label, name)
+	}
+
+	self.advance(n)
+
+	kind := Ident
+
+	if isUpper(name[0]) {
+		kind = Constant
+	}
+
+	// reserved words are only keywords where they aren't method names, as in: obj.class
+	if keywords[name] && !(self.hasPrev && (self.prev.Is(Operator, `.`) || self.prev.Is(Operator, `&.`))) {
+		kind = Keyword
+	}
+
+	return self.finish(tok, start, kind, name)
+}
+
+func (self *Lexer) scanNumber(tok Token, start mark) (Token, error) {
+	var value strings.Builder
+
+	if c := self.at(0); c == '-' || c == '+' {
+		if c == '-' {
+			value.WriteByte('-')
+		}
+
+		self.advance(1)
+	}
+
+	kind := Integer
+	digits := isDigit
+	decimal := true
+
+	if self.at(0) == '0' {
+		switch c := self.at(1); {
+		case c == 'x' || c == 'X':
+			value.WriteString(`0x`)
+			digits, decimal = isHexDigit, false
+			self.advance(2)
+		case c == 'b' || c == 'B':
+			value.WriteString(`0b`)
+			digits, decimal = isBinaryDigit, false
+			self.advance(2)
+		case c == 'o' || c == 'O':
+			value.WriteString(`0o`)
+			digits, decimal = isOctalDigit, false
+			self.advance(2)
+		case c == 'd' || c == 'D':
+			self.advance(2)
+		case c == '_' || isDigit(c):
+			// a leading zero means octal
+			value.WriteString(`0o`)
+			digits, decimal = isOctalDigit, false
+			self.advance(1)
+		}
+	}
+
+	if !self.scanDigits(&value, digits) {
+		return tok, self.errorAt(start, `Invalid number`)
+	}
+
+	if decimal {
+		if self.at(0) == '.' && isDigit(self.at(1)) {
+			value.WriteByte('.')
+			self.advance(1)
+			self.scanDigits(&value, isDigit)
+			kind = Float
+		}
+
+		if c := self.at(0); c == 'e' || c == 'E' {
+			if sign := self.at(1); isDigit(sign) || ((sign == '+' || sign == '-') && isDigit(self.at(2))) {
+				value.WriteByte('e')
+
+				if !isDigit(sign) {
+					value.WriteByte(sign)
+					self.advance(1)
+				}
+
+				self.advance(1)
+				self.scanDigits(&value, isDigit)
+				kind = Float
+			}
+		}
+	}
+
+	if self.at(0) == 'r' && !isIdentChar(self.at(1)) {
+		self.advance(1)
+		kind = Rational
+	} else if self.at(0) == 'i' && !isIdentChar(self.at(1)) {
+		self.advance(1)
+		kind = Imaginary
+	}
+
+	if isIdentChar(self.at(0)) {
+		return tok, self.errorAt(self.mark(), `Invalid character '`+string(self.at(0))+`' in number`)
+	}
+
+	return self.finish(tok, start, kind, value.String()), nil
+}
+
+// reads digits with single underscores between them, reporting whether there were any
+func (self *Lexer) scanDigits(value *strings.Builder, digits func(byte) bool) bool {
+	n := 0
+
+	for {
+		if c := self.at(0); digits(c) {
+			value.WriteByte(c)
+			self.advance(1)
+			n += 1
+		} else if c == '_' && n > 0 && digits(self.at(1)) {
+			self.advance(1)
+		} else {
+			return n > 0
+		}
+	}
+}
+
+func (self *Lexer) scanSymbol(tok Token, start mark) (Token, bool, error) {
+	switch c := self.at(1); {
+	case c == '"':
+		self.advance(2)
+		tok, err := self.scanString(tok, start, Symbol, quote{open: '"', close: '"', mode: escapedQuotes, interpolate: true})
+		return tok, true, err
+
+	case c == '\'':
+		self.advance(2)
+		tok, err := self.scanString(tok, start, Symbol, quote{open: '\'', close: '\'', mode: rawQuotes})
+		return tok, true, err
+
+	case isIdentStart(c), c == '@', c == '$':
+		n := 1
+
+		for n < 3 && (self.at(n) == '@' || (n == 1 && self.at(n) == '$')) {
+			n += 1
+		}
+
+		if !isIdentStart(self.at(n)) {
+			return tok, false, nil
+		}
+
+		for isIdentChar(self.at(n)) {
+			n += 1
+		}
+
+		// setters and predicates, but not :a==b or :a=>b
+		if c := self.at(n); c == '?' || c == '!' {
+			n += 1
+		} else if c == '=' && self.at(n+1) != '=' && self.at(n+1) != '~' && self.at(n+1) != '>' {
+			n += 1
+		}
+
+		name := string(self.src[self.pos+1 : self.pos+n])
+		self.advance(n)
+
+		return self.finish(tok, start, Symbol, name), true, nil
+	}
+
+	for _, op := range symbolOperators {
+		if self.hasPrefixAt(1, op) {
+			self.advance(1 + len(op))
+			return self.finish(tok, start, Symbol, op), true, nil
+		}
+	}
+
+	return tok, false, nil
+}
+
+// reports whether the % at the current position begins a literal such as %w[]
+func (self *Lexer) percentLiteralAhead() bool {
+	if c := self.at(1); isPercentDelimiter(c) {
+		return true
+	} else if strings.IndexByte(`qQwWiIrsx`, c) >= 0 && c != 0 {
+		return isPercentDelimiter(self.at(2))
+	}
+
+	return false
+}
+
+// reports whether the << at the current position begins a heredoc
+func (self *Lexer) heredocAhead() bool {
+	n := 2
+
+	if c := self.at(n); c == '~' || c == '-' {
+		n += 1
+	}
+
+	switch c := self.at(n); {
+	case c == '\'' || c == '"' || c == '`':
+		return true
+	default:
+		return isIdentStart(c)
+	}
+}
+
+// reports whether the ? at the current position begins a character literal such as ?a
+func (self *Lexer) characterAhead() bool {
+	c := self.at(1)
+
+	if c == 0 || isSpace(c) {
+		return false
+	} else if c == '\\' {
+		return true
+	}
+
+	_, size := utf8.DecodeRune(self.src[self.pos+1:])
+	return !isIdentChar(self.at(1 + size))
+}
+
+func (self *Lexer) scanCharacter(tok Token, start mark) (Token, error) {
+	self.advance(1)
+
+	b := &contentBuilder{}
+
+	if self.at(0) == '\\' {
+		if err := self.scanDoubleEscape(b); err != nil {
+			return tok, err
+		}
+	} else {
+		_, size := utf8.DecodeRune(self.src[self.pos:])
+		b.text.Write(self.src[self.pos : self.pos+size])
+		self.advance(size)
+	}
+
+	b.flushText()
+	return self.finish(tok, start, Character, b.joined()), nil
+}
+
+func (self *Lexer) scanBlockComment(tok Token, start mark) (Token, error) {
+	for {
+		self.advance(self.lineEnd() - self.pos)
+
+		if self.atEnd() {
+			return tok, self.errorAt(start, `Unterminated =begin comment`)
+		}
+
+		// move to the start of the next line
+		self.advance(1)
+
+		if self.hasPrefix(`=end`) && isSpaceOrEnd(self.at(4)) {
+			self.advance(self.lineEnd() - self.pos)
+			return self.finish(tok, start, Comment, ``), nil
+		}
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isSpaceOrEnd(c byte) bool {
+	return c == 0 || isSpace(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isOctalDigit(c byte) bool {
+	return c >= '0' && c <= '7'
+}
+
+func isBinaryDigit(c byte) bool {
+	return c == '0' || c == '1'
+}
+
+func isUpper(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || isUpper(c)
+}
+
+// non-ASCII characters may appear in identifiers
+func isIdentStart(c byte) bool {
+	return isAlpha(c) || c == '_' || c >= 0x80
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+func isPercentDelimiter(c byte) bool {
+	return c != 0 && c < 0x80 && !isSpace(c) && !isAlpha(c) && !isDigit(c) && c != '_' && c != '='
+}
@@ -0,0 +1,246 @@
+package lexer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// renders tokens compactly as kind:value, for comparing against expectations
+func describe(tokens []Token) string {
+	out := make([]string, 0, len(tokens))
+
+	for _, tok := range tokens {
+		switch tok.Kind {
+		case EOF:
+			continue
+		case Newline:
+			out = append(out, `NL`)
+		case Words, Symbols:
+			elems := make([]string, len(tok.Elements))
+
+			for i, elem := range tok.Elements {
+				elems[i] = elem.Value
+			}
+
+			out = append(out, fmt.Sprintf("%v:%s", tok.Kind, strings.Join(elems, `|`)))
+		default:
+			if len(tok.Parts) > 0 {
+				parts := make([]string, len(tok.Parts))
+
+				for i, part := range tok.Parts {
+					if part.Interpolation {
+						parts[i] = `#{` + part.Code + `}`
+					} else {
+						parts[i] = part.Text
+					}
+				}
+
+				out = append(out, fmt.Sprintf("%v:%s", tok.Kind, strings.Join(parts, `|`)))
+			} else {
+				out = append(out, fmt.Sprintf("%v:%s", tok.Kind, tok.Value))
+			}
+		}
+	}
+
+	return strings.Join(out, ` `)
+}
+
+func assertTokens(t *testing.T, src string, expected string) {
+	t.Helper()
+
+	tokens, err := Tokenize([]byte(src))
+
+	if err != nil {
+		t.Fatalf("Unexpected error tokenizing %q: %v", src, err)
+	}
+
+	if actual := describe(tokens); actual != expected {
+		t.Fatalf("Expected \"%s\", got \"%s\"", expected, actual)
+	}
+}
+
+func TestLexIdentifiers(t *testing.T) {
+	assertTokens(t, `config.vm.box = "base"`, `identifier:config operator:. identifier:vm operator:. identifier:box operator:= string:base`)
+	assertTokens(t, `empty? save! a!=b`, `identifier:empty? identifier:save! identifier:a operator:!= identifier:b`)
+	assertTokens(t, `Vagrant::Config @name @@count $stdout $0`, `constant:Vagrant operator::: constant:Config instance variable:@name class variable:@@count global variable:$stdout global variable:$0`)
+	assertTokens(t, `if x then nil end; obj.class`, `keyword:if identifier:x keyword:then keyword:nil keyword:end operator:; identifier:obj operator:. identifier:class`)
+	assertTokens(t, `defined?(x)`, `keyword:defined? operator:( identifier:x operator:)`)
+}
+
+func TestLexSymbolsAndLabels(t *testing.T) {
+	assertTokens(t, `:name :"quoted name" :'raw' :+ :[]= :name= :empty?`, `symbol:name symbol:quoted name symbol:raw symbol:+ symbol:[]= symbol:name= symbol:empty?`)
+	assertTokens(t, `{name: 1, "key": 2, :sym => 3}`, `operator:{ label:name integer:1 operator:, label:key integer:2 operator:, symbol:sym operator:=> integer:3 operator:}`)
+	assertTokens(t, `a ? b : c`, `identifier:a operator:? identifier:b operator:: identifier:c`)
+	assertTokens(t, `x ? y: z`, `identifier:x operator:? identifier:y operator:: identifier:z`)
+}
+
+func TestLexNumbers(t *testing.T) {
+	assertTokens(t, `1_000_000 0x1F 0b1010 0o17 017 0d99 1.5 1e10 2.5E-3 3r 2i`, `integer:1000000 integer:0x1F integer:0b1010 integer:0o17 integer:0o17 integer:99 float:1.5 float:1e10 float:2.5e-3 rational:3 imaginary:2`)
+	assertTokens(t, `x = -1`, `identifier:x operator:= integer:-1`)
+	assertTokens(t, `x - 1`, `identifier:x operator:- integer:1`)
+	assertTokens(t, `puts -1`, `identifier:puts integer:-1`)
+	assertTokens(t, `1.times`, `integer:1 operator:. identifier:times`)
+
+	for _, bad := range []string{`0x`, `1abc`, `09`} {
+		if _, err := Tokenize([]byte(bad)); err == nil {
+			t.Fatalf("Expected an error tokenizing %q", bad)
+		}
+	}
+}
+
+func TestLexStrings(t *testing.T) {
+	assertTokens(t, `'it\'s' 'a\nb'`, `string:it's string:a\nb`)
+	assertTokens(t, `"tab\there" "q\"uote"`, "string:tab\there string:q\"uote")
+	assertTokens(t, `"a#{b}c" "#{"nested #{x}"}"`, `string:a|#{b}|c string:#{"nested #{x}"}`)
+	assertTokens(t, `"#{h.map { |k| k }}"`, `string:#{h.map { |k| k }}`)
+	assertTokens(t, `%q(a (nested) b), %Q[#{x}], %(plain)`, `string:a (nested) b operator:, string:#{x} operator:, string:plain`)
+	assertTokens(t, `%w[a b\ c], %i(x y)`, `word list:a|b c operator:, symbol list:x|y`)
+	assertTokens(t, `%W[a#{b} c]`, `word list:|c`)
+	assertTokens(t, "`ls`", `command string:ls`)
+	assertTokens(t, `?a`, `character:a`)
+	assertTokens(t, `"é"`, `string:é`)
+	assertTokens(t, `"\x41\101\0" "\u00e9\u{48 49}\u{1F600}"`, "string:AA\x00 string:éHI\U0001F600")
+	assertTokens(t, `"\ca\C-a\c?" "\M-a\M-\C-a\C-\M-a"`, "string:\x01\x01\x7f string:\xe1\x81\x81")
+	assertTokens(t, `?\C-a`, "character:\x01")
+}
+
+func TestLexRegexps(t *testing.T) {
+	tokens, err := Tokenize([]byte(`x =~ /a\/b#{c}/mi; y = 4 / 2; %r{a/b}; /\.\\/; %r{a\}b}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := `identifier:x operator:=~ regular expression:a/b|#{c} operator:; identifier:y operator:= integer:4 operator:/ integer:2 operator:; regular expression:a/b operator:; regular expression:\.\\ operator:; regular expression:a\}b`; describe(tokens) != expected {
+		t.Fatalf("Expected \"%s\", got \"%s\"", expected, describe(tokens))
+	}
+
+	if tokens[2].Flags != `mi` {
+		t.Fatalf("Expected \"mi\", got \"%s\"", tokens[2].Flags)
+	}
+}
+
+func TestLexHeredocs(t *testing.T) {
+	assertTokens(t, "x = <<~EOS\n  one\n    two\n  EOS\ny", "identifier:x operator:= string:one\n  two\n NL identifier:y")
+	assertTokens(t, "f(<<-A, <<'B')\n  a #{1}\n  A\nraw #{1}\nB\nz", "identifier:f operator:( string:  a |#{1}|\n operator:, string:raw #{1}\n operator:) NL identifier:z")
+
+	tokens, err := Tokenize([]byte("a = <<EOS\nbody\nEOS\nb"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if last := tokens[len(tokens)-2]; last.Value != `b` || last.Line != 4 || last.Column != 1 {
+		t.Fatalf("Expected 'b' at 4:1, got '%s' at %d:%d", last.Value, last.Line, last.Column)
+	}
+
+	if _, err := Tokenize([]byte("x = <<~EOS\nnever ends\n")); err == nil {
+		t.Fatalf("Expected an error for an unterminated heredoc")
+	}
+}
+
+func TestLexComments(t *testing.T) {
+	assertTokens(t, "a # trailing\n=begin\nblock\n=end\nb", "identifier:a comment: NL comment: NL identifier:b")
+	assertTokens(t, "a\n__END__\nnot code", "identifier:a NL")
+}
+
+func TestLexPositions(t *testing.T) {
+	tokens, err := Tokenize([]byte("foo = {\n  bar: 'baz'\n}"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bar := tokens[4]
+
+	if bar.Kind != Label || bar.Offset != 10 || bar.Line != 2 || bar.Column != 3 || !bar.SpaceBefore {
+		t.Fatalf("Unexpected position for %v: offset %d, %d:%d", bar, bar.Offset, bar.Line, bar.Column)
+	}
+
+	if baz := tokens[5]; baz.Text != `'baz'` || baz.End() != 20 {
+		t.Fatalf("Unexpected text or end for %v: %d", baz, baz.End())
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	_, err := Tokenize([]byte("x = [\n  'unterminated\n"))
+
+	var lexErr *Error
+
+	if !errors.As(err, &lexErr) {
+		t.Fatalf("Expected a *lexer.Error, got %v", err)
+	}
+
+	if lexErr.Line != 2 || lexErr.Column != 3 || lexErr.Msg != `Unterminated string` {
+		t.Fatalf("Unexpected error: %v", lexErr)
+	}
+}
+
+func TestLexEscapeErrors(t *testing.T) {
+	for source, msg := range map[string]string{
+		`"\xZ"`:         `Invalid hex escape`,
+		`"\u12"`:        `Invalid Unicode escape`,
+		`"\u{110000}"`:  `Invalid Unicode codepoint`,
+		`"\uD800"`:      `Invalid Unicode codepoint`,
+		`"\u{1234567}"`: `Invalid Unicode escape`,
+		`"\M"`:          `Invalid escape character syntax`,
+	} {
+		_, err := Tokenize([]byte(source))
+
+		var lexErr *Error
+
+		if !errors.As(err, &lexErr) {
+			t.Fatalf("%s: Expected a *lexer.Error, got %v", source, err)
+		} else if lexErr.Msg != msg || lexErr.Column != 2 {
+			t.Fatalf("%s: Expected %q at column 2, got %q at column %d", source, msg, lexErr.Msg, lexErr.Column)
+		}
+	}
+}
+
+func TestLexIncremental(t *testing.T) {
+	src := "items = [1, 'two', <<~EOS, :four]\n  three\nEOS\n# done\n"
+	expected, err := Tokenize([]byte(src))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// feed the source a byte at a time, only reading tokens that are complete
+	lex := NewIncremental()
+	tokens := make([]Token, 0)
+
+	for i := 0; i <= len(src); i++ {
+		if i < len(src) {
+			lex.Append([]byte{src[i]})
+		} else {
+			lex.Close()
+		}
+
+		for {
+			tok, err := lex.Next()
+
+			if err == ErrNeedMore {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			tokens = append(tokens, tok)
+			lex.Discard(tok.Offset)
+
+			if tok.Kind == EOF {
+				break
+			}
+		}
+	}
+
+	if describe(tokens) != describe(expected) {
+		t.Fatalf("Expected \"%s\", got \"%s\"", describe(expected), describe(tokens))
+	}
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("Expected %d tokens, got %d", len(expected), len(tokens))
+	}
+}
@@ -0,0 +1,732 @@
+package lexer
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// how backslashes within a literal are treated
+type quoteMode int
+
+const (
+	// single-quoted: only backslashes and the delimiters can be escaped
+	rawQuotes quoteMode = iota
+
+	// double-quoted: the full set of escape sequences
+	escapedQuotes
+
+	// regexps: escapes are kept as written, for the regexp engine to interpret
+	regexpQuotes
+
+	// single-quoted heredocs: backslashes have no special meaning at all
+	literalQuotes
+)
+
+// describes how to read the contents of a string-like literal
+type quote struct {
+	open        byte
+	close       byte
+	mode        quoteMode
+	interpolate bool
+	words       bool
+}
+
+// collects the text and interpolations of a literal as it is read
+type contentBuilder struct {
+	parts []Part
+	text  bytes.Buffer
+	words [][]Part
+}
+
+func (self *contentBuilder) flushText() {
+	if self.text.Len() > 0 {
+		self.parts = append(self.parts, Part{
+			Text: self.text.String(),
+		})
+
+		self.text.Reset()
+	}
+}
+
+func (self *contentBuilder) interpolate(part Part) {
+	self.flushText()
+	self.parts = append(self.parts, part)
+}
+
+func (self *contentBuilder) endWord() {
+	self.flushText()
+
+	if len(self.parts) > 0 {
+		self.words = append(self.words, self.parts)
+		self.parts = nil
+	}
+}
+
+// returns the literal text of all parts, ignoring interpolations
+func (self *contentBuilder) joined() string {
+	return joinParts(self.parts)
+}
+
+func joinParts(parts []Part) string {
+	var text strings.Builder
+
+	for _, part := range parts {
+		text.WriteString(part.Text)
+	}
+
+	return text.String()
+}
+
+// sets the token's value, or its parts if it contains interpolations
+func setContent(tok *Token, parts []Part) {
+	for _, part := range parts {
+		if part.Interpolation {
+			tok.Parts = parts
+			return
+		}
+	}
+
+	tok.Value = joinParts(parts)
+}
+
+// returns the closing delimiter for the given opening one
+func closingDelimiter(open byte) byte {
+	switch open {
+	case '(':
+		return ')'
+	case '[':
+		return ']'
+	case '{':
+		return '}'
+	case '<':
+		return '>'
+	default:
+		return open
+	}
+}
+
+// reads the contents of a literal up to its closing delimiter, which is consumed; with
+// no closing delimiter, the contents run to the end of the input
+func (self *Lexer) scanContent(q quote, start mark, noun string) (*contentBuilder, error) {
+	b := &contentBuilder{}
+	depth := 0
+
+	for {
+		if self.atEnd() {
+			if q.close == 0 || self.short {
+				break
+			}
+
+			return nil, self.errorAt(start, `Unterminated `+noun)
+		}
+
+		c := self.at(0)
+
+		if c == q.close && depth == 0 {
+			self.advance(1)
+			break
+		} else if q.open != q.close {
+			if c == q.open {
+				depth += 1
+			} else if c == q.close {
+				depth -= 1
+			}
+		}
+
+		switch {
+		case c == '\\' && q.mode != literalQuotes:
+			if err := self.scanEscape(b, q); err != nil {
+				return nil, err
+			}
+
+		case q.interpolate && c == '#' && self.at(1) == '{':
+			part, err := self.scanInterpolation()
+
+			if err != nil {
+				return nil, err
+			} else if self.short {
+				return b, nil
+			}
+
+			b.interpolate(part)
+
+		case q.words && isSpace(c):
+			b.endWord()
+			self.advance(1)
+
+		default:
+			b.text.WriteByte(c)
+			self.advance(1)
+		}
+	}
+
+	if q.words {
+		b.endWord()
+	} else {
+		b.flushText()
+	}
+
+	return b, nil
+}
+
+// reads a backslash and what follows it
+func (self *Lexer) scanEscape(b *contentBuilder, q quote) error {
+	c := self.at(1)
+
+	switch q.mode {
+	case escapedQuotes:
+		return self.scanDoubleEscape(b)
+
+	case regexpQuotes:
+		// as in Ruby, an escaped delimiter is just the delimiter (e.g.: the source of /a\/b/
+		// is a/b) unless it means something unescaped
+		if c != q.close || strings.IndexByte(`$*+.?^|)]}>`, c) >= 0 {
+			b.text.WriteByte('\\')
+		}
+
+		b.text.WriteByte(c)
+
+	default:
+		if c == '\\' || c == q.close || c == q.open || (q.words && isSpace(c)) {
+			b.text.WriteByte(c)
+		} else {
+			b.text.WriteByte('\\')
+			self.advance(1)
+			return nil
+		}
+	}
+
+	self.advance(2)
+	return nil
+}
+
+// reads an escape sequence as found in double-quoted strings
+func (self *Lexer) scanDoubleEscape(b *contentBuilder) error {
+	start := self.mark()
+	c := self.at(1)
+
+	switch c {
+	case 'n':
+		b.text.WriteByte('\n')
+	case 't':
+		b.text.WriteByte('\t')
+	case 'r':
+		b.text.WriteByte('\r')
+	case 's':
+		b.text.WriteByte(' ')
+	case 'e':
+		b.text.WriteByte(0x1b)
+	case 'a':
+		b.text.WriteByte(0x07)
+	case 'b':
+		b.text.WriteByte(0x08)
+	case 'f':
+		b.text.WriteByte(0x0c)
+	case 'v':
+		b.text.WriteByte(0x0b)
+	case '\n':
+		// an escaped line break continues the string without one
+	case 'u':
+		return self.scanUnicodeEscape(b, start)
+
+	case 'x':
+		// one or two hex digits give a byte: \x41
+		n, value := self.scanEscapeDigits(2, 2, 16)
+
+		if n == 0 {
+			return self.errorAt(start, `Invalid hex escape`)
+		}
+
+		b.text.WriteByte(byte(value))
+		self.advance(2 + n)
+		return nil
+
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		// one to three octal digits give a byte: \0, \101
+		n, value := self.scanEscapeDigits(1, 3, 8)
+
+		b.text.WriteByte(byte(value))
+		self.advance(1 + n)
+		return nil
+
+	case 'c', 'C', 'M':
+		value, err := self.scanMetaEscape(start)
+
+		if err != nil {
+			return err
+		}
+
+		b.text.WriteByte(value)
+		return nil
+
+	default:
+		// any other character stands for itself
+		b.text.WriteByte(c)
+	}
+
+	self.advance(2)
+	return nil
+}
+
+// reads up to max digits in the given base, beginning at the given distance from the
+// current position, returning how many there were and their value
+func (self *Lexer) scanEscapeDigits(offset int, max int, base int) (int, uint64) {
+	n := 0
+
+	for n < max {
+		c := self.at(offset + n)
+
+		if base == 16 && !isHexDigit(c) || base == 8 && !isOctalDigit(c) {
+			break
+		}
+
+		n += 1
+	}
+
+	value, _ := strconv.ParseUint(string(self.src[self.pos+offset:self.pos+offset+n]), base, 32)
+	return n, value
+}
+
+// reads a Unicode escape: either four hex digits (\u00e9) or, between braces, any number
+// of codepoints of up to six hex digits each, separated by spaces (\u{48 1F600})
+func (self *Lexer) scanUnicodeEscape(b *contentBuilder, start mark) error {
+	if self.at(2) != '{' {
+		n, value := self.scanEscapeDigits(2, 4, 16)
+
+		if n != 4 {
+			return self.errorAt(start, `Invalid Unicode escape`)
+		} else if !validCodepoint(value) {
+			return self.errorAt(start, `Invalid Unicode codepoint`)
+		}
+
+		b.text.WriteRune(rune(value))
+		self.advance(6)
+		return nil
+	}
+
+	self.advance(3)
+
+	for {
+		for self.at(0) == ' ' || self.at(0) == '\t' {
+			self.advance(1)
+		}
+
+		if self.at(0) == '}' {
+			break
+		}
+
+		n, value := self.scanEscapeDigits(0, 6, 16)
+
+		if n == 0 || isHexDigit(self.at(n)) {
+			return self.errorAt(start, `Invalid Unicode escape`)
+		} else if !validCodepoint(value) {
+			return self.errorAt(start, `Invalid Unicode codepoint`)
+		}
+
+		b.text.WriteRune(rune(value))
+		self.advance(n)
+	}
+
+	self.advance(1)
+	return nil
+}
+
+// reports whether a value is a Unicode codepoint that can be encoded as UTF-8
+func validCodepoint(value uint64) bool {
+	return value <= unicode.MaxRune && (value < 0xd800 || value > 0xdfff)
+}
+
+// reads a control or meta escape (\cx or \C-x, and \M-x), which may be combined as in
+// \M-\C-x, returning the byte it stands for
+func (self *Lexer) scanMetaEscape(start mark) (byte, error) {
+	kind := self.at(1)
+
+	switch {
+	case kind == 'c':
+		self.advance(2)
+	case (kind == 'C' || kind == 'M') && self.at(2) == '-':
+		self.advance(3)
+	default:
+		return 0, self.errorAt(start, `Invalid escape character syntax`)
+	}
+
+	var c byte
+
+	switch next := self.at(1); {
+	case self.atEnd() || self.at(0) >= utf8.RuneSelf:
+		return 0, self.errorAt(start, `Invalid escape character syntax`)
+
+	case self.at(0) == '\\' && (next == 'c' || next == 'C' || next == 'M'):
+		value, err := self.scanMetaEscape(start)
+
+		if err != nil {
+			return 0, err
+		}
+
+		c = value
+
+	case self.at(0) == '\\':
+		// the character may itself be escaped, as in \C-\s
+		escaped := &contentBuilder{}
+
+		if err := self.scanDoubleEscape(escaped); err != nil {
+			return 0, err
+		} else if escaped.text.Len() != 1 {
+			return 0, self.errorAt(start, `Invalid escape character syntax`)
+		}
+
+		c = escaped.text.Bytes()[0]
+
+	default:
+		c = self.at(0)
+		self.advance(1)
+	}
+
+	switch {
+	case kind == 'M':
+		return c | 0x80, nil
+	case c == '?':
+		return 0x7f, nil
+	}
+
+	return c & 0x9f, nil
+}
+
+// reads #{...}, returning the code within
+func (self *Lexer) scanInterpolation() (Part, error) {
+	start := self.mark()
+	self.advance(2)
+
+	part := Part{
+		Interpolation: true,
+		Offset:        self.Offset(),
+		Line:          self.line,
+		Column:        self.col,
+	}
+
+	sub := &Lexer{
+		src:    self.src,
+		base:   self.base,
+		pos:    self.pos,
+		line:   self.line,
+		col:    self.col,
+		final:  self.final,
+		resume: -1,
+	}
+
+	depth := 0
+
+	for {
+		tok, err := sub.next()
+
+		if sub.short {
+			self.short = true
+			return part, nil
+		} else if err != nil {
+			return part, err
+		}
+
+		switch {
+		case tok.Kind == EOF:
+			return part, self.errorAt(start, `Unterminated interpolation`)
+
+		case tok.Is(Operator, `{`):
+			depth += 1
+
+		case tok.Is(Operator, `}`):
+			if depth == 0 {
+				part.Code = string(self.src[self.pos : tok.Offset-self.base])
+				self.pos, self.line, self.col = sub.pos, sub.line, sub.col
+				return part, nil
+			}
+
+			depth -= 1
+		}
+	}
+}
+
+// reads a quoted literal whose opening delimiter has been consumed
+func (self *Lexer) scanString(tok Token, start mark, kind Kind, q quote) (Token, error) {
+	noun := `string`
+
+	if kind == Symbol {
+		noun = `symbol`
+	}
+
+	b, err := self.scanContent(q, start, noun)
+
+	if err != nil || self.short {
+		return tok, err
+	}
+
+	// "name": is a label, just as name: is
+	if kind == String && (q.close == '"' || q.close == '\'') && self.at(0) == ':' && self.at(1) != ':' && self.labelAllowed() {
+		self.advance(1)
+		kind = Label
+	}
+
+	tok = self.finish(tok, start, kind, ``)
+	setContent(&tok, b.parts)
+
+	return tok, nil
+}
+
+func (self *Lexer) scanRegexp(tok Token, start mark, q quote) (Token, error) {
+	b, err := self.scanContent(q, start, `regular expression`)
+
+	if err != nil || self.short {
+		return tok, err
+	}
+
+	n := 0
+
+	for c := self.at(n); c != 0 && strings.IndexByte(`imxounse`, c) >= 0; c = self.at(n) {
+		n += 1
+	}
+
+	tok.Flags = string(self.src[self.pos : self.pos+n])
+	self.advance(n)
+
+	tok = self.finish(tok, start, Regexp, ``)
+	setContent(&tok, b.parts)
+
+	return tok, nil
+}
+
+// reads %q(), %w[] and the like
+func (self *Lexer) scanPercent(tok Token, start mark) (Token, error) {
+	n := 1
+	kind := byte('Q')
+
+	if isAlpha(self.at(1)) {
+		kind = self.at(1)
+		n = 2
+	}
+
+	open := self.at(n)
+	q := quote{
+		open:  open,
+		close: closingDelimiter(open),
+	}
+
+	self.advance(n + 1)
+
+	switch kind {
+	case 'q':
+		q.mode = rawQuotes
+		return self.scanString(tok, start, String, q)
+
+	case 'Q':
+		q.mode, q.interpolate = escapedQuotes, true
+		return self.scanString(tok, start, String, q)
+
+	case 's':
+		q.mode = rawQuotes
+		return self.scanString(tok, start, Symbol, q)
+
+	case 'x':
+		q.mode, q.interpolate = escapedQuotes, true
+		return self.scanString(tok, start, XString, q)
+
+	case 'r':
+		q.mode, q.interpolate = regexpQuotes, true
+		return self.scanRegexp(tok, start, q)
+
+	case 'w', 'W', 'i', 'I':
+		q.words = true
+
+		if kind == 'W' || kind == 'I' {
+			q.mode, q.interpolate = escapedQuotes, true
+		}
+
+		b, err := self.scanContent(q, start, `list`)
+
+		if err != nil || self.short {
+			return tok, err
+		}
+
+		listKind, elemKind := Words, String
+
+		if kind == 'i' || kind == 'I' {
+			listKind, elemKind = Symbols, Symbol
+		}
+
+		tok = self.finish(tok, start, listKind, ``)
+		tok.Elements = make([]Token, len(b.words))
+
+		for i, parts := range b.words {
+			elem := Token{
+				Kind:   elemKind,
+				Offset: tok.Offset,
+				Line:   tok.Line,
+				Column: tok.Column,
+			}
+
+			setContent(&elem, parts)
+			tok.Elements[i] = elem
+		}
+
+		return tok, nil
+	}
+
+	return tok, self.errorAt(start, `Unknown type of %string`)
+}
+
+// reads <<ID, <<-ID and <<~ID (optionally with the ID quoted), along with the body of
+// the heredoc, which starts on the following line
+func (self *Lexer) scanHeredoc(tok Token, start mark) (Token, error) {
+	n := 2
+	squiggly, dash := false, false
+
+	switch self.at(n) {
+	case '~':
+		squiggly = true
+		n += 1
+	case '-':
+		dash = true
+		n += 1
+	}
+
+	kind := String
+	q := quote{mode: escapedQuotes, interpolate: true}
+
+	var id string
+
+	switch c := self.at(n); c {
+	case '\'', '"', '`':
+		m := n + 1
+
+		for self.at(m) != c {
+			if self.at(m) == '\n' || self.at(m) == 0 {
+				return tok, self.errorAt(start, `Unterminated heredoc identifier`)
+			}
+
+			m += 1
+		}
+
+		id = string(self.src[self.pos+n+1 : self.pos+m])
+		n = m + 1
+
+		if c == '\'' {
+			q = quote{mode: literalQuotes}
+		} else if c == '`' {
+			kind = XString
+		}
+	default:
+		m := n
+
+		for isIdentChar(self.at(m)) {
+			m += 1
+		}
+
+		id = string(self.src[self.pos+n : self.pos+m])
+		n = m
+	}
+
+	self.advance(n)
+
+	// the body follows the current line, or the body of an earlier heredoc on this line
+	var bodyStart, bodyLine int
+
+	if self.resume >= 0 {
+		bodyStart, bodyLine = self.resume-self.base, self.resumeLine
+	} else {
+		end := self.lineEnd()
+
+		if end >= len(self.src) {
+			return tok, self.errorAt(start, `Unterminated heredoc`)
+		}
+
+		bodyStart, bodyLine = end+1, self.line+1
+	}
+
+	lineStart, lines := bodyStart, 0
+
+	for {
+		if lineStart >= len(self.src) {
+			if !self.final {
+				self.short = true
+				return tok, nil
+			}
+
+			return tok, self.errorAt(start, `Unterminated heredoc, expected '`+id+`'`)
+		}
+
+		lineEnd, next := len(self.src), len(self.src)
+
+		if i := bytes.IndexByte(self.src[lineStart:], '\n'); i >= 0 {
+			lineEnd, next = lineStart+i, lineStart+i+1
+		} else if !self.final {
+			self.short = true
+			return tok, nil
+		}
+
+		line := strings.TrimRight(string(self.src[lineStart:lineEnd]), "\r")
+
+		if squiggly || dash {
+			line = strings.TrimLeft(line, " \t")
+		}
+
+		if line == id {
+			self.resume, self.resumeLine = self.base+next, bodyLine+lines+1
+			break
+		}
+
+		lineStart, lines = next, lines+1
+	}
+
+	body := self.src[bodyStart:lineStart]
+
+	if squiggly {
+		body = dedent(body)
+	}
+
+	sub := NewAt(body, self.base+bodyStart, bodyLine, 1)
+	b, err := sub.scanContent(q, sub.mark(), `heredoc`)
+
+	if err != nil {
+		return tok, err
+	}
+
+	tok = self.finish(tok, start, kind, ``)
+	setContent(&tok, b.parts)
+
+	return tok, nil
+}
+
+// removes the indentation common to all non-blank lines, as <<~ does
+func dedent(body []byte) []byte {
+	lines := strings.SplitAfter(string(body), "\n")
+	indent := -1
+
+	for _, line := range lines {
+		if strings.TrimSpace(line) == `` {
+			continue
+		}
+
+		if width := len(line) - len(strings.TrimLeft(line, " \t")); indent < 0 || width < indent {
+			indent = width
+		}
+	}
+
+	if indent <= 0 {
+		return body
+	}
+
+	var out strings.Builder
+
+	for _, line := range lines {
+		width := len(line) - len(strings.TrimLeft(line, " \t"))
+
+		if width > indent {
+			width = indent
+		}
+
+		out.WriteString(line[width:])
+	}
+
+	return []byte(out.String())
+}
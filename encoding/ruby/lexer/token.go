@@ -0,0 +1,156 @@
+// Package lexer splits Ruby source into tokens, recording where in the source each one
+// was found.
+package lexer
+
+import (
+	"fmt"
+)
+
+// A Kind identifies what sort of token was read.
+type Kind int
+
+const (
+	EOF       Kind = iota
+	Newline        // a line break, which ends a statement unless the parser says otherwise
+	Comment        // # to the end of the line, or an =begin/=end block
+	Ident          // local variable and method names: config, empty?, save!
+	Constant       // names starting with an uppercase letter: Vagrant, VERSION
+	IVar           // @name
+	CVar           // @@name
+	GVar           // $name
+	Keyword        // reserved words: if, end, nil, true, do, ...
+	Label          // hash keys and keyword arguments: name:, "name":
+	Symbol         // :name, :"name", :+
+	String         // 'a', "a", %q(a), %Q(a), %(a), heredocs
+	XString        // `a`, %x(a)
+	Character      // ?a
+	Integer        // 1_000, 0x1F, 0b101, 0o17, 017
+	Float          // 1.5, 1e10
+	Rational       // 3r, 1.5r
+	Imaginary      // 2i
+	Regexp         // /a/i, %r{a}
+	Words          // %w[a b], %W[a b]
+	Symbols        // %i[a b], %I[a b]
+	Operator       // punctuation and operators: ( ) , . :: => + ** ...
+)
+
+var kindNames = map[Kind]string{
+	EOF:       `end of input`,
+	Newline:   `newline`,
+	Comment:   `comment`,
+	Ident:     `identifier`,
+	Constant:  `constant`,
+	IVar:      `instance variable`,
+	CVar:      `class variable`,
+	GVar:      `global variable`,
+	Keyword:   `keyword`,
+	Label:     `label`,
+	Symbol:    `symbol`,
+	String:    `string`,
+	XString:   `command string`,
+	Character: `character`,
+	Integer:   `integer`,
+	Float:     `float`,
+	Rational:  `rational`,
+	Imaginary: `imaginary`,
+	Regexp:    `regular expression`,
+	Words:     `word list`,
+	Symbols:   `symbol list`,
+	Operator:  `operator`,
+}
+
+func (self Kind) String() string {
+	if name, ok := kindNames[self]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Kind(%d)", int(self))
+}
+
+// A Token is a single lexical element of Ruby source.
+type Token struct {
+	Kind Kind
+
+	// the token exactly as it appears in the source; for heredocs, this is only the
+	// opening <<~ID, the body being found on the lines that follow
+	Text string
+
+	// the name of identifiers, keywords, labels, symbols and operators; the contents of
+	// strings with escapes processed; numbers without underscores, in Go syntax
+	Value string
+
+	// for strings, symbols, regexps and command strings containing interpolations,
+	// the literal text and interpolated code in order (Value is then empty)
+	Parts []Part
+
+	// the words of %w and %i lists, as String and Symbol tokens respectively
+	Elements []Token
+
+	// the options following a regular expression, e.g.: "mi"
+	Flags string
+
+	// the byte offset, line and column (both starting at 1, the column counted in bytes)
+	// at which the token begins
+	Offset int
+	Line   int
+	Column int
+
+	// whether whitespace separates this token from the one before it
+	SpaceBefore bool
+}
+
+// End returns the byte offset just past the token's source text.
+func (self Token) End() int {
+	return self.Offset + len(self.Text)
+}
+
+// Is reports whether this token is of the given kind and has the given value.
+func (self Token) Is(kind Kind, value string) bool {
+	return self.Kind == kind && self.Value == value
+}
+
+// Interpolated reports whether the token contains interpolated code.
+func (self Token) Interpolated() bool {
+	for _, part := range self.Parts {
+		if part.Interpolation {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (self Token) String() string {
+	if self.Kind == EOF {
+		return self.Kind.String()
+	}
+
+	return fmt.Sprintf("%v '%s'", self.Kind, self.Text)
+}
+
+// A Part is either literal text or interpolated code within a string-like token.
+type Part struct {
+	// literal text, with escapes processed
+	Text string
+
+	// the source between #{ and }
+	Code          string
+	Interpolation bool
+
+	// where Code begins in the source
+	Offset int
+	Line   int
+	Column int
+}
+
+// An Error describes source that could not be tokenized.
+type Error struct {
+	Offset int
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (self *Error) Error() string {
+	return fmt.Sprintf("%s at line %d, column %d", self.Msg, self.Line, self.Column)
+}
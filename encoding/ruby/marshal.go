@@ -1,10 +1,17 @@
 package ruby
 
-// import (
-// 	"bytes"
-// 	"reflect"
-// 	"sync"
-// )
+// Marshaler is the interface implemented by types that can produce their own Ruby
+// representation.  The returned bytes are written verbatim.
+type Marshaler interface {
+	MarshalRuby() ([]byte, error)
+}
+
+// Unmarshaler is the interface implemented by types that can decode a Ruby representation
+// of themselves.  UnmarshalRuby receives the source of the value exactly as written, such
+// as: Ref.new('db'), and must copy it if it wishes to retain it.
+type Unmarshaler interface {
+	UnmarshalRuby([]byte) error
+}
 
 func Marshal(v interface{}) ([]byte, error) {
 	e := &encodeState{}
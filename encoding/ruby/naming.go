@@ -0,0 +1,69 @@
+package ruby
+
+import (
+	"strings"
+	"unicode"
+)
+
+// A NamingStrategy transforms a Go identifier or map key into the key written to Ruby.
+type NamingStrategy func(name string) string
+
+// SnakeCase converts names like "SkipIfZero" or "HTTPServer" into "skip_if_zero" and "http_server".
+func SnakeCase(name string) string {
+	return strings.Join(lowerWords(name), `_`)
+}
+
+// KebabCase converts names like "SkipIfZero" or "HTTPServer" into "skip-if-zero" and "http-server".
+func KebabCase(name string) string {
+	return strings.Join(lowerWords(name), `-`)
+}
+
+// CamelCase converts names like "SkipIfZero" or "http_server" into "skipIfZero" and "httpServer".
+func CamelCase(name string) string {
+	words := lowerWords(name)
+
+	for i := 1; i < len(words); i++ {
+		runes := []rune(words[i])
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+
+	return strings.Join(words, ``)
+}
+
+// splits an identifier into lowercased words at separators, at lower-to-upper case
+// transitions and at the end of runs of capitals (so "HTTPServer" is "http", "server")
+func lowerWords(name string) []string {
+	runes := []rune(name)
+	words := make([]string, 0)
+	current := make([]rune, 0, len(runes))
+
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, strings.ToLower(string(current)))
+			current = current[:0]
+		}
+	}
+
+	for i, r := range runes {
+		switch {
+		case r == '_' || r == '-' || r == '.' || unicode.IsSpace(r):
+			flush()
+			continue
+		case i > 0 && unicode.IsUpper(r):
+			previous := runes[i-1]
+
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) {
+				flush()
+			} else if unicode.IsUpper(previous) && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+				flush()
+			}
+		}
+
+		current = append(current, r)
+	}
+
+	flush()
+
+	return words
+}
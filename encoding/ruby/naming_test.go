@@ -0,0 +1,83 @@
+package ruby
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNamingStrategies(t *testing.T) {
+	for in, shouldBe := range map[string][3]string{
+		`SkipIfZero`:    {`skip_if_zero`, `skipIfZero`, `skip-if-zero`},
+		`HTTPServer`:    {`http_server`, `httpServer`, `http-server`},
+		`UserID`:        {`user_id`, `userId`, `user-id`},
+		`Port2Forward`:  {`port2_forward`, `port2Forward`, `port2-forward`},
+		`already_snake`: {`already_snake`, `alreadySnake`, `already-snake`},
+		`kebab-case`:    {`kebab_case`, `kebabCase`, `kebab-case`},
+		`Name`:          {`name`, `name`, `name`},
+	} {
+		if s := SnakeCase(in); s != shouldBe[0] {
+			t.Fatalf("Expected SnakeCase(%q) to be %q, got %q", in, shouldBe[0], s)
+		}
+
+		if s := CamelCase(in); s != shouldBe[1] {
+			t.Fatalf("Expected CamelCase(%q) to be %q, got %q", in, shouldBe[1], s)
+		}
+
+		if s := KebabCase(in); s != shouldBe[2] {
+			t.Fatalf("Expected KebabCase(%q) to be %q, got %q", in, shouldBe[2], s)
+		}
+	}
+}
+
+func TestEncoderFieldNaming(t *testing.T) {
+	var buf bytes.Buffer
+
+	in := TestStruct{
+		Name:       `test`,
+		Count:      1,
+		SkipIfZero: 2,
+		SkipAlways: true,
+	}
+
+	encoder := NewEncoder(&buf)
+	encoder.SetFieldNaming(SnakeCase)
+
+	if err := encoder.Encode(in); err != nil {
+		t.Fatal(err)
+	}
+
+	shouldBe := "{'name'=>'test', 'count'=>1, 'skip_if_zero'=>2}\n"
+
+	if s := buf.String(); s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	} else {
+		t.Log(s)
+	}
+}
+
+func TestEncoderMapKeyNaming(t *testing.T) {
+	var buf bytes.Buffer
+
+	in := map[string]interface{}{
+		`ListenAddress`: `0.0.0.0`,
+		`MaxConns`:      4,
+		`Nested`: map[Symbol]int{
+			`ReadTimeout`: 30,
+		},
+	}
+
+	encoder := NewEncoder(&buf)
+	encoder.SetMapKeyNaming(SnakeCase)
+
+	if err := encoder.Encode(in); err != nil {
+		t.Fatal(err)
+	}
+
+	shouldBe := "{'listen_address'=>'0.0.0.0', 'max_conns'=>4, 'nested'=>{:read_timeout=>30}}\n"
+
+	if s := buf.String(); s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	} else {
+		t.Log(s)
+	}
+}
@@ -0,0 +1,88 @@
+package ruby
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Optional is implemented by wrapper types that may or may not hold a value.  When ok is
+// true, the value returned is encoded in place of the wrapper; otherwise, nil is written.
+// The types in database/sql with a Valid field (sql.NullString, sql.NullInt64,
+// sql.NullTime, sql.Null[T], and so on) are treated this way without implementing it.
+type Optional interface {
+	RubyOptional() (value interface{}, ok bool)
+}
+
+var optionalType = reflect.TypeOf((*Optional)(nil)).Elem()
+var timeType = reflect.TypeOf(time.Time{})
+
+// reports whether the type is one of database/sql's Null wrappers
+func isSQLNullType(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || t.PkgPath() != `database/sql` || !strings.HasPrefix(t.Name(), `Null`) {
+		return false
+	}
+
+	valid, ok := t.FieldByName(`Valid`)
+
+	return ok && valid.Type.Kind() == reflect.Bool && t.NumField() == 2
+}
+
+// returns the value held by an Optional or database/sql Null wrapper, and whether it holds one;
+// isOptional is false if the value is not such a wrapper
+func optionalValue(v reflect.Value) (inner reflect.Value, ok bool, isOptional bool) {
+	if v.Type().Implements(optionalType) {
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+			return reflect.Value{}, false, true
+		}
+
+		value, ok := v.Interface().(Optional).RubyOptional()
+		return reflect.ValueOf(value), ok, true
+	} else if isSQLNullType(v.Type()) {
+		if !v.FieldByName(`Valid`).Bool() {
+			return reflect.Value{}, false, true
+		}
+
+		return sqlNullValue(v), true, true
+	}
+
+	return reflect.Value{}, false, false
+}
+
+// returns the field of a database/sql Null wrapper that holds its value: whichever field
+// isn't Valid
+func sqlNullValue(v reflect.Value) reflect.Value {
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Name != `Valid` {
+			return v.Field(i)
+		}
+	}
+
+	return reflect.Value{}
+}
+
+// encode optional values as either the value they hold or nil
+func optionalEncoder(e *encodeState, v reflect.Value) error {
+	if inner, ok, _ := optionalValue(v); ok {
+		return e.reflectValue(inner)
+	}
+
+	e.writeStrings(`nil`)
+	return nil
+}
+
+// encode times as a call to Time.at, preserving nanoseconds and the UTC offset
+func timeEncoder(e *encodeState, v reflect.Value) error {
+	t := v.Interface().(time.Time)
+	seconds := strconv.FormatInt(t.Unix(), 10)
+	offset := t.Format(`-07:00`)
+
+	if nsec := t.Nanosecond(); nsec > 0 {
+		e.writeStrings(`Time.at(`, seconds, `, `, strconv.Itoa(nsec), `, :nsec, in: '`, offset, `')`)
+	} else {
+		e.writeStrings(`Time.at(`, seconds, `, in: '`, offset, `')`)
+	}
+
+	return nil
+}
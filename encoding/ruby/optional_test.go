@@ -0,0 +1,80 @@
+package ruby
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+type TestRow struct {
+	ID        int64           `ruby:"id"`
+	Name      sql.NullString  `ruby:"name"`
+	Email     sql.NullString  `ruby:"email"`
+	Score     sql.NullFloat64 `ruby:"score,omitnil"`
+	Logins    sql.NullInt64   `ruby:"logins,omitempty"`
+	CreatedAt sql.NullTime    `ruby:"created_at"`
+	Parent    sql.Null[int]   `ruby:"parent"`
+	Nickname  TestMaybe       `ruby:"nickname"`
+}
+
+type TestMaybe struct {
+	Value string
+	Set   bool
+}
+
+func (self TestMaybe) RubyOptional() (interface{}, bool) {
+	return self.Value, self.Set
+}
+
+func TestEncodeSQLNullTypes(t *testing.T) {
+	e := &encodeState{}
+
+	in := TestRow{
+		ID:   1,
+		Name: sql.NullString{String: `test`, Valid: true},
+		CreatedAt: sql.NullTime{
+			Time:  time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC),
+			Valid: true,
+		},
+		Parent:   sql.Null[int]{V: 7, Valid: true},
+		Nickname: TestMaybe{Value: `t`, Set: true},
+	}
+
+	shouldBe := `{'id'=>1, 'name'=>'test', 'email'=>nil, 'created_at'=>Time.at(1700000000, in: '+00:00'), 'parent'=>7, 'nickname'=>'t'}`
+
+	if err := e.marshal(in); err != nil {
+		t.Fatal(err)
+	} else if s := e.String(); s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	} else {
+		t.Log(s)
+	}
+
+	e.Reset()
+
+	if err := e.marshal([]TestMaybe{{Value: `unset`}}); err != nil {
+		t.Fatal(err)
+	} else if s := e.String(); s != `[nil]` {
+		t.Fatalf("Expected \"[nil]\", got \"%s\"", s)
+	}
+}
+
+func TestEncodeTime(t *testing.T) {
+	e := &encodeState{}
+
+	in := []time.Time{
+		time.Unix(1700000000, 0).UTC(),
+		time.Unix(1700000000, 500).In(time.FixedZone(`EST`, -5*60*60)),
+		time.Unix(-86400, 0).UTC(),
+	}
+
+	shouldBe := `[Time.at(1700000000, in: '+00:00'), Time.at(1700000000, 500, :nsec, in: '-05:00'), Time.at(-86400, in: '+00:00')]`
+
+	if err := e.marshal(in); err != nil {
+		t.Fatal(err)
+	} else if s := e.String(); s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	} else {
+		t.Log(s)
+	}
+}
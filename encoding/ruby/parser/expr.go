@@ -0,0 +1,957 @@
+package parser
+
+import (
+	"github.com/ghetzel/rubyutils/encoding/ruby/ast"
+	"github.com/ghetzel/rubyutils/encoding/ruby/lexer"
+	"strings"
+)
+
+// operator precedence, lowest first
+const (
+	precLowest = iota
+	precTernary
+	precRange
+	precOr
+	precAnd
+	precEquality
+	precComparison
+	precBitOr
+	precBitAnd
+	precShift
+	precAdditive
+	precMultiplicative
+	precUnaryMinus
+	precPower
+	precUnary
+)
+
+var binaryPrecedence = map[string]int{
+	`||`:  precOr,
+	`&&`:  precAnd,
+	`<=>`: precEquality,
+	`==`:  precEquality,
+	`===`: precEquality,
+	`!=`:  precEquality,
+	`=~`:  precEquality,
+	`!~`:  precEquality,
+	`<`:   precComparison,
+	`<=`:  precComparison,
+	`>`:   precComparison,
+	`>=`:  precComparison,
+	`|`:   precBitOr,
+	`^`:   precBitOr,
+	`&`:   precBitAnd,
+	`<<`:  precShift,
+	`>>`:  precShift,
+	`+`:   precAdditive,
+	`-`:   precAdditive,
+	`*`:   precMultiplicative,
+	`/`:   precMultiplicative,
+	`%`:   precMultiplicative,
+	`**`:  precPower,
+}
+
+var assignmentOperators = map[string]bool{
+	`=`:   true,
+	`+=`:  true,
+	`-=`:  true,
+	`*=`:  true,
+	`/=`:  true,
+	`%=`:  true,
+	`**=`: true,
+	`||=`: true,
+	`&&=`: true,
+	`|=`:  true,
+	`&=`:  true,
+	`^=`:  true,
+	`<<=`: true,
+	`>>=`: true,
+}
+
+// keywords that aren't part of the supported subset of the language
+var unsupportedKeywords = map[string]bool{
+	`BEGIN`:  true,
+	`END`:    true,
+	`alias`:  true,
+	`break`:  true,
+	`case`:   true,
+	`class`:  true,
+	`def`:    true,
+	`for`:    true,
+	`module`: true,
+	`next`:   true,
+	`redo`:   true,
+	`retry`:  true,
+	`return`: true,
+	`super`:  true,
+	`undef`:  true,
+	`until`:  true,
+	`while`:  true,
+	`yield`:  true,
+}
+
+// reports whether the expression can be assigned to
+func isAssignable(expr ast.Expr) bool {
+	switch node := expr.(type) {
+	case *ast.Ident, *ast.Variable, *ast.Const, *ast.Index:
+		return true
+	case *ast.Call:
+		// attribute writers, as in: config.vm.box = 'base'
+		return node.Receiver != nil && len(node.Args) == 0 && !node.Parens && node.Block == nil
+	}
+
+	return false
+}
+
+// parses operators of at least the given precedence (Pratt-style), along with
+// assignments and the ternary operator
+func (self *Parser) parseExpr(minPrec int) ast.Expr {
+	left := self.parseUnary()
+
+	// assignment takes everything to its right, even within a higher-precedence
+	// expression, as in: a && b = c
+	if tok := self.peek(); tok.Kind == lexer.Operator && assignmentOperators[tok.Value] && isAssignable(left) {
+		self.next()
+		self.skipNewlines()
+
+		if ident, ok := left.(*ast.Ident); ok {
+			self.locals[ident.Name] = true
+		}
+
+		value := self.parseExpr(precTernary)
+
+		left = &ast.Assign{
+			Span:     self.span(left.Pos()),
+			Target:   left,
+			Operator: tok.Value,
+			Value:    value,
+		}
+	}
+
+	for {
+		self.splitSign()
+		tok := self.peek()
+
+		if tok.Kind != lexer.Operator {
+			return left
+		}
+
+		switch {
+		case tok.Value == `?` && minPrec <= precTernary:
+			self.next()
+			self.skipNewlines()
+			then := self.parseExpr(precTernary)
+			self.skipNewlines()
+			self.expectOp(`:`)
+			self.skipNewlines()
+			otherwise := self.parseExpr(precTernary)
+
+			left = &ast.If{
+				Span:    self.span(left.Pos()),
+				Cond:    left,
+				Then:    []ast.Expr{then},
+				Else:    []ast.Expr{otherwise},
+				Ternary: true,
+			}
+
+		case (tok.Value == `..` || tok.Value == `...`) && minPrec <= precRange:
+			self.next()
+
+			rng := &ast.Range{
+				Low:       left,
+				Exclusive: tok.Value == `...`,
+			}
+
+			if !self.rangeEndsHere() {
+				rng.High = self.parseExpr(precRange + 1)
+			}
+
+			rng.Span = self.span(left.Pos())
+			left = rng
+
+		default:
+			prec, ok := binaryPrecedence[tok.Value]
+
+			if !ok || prec < minPrec {
+				return left
+			}
+
+			self.next()
+			self.skipNewlines()
+
+			// exponentiation is right-associative
+			nextPrec := prec + 1
+
+			if tok.Value == `**` {
+				nextPrec = prec
+			}
+
+			right := self.parseExpr(nextPrec)
+
+			left = &ast.Binary{
+				Span:     self.span(left.Pos()),
+				Operator: tok.Value,
+				Left:     left,
+				Right:    right,
+			}
+		}
+	}
+}
+
+// reports whether a range has no end, as in: (1..)
+// the lexer reads the -1 in "x -1" as a negative number, but where an operand has just
+// ended (as with a local variable, which never takes arguments) it is a subtraction
+func (self *Parser) splitSign() {
+	tok := self.peek()
+
+	switch tok.Kind {
+	case lexer.Integer, lexer.Float, lexer.Rational, lexer.Imaginary:
+		if sign := tok.Text[:1]; sign == `-` || sign == `+` {
+			op := lexer.Token{
+				Kind:        lexer.Operator,
+				Text:        sign,
+				Value:       sign,
+				Offset:      tok.Offset,
+				Line:        tok.Line,
+				Column:      tok.Column,
+				SpaceBefore: tok.SpaceBefore,
+			}
+
+			tok.Text = tok.Text[1:]
+			tok.Value = strings.TrimPrefix(tok.Value, sign)
+			tok.Offset++
+			tok.Column++
+			tok.SpaceBefore = false
+
+			self.buf = append([]lexer.Token{op, tok}, self.buf[1:]...)
+		}
+	}
+}
+
+func (self *Parser) rangeEndsHere() bool {
+	tok := self.peek()
+
+	switch tok.Kind {
+	case lexer.Newline, lexer.EOF:
+		return true
+	case lexer.Operator:
+		return isCloser(tok, []string{`)`, `]`, `}`, `,`, `;`, `=>`})
+	case lexer.Keyword:
+		return isCloser(tok, []string{`then`, `end`, `if`, `unless`, `and`, `or`, `do`})
+	}
+
+	return false
+}
+
+func (self *Parser) parseUnary() ast.Expr {
+	tok := self.peek()
+
+	switch {
+	case tok.Is(lexer.Operator, `-`), tok.Is(lexer.Operator, `+`), tok.Is(lexer.Operator, `!`), tok.Is(lexer.Operator, `~`):
+		self.next()
+
+		prec := precUnary
+
+		if tok.Value == `-` {
+			prec = precUnaryMinus
+		}
+
+		operand := self.parseExpr(prec)
+
+		return &ast.Unary{
+			Span:     self.span(tok.Offset),
+			Operator: tok.Value,
+			Operand:  operand,
+		}
+
+	case tok.Is(lexer.Operator, `..`), tok.Is(lexer.Operator, `...`):
+		self.next()
+
+		high := self.parseExpr(precRange + 1)
+
+		return &ast.Range{
+			Span:      self.span(tok.Offset),
+			High:      high,
+			Exclusive: tok.Value == `...`,
+		}
+
+	case tok.Is(lexer.Keyword, `not`):
+		self.next()
+
+		operand := self.parseExpr(precLowest)
+
+		return &ast.Unary{
+			Span:     self.span(tok.Offset),
+			Operator: `not`,
+			Operand:  operand,
+		}
+
+	case tok.Is(lexer.Keyword, `defined?`):
+		self.next()
+
+		operand := self.parseExpr(precUnary)
+
+		return &ast.Unary{
+			Span:     self.span(tok.Offset),
+			Operator: `defined?`,
+			Operand:  operand,
+		}
+	}
+
+	return self.parsePostfix(self.parsePrimary())
+}
+
+func (self *Parser) parsePrimary() ast.Expr {
+	tok := self.next()
+
+	switch tok.Kind {
+	case lexer.Integer:
+		return &ast.Integer{Span: tokenSpan(tok), Value: tok.Value}
+	case lexer.Float:
+		return &ast.Float{Span: tokenSpan(tok), Value: tok.Value}
+	case lexer.Rational:
+		return &ast.Rational{Span: tokenSpan(tok), Value: tok.Value}
+	case lexer.Imaginary:
+		return &ast.Imaginary{Span: tokenSpan(tok), Value: tok.Value}
+
+	case lexer.String, lexer.Character:
+		node := &ast.String{
+			Parts: self.parseParts(tok),
+		}
+
+		// adjacent string literals are joined
+		for next := self.peek(); next.Kind == lexer.String; next = self.peek() {
+			node.Parts = append(node.Parts, self.parseParts(self.next())...)
+		}
+
+		node.Span = self.span(tok.Offset)
+		return node
+
+	case lexer.XString:
+		return &ast.XString{Span: tokenSpan(tok), Parts: self.parseParts(tok)}
+	case lexer.Symbol:
+		return &ast.Symbol{Span: tokenSpan(tok), Parts: self.parseParts(tok)}
+	case lexer.Regexp:
+		return &ast.Regexp{Span: tokenSpan(tok), Parts: self.parseParts(tok), Flags: tok.Flags}
+
+	case lexer.Words, lexer.Symbols:
+		array := &ast.Array{
+			Span:     tokenSpan(tok),
+			Elements: make([]ast.Expr, len(tok.Elements)),
+		}
+
+		for i, elem := range tok.Elements {
+			if elem.Kind == lexer.Symbol {
+				array.Elements[i] = &ast.Symbol{Span: tokenSpan(tok), Parts: self.parseParts(elem)}
+			} else {
+				array.Elements[i] = &ast.String{Span: tokenSpan(tok), Parts: self.parseParts(elem)}
+			}
+		}
+
+		return array
+
+	case lexer.Ident:
+		return self.parseIdentifier(tok)
+
+	case lexer.Constant:
+		// constants followed by arguments are method calls, as in: Integer('42')
+		if (self.isOp(`(`) && !self.peek().SpaceBefore) || self.commandArgsAhead(false) {
+			call := &ast.Call{Name: tok.Value}
+			self.parseCallArgs(call, tok.Offset)
+			return call
+		}
+
+		return &ast.Const{Span: tokenSpan(tok), Name: tok.Value}
+
+	case lexer.IVar, lexer.CVar, lexer.GVar:
+		return &ast.Variable{Span: tokenSpan(tok), Name: tok.Value}
+
+	case lexer.Keyword:
+		switch tok.Value {
+		case `nil`:
+			return &ast.Nil{Span: tokenSpan(tok)}
+		case `true`, `false`:
+			return &ast.Bool{Span: tokenSpan(tok), Value: tok.Value == `true`}
+		case `self`:
+			return &ast.Self{Span: tokenSpan(tok)}
+		case `__FILE__`, `__LINE__`, `__ENCODING__`:
+			return &ast.Ident{Span: tokenSpan(tok), Name: tok.Value}
+		case `if`, `unless`:
+			return self.parseIf(tok)
+		case `begin`:
+			body := self.parseStatements(`end`)
+			self.expectKeyword(`end`)
+
+			return &ast.Paren{Span: self.span(tok.Offset), Body: body}
+		}
+
+		if unsupportedKeywords[tok.Value] {
+			self.fail(tok, `'%s' is not supported`, tok.Value)
+		}
+
+	case lexer.Operator:
+		switch tok.Value {
+		case `(`:
+			saved := self.noDo
+			self.noDo = 0
+			body := self.parseStatements(`)`)
+			self.expectOp(`)`)
+			self.noDo = saved
+
+			return &ast.Paren{Span: self.span(tok.Offset), Body: body}
+
+		case `[`:
+			elements := self.parseArgs(`]`)
+			return &ast.Array{Span: self.span(tok.Offset), Elements: elements}
+
+		case `{`:
+			return self.parseHash(tok)
+
+		case `::`:
+			name := self.next()
+
+			if name.Kind != lexer.Constant {
+				self.unexpected(name)
+			}
+
+			return &ast.Const{Span: self.span(tok.Offset), Name: name.Value, TopLevel: true}
+
+		case `->`:
+			return self.parseLambda(tok)
+		}
+	}
+
+	self.unexpected(tok)
+	return nil
+}
+
+// parses the literal text and interpolations of a string-like token
+func (self *Parser) parseParts(tok lexer.Token) []ast.Expr {
+	if len(tok.Parts) == 0 {
+		if tok.Value == `` {
+			return nil
+		}
+
+		return []ast.Expr{&ast.StringText{Span: tokenSpan(tok), Value: tok.Value}}
+	}
+
+	parts := make([]ast.Expr, len(tok.Parts))
+
+	for i, part := range tok.Parts {
+		if part.Interpolation {
+			file, err := New(lexer.NewAt([]byte(part.Code), part.Offset, part.Line, part.Column)).File()
+
+			if err != nil {
+				panic(bailout{err})
+			}
+
+			parts[i] = &ast.Interpolation{
+				Span: ast.Span{Start: part.Offset - 2, Stop: part.Offset + len(part.Code) + 1},
+				Body: file.Body,
+			}
+		} else {
+			parts[i] = &ast.StringText{Span: tokenSpan(tok), Value: part.Text}
+		}
+	}
+
+	return parts
+}
+
+// parses a bare name, which may be a local variable or a method call; as in Ruby, names
+// already assigned to are variables, so "x -1" subtracts from x rather than calling it
+func (self *Parser) parseIdentifier(tok lexer.Token) ast.Expr {
+	parens := self.isOp(`(`) && !self.peek().SpaceBefore
+
+	if !parens && (self.locals[tok.Value] || !(self.commandArgsAhead(true) || self.blockAhead())) {
+		return &ast.Ident{Span: tokenSpan(tok), Name: tok.Value}
+	}
+
+	call := &ast.Call{Name: tok.Value}
+	self.parseCallArgs(call, tok.Offset)
+
+	return call
+}
+
+// reports whether the next token begins the arguments of a call written without
+// parentheses, as in: gem 'rails', require: false
+func (self *Parser) commandArgsAhead(operators bool) bool {
+	tok := self.peek()
+
+	if !tok.SpaceBefore {
+		return false
+	}
+
+	switch tok.Kind {
+	case lexer.Integer, lexer.Float, lexer.Rational, lexer.Imaginary, lexer.String, lexer.XString,
+		lexer.Character, lexer.Symbol, lexer.Regexp, lexer.Words, lexer.Symbols, lexer.Label,
+		lexer.Ident, lexer.Constant, lexer.IVar, lexer.CVar, lexer.GVar:
+		return true
+
+	case lexer.Keyword:
+		switch tok.Value {
+		case `nil`, `true`, `false`, `self`, `not`, `defined?`, `__FILE__`, `__LINE__`:
+			return true
+		}
+
+	case lexer.Operator:
+		if !operators {
+			return false
+		}
+
+		switch tok.Value {
+		case `[`, `(`, `->`, `::`:
+			return true
+		case `-`, `*`, `**`, `&`, `!`, `~`:
+			// a prefix operator, as in: puts -x, call *args
+			return !self.peekAt(1).SpaceBefore
+		}
+	}
+
+	return false
+}
+
+// reports whether a block follows; do...end blocks belong to the outermost call
+// written without parentheses, so calls within its arguments don't take them
+func (self *Parser) blockAhead() bool {
+	return self.isOp(`{`) || (self.isKeyword(`do`) && self.noDo == 0)
+}
+
+// parses the arguments and block (if any) of a method call whose name has been read
+func (self *Parser) parseCallArgs(call *ast.Call, start int) {
+	if self.isOp(`(`) && !self.peek().SpaceBefore {
+		self.next()
+		call.Args = self.parseArgs(`)`)
+		call.Parens = true
+	} else if self.commandArgsAhead(true) {
+		self.noDo += 1
+		call.Args = self.parseCommandArgs()
+		self.noDo -= 1
+	}
+
+	if self.blockAhead() {
+		call.Block = self.parseBlock()
+	}
+
+	call.Span = self.span(start)
+}
+
+// parses method calls, constant lookups and element references following an expression
+func (self *Parser) parsePostfix(expr ast.Expr) ast.Expr {
+	for {
+		tok := self.peek()
+
+		switch {
+		case tok.Kind == lexer.Newline && self.leadingDotAhead():
+			self.skipNewlines()
+
+		case tok.Is(lexer.Operator, `.`), tok.Is(lexer.Operator, `&.`):
+			self.next()
+			self.skipNewlines()
+
+			call := &ast.Call{
+				Receiver: expr,
+				Operator: tok.Value,
+			}
+
+			switch name := self.peek(); {
+			case name.Is(lexer.Operator, `(`):
+				// receiver.() is shorthand for receiver.call()
+				call.Name = `call`
+			case name.Kind == lexer.Ident, name.Kind == lexer.Constant, name.Kind == lexer.Keyword:
+				call.Name = self.next().Value
+			default:
+				self.fail(name, `Expected a method name, found %v`, name)
+			}
+
+			self.parseCallArgs(call, expr.Pos())
+			expr = call
+
+		case tok.Is(lexer.Operator, `::`) && !tok.SpaceBefore:
+			self.next()
+			name := self.next()
+
+			if name.Kind == lexer.Constant && !(self.isOp(`(`) && !self.peek().SpaceBefore) {
+				expr = &ast.Const{
+					Span:  self.span(expr.Pos()),
+					Scope: expr,
+					Name:  name.Value,
+				}
+			} else if name.Kind == lexer.Ident || name.Kind == lexer.Constant {
+				call := &ast.Call{
+					Receiver: expr,
+					Operator: `::`,
+					Name:     name.Value,
+				}
+
+				self.parseCallArgs(call, expr.Pos())
+				expr = call
+			} else {
+				self.fail(name, `Expected a constant or method name, found %v`, name)
+			}
+
+		case tok.Is(lexer.Operator, `[`) && !tok.SpaceBefore:
+			self.next()
+			args := self.parseArgs(`]`)
+
+			expr = &ast.Index{
+				Span:     self.span(expr.Pos()),
+				Receiver: expr,
+				Args:     args,
+			}
+
+		default:
+			return expr
+		}
+	}
+}
+
+// reports whether the next line continues a method chain, as in:
+//
+//	items
+//	  .map(&:to_s)
+func (self *Parser) leadingDotAhead() bool {
+	n := 0
+
+	for self.peekAt(n).Kind == lexer.Newline {
+		n += 1
+	}
+
+	tok := self.peekAt(n)
+	return tok.Is(lexer.Operator, `.`) || tok.Is(lexer.Operator, `&.`)
+}
+
+// parses arguments (or array elements) up to the given closing bracket
+func (self *Parser) parseArgs(closer string) []ast.Expr {
+	saved := self.noDo
+	self.noDo = 0
+
+	defer func() {
+		self.noDo = saved
+	}()
+
+	args := make([]ast.Expr, 0)
+	var kwargs *ast.Hash
+
+	for {
+		self.skipNewlines()
+
+		if self.acceptOp(closer) {
+			break
+		}
+
+		args, kwargs = self.parseArg(args, kwargs)
+		self.skipNewlines()
+
+		if !self.acceptOp(`,`) {
+			self.expectOp(closer)
+			break
+		}
+	}
+
+	return args
+}
+
+// parses arguments written without parentheses, which end with the line
+func (self *Parser) parseCommandArgs() []ast.Expr {
+	args := make([]ast.Expr, 0)
+	var kwargs *ast.Hash
+
+	for {
+		args, kwargs = self.parseArg(args, kwargs)
+
+		if !self.acceptOp(`,`) {
+			return args
+		}
+
+		self.skipNewlines()
+	}
+}
+
+// parses a single argument; keyword arguments are collected into a hash that is added
+// to the arguments where the first of them appears
+func (self *Parser) parseArg(args []ast.Expr, kwargs *ast.Hash) ([]ast.Expr, *ast.Hash) {
+	tok := self.peek()
+
+	addPair := func(pair ast.Expr) {
+		if kwargs == nil {
+			kwargs = &ast.Hash{Span: ast.Span{Start: pair.Pos()}}
+			args = append(args, kwargs)
+		}
+
+		kwargs.Pairs = append(kwargs.Pairs, pair)
+		kwargs.Stop = pair.End()
+	}
+
+	switch {
+	case tok.Kind == lexer.Label:
+		addPair(self.parseLabelPair(self.next()))
+
+	case tok.Is(lexer.Operator, `*`):
+		self.next()
+		value := self.parseExpr(precLowest)
+		args = append(args, &ast.Splat{Span: self.span(tok.Offset), Value: value})
+
+	case tok.Is(lexer.Operator, `**`):
+		self.next()
+		value := self.parseExpr(precLowest)
+		addPair(&ast.DoubleSplat{Span: self.span(tok.Offset), Value: value})
+
+	case tok.Is(lexer.Operator, `&`):
+		self.next()
+		value := self.parseExpr(precLowest)
+		args = append(args, &ast.BlockPass{Span: self.span(tok.Offset), Value: value})
+
+	default:
+		value := self.parseExpr(precLowest)
+
+		if self.acceptOp(`=>`) {
+			self.skipNewlines()
+			pairValue := self.parseExpr(precLowest)
+
+			addPair(&ast.Pair{
+				Span:  self.span(value.Pos()),
+				Key:   value,
+				Value: pairValue,
+			})
+		} else {
+			args = append(args, value)
+		}
+	}
+
+	return args, kwargs
+}
+
+// parses the value following a label; with none, as in {x:, y:}, the value is the local
+// variable or method of the same name
+func (self *Parser) parseLabelPair(label lexer.Token) *ast.Pair {
+	key := &ast.Symbol{
+		Span:  tokenSpan(label),
+		Parts: self.parseParts(label),
+	}
+
+	var value ast.Expr
+
+	if tok := self.peek(); tok.Kind == lexer.Newline || tok.Kind == lexer.EOF || isCloser(tok, []string{`,`, `)`, `]`, `}`}) {
+		value = &ast.Ident{Span: tokenSpan(label), Name: label.Value}
+	} else {
+		self.skipNewlines()
+		value = self.parseExpr(precLowest)
+	}
+
+	return &ast.Pair{
+		Span:  self.span(label.Offset),
+		Key:   key,
+		Value: value,
+		Label: true,
+	}
+}
+
+func (self *Parser) parseHash(open lexer.Token) ast.Expr {
+	saved := self.noDo
+	self.noDo = 0
+
+	defer func() {
+		self.noDo = saved
+	}()
+
+	hash := &ast.Hash{
+		Pairs:  make([]ast.Expr, 0),
+		Braces: true,
+	}
+
+	for {
+		self.skipNewlines()
+
+		if self.acceptOp(`}`) {
+			break
+		}
+
+		switch tok := self.peek(); {
+		case tok.Kind == lexer.Label:
+			hash.Pairs = append(hash.Pairs, self.parseLabelPair(self.next()))
+
+		case tok.Is(lexer.Operator, `**`):
+			self.next()
+			value := self.parseExpr(precLowest)
+			hash.Pairs = append(hash.Pairs, &ast.DoubleSplat{Span: self.span(tok.Offset), Value: value})
+
+		default:
+			key := self.parseExpr(precLowest)
+			self.skipNewlines()
+			self.expectOp(`=>`)
+			self.skipNewlines()
+			value := self.parseExpr(precLowest)
+
+			hash.Pairs = append(hash.Pairs, &ast.Pair{
+				Span:  self.span(key.Pos()),
+				Key:   key,
+				Value: value,
+			})
+		}
+
+		self.skipNewlines()
+
+		if !self.acceptOp(`,`) {
+			self.skipNewlines()
+			self.expectOp(`}`)
+			break
+		}
+	}
+
+	hash.Span = self.span(open.Offset)
+	return hash
+}
+
+// parses the rest of an if or unless statement, whose keyword has been read
+func (self *Parser) parseIf(tok lexer.Token) ast.Expr {
+	node := &ast.If{
+		Cond:   self.parseNot(),
+		Unless: tok.Value == `unless`,
+	}
+
+	if !self.isKeyword(`then`) && !self.isOp(`;`) && self.peek().Kind != lexer.Newline {
+		self.fail(self.peek(), `Expected 'then' or a newline, found %v`, self.peek())
+	}
+
+	self.skipTerminators()
+
+	if self.isKeyword(`then`) {
+		self.next()
+	}
+
+	node.Then = self.parseStatements(`elsif`, `else`, `end`)
+
+	switch next := self.peek(); {
+	case next.Is(lexer.Keyword, `elsif`) && !node.Unless:
+		// the nested statement reads through the end of this one
+		self.next()
+		node.Else = []ast.Expr{self.parseIf(next)}
+
+	case next.Is(lexer.Keyword, `else`):
+		self.next()
+		node.Else = self.parseStatements(`end`)
+		self.expectKeyword(`end`)
+
+	default:
+		self.expectKeyword(`end`)
+	}
+
+	node.Span = self.span(tok.Offset)
+	return node
+}
+
+// parses a do...end or {...} block
+func (self *Parser) parseBlock() *ast.Block {
+	open := self.next()
+	closer := `end`
+
+	if open.Value == `{` {
+		closer = `}`
+	}
+
+	saved := self.noDo
+	self.noDo = 0
+
+	defer func() {
+		self.noDo = saved
+	}()
+
+	block := &ast.Block{
+		Braces: closer == `}`,
+	}
+
+	self.skipNewlines()
+
+	if self.acceptOp(`|`) {
+		block.Params = self.parseParams(`|`)
+	} else {
+		self.acceptOp(`||`)
+	}
+
+	block.Body = self.parseStatements(closer)
+
+	if closer == `}` {
+		self.expectOp(closer)
+	} else {
+		self.expectKeyword(closer)
+	}
+
+	block.Span = self.span(open.Offset)
+	return block
+}
+
+// parses block or lambda parameters up to the given closing operator
+func (self *Parser) parseParams(closer string) []*ast.Param {
+	params := make([]*ast.Param, 0)
+
+	for !self.acceptOp(closer) {
+		start := self.peek()
+		param := &ast.Param{}
+
+		if tok := self.peek(); tok.Is(lexer.Operator, `*`) || tok.Is(lexer.Operator, `**`) || tok.Is(lexer.Operator, `&`) {
+			param.Prefix = self.next().Value
+		}
+
+		name := self.next()
+
+		if name.Kind != lexer.Ident {
+			self.fail(name, `Expected a parameter name, found %v`, name)
+		}
+
+		param.Name = name.Value
+		self.locals[name.Value] = true
+
+		if self.acceptOp(`=`) {
+			param.Default = self.parseExpr(precBitOr + 1)
+		}
+
+		param.Span = self.span(start.Offset)
+		params = append(params, param)
+
+		if !self.acceptOp(`,`) {
+			self.expectOp(closer)
+			break
+		}
+	}
+
+	return params
+}
+
+// parses ->(params) { body }, the -> having been read
+func (self *Parser) parseLambda(tok lexer.Token) ast.Expr {
+	var params []*ast.Param
+
+	if self.acceptOp(`(`) {
+		params = self.parseParams(`)`)
+	} else if self.peek().Kind == lexer.Ident {
+		params = make([]*ast.Param, 0)
+
+		for self.peek().Kind == lexer.Ident {
+			name := self.next()
+			params = append(params, &ast.Param{Span: tokenSpan(name), Name: name.Value})
+			self.locals[name.Value] = true
+
+			if !self.acceptOp(`,`) {
+				break
+			}
+		}
+	}
+
+	if !self.isOp(`{`) && !self.isKeyword(`do`) {
+		self.fail(self.peek(), `Expected a block, found %v`, self.peek())
+	}
+
+	saved := self.noDo
+	self.noDo = 0
+	block := self.parseBlock()
+	self.noDo = saved
+
+	if params != nil {
+		block.Params = params
+	}
+
+	return &ast.Lambda{
+		Span:  self.span(tok.Offset),
+		Block: block,
+	}
+}
@@ -0,0 +1,339 @@
+// Package parser builds syntax trees from the configuration-style subset of Ruby found in
+// Vagrantfiles, Gemfiles, Chef attribute files and the output of the ruby encoder.
+package parser
+
+import (
+	"fmt"
+	"github.com/ghetzel/rubyutils/encoding/ruby/ast"
+	"github.com/ghetzel/rubyutils/encoding/ruby/lexer"
+)
+
+// An Error describes source that could not be parsed.  It is the same type the lexer
+// uses, so that callers need only handle one.
+type Error = lexer.Error
+
+// A TokenSource supplies tokens to a Parser; *lexer.Lexer is one.
+type TokenSource interface {
+	Next() (lexer.Token, error)
+}
+
+// A Parser reads statements from a stream of tokens.
+type Parser struct {
+	tokens  TokenSource
+	buf     []lexer.Token
+	lastEnd int
+	noDo    int
+	locals  map[string]bool
+}
+
+// carries an error out of the recursive descent to the exported method that started it
+type bailout struct {
+	err error
+}
+
+// New returns a Parser reading the given tokens.
+func New(tokens TokenSource) *Parser {
+	return &Parser{
+		tokens: tokens,
+		locals: make(map[string]bool),
+	}
+}
+
+// ParseFile parses an entire source file.
+func ParseFile(src []byte) (*ast.File, error) {
+	return New(lexer.New(src)).File()
+}
+
+// ParseExpr parses source consisting of a single statement.
+func ParseExpr(src []byte) (ast.Expr, error) {
+	return New(lexer.New(src)).Expr()
+}
+
+// File parses statements up to the end of the input.
+func (self *Parser) File() (file *ast.File, err error) {
+	defer self.recover(&err)
+
+	start := self.peek().Offset
+	body := self.parseStatements()
+
+	if tok := self.peek(); tok.Kind != lexer.EOF {
+		self.unexpected(tok)
+	}
+
+	return &ast.File{
+		Span: self.span(start),
+		Body: body,
+	}, nil
+}
+
+// Expr parses exactly one statement, which must be all that remains of the input.
+func (self *Parser) Expr() (expr ast.Expr, err error) {
+	defer self.recover(&err)
+
+	self.skipTerminators()
+
+	if tok := self.peek(); tok.Kind == lexer.EOF {
+		self.fail(tok, `Expected an expression, found %v`, tok)
+	}
+
+	expr = self.parseStatement()
+	self.skipTerminators()
+
+	if tok := self.peek(); tok.Kind != lexer.EOF {
+		self.unexpected(tok)
+	}
+
+	return expr, nil
+}
+
+// Statement parses the next statement, skipping any blank lines and semicolons before it
+// and leaving the line break or semicolon after it unread.  At the end of the input, it
+// returns nil.
+func (self *Parser) Statement() (expr ast.Expr, err error) {
+	defer self.recover(&err)
+
+	self.skipTerminators()
+
+	if self.peek().Kind == lexer.EOF {
+		return nil, nil
+	}
+
+	expr = self.parseStatement()
+
+	if tok := self.peek(); tok.Kind != lexer.Newline && tok.Kind != lexer.EOF && !tok.Is(lexer.Operator, `;`) {
+		self.unexpected(tok)
+	}
+
+	return expr, nil
+}
+
+// Value parses a single expression, such as an element of an array or a value in a hash,
+// skipping any line breaks before it.
+func (self *Parser) Value() (expr ast.Expr, err error) {
+	defer self.recover(&err)
+
+	self.skipNewlines()
+	return self.parseExpr(precLowest), nil
+}
+
+// Peek returns the next token without reading it.  Comments are never returned.
+func (self *Parser) Peek() (tok lexer.Token, err error) {
+	defer self.recover(&err)
+	return self.peek(), nil
+}
+
+// Next reads the next token, for callers that handle some of the input themselves.
+func (self *Parser) Next() (tok lexer.Token, err error) {
+	defer self.recover(&err)
+	return self.next(), nil
+}
+
+func (self *Parser) recover(err *error) {
+	if r := recover(); r != nil {
+		if b, ok := r.(bailout); ok {
+			*err = b.err
+		} else {
+			panic(r)
+		}
+	}
+}
+
+// returns the token n places ahead, skipping comments
+func (self *Parser) peekAt(n int) lexer.Token {
+	for len(self.buf) <= n {
+		tok, err := self.tokens.Next()
+
+		if err != nil {
+			panic(bailout{err})
+		} else if tok.Kind != lexer.Comment {
+			self.buf = append(self.buf, tok)
+		}
+	}
+
+	return self.buf[n]
+}
+
+func (self *Parser) peek() lexer.Token {
+	return self.peekAt(0)
+}
+
+func (self *Parser) next() lexer.Token {
+	tok := self.peek()
+	self.buf = self.buf[1:]
+	self.lastEnd = tok.End()
+
+	return tok
+}
+
+func (self *Parser) isOp(value string) bool {
+	return self.peek().Is(lexer.Operator, value)
+}
+
+func (self *Parser) isKeyword(value string) bool {
+	return self.peek().Is(lexer.Keyword, value)
+}
+
+func (self *Parser) acceptOp(value string) bool {
+	if self.isOp(value) {
+		self.next()
+		return true
+	}
+
+	return false
+}
+
+func (self *Parser) expectOp(value string) lexer.Token {
+	if tok := self.peek(); !tok.Is(lexer.Operator, value) {
+		self.fail(tok, `Expected '%s', found %v`, value, tok)
+	}
+
+	return self.next()
+}
+
+func (self *Parser) expectKeyword(value string) lexer.Token {
+	if tok := self.peek(); !tok.Is(lexer.Keyword, value) {
+		self.fail(tok, `Expected '%s', found %v`, value, tok)
+	}
+
+	return self.next()
+}
+
+func (self *Parser) skipNewlines() {
+	for self.peek().Kind == lexer.Newline {
+		self.next()
+	}
+}
+
+func (self *Parser) skipTerminators() {
+	for self.peek().Kind == lexer.Newline || self.isOp(`;`) {
+		self.next()
+	}
+}
+
+func (self *Parser) fail(tok lexer.Token, format string, args ...interface{}) {
+	panic(bailout{&Error{
+		Offset: tok.Offset,
+		Line:   tok.Line,
+		Column: tok.Column,
+		Msg:    fmt.Sprintf(format, args...),
+	}})
+}
+
+func (self *Parser) unexpected(tok lexer.Token) {
+	self.fail(tok, `Unexpected %v`, tok)
+}
+
+// returns the span from the given offset to the end of the last token read
+func (self *Parser) span(start int) ast.Span {
+	return ast.Span{
+		Start: start,
+		Stop:  self.lastEnd,
+	}
+}
+
+func tokenSpan(tok lexer.Token) ast.Span {
+	return ast.Span{
+		Start: tok.Offset,
+		Stop:  tok.End(),
+	}
+}
+
+// reports whether the token is one of the given keywords or operators
+func isCloser(tok lexer.Token, closers []string) bool {
+	if tok.Kind == lexer.Keyword || tok.Kind == lexer.Operator {
+		for _, closer := range closers {
+			if tok.Value == closer {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// parses statements up to (but not including) one of the given keywords or operators, or
+// the end of the input
+func (self *Parser) parseStatements(closers ...string) []ast.Expr {
+	body := make([]ast.Expr, 0)
+
+	for {
+		self.skipTerminators()
+
+		if tok := self.peek(); tok.Kind == lexer.EOF || isCloser(tok, closers) {
+			return body
+		}
+
+		body = append(body, self.parseStatement())
+
+		if tok := self.peek(); tok.Kind != lexer.Newline && tok.Kind != lexer.EOF && !tok.Is(lexer.Operator, `;`) && !isCloser(tok, closers) {
+			self.unexpected(tok)
+		}
+	}
+}
+
+// parses an expression along with any trailing if/unless modifiers
+func (self *Parser) parseStatement() ast.Expr {
+	expr := self.parseNot()
+
+	for {
+		tok := self.peek()
+
+		switch {
+		case tok.Is(lexer.Keyword, `if`), tok.Is(lexer.Keyword, `unless`):
+			self.next()
+
+			cond := self.parseNot()
+
+			expr = &ast.If{
+				Span:     self.span(expr.Pos()),
+				Cond:     cond,
+				Then:     []ast.Expr{expr},
+				Unless:   tok.Value == `unless`,
+				Modifier: true,
+			}
+
+		case tok.Is(lexer.Keyword, `while`), tok.Is(lexer.Keyword, `until`), tok.Is(lexer.Keyword, `rescue`):
+			self.fail(tok, `'%s' modifiers are not supported`, tok.Value)
+
+		default:
+			return expr
+		}
+	}
+}
+
+// parses expressions joined by the lowest-precedence logical operators: not, and, or
+func (self *Parser) parseNot() ast.Expr {
+	left := self.parseNotOperand()
+
+	for self.isKeyword(`and`) || self.isKeyword(`or`) {
+		op := self.next()
+		self.skipNewlines()
+
+		right := self.parseNotOperand()
+
+		left = &ast.Binary{
+			Span:     self.span(left.Pos()),
+			Operator: op.Value,
+			Left:     left,
+			Right:    right,
+		}
+	}
+
+	return left
+}
+
+func (self *Parser) parseNotOperand() ast.Expr {
+	if tok := self.peek(); tok.Is(lexer.Keyword, `not`) {
+		self.next()
+
+		operand := self.parseNotOperand()
+
+		return &ast.Unary{
+			Span:     self.span(tok.Offset),
+			Operator: `not`,
+			Operand:  operand,
+		}
+	}
+
+	return self.parseExpr(precLowest)
+}
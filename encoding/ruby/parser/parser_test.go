@@ -0,0 +1,377 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ghetzel/rubyutils/encoding/ruby/ast"
+	"github.com/ghetzel/rubyutils/encoding/ruby/lexer"
+)
+
+// renders a tree as an s-expression, for comparing against expectations
+func sexp(node ast.Node) string {
+	list := func(items ...string) string {
+		return `(` + strings.Join(items, ` `) + `)`
+	}
+
+	exprs := func(nodes []ast.Expr) []string {
+		out := make([]string, len(nodes))
+
+		for i, n := range nodes {
+			out[i] = sexp(n)
+		}
+
+		return out
+	}
+
+	optional := func(n ast.Expr) string {
+		if n == nil {
+			return `_`
+		}
+
+		return sexp(n)
+	}
+
+	parts := func(kind string, nodes []ast.Expr) string {
+		return list(append([]string{kind}, exprs(nodes)...)...)
+	}
+
+	switch n := node.(type) {
+	case *ast.File:
+		return strings.Join(exprs(n.Body), `; `)
+	case *ast.Nil:
+		return `nil`
+	case *ast.Bool:
+		return strconv.FormatBool(n.Value)
+	case *ast.Self:
+		return `self`
+	case *ast.Integer:
+		return n.Value
+	case *ast.Float:
+		return n.Value
+	case *ast.Rational:
+		return n.Value + `r`
+	case *ast.Imaginary:
+		return n.Value + `i`
+	case *ast.String:
+		if value, ok := n.Literal(); ok {
+			return strconv.Quote(value)
+		}
+
+		return parts(`dstr`, n.Parts)
+	case *ast.StringText:
+		return strconv.Quote(n.Value)
+	case *ast.Interpolation:
+		return list(append([]string{`#`}, exprs(n.Body)...)...)
+	case *ast.XString:
+		return parts(`xstr`, n.Parts)
+	case *ast.Symbol:
+		if value, ok := n.Literal(); ok {
+			return `:` + value
+		}
+
+		return parts(`dsym`, n.Parts)
+	case *ast.Regexp:
+		if value, ok := n.Literal(); ok {
+			return `/` + value + `/` + n.Flags
+		}
+
+		return parts(`dregexp`, n.Parts)
+	case *ast.Array:
+		return `[` + strings.Join(exprs(n.Elements), ` `) + `]`
+	case *ast.Hash:
+		if n.Braces {
+			return `{` + strings.Join(exprs(n.Pairs), ` `) + `}`
+		}
+
+		return `kw{` + strings.Join(exprs(n.Pairs), ` `) + `}`
+	case *ast.Pair:
+		if n.Label {
+			return strings.TrimPrefix(sexp(n.Key), `:`) + `: ` + sexp(n.Value)
+		}
+
+		return sexp(n.Key) + `=>` + sexp(n.Value)
+	case *ast.Range:
+		op := `..`
+
+		if n.Exclusive {
+			op = `...`
+		}
+
+		return list(op, optional(n.Low), optional(n.High))
+	case *ast.Ident:
+		return n.Name
+	case *ast.Const:
+		if n.TopLevel {
+			return `::` + n.Name
+		} else if n.Scope != nil {
+			return sexp(n.Scope) + `::` + n.Name
+		}
+
+		return n.Name
+	case *ast.Variable:
+		return n.Name
+	case *ast.Call:
+		name := n.Name
+
+		if n.Receiver != nil {
+			name = sexp(n.Receiver) + n.Operator + n.Name
+		}
+
+		items := append([]string{name}, exprs(n.Args)...)
+
+		if n.Block != nil {
+			items = append(items, sexp(n.Block))
+		}
+
+		return list(items...)
+	case *ast.Block:
+		params := make([]string, len(n.Params))
+
+		for i, param := range n.Params {
+			params[i] = param.Prefix + param.Name
+
+			if param.Default != nil {
+				params[i] += `=` + sexp(param.Default)
+			}
+		}
+
+		kind := `do`
+
+		if n.Braces {
+			kind = `{}`
+		}
+
+		return list(append([]string{kind, `|` + strings.Join(params, `,`) + `|`}, exprs(n.Body)...)...)
+	case *ast.Lambda:
+		return list(`->`, sexp(n.Block))
+	case *ast.BlockPass:
+		return `&` + sexp(n.Value)
+	case *ast.Splat:
+		return `*` + sexp(n.Value)
+	case *ast.DoubleSplat:
+		return `**` + sexp(n.Value)
+	case *ast.Index:
+		return list(append([]string{`[]`, sexp(n.Receiver)}, exprs(n.Args)...)...)
+	case *ast.Assign:
+		return list(n.Operator, sexp(n.Target), sexp(n.Value))
+	case *ast.Binary:
+		return list(n.Operator, sexp(n.Left), sexp(n.Right))
+	case *ast.Unary:
+		return list(n.Operator, sexp(n.Operand))
+	case *ast.If:
+		kind := `if`
+
+		if n.Unless {
+			kind = `unless`
+		} else if n.Ternary {
+			kind = `?:`
+		}
+
+		return list(kind, sexp(n.Cond), list(exprs(n.Then)...), list(exprs(n.Else)...))
+	case *ast.Paren:
+		return list(append([]string{`begin`}, exprs(n.Body)...)...)
+	}
+
+	return fmt.Sprintf("<%T>", node)
+}
+
+func assertParse(t *testing.T, src string, expected string) {
+	t.Helper()
+
+	file, err := ParseFile([]byte(src))
+
+	if err != nil {
+		t.Fatalf("Unexpected error parsing %q: %v", src, err)
+	}
+
+	if actual := sexp(file); actual != expected {
+		t.Fatalf("Expected \"%s\", got \"%s\"", expected, actual)
+	}
+}
+
+func TestParseLiterals(t *testing.T) {
+	assertParse(t, `[1, -2.5, 3r, 'a', :b, nil, true, self]`, `[1 -2.5 3r "a" :b nil true self]`)
+	assertParse(t, `{a: 1, 'b' => 2, "c": 3, **rest}`, `{a: 1 "b"=>2 c: 3 **rest}`)
+	assertParse(t, `[1..5, 'a'...'z', (1..), (..5)]`, `[(.. 1 5) (... "a" "z") (begin (.. 1 _)) (begin (.. _ 5))]`)
+	assertParse(t, `%w[a b] + %i[c]`, `(+ ["a" "b"] [:c])`)
+	assertParse(t, `"a" 'b'`, `"ab"`)
+	assertParse(t, `/^a+$/i`, `/^a+$/i`)
+	assertParse(t, "{\n  a: 1,\n  b: [\n    2,\n  ],\n}", `{a: 1 b: [2]}`)
+	assertParse(t, `{x:, y:}`, `{x: x y: y}`)
+}
+
+func TestParseInterpolation(t *testing.T) {
+	assertParse(t, `"app-#{node['env']}-#{1 + 2}"`, `(dstr "app-" (# ([] node "env")) "-" (# (+ 1 2)))`)
+	assertParse(t, `:"sym_#{name}"`, `(dsym "sym_" (# name))`)
+	assertParse(t, "x = <<~EOS\n  Hello #{name}\nEOS", `(= x (dstr "Hello " (# name) "\n"))`)
+}
+
+func TestParseOperators(t *testing.T) {
+	assertParse(t, `a + b * c ** d ** e`, `(+ a (* b (** c (** d e))))`)
+	assertParse(t, `a && b || !c`, `(|| (&& a b) (! c))`)
+	assertParse(t, `a == 1 and not b or c`, `(or (and (== a 1) (not b)) c)`)
+	assertParse(t, `-x.abs`, `(- (x.abs))`)
+	assertParse(t, `x = y = 60 * 60`, `(= x (= y (* 60 60)))`)
+	assertParse(t, `a ||= {}`, `(||= a {})`)
+	assertParse(t, `a ? b : c ? d : e`, `(?: a (b) ((?: c (d) (e))))`)
+	assertParse(t, `x = 1; x -1`, `(= x 1); (- x 1)`)
+	assertParse(t, `a && b = c`, `(&& a (= b c))`)
+}
+
+func TestParseCalls(t *testing.T) {
+	assertParse(t, `puts -1`, `(puts -1)`)
+	assertParse(t, `File.join('a', 'b')`, `(File.join "a" "b")`)
+	assertParse(t, `Integer('42')`, `(Integer "42")`)
+	assertParse(t, `::Foo::Bar::BAZ`, `::Foo::Bar::BAZ`)
+	assertParse(t, `Foo::bar(1)`, `(Foo::bar 1)`)
+	assertParse(t, `[1, 2].map(&:to_s).freeze`, `(([1 2].map &:to_s).freeze)`)
+	assertParse(t, "items\n  .select { |i| i > 1 }\n  &.first", `((items.select ({} |i| (> i 1)))&.first)`)
+	assertParse(t, `foo bar do end`, `(foo bar (do ||))`)
+	assertParse(t, `foo bar { }`, `(foo (bar ({} ||)))`)
+	assertParse(t, `set :name, 'value'`, `(set :name "value")`)
+	assertParse(t, `call *args, **opts, &blk`, `(call *args kw{**opts} &blk)`)
+	assertParse(t, `f(a, key: 1, 'other' => 2)`, `(f a kw{key: 1 "other"=>2})`)
+	assertParse(t, `list[0][1..2]`, `([] ([] list 0) (.. 1 2))`)
+	assertParse(t, `->(x, y = 1) { x + y }`, `(-> ({} |x,y=1| (+ x y)))`)
+	assertParse(t, `run.() && obj.class`, `(&& (run.call) (obj.class))`)
+}
+
+func TestParseConditionals(t *testing.T) {
+	assertParse(t, `x = 1 if y`, `(if y ((= x 1)) ())`)
+	assertParse(t, `puts 'no' unless ok?`, `(unless ok? ((puts "no")) ())`)
+	assertParse(t, "if a\n  1\nelsif b then 2\nelse\n  3\nend", `(if a (1) ((if b (2) (3))))`)
+	assertParse(t, "unless a; b; end", `(unless a (b) ())`)
+	assertParse(t, "v = begin\n  1\nend", `(= v (begin 1))`)
+}
+
+func TestParseConfigFiles(t *testing.T) {
+	assertParse(t, `Vagrant.configure("2") do |config|
+  config.vm.box = "hashicorp/bionic64"
+  config.vm.network :forwarded_port, guest: 80, host: 8080
+  config.vm.provider "virtualbox" do |vb|
+    vb.memory = 1024 * 2
+  end
+end`, `(Vagrant.configure "2" (do |config| (= ((config.vm).box) "hashicorp/bionic64") ((config.vm).network :forwarded_port kw{guest: 80 host: 8080}) ((config.vm).provider "virtualbox" (do |vb| (= (vb.memory) (* 1024 2))))))`)
+
+	assertParse(t, `source 'https://rubygems.org'
+ruby '3.2.0'
+
+gem 'rails', '~> 7.0'
+
+group :development, :test do
+  gem 'rspec', require: false # comment
+end`, `(source "https://rubygems.org"); (ruby "3.2.0"); (gem "rails" "~> 7.0"); (group :development :test (do || (gem "rspec" kw{require: false})))`)
+
+	assertParse(t, `default['app']['port'] = 8080
+default['app']['name'] ||= "app-#{node.chef_environment}"`, `(= ([] ([] default "app") "port") 8080); (||= ([] ([] default "app") "name") (dstr "app-" (# (node.chef_environment))))`)
+}
+
+func TestParsePositions(t *testing.T) {
+	src := "x = {\n  a: [1, 2]\n}\n"
+	expr, err := ParseExpr([]byte(src))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := expr.(*ast.Assign).Value.(*ast.Hash)
+
+	if hash.Pos() != 4 || hash.End() != 19 {
+		t.Fatalf("Expected hash at 4-19, got %d-%d", hash.Pos(), hash.End())
+	}
+
+	array := hash.Pairs[0].(*ast.Pair).Value
+
+	if text := src[array.Pos():array.End()]; text != `[1, 2]` {
+		t.Fatalf("Expected \"[1, 2]\", got \"%s\"", text)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for src, expected := range map[string]string{
+		"foo(1,\n  2":         `Expected ')', found end of input at line 2, column 4`,
+		"x = [1 2]":           `Expected ']', found integer '2' at line 1, column 8`,
+		"case x\nwhen 1\nend": `'case' is not supported at line 1, column 1`,
+		"if x\n  y":           `Expected 'end', found end of input at line 2, column 4`,
+		`"a#{1 2}"`:           `Unexpected integer '2' at line 1, column 7`,
+	} {
+		_, err := ParseFile([]byte(src))
+
+		var parseErr *Error
+
+		if !errors.As(err, &parseErr) {
+			t.Fatalf("Expected a *parser.Error for %q, got %v", src, err)
+		}
+
+		if err.Error() != expected {
+			t.Fatalf("Expected \"%s\", got \"%s\"", expected, err.Error())
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	file, err := ParseFile([]byte("gem 'a'\ngroup :test do\n  gem 'b', '1.0'\nend"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gems := make([]string, 0)
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		if call, ok := node.(*ast.Call); ok && call.Name == `gem` {
+			name, _ := call.Args[0].(*ast.String).Literal()
+			gems = append(gems, name)
+		}
+
+		return true
+	})
+
+	if strings.Join(gems, `,`) != `a,b` {
+		t.Fatalf("Expected \"a,b\", got \"%s\"", strings.Join(gems, `,`))
+	}
+}
+
+func TestParserStatements(t *testing.T) {
+	p := New(lexer.New([]byte("\n{a: 1}; [2,\n 3]\n\n4 if x\n")))
+	statements := make([]string, 0)
+
+	for {
+		expr, err := p.Statement()
+
+		if err != nil {
+			t.Fatal(err)
+		} else if expr == nil {
+			break
+		}
+
+		statements = append(statements, sexp(expr))
+	}
+
+	if actual, shouldBe := strings.Join(statements, `; `), `{a: 1}; [2 3]; (if x (4) ())`; actual != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, actual)
+	}
+
+	p = New(lexer.New([]byte("[\n  1 + 2,\n  'b' => 3]")))
+
+	if tok, err := p.Next(); err != nil || !tok.Is(lexer.Operator, `[`) {
+		t.Fatalf("Expected '[', got %v (%v)", tok, err)
+	}
+
+	key, _ := p.Value()
+
+	if tok, err := p.Peek(); err != nil || !tok.Is(lexer.Operator, `,`) {
+		t.Fatalf("Expected ',', got %v (%v)", tok, err)
+	}
+
+	p.Next()
+	value, _ := p.Value()
+
+	if sexp(key) != `(+ 1 2)` || sexp(value) != `"b"` {
+		t.Fatalf("Unexpected values %s, %s", sexp(key), sexp(value))
+	}
+}
@@ -0,0 +1,352 @@
+package ruby
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// returns the Ruby regular expression literal equivalent to the given Go regular expression.
+// The expression is parsed and rewritten rather than copied so that Go-specific syntax (named
+// groups, the s flag, and the meaning of ^, $ and . without flags) has the same effect in Ruby.
+func goRegexpLiteral(re *regexp.Regexp) (string, error) {
+	tree, err := syntax.Parse(re.String(), syntax.Perl)
+
+	if err != nil {
+		return ``, err
+	}
+
+	var source strings.Builder
+
+	if err := writeRubyRegexp(&source, tree, false); err != nil {
+		return ``, fmt.Errorf("Cannot express regular expression /%s/ in Ruby: %v", re.String(), err)
+	}
+
+	return `/` + source.String() + `/`, nil
+}
+
+// writes a single node of a parsed Go regular expression as Ruby regular expression syntax;
+// if grouped is true, the node must be written as a single atom (e.g.: for a repetition)
+func writeRubyRegexp(out *strings.Builder, re *syntax.Regexp, grouped bool) error {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		out.WriteString(`(?!)`)
+	case syntax.OpEmptyMatch:
+		out.WriteString(`(?:)`)
+	case syntax.OpLiteral:
+		literal := make([]string, len(re.Rune))
+
+		for i, r := range re.Rune {
+			// case-folded literals are stored in their canonical (upper) case
+			if re.Flags&syntax.FoldCase != 0 {
+				r = unicode.ToLower(r)
+			}
+
+			literal[i] = escapeRegexpRune(r, false)
+		}
+
+		switch {
+		case re.Flags&syntax.FoldCase != 0:
+			out.WriteString(`(?i:` + strings.Join(literal, ``) + `)`)
+		case grouped && len(literal) > 1:
+			out.WriteString(`(?:` + strings.Join(literal, ``) + `)`)
+		default:
+			out.WriteString(strings.Join(literal, ``))
+		}
+	case syntax.OpCharClass:
+		out.WriteString(rubyCharClass(re.Rune))
+	case syntax.OpAnyCharNotNL:
+		out.WriteString(`.`)
+	case syntax.OpAnyChar:
+		// Ruby's m flag is Go's s flag: dot matches newlines
+		out.WriteString(`(?m:.)`)
+	case syntax.OpBeginLine:
+		out.WriteString(`^`)
+	case syntax.OpEndLine:
+		out.WriteString(`$`)
+	case syntax.OpBeginText:
+		out.WriteString(`\A`)
+	case syntax.OpEndText:
+		out.WriteString(`\z`)
+	case syntax.OpWordBoundary:
+		out.WriteString(`\b`)
+	case syntax.OpNoWordBoundary:
+		out.WriteString(`\B`)
+	case syntax.OpCapture:
+		if re.Name != `` {
+			out.WriteString(`(?<` + re.Name + `>`)
+		} else {
+			out.WriteString(`(`)
+		}
+
+		if err := writeRubyRegexp(out, re.Sub[0], false); err != nil {
+			return err
+		}
+
+		out.WriteString(`)`)
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		if err := writeRubyRegexp(out, re.Sub[0], true); err != nil {
+			return err
+		}
+
+		switch re.Op {
+		case syntax.OpStar:
+			out.WriteString(`*`)
+		case syntax.OpPlus:
+			out.WriteString(`+`)
+		case syntax.OpQuest:
+			out.WriteString(`?`)
+		default:
+			switch {
+			case re.Max == re.Min:
+				out.WriteString(`{` + strconv.Itoa(re.Min) + `}`)
+			case re.Max < 0:
+				out.WriteString(`{` + strconv.Itoa(re.Min) + `,}`)
+			default:
+				out.WriteString(`{` + strconv.Itoa(re.Min) + `,` + strconv.Itoa(re.Max) + `}`)
+			}
+		}
+
+		if re.Flags&syntax.NonGreedy != 0 {
+			out.WriteString(`?`)
+		}
+	case syntax.OpConcat, syntax.OpAlternate:
+		separator := ``
+
+		if re.Op == syntax.OpAlternate {
+			separator = `|`
+		}
+
+		if grouped || re.Op == syntax.OpAlternate {
+			out.WriteString(`(?:`)
+		}
+
+		for i, sub := range re.Sub {
+			if i > 0 {
+				out.WriteString(separator)
+			}
+
+			if err := writeRubyRegexp(out, sub, false); err != nil {
+				return err
+			}
+		}
+
+		if grouped || re.Op == syntax.OpAlternate {
+			out.WriteString(`)`)
+		}
+	default:
+		return fmt.Errorf("unsupported construct %v", re.Op)
+	}
+
+	return nil
+}
+
+// a Unicode general category or script that a character class can be written in terms of,
+// e.g.: \p{L}, with the rune ranges it covers
+type unicodeProperty struct {
+	Name   string
+	Ranges []rune
+	Size   int
+}
+
+var unicodeProperties []unicodeProperty
+var unicodePropertiesOnce sync.Once
+
+// returns the Unicode properties known to both Go and Ruby, largest first, with their
+// ranges as Go's regexp parser expands them
+func loadUnicodeProperties() []unicodeProperty {
+	unicodePropertiesOnce.Do(func() {
+		names := make([]string, 0, len(unicode.Categories)+len(unicode.Scripts))
+
+		for name := range unicode.Categories {
+			names = append(names, name)
+		}
+
+		for name := range unicode.Scripts {
+			names = append(names, name)
+		}
+
+		for _, name := range names {
+			if tree, err := syntax.Parse(`\p{`+name+`}`, syntax.Perl); err == nil && tree.Op == syntax.OpCharClass {
+				unicodeProperties = append(unicodeProperties, unicodeProperty{
+					Name:   name,
+					Ranges: tree.Rune,
+					Size:   runeCount(tree.Rune),
+				})
+			}
+		}
+
+		sort.Slice(unicodeProperties, func(i, j int) bool {
+			if unicodeProperties[i].Size != unicodeProperties[j].Size {
+				return unicodeProperties[i].Size > unicodeProperties[j].Size
+			}
+
+			return unicodeProperties[i].Name < unicodeProperties[j].Name
+		})
+	})
+
+	return unicodeProperties
+}
+
+// returns a Ruby character class matching the given (sorted and non-overlapping) rune
+// ranges.  Classes that Go has expanded from Unicode properties (e.g.: \pL) are written
+// in terms of those properties, and negated if that is shorter, rather than as the
+// thousands of ranges they cover.
+func rubyCharClass(ranges []rune) string {
+	if len(ranges) == 0 {
+		return `(?!)`
+	}
+
+	items, single := charClassItems(ranges)
+	class := `[` + items + `]`
+
+	if single {
+		class = items
+	}
+
+	if complement := complementRanges(ranges); len(complement) > 0 {
+		items, single := charClassItems(complement)
+		negated := `[^` + items + `]`
+
+		if single {
+			negated = `\P` + items[2:]
+		}
+
+		if len(negated) < len(class) {
+			return negated
+		}
+	}
+
+	return class
+}
+
+// returns the contents of a character class matching the given rune ranges, made up of
+// the largest Unicode properties within them and then any ranges that remain, and whether
+// that is a single property (which needs no brackets)
+func charClassItems(ranges []rune) (string, bool) {
+	var items strings.Builder
+
+	remaining := ranges
+	size := runeCount(ranges)
+	properties := 0
+
+	for _, property := range loadUnicodeProperties() {
+		if property.Size > size || len(remaining) == 0 {
+			continue
+		} else if !containsRanges(ranges, property.Ranges) {
+			continue
+		}
+
+		// properties that add nothing to those already written are skipped
+		if rest := subtractRanges(remaining, property.Ranges); runeCount(rest) < runeCount(remaining) {
+			items.WriteString(`\p{` + property.Name + `}`)
+			remaining = rest
+			properties += 1
+		}
+	}
+
+	for i := 0; i+1 < len(remaining); i += 2 {
+		lo, hi := remaining[i], remaining[i+1]
+		items.WriteString(escapeRegexpRune(lo, true))
+
+		if hi != lo {
+			items.WriteString(`-` + escapeRegexpRune(hi, true))
+		}
+	}
+
+	return items.String(), properties == 1 && len(remaining) == 0
+}
+
+// returns the number of runes within the given ranges
+func runeCount(ranges []rune) int {
+	count := 0
+
+	for i := 0; i+1 < len(ranges); i += 2 {
+		count += int(ranges[i+1]-ranges[i]) + 1
+	}
+
+	return count
+}
+
+// reports whether every rune in the ranges b is also within the ranges a
+func containsRanges(a []rune, b []rune) bool {
+	i := 0
+
+	for j := 0; j+1 < len(b); j += 2 {
+		for i+1 < len(a) && a[i+1] < b[j] {
+			i += 2
+		}
+
+		if i+1 >= len(a) || a[i] > b[j] || a[i+1] < b[j+1] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// returns the ranges a without any of the runes within the ranges b
+func subtractRanges(a []rune, b []rune) []rune {
+	out := make([]rune, 0, len(a))
+	j := 0
+
+	for i := 0; i+1 < len(a); i += 2 {
+		lo, hi := a[i], a[i+1]
+
+		for j+1 < len(b) && b[j+1] < lo {
+			j += 2
+		}
+
+		for k := j; k+1 < len(b) && b[k] <= hi && lo <= hi; k += 2 {
+			if b[k] > lo {
+				out = append(out, lo, b[k]-1)
+			}
+
+			lo = b[k+1] + 1
+		}
+
+		if lo <= hi {
+			out = append(out, lo, hi)
+		}
+	}
+
+	return out
+}
+
+// returns the ranges of every rune not within the given ranges
+func complementRanges(ranges []rune) []rune {
+	return subtractRanges([]rune{0, unicode.MaxRune}, ranges)
+}
+
+// escapes a single rune for use in a Ruby regular expression literal, either within a
+// character class or outside of one
+func escapeRegexpRune(r rune, inClass bool) string {
+	switch r {
+	case '\n':
+		return `\n`
+	case '\t':
+		return `\t`
+	case '\r':
+		return `\r`
+	case '\f':
+		return `\f`
+	case '\v':
+		return `\v`
+	}
+
+	// forward slashes delimit the literal and "#" could begin an interpolation
+	if strings.ContainsRune(`\/#`, r) || (inClass && strings.ContainsRune(`[]^-&`, r)) || (!inClass && strings.ContainsRune(`.+*?()|[]{}^$`, r)) {
+		return `\` + string(r)
+	}
+
+	if !unicode.IsPrint(r) {
+		return fmt.Sprintf("\\u{%x}", r)
+	}
+
+	return string(r)
+}
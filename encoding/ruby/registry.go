@@ -0,0 +1,154 @@
+package ruby
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// An EncoderFunc writes the Ruby representation of a value of the type it was
+// registered for.  Writing nothing is an error, as there would be no value in its place.
+type EncoderFunc func(w *Writer, v reflect.Value) error
+
+// encoders registered for all encoding operations, keyed on type
+var encoderRegistry sync.Map
+
+// RegisterEncoder registers a function used to encode all values of the given type,
+// taking precedence over the type's MarshalRuby method and its default encoding.  A
+// function registered for a non-pointer type is also used for non-nil pointers to it.
+// This is intended for types you don't own; types registered with an Encoder's own
+// RegisterEncoder take precedence over those registered here.
+func RegisterEncoder(t reflect.Type, fn EncoderFunc) {
+	if fn == nil {
+		encoderRegistry.Delete(t)
+	} else {
+		encoderRegistry.Store(t, fn)
+	}
+}
+
+// RegisterEncoder registers a function used to encode all values of the given type
+// written by this encoder.  See the package-level RegisterEncoder.
+func (self *Encoder) RegisterEncoder(t reflect.Type, fn EncoderFunc) {
+	if self.options.encoders == nil {
+		self.options.encoders = make(map[reflect.Type]EncoderFunc)
+	}
+
+	if fn == nil {
+		delete(self.options.encoders, t)
+	} else {
+		self.options.encoders[t] = fn
+	}
+}
+
+// returns the registered encoder for the value's type, if any, along with the value
+// it should be given (which is the pointed-to value when only the element type is registered)
+func (self *encodeState) customEncoder(v reflect.Value) (EncoderFunc, reflect.Value) {
+	if fn := self.lookupEncoder(v.Type()); fn != nil {
+		return fn, v
+	}
+
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		if fn := self.lookupEncoder(v.Type().Elem()); fn != nil {
+			return fn, v.Elem()
+		}
+	}
+
+	return nil, v
+}
+
+func (self *encodeState) lookupEncoder(t reflect.Type) EncoderFunc {
+	if fn, ok := self.encoders[t]; ok {
+		return fn
+	} else if fn, ok := encoderRegistry.Load(t); ok {
+		return fn.(EncoderFunc)
+	}
+
+	return nil
+}
+
+// adapts a registered EncoderFunc to the encoder's internal signature; a function that
+// writes nothing would leave a hole in the output where its value belongs
+func customEncoder(fn EncoderFunc) encoderFunc {
+	return func(e *encodeState, v reflect.Value) error {
+		w := &Writer{e: e}
+
+		if err := fn(w, v); err != nil {
+			return err
+		} else if !w.started {
+			return &UnsupportedValueError{
+				Value: v,
+				Str:   fmt.Sprintf("of type '%v' (its registered encoder wrote nothing)", v.Type()),
+				Path:  e.path.String(),
+			}
+		}
+
+		return nil
+	}
+}
+
+// A Writer is given to registered encoder functions to write the Ruby representation
+// of a value.  Everything written through a Writer makes up that single value.
+type Writer struct {
+	e       *encodeState
+	started bool
+}
+
+// WriteRaw writes the given Ruby source verbatim.
+func (self *Writer) WriteRaw(code string) {
+	self.write([]byte(code))
+}
+
+// WriteString writes the given string as a (non-interpolated) Ruby string literal.
+func (self *Writer) WriteString(str string) {
+	self.WriteRaw(singleQuote(str))
+}
+
+// WriteSymbol writes the given name as a Ruby symbol literal.
+func (self *Writer) WriteSymbol(name string) {
+	self.WriteRaw(symbolLiteral(name))
+}
+
+// WriteValue writes the Ruby representation of any Go value, using the same settings
+// as the encoder that is writing the value being encoded.
+func (self *Writer) WriteValue(v interface{}) error {
+	data, err := self.e.encodeInline(reflect.ValueOf(v))
+
+	if err != nil {
+		return err
+	}
+
+	self.write(data)
+	return nil
+}
+
+// Require notes that the Ruby code written needs the given library to be loaded; the
+// libraries needed are reported by the Encoder's Requires method.
+func (self *Writer) Require(library string) {
+	self.e.require(library)
+}
+
+func (self *Writer) write(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	// the first write is indented as any other value would be, the rest follow on from it
+	if self.started {
+		self.e.writeBytesUnindented(data)
+	} else {
+		self.e.writeBytes(data)
+		self.started = true
+	}
+}
+
+// encodes a value at the current indentation level, returning it without leading indentation
+func (self *encodeState) encodeInline(v reflect.Value) ([]byte, error) {
+	enc := self.child(self.indentLevel, self.fieldOptions, self.path)
+
+	if err := enc.reflectValue(v); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimPrefix(enc.Bytes(), enc.getIndentBytes()), nil
+}
@@ -0,0 +1,101 @@
+package ruby
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type TestUUID [4]byte
+
+type TestDecimal struct {
+	unscaled int64
+	scale    int
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	RegisterEncoder(reflect.TypeOf(TestUUID{}), func(w *Writer, v reflect.Value) error {
+		id := v.Interface().(TestUUID)
+		w.WriteString(fmt.Sprintf("%x", id[:]))
+		return nil
+	})
+
+	defer RegisterEncoder(reflect.TypeOf(TestUUID{}), nil)
+
+	id := TestUUID{0xde, 0xad, 0xbe, 0xef}
+
+	in := map[string]interface{}{
+		`id`:      id,
+		`pointer`: &id,
+		`nil`:     (*TestUUID)(nil),
+	}
+
+	shouldBe := `{'id'=>'deadbeef', 'nil'=>nil, 'pointer'=>'deadbeef'}`
+
+	if data, err := Marshal(in); err != nil {
+		t.Fatal(err)
+	} else if s := string(data); s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	} else {
+		t.Log(s)
+	}
+}
+
+func TestEncoderRegisterEncoder(t *testing.T) {
+	var buf bytes.Buffer
+
+	encoder := NewEncoder(&buf)
+	encoder.SetIndent(``, `  `)
+	encoder.RegisterEncoder(reflect.TypeOf(TestDecimal{}), func(w *Writer, v reflect.Value) error {
+		d := v.Interface().(TestDecimal)
+		w.WriteRaw(`BigDecimal(`)
+
+		if err := w.WriteValue(fmt.Sprintf("%de-%d", d.unscaled, d.scale)); err != nil {
+			return err
+		}
+
+		w.WriteRaw(`)`)
+		return nil
+	})
+
+	in := map[string]interface{}{
+		`price`: TestDecimal{1999, 2},
+		`fees`:  []TestDecimal{{5, 1}},
+	}
+
+	if err := encoder.Encode(in); err != nil {
+		t.Fatal(err)
+	}
+
+	shouldBe := "{\n  'fees' => [\n    BigDecimal('5e-1')\n],\n  'price' => BigDecimal('1999e-2')\n}\n"
+
+	if s := buf.String(); s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	} else {
+		t.Log(s)
+	}
+
+	// registrations on one encoder do not leak into others
+	if data, err := Marshal(TestDecimal{1, 1}); err != nil {
+		t.Fatal(err)
+	} else if s := string(data); s != `{}` {
+		t.Fatalf("Expected \"{}\", got \"%s\"", s)
+	}
+}
+
+func TestEncoderRegisterEncoderWritesNothing(t *testing.T) {
+	encoder := NewEncoder(&bytes.Buffer{})
+	encoder.RegisterEncoder(reflect.TypeOf(TestUUID{}), func(w *Writer, v reflect.Value) error {
+		w.WriteRaw(``)
+		return nil
+	})
+
+	err := encoder.Encode(map[string]interface{}{`id`: TestUUID{}})
+
+	if valueErr, ok := err.(*UnsupportedValueError); !ok {
+		t.Fatalf("Expected *UnsupportedValueError, got %T (%v)", err, err)
+	} else if shouldBe := "Unsupported value of type 'ruby.TestUUID' (its registered encoder wrote nothing) at [\"id\"], cannot encode"; valueErr.Error() != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, valueErr.Error())
+	}
+}
@@ -0,0 +1,194 @@
+package ruby
+
+import (
+	"reflect"
+)
+
+// reports whether the type has the shape of an iter.Seq (func(yield func(V) bool)) or,
+// if pairs is true, an iter.Seq2 (func(yield func(K, V) bool))
+func isSequenceType(t reflect.Type, pairs bool) bool {
+	if t.Kind() != reflect.Func || t.NumIn() != 1 || t.NumOut() != 0 {
+		return false
+	}
+
+	yield := t.In(0)
+	arity := 1
+
+	if pairs {
+		arity = 2
+	}
+
+	return yield.Kind() == reflect.Func && yield.NumIn() == arity && yield.NumOut() == 1 && yield.Out(0).Kind() == reflect.Bool
+}
+
+// reports whether the type is a receive-only channel
+func isReceiveChanType(t reflect.Type) bool {
+	return t.Kind() == reflect.Chan && t.ChanDir() == reflect.RecvDir
+}
+
+// reports whether the value is a sequence that the encoder has been told to drain
+func (self *encodeState) isStreamable(v reflect.Value) bool {
+	return self.streamSequences && (isSequenceType(v.Type(), false) || isSequenceType(v.Type(), true) || isReceiveChanType(v.Type()))
+}
+
+// tracks the writing of array elements whose number isn't known up front
+type sequenceWriter struct {
+	e     *encodeState
+	path  *valuePath
+	count int
+}
+
+// encodes and writes the next element, flushing it to the output stream
+func (self *sequenceWriter) writeElement(value reflect.Value) error {
+	if self.e.skipsUnsupported() && self.e.isUnsupported(value) {
+		return nil
+	}
+
+	if self.count > 0 {
+		self.e.writeStringsUnindented(`,`)
+
+		if !self.e.indentEnabled {
+			self.e.writeStringsUnindented(` `)
+		}
+	}
+
+	if self.e.indentEnabled {
+		self.e.writeStringsUnindented("\n")
+	}
+
+	self.e.path = self.path.Index(self.count)
+	self.count += 1
+
+	if err := self.e.reflectValue(value); err != nil {
+		return err
+	}
+
+	return self.e.flush()
+}
+
+// encode iter.Seq values and receive-only channels as arrays, writing each element as it is produced
+func sequenceEncoder(e *encodeState, v reflect.Value) error {
+	if v.IsNil() {
+		e.writeStrings(`nil`)
+		return nil
+	}
+
+	w := &sequenceWriter{
+		e:    e,
+		path: e.path,
+	}
+
+	e.writeStringsUnindented(`[`)
+	e.indentLevel += 1
+
+	var err error
+
+	if v.Kind() == reflect.Chan {
+		for {
+			value, ok := v.Recv()
+
+			if !ok {
+				break
+			} else if err = w.writeElement(value); err != nil {
+				break
+			}
+		}
+	} else {
+		yield := reflect.MakeFunc(v.Type().In(0), func(args []reflect.Value) []reflect.Value {
+			err = w.writeElement(args[0])
+			return []reflect.Value{reflect.ValueOf(err == nil)}
+		})
+
+		v.Call([]reflect.Value{yield})
+	}
+
+	e.path = w.path
+	e.indentLevel -= 1
+
+	if err != nil {
+		return err
+	}
+
+	if w.count > 0 && e.indentEnabled {
+		e.writeStringsUnindented("\n")
+	}
+
+	e.writeStringsUnindented(`]`)
+	return nil
+}
+
+// encode iter.Seq2 values as hashes, writing each pair as it is produced
+func sequence2Encoder(e *encodeState, v reflect.Value) error {
+	if v.IsNil() {
+		e.writeStrings(`nil`)
+		return nil
+	}
+
+	e.writeStrings(`{`)
+
+	var err error
+	var count int
+
+	parentPath := e.path
+
+	yield := reflect.MakeFunc(v.Type().In(0), func(args []reflect.Value) []reflect.Value {
+		key, value := args[0], args[1]
+
+		if e.skipsUnsupported() && (e.isUnsupported(key) || e.isUnsupported(value)) {
+			return []reflect.Value{reflect.ValueOf(true)}
+		}
+
+		if count == 0 {
+			if e.indentEnabled {
+				e.writeStringsUnindented("\n")
+			}
+
+			e.indentLevel += 1
+		} else {
+			e.writeStringsUnindented(`,`)
+
+			if e.indentEnabled {
+				e.writeStringsUnindented("\n")
+			} else {
+				e.writeStringsUnindented(` `)
+			}
+		}
+
+		count += 1
+		path := parentPath.Key(key.Interface())
+
+		var keyBytes []byte
+
+		if keyBytes, err = e.encodeKey(key, path); err != nil {
+			return []reflect.Value{reflect.ValueOf(false)}
+		}
+
+		// unlike those of maps, keys aren't checked for duplicates, as that would mean
+		// holding every key written in memory
+		if err = e.writeKeyValue(keyBytes, value, e.fieldOptions, path); err == nil {
+			err = e.flush()
+		}
+
+		return []reflect.Value{reflect.ValueOf(err == nil)}
+	})
+
+	v.Call([]reflect.Value{yield})
+
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		if e.indentEnabled {
+			e.writeStringsUnindented("\n")
+		}
+
+		e.indentLevel -= 1
+		e.writeStrings(`}`)
+	} else {
+		// if we didn't write anything, don't indent this (it's just an empty "{}")
+		e.writeStringsUnindented(`}`)
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package ruby
+
+import (
+	"bytes"
+	"iter"
+	"slices"
+	"testing"
+)
+
+// records each write separately so that streaming can be observed
+type testChunkWriter struct {
+	chunks []string
+}
+
+func (self *testChunkWriter) Write(p []byte) (int, error) {
+	self.chunks = append(self.chunks, string(p))
+	return len(p), nil
+}
+
+func testCountTo(n int) iter.Seq[int] {
+	return func(yield func(int) bool) {
+		for i := 1; i <= n; i++ {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+}
+
+func TestEncodeSequences(t *testing.T) {
+	var buf bytes.Buffer
+
+	ch := make(chan string, 2)
+	ch <- `a`
+	ch <- `b`
+	close(ch)
+
+	in := map[string]interface{}{
+		`count`:  testCountTo(3),
+		`empty`:  testCountTo(0),
+		`pairs`:  slices.All([]string{`x`, `y`}),
+		`chan`:   (<-chan string)(ch),
+		`nilseq`: iter.Seq[int](nil),
+	}
+
+	encoder := NewEncoder(&buf)
+	encoder.SetStreamSequences(true)
+
+	if err := encoder.Encode(in); err != nil {
+		t.Fatal(err)
+	}
+
+	shouldBe := "{'chan'=>['a', 'b'], 'count'=>[1, 2, 3], 'empty'=>[], 'nilseq'=>nil, 'pairs'=>{0=>'x', 1=>'y'}}\n"
+
+	if s := buf.String(); s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	} else {
+		t.Log(s)
+	}
+
+	// without opting in, sequences are unsupported
+	if _, err := Marshal(testCountTo(1)); err == nil {
+		t.Fatal("Expected an error encoding a sequence without streaming enabled")
+	}
+}
+
+func TestEncodeSequencesIndented(t *testing.T) {
+	var buf bytes.Buffer
+
+	encoder := NewEncoder(&buf)
+	encoder.SetIndent(``, `  `)
+	encoder.SetStreamSequences(true)
+
+	in := struct {
+		Items iter.Seq[int]          `ruby:"items"`
+		Pairs iter.Seq2[int, string] `ruby:"pairs"`
+	}{
+		Items: testCountTo(2),
+		Pairs: slices.All([]string{`x`}),
+	}
+
+	if err := encoder.Encode(in); err != nil {
+		t.Fatal(err)
+	}
+
+	shouldBe := "{\n  'items' => [\n    1,\n    2\n],\n  'pairs' => {\n    0 => 'x'\n  }\n}\n"
+
+	if s := buf.String(); s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	} else {
+		t.Log(s)
+	}
+}
+
+func TestEncodeSequenceStreams(t *testing.T) {
+	w := &testChunkWriter{}
+
+	encoder := NewEncoder(w)
+	encoder.SetStreamSequences(true)
+
+	if err := encoder.Encode(testCountTo(1000)); err != nil {
+		t.Fatal(err)
+	}
+
+	// each element is written as it is produced, rather than all at once at the end
+	if len(w.chunks) < 1000 {
+		t.Fatalf("Expected at least 1000 writes, got %d", len(w.chunks))
+	}
+
+	if first := w.chunks[0]; first != `[1` {
+		t.Fatalf("Expected the first write to be \"[1\", got %q", first)
+	}
+}
+
+func TestEncodeSequence2DuplicateKeys(t *testing.T) {
+	var buf bytes.Buffer
+
+	encoder := NewEncoder(&buf)
+	encoder.SetStreamSequences(true)
+
+	in := iter.Seq2[string, int](func(yield func(string, int) bool) {
+		_ = yield(`a`, 1) && yield(`a`, 2)
+	})
+
+	// keys are not remembered, so a repeated key is written again for Ruby to overwrite
+	if err := encoder.Encode(in); err != nil {
+		t.Fatal(err)
+	} else if shouldBe := "{'a'=>1, 'a'=>2}\n"; buf.String() != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, buf.String())
+	}
+}
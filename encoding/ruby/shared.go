@@ -0,0 +1,277 @@
+package ruby
+
+import (
+	"fmt"
+	"github.com/ghetzel/go-stockutil/stringutil"
+	"reflect"
+	"sort"
+)
+
+// identifies a map, slice or pointer by what it refers to; slices sharing a backing
+// array are only the same value if they also have the same length
+type referenceKey struct {
+	Type    reflect.Type
+	Pointer uintptr
+	Len     int
+}
+
+// a value that is referred to from more than one place in the input
+type sharedReference struct {
+	Key   referenceKey
+	Value reflect.Value
+	Path  *valuePath
+}
+
+// A CyclicReferenceError is returned when encoding shared references and a value
+// contains itself, which cannot be written as a Ruby literal.
+type CyclicReferenceError struct {
+	Type reflect.Type
+	Path string
+}
+
+func (self *CyclicReferenceError) Error() string {
+	if self.Path != `` {
+		return fmt.Sprintf("Cyclic reference to type '%v' at %s, cannot encode", self.Type, self.Path)
+	}
+
+	return fmt.Sprintf("Cyclic reference to type '%v', cannot encode", self.Type)
+}
+
+// returns the identity of maps, slices and pointers to composite values; other values
+// (including pointers to scalars) have no identity worth preserving in Ruby
+func referenceKeyOf(v reflect.Value) (referenceKey, bool) {
+	switch v.Kind() {
+	case reflect.Map:
+		if !v.IsNil() {
+			return referenceKey{Type: v.Type(), Pointer: v.Pointer()}, true
+		}
+	case reflect.Slice:
+		if !v.IsNil() && v.Len() > 0 {
+			return referenceKey{Type: v.Type(), Pointer: v.Pointer(), Len: v.Len()}, true
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			switch v.Type().Elem().Kind() {
+			case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+				return referenceKey{Type: v.Type(), Pointer: v.Pointer()}, true
+			}
+		}
+	}
+
+	return referenceKey{}, false
+}
+
+// walks a value the way the encoder would, counting how often each map, slice and
+// pointer is reached
+type referenceWalker struct {
+	e       *encodeState
+	counts  map[referenceKey]int
+	active  map[referenceKey]bool
+	visited []sharedReference
+}
+
+func (self *referenceWalker) walk(v reflect.Value, path *valuePath) error {
+	if !v.IsValid() {
+		return nil
+	}
+
+	if key, ok := referenceKeyOf(v); ok {
+		if self.active[key] {
+			return &CyclicReferenceError{
+				Type: v.Type(),
+				Path: path.String(),
+			}
+		}
+
+		self.counts[key] += 1
+
+		// everything within has already been counted
+		if self.counts[key] > 1 {
+			return nil
+		}
+
+		self.active[key] = true
+
+		defer func() {
+			delete(self.active, key)
+
+			// recorded once everything it contains has been, so that values are always
+			// visited after the values they depend on
+			self.visited = append(self.visited, sharedReference{
+				Key:   key,
+				Value: v,
+				Path:  path,
+			})
+		}()
+	}
+
+	if self.isOpaque(v) {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if !v.IsNil() {
+			return self.walk(v.Elem(), path)
+		}
+
+	case reflect.Struct:
+		fields, err := typeFields(v.Type(), self.e.tagKeys, self.e.fieldNaming)
+
+		if err != nil {
+			return err
+		}
+
+		for _, field := range self.e.structFieldsToWrite(v, fields, false) {
+			// values written with formatting options are never replaced by a reference
+			if field.Options.formatsValues() {
+				continue
+			}
+
+			if err := self.walk(field.Value, path.Field(field.GoName)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		for _, key := range sortedMapKeys(v) {
+			keyPath := path.Key(key.Interface())
+
+			if err := self.walk(key, keyPath); err != nil {
+				return err
+			}
+
+			if err := self.walk(v.MapIndex(key), keyPath); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+
+		for i := 0; i < v.Len(); i++ {
+			if err := self.walk(v.Index(i), path.Index(i)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// reports whether the value is written by something other than the generic encoders,
+// in which case what it contains is not walked
+func (self *referenceWalker) isOpaque(v reflect.Value) bool {
+	t := v.Type()
+
+	if fn, _ := self.e.customEncoder(v); fn != nil {
+		return true
+	} else if self.e.isStreamable(v) {
+		return true
+	} else if fn := typeEncoder(t); fn != nil && t != setType {
+		return true
+	} else if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		return true
+	} else if t.Implements(optionalType) || isSQLNullType(t) {
+		return true
+	}
+
+	return false
+}
+
+// returns the keys of a map in the order the encoder would write them, as far as
+// they can be sorted
+func sortedMapKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	sortKeys := make([]string, len(keys))
+
+	for i, key := range keys {
+		if str, err := stringutil.ToString(key.Interface()); err == nil {
+			sortKeys[i] = str
+		} else {
+			return keys
+		}
+	}
+
+	sort.Sort(&keySorter{keys: keys, sortKeys: sortKeys})
+	return keys
+}
+
+type keySorter struct {
+	keys     []reflect.Value
+	sortKeys []string
+}
+
+func (self *keySorter) Len() int           { return len(self.keys) }
+func (self *keySorter) Less(i, j int) bool { return self.sortKeys[i] < self.sortKeys[j] }
+
+func (self *keySorter) Swap(i, j int) {
+	self.keys[i], self.keys[j] = self.keys[j], self.keys[i]
+	self.sortKeys[i], self.sortKeys[j] = self.sortKeys[j], self.sortKeys[i]
+}
+
+// returns the values reached more than once, each after any shared values it contains
+func (self *encodeState) findSharedReferences(v reflect.Value) ([]sharedReference, error) {
+	walker := &referenceWalker{
+		e:      self,
+		counts: make(map[referenceKey]int),
+		active: make(map[referenceKey]bool),
+	}
+
+	if err := walker.walk(v, nil); err != nil {
+		return nil, err
+	}
+
+	shared := make([]sharedReference, 0)
+
+	for _, ref := range walker.visited {
+		if walker.counts[ref.Key] > 1 {
+			shared = append(shared, ref)
+		}
+	}
+
+	return shared, nil
+}
+
+// writes each shared value as an assignment to a local variable, one per line, so that
+// the value that follows can refer to them by name
+func (self *encodeState) writeSharedReferences(v reflect.Value) error {
+	refs, err := self.findSharedReferences(v)
+
+	if err != nil {
+		return err
+	}
+
+	self.shared = make(map[referenceKey]string, len(refs))
+
+	for i, ref := range refs {
+		name := fmt.Sprintf("shared_%d", i+1)
+
+		if err := self.writeEntry([]byte(name+` = `), ref.Value, nil, ref.Path); err != nil {
+			return err
+		}
+
+		self.writeStringsUnindented("\n")
+
+		// only referred to once written; until then, the value is written in full
+		self.shared[ref.Key] = name
+	}
+
+	return nil
+}
+
+// returns the name of the local variable holding the given value, if it has one
+func (self *encodeState) sharedName(v reflect.Value) (string, bool) {
+	if self.shared == nil || self.fieldOptions.formatsValues() {
+		return ``, false
+	}
+
+	if key, ok := referenceKeyOf(v); ok {
+		name, ok := self.shared[key]
+		return name, ok
+	}
+
+	return ``, false
+}
@@ -0,0 +1,99 @@
+package ruby
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+type TestSharedNode struct {
+	Name     string            `ruby:"name"`
+	Tags     []string          `ruby:"tags,omitempty"`
+	Children []*TestSharedNode `ruby:"children,omitempty"`
+}
+
+func encodeShared(t *testing.T, v interface{}) string {
+	var buf bytes.Buffer
+
+	enc := NewEncoder(&buf)
+	enc.SetSharedReferences(true)
+
+	if err := enc.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.String()
+}
+
+func TestEncodeSharedReferences(t *testing.T) {
+	tags := []string{`a`, `b`}
+	leaf := &TestSharedNode{Name: `leaf`, Tags: tags}
+	mid := &TestSharedNode{Name: `mid`, Tags: tags, Children: []*TestSharedNode{leaf}}
+
+	out := encodeShared(t, map[string]interface{}{
+		`first`:  mid,
+		`second`: mid,
+		`third`:  leaf,
+		`other`:  &TestSharedNode{Name: `other`},
+	})
+
+	expected := "shared_1 = ['a', 'b']\n" +
+		"shared_2 = {'name'=>'leaf', 'tags'=>shared_1}\n" +
+		"shared_3 = {'name'=>'mid', 'tags'=>shared_1, 'children'=>[shared_2]}\n" +
+		"{'first'=>shared_3, 'other'=>{'name'=>'other'}, 'second'=>shared_3, 'third'=>shared_2}\n"
+
+	if out != expected {
+		t.Fatalf("Expected \"%s\", got \"%s\"", expected, out)
+	}
+}
+
+func TestEncodeSharedReferencesUnshared(t *testing.T) {
+	out := encodeShared(t, map[string]interface{}{
+		`a`: []int{1, 2},
+		`b`: []int{1, 2},
+	})
+
+	if expected := "{'a'=>[1, 2], 'b'=>[1, 2]}\n"; out != expected {
+		t.Fatalf("Expected \"%s\", got \"%s\"", expected, out)
+	}
+}
+
+func TestEncodeSharedReferencesIndented(t *testing.T) {
+	var buf bytes.Buffer
+
+	shared := map[string]int{`x`: 1}
+
+	enc := NewEncoder(&buf)
+	enc.SetSharedReferences(true)
+	enc.SetIndent(``, `  `)
+
+	if err := enc.Encode([]interface{}{shared, shared}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "shared_1 = {\n  'x' => 1\n}\n[\n  shared_1,\n  shared_1\n]\n"
+
+	if out := buf.String(); out != expected {
+		t.Fatalf("Expected \"%s\", got \"%s\"", expected, out)
+	}
+}
+
+func TestEncodeSharedReferencesCycle(t *testing.T) {
+	root := &TestSharedNode{Name: `root`}
+	root.Children = []*TestSharedNode{root}
+
+	var buf bytes.Buffer
+
+	enc := NewEncoder(&buf)
+	enc.SetSharedReferences(true)
+
+	var cycleErr *CyclicReferenceError
+
+	if err := enc.Encode(root); !errors.As(err, &cycleErr) {
+		t.Fatalf("Expected a *CyclicReferenceError, got %v", err)
+	}
+
+	if expected := `Children[0]`; cycleErr.Path != expected {
+		t.Fatalf("Expected \"%s\", got \"%s\"", expected, cycleErr.Path)
+	}
+}
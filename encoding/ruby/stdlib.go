@@ -0,0 +1,110 @@
+package ruby
+
+import (
+	"net"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"sort"
+)
+
+var (
+	ipType          = reflect.TypeOf(net.IP{})
+	ipNetType       = reflect.TypeOf(net.IPNet{})
+	ipNetPtrType    = reflect.TypeOf((*net.IPNet)(nil))
+	netipAddrType   = reflect.TypeOf(netip.Addr{})
+	netipPrefixType = reflect.TypeOf(netip.Prefix{})
+	urlType         = reflect.TypeOf(url.URL{})
+	urlPtrType      = reflect.TypeOf((*url.URL)(nil))
+)
+
+// the set of Ruby libraries needed by the encoded output
+type requireSet map[string]bool
+
+// notes that the output being written needs the given Ruby library
+func (self *encodeState) require(library string) {
+	if self.requires != nil {
+		self.requires[library] = true
+	}
+}
+
+// returns the required libraries in lexical order
+func (self requireSet) sorted() []string {
+	libraries := make([]string, 0, len(self))
+
+	for library := range self {
+		libraries = append(libraries, library)
+	}
+
+	sort.Strings(libraries)
+	return libraries
+}
+
+// Requires returns the Ruby libraries (e.g.: "ipaddr", "uri") that the output written so far
+// needs loaded with require, in lexical order.
+func (self *Encoder) Requires() []string {
+	return self.options.requires.sorted()
+}
+
+// encode IP addresses and networks as IPAddr objects
+func ipAddrEncoder(e *encodeState, v reflect.Value) error {
+	var address string
+
+	switch value := v.Interface().(type) {
+	case net.IP:
+		if len(value) == 0 {
+			e.writeStrings(`nil`)
+			return nil
+		}
+
+		address = value.String()
+	case netip.Addr:
+		if !value.IsValid() {
+			e.writeStrings(`nil`)
+			return nil
+		}
+
+		address = value.String()
+	case net.IPNet:
+		address = value.String()
+	case *net.IPNet:
+		if value == nil {
+			e.writeStrings(`nil`)
+			return nil
+		}
+
+		address = value.String()
+	case netip.Prefix:
+		if !value.IsValid() {
+			e.writeStrings(`nil`)
+			return nil
+		}
+
+		address = value.String()
+	}
+
+	e.require(`ipaddr`)
+	e.writeStrings(`IPAddr.new(`, singleQuote(address), `)`)
+	return nil
+}
+
+// encode URLs as URI objects
+func urlEncoder(e *encodeState, v reflect.Value) error {
+	var u *url.URL
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			e.writeStrings(`nil`)
+			return nil
+		}
+
+		u = v.Interface().(*url.URL)
+	} else {
+		value := v.Interface().(url.URL)
+		u = &value
+	}
+
+	e.require(`uri`)
+	e.writeStrings(`URI(`, singleQuote(u.String()), `)`)
+	return nil
+}
@@ -0,0 +1,137 @@
+package ruby
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+type TestAllowList struct {
+	Hosts    []net.IP       `ruby:"hosts"`
+	Networks []*net.IPNet   `ruby:"networks"`
+	Gateway  netip.Addr     `ruby:"gateway"`
+	Subnet   netip.Prefix   `ruby:"subnet"`
+	Callback *url.URL       `ruby:"callback"`
+	Root     string         `ruby:"root,pathname"`
+	Excludes []string       `ruby:"excludes,pathname"`
+	Labels   map[string]Set `ruby:"labels,omitempty"`
+	Unset    *net.IPNet     `ruby:"unset"`
+}
+
+func TestEncodeStdlibTypes(t *testing.T) {
+	var buf bytes.Buffer
+
+	_, network, _ := net.ParseCIDR(`10.0.0.0/8`)
+	callback, _ := url.Parse(`https://example.com/hook?x=1`)
+
+	in := TestAllowList{
+		Hosts:    []net.IP{net.ParseIP(`192.168.1.1`), net.ParseIP(`::1`)},
+		Networks: []*net.IPNet{network},
+		Gateway:  netip.MustParseAddr(`172.16.0.1`),
+		Subnet:   netip.MustParsePrefix(`172.16.0.0/12`),
+		Callback: callback,
+		Root:     `/srv/app`,
+		Excludes: []string{`tmp`},
+	}
+
+	encoder := NewEncoder(&buf)
+
+	if err := encoder.Encode(in); err != nil {
+		t.Fatal(err)
+	}
+
+	shouldBe := "{'hosts'=>[IPAddr.new('192.168.1.1'), IPAddr.new('::1')], 'networks'=>[IPAddr.new('10.0.0.0/8')], " +
+		"'gateway'=>IPAddr.new('172.16.0.1'), 'subnet'=>IPAddr.new('172.16.0.0/12'), " +
+		"'callback'=>URI('https://example.com/hook?x=1'), 'root'=>Pathname.new('/srv/app'), " +
+		"'excludes'=>[Pathname.new('tmp')], 'unset'=>nil}\n"
+
+	if s := buf.String(); s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	} else {
+		t.Log(s)
+	}
+
+	if requires, shouldBe := encoder.Requires(), []string{`ipaddr`, `pathname`, `uri`}; !reflect.DeepEqual(requires, shouldBe) {
+		t.Fatalf("Expected requires %v, got %v", shouldBe, requires)
+	}
+
+	if err := encoder.Encode(Set{1}); err != nil {
+		t.Fatal(err)
+	} else if requires, shouldBe := encoder.Requires(), []string{`ipaddr`, `pathname`, `set`, `uri`}; !reflect.DeepEqual(requires, shouldBe) {
+		t.Fatalf("Expected requires %v, got %v", shouldBe, requires)
+	}
+}
+
+func TestUnmarshalStdlibTypes(t *testing.T) {
+	_, network, _ := net.ParseCIDR(`fd00::/8`)
+	callback, _ := url.Parse(`https://user@example.com:8443/hook?x=1#top`)
+
+	in := TestAllowList{
+		Hosts:    []net.IP{net.ParseIP(`192.168.1.1`), net.ParseIP(`::1`)},
+		Networks: []*net.IPNet{network},
+		Gateway:  netip.MustParseAddr(`172.16.0.1`),
+		Subnet:   netip.MustParsePrefix(`172.16.0.0/12`),
+		Callback: callback,
+		Root:     `/srv/app`,
+		Excludes: []string{`tmp`},
+	}
+
+	data, err := Marshal(in)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out TestAllowList
+
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(in, out) {
+		t.Fatalf("Expected %+v, got %+v (from %s)", in, out, data)
+	}
+
+	// as in Ruby, networks are masked to their prefix length and addresses are networks of one
+	if err := Unmarshal([]byte(`{'networks' => [IPAddr.new('10.1.2.3/8'), IPAddr.new('10.0.0.1')], 'callback' => URI.parse('/x')}`), &out); err != nil {
+		t.Fatal(err)
+	} else if s := fmt.Sprint(out.Networks); s != `[10.0.0.0/8 10.0.0.1/32]` {
+		t.Fatalf("Expected \"[10.0.0.0/8 10.0.0.1/32]\", got \"%s\"", s)
+	} else if s := out.Callback.String(); s != `/x` {
+		t.Fatalf("Expected \"/x\", got \"%s\"", s)
+	}
+
+	var unmarshalerErr *UnmarshalerError
+
+	if err := Unmarshal([]byte(`{'gateway' => IPAddr.new('10.0.0.0/8')}`), &out); !errors.As(err, &unmarshalerErr) {
+		t.Fatalf("Expected *UnmarshalerError, got %T (%v)", err, err)
+	}
+
+	var values interface{}
+
+	if err := Unmarshal([]byte(`[IPAddr.new('::1'), URI('http://x/')]`), &values); err != nil {
+		t.Fatal(err)
+	} else if shouldBe := []interface{}{`::1`, `http://x/`}; !reflect.DeepEqual(values, shouldBe) {
+		t.Fatalf("Expected %v, got %v", shouldBe, values)
+	}
+}
+
+func TestWriterRequire(t *testing.T) {
+	var buf bytes.Buffer
+
+	encoder := NewEncoder(&buf)
+	encoder.RegisterEncoder(reflect.TypeOf(TestDecimal{}), func(w *Writer, v reflect.Value) error {
+		w.Require(`bigdecimal`)
+		w.WriteRaw(`BigDecimal('0')`)
+		return nil
+	})
+
+	if err := encoder.Encode(TestDecimal{}); err != nil {
+		t.Fatal(err)
+	} else if requires := encoder.Requires(); !reflect.DeepEqual(requires, []string{`bigdecimal`}) {
+		t.Fatalf("Expected requires [bigdecimal], got %v", requires)
+	}
+}
@@ -0,0 +1,223 @@
+package ruby
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Struct fields are encoded according to their `ruby` struct tag, which has the form:
+//
+//	ruby:"[name][,option]..."
+//
+// The name is the key the field is written under; if it is empty, the Go field
+// name is used.  A tag consisting solely of "-" skips the field entirely (use "-,"
+// to name a field "-").  The following options are recognized:
+//
+//	omitempty  skip the field if it is false, 0, a nil pointer or interface, or
+//	           an empty string, map, slice or array (as encoding/json does)
+//	omitnil    skip the field only if it is a nil pointer, interface, map, slice,
+//	           channel or func; empty but non-nil collections are still written
+//	omitzero   skip the field if its IsZero() method returns true or, lacking
+//	           one, if it is the zero value for its type
+//	string     write booleans and numbers as Ruby strings (e.g.: '42')
+//	symbol     write strings as Ruby symbols (e.g.: :name)
+//	raw        write a string or []byte verbatim as Ruby source
+//	pathname   write strings as Pathname objects (e.g.: Pathname.new('/etc'))
+//	inline     write the fields of a nested struct as if they belonged to the parent
+//	hex        write integers in hexadecimal (e.g.: 0x1f)
+//	octal      write integers in octal (e.g.: 0o755)
+//	binary     write integers in binary (e.g.: 0b101)
+//	arg        when reading a DSL (see DSLReader), receive the next of the positional
+//	           arguments given to the call that sets the struct
+//	skip-unsupported
+//	           omit the field (or its elements) if it holds a value with no Ruby
+//	           representation, such as a channel or func, rather than failing
+//
+// Options that format values also apply to the elements of slices, arrays and map
+// values held by the field.  Tags are validated the first time a struct type is
+// encoded; an unknown, repeated or inapplicable option yields a *TagError.
+var knownTagOptions = map[string]bool{
+	`omitempty`: true,
+	`omitnil`:   true,
+	`omitzero`:  true,
+	`string`:    true,
+	`symbol`:    true,
+	`raw`:       true,
+	`pathname`:  true,
+	`inline`:    true,
+	`hex`:       true,
+	`octal`:     true,
+	`binary`:    true,
+	`arg`:       true,
+
+	`skip-unsupported`: true,
+}
+
+// groups of options of which at most one may be given
+var exclusiveTagOptions = [][]string{
+	{`hex`, `octal`, `binary`},
+	{`string`, `symbol`, `raw`, `pathname`},
+}
+
+// A TagError describes a malformed `ruby` struct tag.
+type TagError struct {
+	Struct reflect.Type
+	Field  string
+	Tag    string
+	Reason string
+}
+
+func (self *TagError) Error() string {
+	return fmt.Sprintf("Invalid ruby tag '%s' on field '%v.%s': %s", self.Tag, self.Struct, self.Field, self.Reason)
+}
+
+// tagOptions is the comma-separated list of options that follows the field name
+// in a `ruby:"..."` struct tag.
+type tagOptions []string
+
+// splits a struct tag into the field name and the options that follow it
+func parseTag(tag string) (string, tagOptions) {
+	parts := strings.Split(tag, `,`)
+	return parts[0], tagOptions(parts[1:])
+}
+
+// reports whether the given option is present in the list
+func (self tagOptions) Contains(option string) bool {
+	for _, opt := range self {
+		if opt == option {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reports whether any option changes how the field's value is written, as opposed to
+// whether it is written at all
+func (self tagOptions) formatsValues() bool {
+	for _, group := range exclusiveTagOptions {
+		for _, opt := range group {
+			if self.Contains(opt) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// returns only those options which are recognized and valid for the field on their own;
+// this is used to borrow options from tags that belong to other encoders
+func (self tagOptions) applicable(name string, fieldType reflect.Type) tagOptions {
+	options := make(tagOptions, 0, len(self))
+
+	for _, opt := range self {
+		if opt != `` && knownTagOptions[opt] && (tagOptions{opt}).validate(name, fieldType) == `` {
+			options = append(options, opt)
+		}
+	}
+
+	return options
+}
+
+// checks the options of a struct field's tag against the tag grammar and the field's type,
+// returning a description of the first problem found
+func (self tagOptions) validate(name string, fieldType reflect.Type) string {
+	seen := make(map[string]bool)
+
+	for i, opt := range self {
+		// a lone trailing comma (as in "-,") is permitted
+		if opt == `` && i == 0 && len(self) == 1 {
+			continue
+		} else if opt == `` {
+			return `empty option`
+		} else if !knownTagOptions[opt] {
+			return fmt.Sprintf("unknown option '%s'", opt)
+		} else if seen[opt] {
+			return fmt.Sprintf("option '%s' given more than once", opt)
+		}
+
+		seen[opt] = true
+	}
+
+	for _, group := range exclusiveTagOptions {
+		var given []string
+
+		for _, opt := range group {
+			if seen[opt] {
+				given = append(given, opt)
+			}
+		}
+
+		if len(given) > 1 {
+			return fmt.Sprintf("options '%s' are mutually exclusive", strings.Join(given, `', '`))
+		}
+	}
+
+	// formatting options apply to the innermost element type of pointers and collections
+	elemKind := elementType(fieldType).Kind()
+
+	switch {
+	case seen[`inline`] && name != ``:
+		return `inlined fields cannot be named`
+	case seen[`inline`] && indirectType(fieldType).Kind() != reflect.Struct:
+		return fmt.Sprintf("option 'inline' requires a struct, not %v", fieldType)
+	case (seen[`hex`] || seen[`octal`] || seen[`binary`]) && !isIntegerKind(elemKind):
+		return fmt.Sprintf("integer formatting requires an integer type, not %v", fieldType)
+	case seen[`string`] && !isScalarKind(elemKind):
+		return fmt.Sprintf("option 'string' requires a boolean, numeric or string type, not %v", fieldType)
+	case seen[`symbol`] && elemKind != reflect.String:
+		return fmt.Sprintf("option 'symbol' requires a string type, not %v", fieldType)
+	case seen[`pathname`] && elemKind != reflect.String:
+		return fmt.Sprintf("option 'pathname' requires a string type, not %v", fieldType)
+	case seen[`raw`] && !isRawType(indirectType(fieldType)):
+		return fmt.Sprintf("option 'raw' requires a string or []byte, not %v", fieldType)
+	}
+
+	return ``
+}
+
+// dereferences pointer types
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+// dereferences pointer types and descends into the elements of slices, arrays and maps
+func elementType(t reflect.Type) reflect.Type {
+	for {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+		default:
+			return t
+		}
+	}
+}
+
+func isIntegerKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+
+	return false
+}
+
+func isScalarKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return isIntegerKind(kind)
+}
+
+func isRawType(t reflect.Type) bool {
+	return t.Kind() == reflect.String || (t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8)
+}
@@ -0,0 +1,215 @@
+package ruby
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type TestStructTagOptions struct {
+	Port     int                   `ruby:"port,string"`
+	Enabled  bool                  `ruby:"enabled,string"`
+	Provider string                `ruby:"provider,symbol"`
+	Roles    []string              `ruby:"roles,symbol"`
+	Command  string                `ruby:"command,raw"`
+	Parent   *TestStructTagOptions `ruby:"parent,omitnil"`
+	Tags     []string              `ruby:"tags,omitnil"`
+	Dash     string                `ruby:"-,"`
+}
+
+type TestStructInlineBase struct {
+	ID   int    `ruby:"id"`
+	Kind string `ruby:"kind"`
+}
+
+type TestStructInlineExtra struct {
+	Note string `ruby:"note"`
+}
+
+type TestStructInline struct {
+	Base  TestStructInlineBase   `ruby:",inline"`
+	Extra *TestStructInlineExtra `ruby:",inline"`
+	Name  string                 `ruby:"name"`
+}
+
+type TestStructTypo struct {
+	Name string `ruby:"name,omitemtpy"`
+}
+
+type TestStructNestedTypo struct {
+	Items map[string][]*TestStructTypo
+}
+
+func TestEncodeStructTagOptions(t *testing.T) {
+	e := &encodeState{}
+
+	in := TestStructTagOptions{
+		Port:     8080,
+		Enabled:  true,
+		Provider: `virtualbox`,
+		Roles:    []string{`web`, `db server`},
+		Command:  `ENV['HOME']`,
+		Tags:     []string{},
+		Dash:     `dash`,
+	}
+
+	shouldBe := `{'port'=>'8080', 'enabled'=>'true', 'provider'=>:virtualbox, 'roles'=>[:web, :'db server'], 'command'=>ENV['HOME'], 'tags'=>[], '-'=>'dash'}`
+
+	if err := e.marshal(in); err != nil {
+		t.Fatal(err)
+	} else {
+		if s := e.String(); s != shouldBe {
+			t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+		} else {
+			t.Log(s)
+		}
+	}
+}
+
+func TestEncodeStructInline(t *testing.T) {
+	e := &encodeState{}
+
+	in := TestStructInline{
+		Base: TestStructInlineBase{
+			ID:   1,
+			Kind: `box`,
+		},
+		Name: `test`,
+	}
+
+	shouldBe := `{'id'=>1, 'kind'=>'box', 'name'=>'test'}`
+
+	if err := e.marshal(in); err != nil {
+		t.Fatal(err)
+	} else {
+		if s := e.String(); s != shouldBe {
+			t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+		} else {
+			t.Log(s)
+		}
+	}
+}
+
+func TestEncodeSymbol(t *testing.T) {
+	e := &encodeState{}
+
+	in := []Symbol{`name`, `valid?`, `with-dash`}
+	shouldBe := `[:name, :valid?, :'with-dash']`
+
+	if err := e.marshal(in); err != nil {
+		t.Fatal(err)
+	} else {
+		if s := e.String(); s != shouldBe {
+			t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+		} else {
+			t.Log(s)
+		}
+	}
+}
+
+func TestEncodeStructInvalidTag(t *testing.T) {
+	e := &encodeState{}
+
+	err := e.marshal(TestStructTypo{})
+
+	if tagErr, ok := err.(*TagError); !ok {
+		t.Fatalf("Expected *TagError, got %T (%v)", err, err)
+	} else if tagErr.Field != `Name` || tagErr.Struct != reflect.TypeOf(TestStructTypo{}) {
+		t.Fatalf("Expected error on TestStructTypo.Name, got %v", tagErr)
+	} else {
+		t.Log(tagErr)
+	}
+}
+
+func TestValidateType(t *testing.T) {
+	for _, valid := range []interface{}{
+		TestStruct{},
+		TestStructComplex{},
+		TestStructNumeric{},
+		TestStructTagOptions{},
+		TestStructInline{},
+	} {
+		if err := ValidateType(reflect.TypeOf(valid)); err != nil {
+			t.Fatalf("Expected %T to be valid, got %v", valid, err)
+		}
+	}
+
+	if err := ValidateType(reflect.TypeOf(TestStructNestedTypo{})); err == nil {
+		t.Fatal("Expected an error for a nested struct with a misspelled option")
+	}
+
+	for _, invalid := range []interface{}{
+		struct {
+			Name string `ruby:",hex"`
+		}{},
+		struct {
+			Mode int `ruby:",hex,octal"`
+		}{},
+		struct {
+			Mode int `ruby:",omitempty,omitempty"`
+		}{},
+		struct {
+			Mode int `ruby:"mode,,omitempty"`
+		}{},
+		struct {
+			Count int `ruby:",symbol"`
+		}{},
+		struct {
+			Base TestStructInlineBase `ruby:"base,inline"`
+		}{},
+		struct {
+			Names []string `ruby:",inline"`
+		}{},
+	} {
+		if err := ValidateType(reflect.TypeOf(invalid)); err == nil {
+			t.Fatalf("Expected %T to be invalid", invalid)
+		} else if _, ok := err.(*TagError); !ok {
+			t.Fatalf("Expected *TagError, got %T", err)
+		} else {
+			t.Log(err)
+		}
+	}
+}
+
+type TestStructFallbackTags struct {
+	Name     string   `json:"name"`
+	Count    int      `json:"count,omitempty"`
+	Hidden   string   `json:"-"`
+	Aliases  []string `json:"aliases,omitempty,flow"`
+	Provider string   `ruby:"provider,symbol" json:"provider_name"`
+	Mode     int      `yaml:"mode"`
+	Untagged bool
+}
+
+func TestEncoderTagKeys(t *testing.T) {
+	var buf bytes.Buffer
+
+	in := TestStructFallbackTags{
+		Name:     `test`,
+		Hidden:   `secret`,
+		Provider: `docker`,
+		Mode:     3,
+	}
+
+	encoder := NewEncoder(&buf)
+	encoder.SetTagKeys(`ruby`, `json`)
+
+	if err := encoder.Encode(in); err != nil {
+		t.Fatal(err)
+	}
+
+	encoder.SetTagKeys(`ruby`, `json`, `yaml`)
+
+	if err := encoder.Encode(in); err != nil {
+		t.Fatal(err)
+	}
+
+	shouldBe := "{'name'=>'test', 'provider'=>:docker, 'Mode'=>3, 'Untagged'=>false}\n" +
+		"{'name'=>'test', 'provider'=>:docker, 'mode'=>3, 'Untagged'=>false}\n"
+
+	if s := buf.String(); s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	} else {
+		t.Log(s)
+	}
+}
@@ -0,0 +1,8 @@
+current_dir = File.dirname(__FILE__)
+log_level                :info
+log_location             STDOUT
+node_name                'deployer'
+client_key               "#{current_dir}/deployer.pem"
+chef_server_url          'https://chef.example.com/organizations/example'
+cookbook_path            ["#{current_dir}/../cookbooks"]
+syntax_check_cache_path  File.join(__dir__, 'syntaxcache')
@@ -0,0 +1,124 @@
+package ruby
+
+import (
+	"math/big"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A Symbol is written as a Ruby symbol literal (e.g.: :name) rather than a string.
+type Symbol string
+
+var symbolType = reflect.TypeOf(Symbol(``))
+
+// symbols that can be written without quoting
+var rxBareSymbol = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*[?!]?$`)
+
+// returns the Ruby literal for the given symbol name, quoting it if necessary
+func symbolLiteral(name string) string {
+	if rxBareSymbol.MatchString(name) {
+		return `:` + name
+	}
+
+	return `:` + singleQuote(name)
+}
+
+// returns the given string as a single-quoted (non-interpolated) Ruby string literal
+func singleQuote(str string) string {
+	// escape backslashes (so that none can escape the closing quote) and single-quotes
+	str = strings.Replace(str, `\`, `\\`, -1)
+	str = strings.Replace(str, `'`, `\'`, -1)
+
+	return `'` + str + `'`
+}
+
+// A Number is a Ruby integer or float literal, kept as written (in decimal) so that no
+// precision is lost.  Decoders produce them in place of int64, *big.Int and float64 when
+// UseNumber is called, and they are written as numbers (not strings) when encoded.
+type Number string
+
+var numberType = reflect.TypeOf(Number(``))
+
+// numbers in the form written by Number
+var rxNumber = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// String returns the literal text of the number.
+func (self Number) String() string {
+	return string(self)
+}
+
+// IsInteger reports whether the number was written as an integer rather than a float.
+func (self Number) IsInteger() bool {
+	return !strings.ContainsAny(string(self), `.eE`)
+}
+
+// Int64 returns the number as an int64.
+func (self Number) Int64() (int64, error) {
+	return strconv.ParseInt(string(self), 10, 64)
+}
+
+// Float64 returns the number as a float64.
+func (self Number) Float64() (float64, error) {
+	return strconv.ParseFloat(string(self), 64)
+}
+
+// BigInt returns an integer of any size as a *big.Int, reporting false for floats.
+func (self Number) BigInt() (*big.Int, bool) {
+	if !self.IsInteger() {
+		return nil, false
+	}
+
+	return new(big.Int).SetString(string(self), 10)
+}
+
+// A Set is written as a Ruby Set of its elements (e.g.: Set[1, 2, 3]).
+type Set []interface{}
+
+var setType = reflect.TypeOf(Set{})
+
+// A Range is written as a Ruby range literal (e.g.: 1..10, or 1...10 if Exclusive).
+// A nil Begin or End produces a beginless or endless range, e.g.: (..10) or (1..).
+type Range struct {
+	Begin     interface{}
+	End       interface{}
+	Exclusive bool
+}
+
+var rangeType = reflect.TypeOf(Range{})
+
+// A Regexp is written as a Ruby regular expression literal (e.g.: /^foo$/i).  The Source
+// is Ruby regular expression syntax, and is written verbatim save for escaping any
+// unescaped forward slashes; as in Ruby, decoding one reads those escaped slashes back as
+// plain ones (so /a\/b/ has the Source a/b).  Flags may contain any of "imx" and the encoding flags "nesu".
+type Regexp struct {
+	Source string
+	Flags  string
+}
+
+var rubyRegexpType = reflect.TypeOf(Regexp{})
+var goRegexpType = reflect.TypeOf((*regexp.Regexp)(nil))
+
+var rxRegexpFlags = regexp.MustCompile(`^[imxnesuo]*$`)
+
+// returns the given regular expression source with any unescaped forward slashes escaped
+func escapeRegexpDelimiters(source string) string {
+	var escaped strings.Builder
+	var inEscape bool
+
+	for _, r := range source {
+		switch {
+		case inEscape:
+			inEscape = false
+		case r == '\\':
+			inEscape = true
+		case r == '/':
+			escaped.WriteRune('\\')
+		}
+
+		escaped.WriteRune(r)
+	}
+
+	return escaped.String()
+}
@@ -0,0 +1,105 @@
+package ruby
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestEncodeSet(t *testing.T) {
+	e := &encodeState{}
+
+	in := map[string]interface{}{
+		`empty`: Set{},
+		`ports`: Set{80, 443},
+	}
+
+	shouldBe := `{'empty'=>Set[], 'ports'=>Set[80, 443]}`
+
+	if err := e.marshal(in); err != nil {
+		t.Fatal(err)
+	} else if s := e.String(); s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	} else {
+		t.Log(s)
+	}
+}
+
+func TestEncodeRange(t *testing.T) {
+	e := &encodeState{}
+
+	in := []Range{
+		{Begin: 1, End: 10},
+		{Begin: 1, End: 10, Exclusive: true},
+		{Begin: -5, End: nil},
+		{Begin: nil, End: 10},
+		{Begin: `a`, End: `z`},
+		{},
+	}
+
+	shouldBe := `[1..10, 1...10, (-5..), (..10), 'a'..'z', (nil..nil)]`
+
+	if err := e.marshal(in); err != nil {
+		t.Fatal(err)
+	} else if s := e.String(); s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	} else {
+		t.Log(s)
+	}
+}
+
+func TestEncodeRubyRegexp(t *testing.T) {
+	e := &encodeState{}
+
+	in := []Regexp{
+		{Source: `^foo$`, Flags: `i`},
+		{Source: `a/b\/c`},
+	}
+
+	shouldBe := `[/^foo$/i, /a\/b\/c/]`
+
+	if err := e.marshal(in); err != nil {
+		t.Fatal(err)
+	} else if s := e.String(); s != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, s)
+	} else {
+		t.Log(s)
+	}
+
+	if _, err := Marshal(Regexp{Source: `x`, Flags: `g`}); err == nil {
+		t.Fatal("Expected an error for an invalid flag")
+	}
+}
+
+func TestEncodeGoRegexp(t *testing.T) {
+	for in, shouldBe := range map[string]string{
+		`^foo$`:                 `/\Afoo\z/`,
+		`(?m)^foo$`:             `/^foo$/`,
+		`(?i)foo`:               `/(?i:foo)/`,
+		`(?P<year>\d{4})-\d+?`:  `/(?<year>[0-9]{4})-[0-9]+?/`,
+		`a.b`:                   `/a.b/`,
+		`(?s)a.b`:               `/a(?m:.)b/`,
+		`(ab)*|c{2,}/#`:         `/(?:(ab)*|c{2,}\/\#)/`,
+		`[^a-z]`:                `/[^a-z]/`,
+		`\pL+`:                  `/\p{L}+/`,
+		`[^\pL]`:                `/\P{L}/`,
+		`[\pL\p{Nd}_]`:          `/[\p{L}\p{Nd}_]/`,
+		`\p{Greek}[^\p{Greek}]`: `/\p{Greek}\P{Greek}/`,
+		`[\p{Lu}\d]`:            `/[\p{Lu}0-9]/`,
+		`x{1,3}y?`:              `/x{1,3}y?/`,
+		`\bfoo\B`:               `/\bfoo\B/`,
+	} {
+		if data, err := Marshal(regexp.MustCompile(in)); err != nil {
+			t.Fatal(err)
+		} else if s := string(data); s != shouldBe {
+			t.Fatalf("Expected %q to become \"%s\", got \"%s\"", in, shouldBe, s)
+		} else {
+			t.Log(s)
+		}
+	}
+
+	if data, err := Marshal((*regexp.Regexp)(nil)); err != nil {
+		t.Fatal(err)
+	} else if s := string(data); s != `nil` {
+		t.Fatalf("Expected \"nil\", got \"%s\"", s)
+	}
+}
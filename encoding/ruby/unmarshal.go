@@ -0,0 +1,55 @@
+package ruby
+
+import (
+	"github.com/ghetzel/rubyutils/encoding/ruby/parser"
+)
+
+// Unmarshal parses a single Ruby literal (nil, a boolean, number, string, symbol, or an
+// array or hash of these) from data and stores it in the value pointed to by v.  The
+// expressions the encoder writes for Symbol, Range, Set, Regexp, time.Time, the types of
+// net, net/netip and net/url, database/sql's Null wrappers and fields tagged `pathname`
+// are decoded as those types, as are Float::INFINITY, Float::NAN and rationals (into a
+// big.Rat).  Hashes decode into structs using the same `ruby` struct tags that the
+// encoder reads; keys that name no field are ignored.  Structs that name a Ruby class
+// (see Class) are also decoded from calls to its constructor, whose positional arguments
+// set their fields in order and keyword arguments the fields they name.  Types implementing
+// Unmarshaler are given the source of their value, however it is written, and those
+// implementing encoding.TextUnmarshaler the contents of a string or symbol.  Escape
+// sequences in double-quoted strings are read as Ruby reads them, and interpolations
+// (e.g.: "#{60 * 60}s") are evaluated as Eval would; those naming variables fail with an
+// *EvalError, unless a Decoder has been given their values with SetVariables.  Source that
+// cannot be parsed or decoded yields a *SyntaxError, and values that do not fit the Go
+// type given yield an *UnmarshalTypeError; both report the line and column at fault.
+//
+// Values decoded into an interface{} are stored as:
+//
+//	nil                  nil
+//	true, false          bool
+//	integers             int64, or *big.Int if too large for one (Number with UseNumber)
+//	floats               float64 (Number with UseNumber), including Float::INFINITY
+//	                     and Float::NAN
+//	rationals            *big.Rat, e.g.: 3r, 1/3r or Rational(1, 3)
+//	strings              string
+//	symbols              Symbol
+//	arrays               []interface{}
+//	hashes               map[string]interface{} if every key is a string or symbol,
+//	                     map[interface{}]interface{} otherwise, or if a symbol and a
+//	                     string share a name (e.g.: {a: 1, 'a' => 2}), in which case
+//	                     symbol keys are Symbols
+//	ranges               Range, with Begin and End decoded as these are
+//	Set[...]             Set
+//	regular expressions  Regexp
+//	Time.at(...)         time.Time
+//	Pathname.new(...)    string
+//	IPAddr.new(...)      string
+//	URI(...)             string
+func Unmarshal(data []byte, v interface{}) error {
+	d := newDecodeState(data, 0, 1, 1)
+	node, err := parser.ParseExpr(data)
+
+	if err != nil {
+		return d.syntaxError(err)
+	}
+
+	return d.unmarshal(node, v)
+}
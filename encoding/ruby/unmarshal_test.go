@@ -0,0 +1,151 @@
+package ruby
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a reference to a named resource, written as: Ref.new('name')
+type TestResourceRef struct {
+	Name string
+}
+
+var testResourceRefPattern = regexp.MustCompile(`^Ref\.new\('([^']*)'\)$`)
+
+func (self TestResourceRef) MarshalRuby() ([]byte, error) {
+	return []byte(fmt.Sprintf("Ref.new('%s')", self.Name)), nil
+}
+
+func (self *TestResourceRef) UnmarshalRuby(data []byte) error {
+	if match := testResourceRefPattern.FindSubmatch(data); match != nil {
+		self.Name = string(match[1])
+		return nil
+	}
+
+	return fmt.Errorf("not a resource reference: %s", data)
+}
+
+type TestLevel int
+
+func (self *TestLevel) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case `low`:
+		*self = 1
+	case `high`:
+		*self = 2
+	default:
+		return fmt.Errorf("unknown level %q", text)
+	}
+
+	return nil
+}
+
+type TestResources struct {
+	Primary  TestResourceRef              `ruby:"primary"`
+	Replicas []*TestResourceRef           `ruby:"replicas"`
+	Levels   map[TestLevel]TestLevel      `ruby:"levels"`
+	Default  TestLevel                    `ruby:"default"`
+	Count    TestLevel                    `ruby:"count"`
+	Created  time.Time                    `ruby:"created,omitzero"`
+	Named    map[string]*TestResourceRef  `ruby:"named"`
+	Nested   map[string][]TestResourceRef `ruby:"nested"`
+}
+
+func TestUnmarshalUnmarshaler(t *testing.T) {
+	in := TestResources{
+		Primary:  TestResourceRef{`db`},
+		Replicas: []*TestResourceRef{{`db-1`}, {`db-2`}},
+		Levels:   map[TestLevel]TestLevel{1: 2},
+		Named:    map[string]*TestResourceRef{`cache`: {`redis`}},
+		Nested:   map[string][]TestResourceRef{`queues`: {{`a`}, {`b`}}},
+	}
+
+	data, err := Marshal(in)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out TestResources
+
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("Expected %+v, got %+v (from %s)", in, out, data)
+	}
+}
+
+func TestUnmarshalTextUnmarshaler(t *testing.T) {
+	var out TestResources
+
+	src := `{'levels'=>{'low'=>:high}, 'default'=>:Low, 'count'=>3, 'created'=>'2020-01-02T03:04:05Z'}`
+
+	if err := Unmarshal([]byte(src), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Levels[1] != 2 || out.Default != 1 || out.Count != 3 {
+		t.Fatalf("Unexpected levels: %+v", out)
+	}
+
+	if shouldBe := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC); !out.Created.Equal(shouldBe) {
+		t.Fatalf("Expected %v, got %v", shouldBe, out.Created)
+	}
+}
+
+func TestUnmarshalUnmarshalerError(t *testing.T) {
+	var out TestResources
+
+	err := Unmarshal([]byte("{\n  'replicas' => [Ref.new('a'), Other.new('b')]\n}"), &out)
+
+	var unmarshalerErr *UnmarshalerError
+
+	if !errors.As(err, &unmarshalerErr) {
+		t.Fatalf("Expected *UnmarshalerError, got %T (%v)", err, err)
+	}
+
+	if shouldBe := "Error decoding Ruby value into type '*ruby.TestResourceRef' at Replicas[1], line 2, column 32: not a resource reference: Other.new('b')\n      'replicas' => [Ref.new('a'), Other.new('b')]\n                                   ^"; err.Error() != shouldBe {
+		t.Fatalf("Expected \"%s\", got \"%s\"", shouldBe, err.Error())
+	}
+
+	err = Unmarshal([]byte(`{'default'=>'medium'}`), &out)
+
+	if !errors.As(err, &unmarshalerErr) || unmarshalerErr.Path != `Default` || unmarshalerErr.Err.Error() != `unknown level "medium"` {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestUnmarshalInterpolation(t *testing.T) {
+	var out struct {
+		Name    string `ruby:"name"`
+		Path    string `ruby:"path"`
+		Code    string `ruby:"code,raw"`
+		Emoji   string `ruby:"emoji"`
+		Timeout string `ruby:"timeout"`
+	}
+
+	err := Unmarshal([]byte(`{"na#{'m'}e" => "web-#{1 + 1}", code: "#{home}", emoji: "\u{1F600}\x21", timeout: "#{60 * 60}s"}`), &out)
+
+	if err != nil {
+		t.Fatal(err)
+	} else if out.Name != `web-2` || out.Timeout != `3600s` || out.Emoji != "\U0001F600!" {
+		t.Fatalf("Unexpected values: %+v", out)
+	} else if out.Code != `"#{home}"` {
+		t.Fatalf("Expected raw fields to keep their source, got \"%s\"", out.Code)
+	}
+
+	err = Unmarshal([]byte(`{path: "#{home}/.config"}`), &out)
+
+	if evalErr, ok := err.(*EvalError); !ok {
+		t.Fatalf("Expected *EvalError, got %T (%v)", err, err)
+	} else if evalErr.Msg != `Undefined local variable or method 'home'` || evalErr.Column != 11 {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}